@@ -11,6 +11,7 @@ import (
 
 	"github.com/nuclio/nuclio/pkg/controller"
 	"github.com/pkg/errors"
+	"github.com/spf13/viper"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -26,14 +27,14 @@ type Controller struct {
 	ignoredFunctionCRChanges *controller.IgnoredChanges
 }
 
-func NewController(configurationPath string) (*Controller, error) {
+func NewController(configurationPath string, loggerConfigurationPath string) (*Controller, error) {
 	var err error
 
 	newController := &Controller{
 		functioncrChangesChan: make(chan functioncr.Change),
 	}
 
-	newController.logger, err = newController.createLogger()
+	newController.logger, err = newController.createLogger(loggerConfigurationPath)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create logger")
 	}
@@ -127,10 +128,22 @@ func (c *Controller) getClientConfig(configurationPath string) (*rest.Config, er
 	return rest.InClusterConfig()
 }
 
-func (c *Controller) createLogger() (nuclio.Logger, error) {
+func (c *Controller) createLogger(loggerConfigurationPath string) (nuclio.Logger, error) {
 
-	// TODO: configuration stuff
-	return nucliozap.NewNuclioZap("controller", nucliozap.DebugLevel)
+	// if no configuration file passed, log everything to stdout
+	if loggerConfigurationPath == "" {
+		return nucliozap.NewNuclioZap("controller", nucliozap.DebugLevel)
+	}
+
+	// the logger configuration is read from the "logger" section, same as the processor's
+	configuration := viper.New()
+	configuration.SetConfigFile(loggerConfigurationPath)
+
+	if err := configuration.ReadInConfig(); err != nil {
+		return nil, errors.Wrap(err, "Failed to read logger configuration")
+	}
+
+	return nucliozap.NewNuclioZapFromConfiguration("controller", configuration.Sub("logger"))
 }
 
 func (c *Controller) handleFunctionCRAddOrUpdate(function *functioncr.Function) error {
@@ -10,9 +10,10 @@ import (
 
 func run() error {
 	configPath := flag.String("config", "", "Path of configuration file")
+	loggerConfigPath := flag.String("logger-config", "", "Path of logger configuration file")
 	flag.Parse()
 
-	controller, err := app.NewController(*configPath)
+	controller, err := app.NewController(*configPath, *loggerConfigPath)
 	if err != nil {
 		return err
 	}
@@ -2,29 +2,57 @@ package app
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/checkpoint"
+	_ "github.com/nuclio/nuclio/pkg/processor/checkpoint/file"
 	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/cron"
 	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/generator"
 	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/http"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/kafka"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/mqtt"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/nats"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/poller/filewatcher"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/poller/sqlpoller"
 	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/poller/v3ioitempoller"
 	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/rabbitmq"
+	_ "github.com/nuclio/nuclio/pkg/processor/eventsource/redisstreams"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	_ "github.com/nuclio/nuclio/pkg/processor/output/file"
+	_ "github.com/nuclio/nuclio/pkg/processor/output/http"
+	_ "github.com/nuclio/nuclio/pkg/processor/output/rabbitmq"
 	_ "github.com/nuclio/nuclio/pkg/processor/runtime/golang"
+	_ "github.com/nuclio/nuclio/pkg/processor/runtime/nodejs"
+	_ "github.com/nuclio/nuclio/pkg/processor/runtime/python"
 	_ "github.com/nuclio/nuclio/pkg/processor/runtime/shell"
+	"github.com/nuclio/nuclio/pkg/processor/webadmin"
 	"github.com/nuclio/nuclio/pkg/processor/worker"
 	"github.com/nuclio/nuclio/pkg/zap"
 
+	// the database drivers the sql-poller event source can use
+	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
 type Processor struct {
-	logger        nuclio.Logger
-	configuration map[string]*viper.Viper
-	workers       []worker.Worker
-	eventSources  []eventsource.EventSource
+	logger          nuclio.Logger
+	configuration   map[string]*viper.Viper
+	workers         []worker.Worker
+	eventSources    []eventsource.EventSource
+	workerPools     []*worker.WorkerPool
+	deadLetterSinks []eventsource.DeadLetterSink
+	outputBindings  *output.Bindings
+	checkpointStore checkpoint.Store
+	webAdminServer  *webadmin.Server
+	stopTimeout     time.Duration
 }
 
 func NewProcessor(configurationPath string) (*Processor, error) {
@@ -42,7 +70,12 @@ func NewProcessor(configurationPath string) (*Processor, error) {
 	// initialize a logger
 	newProcessor.logger, err = newProcessor.createLogger(newProcessor.configuration["logger"])
 	if err != nil {
-		return nil, errors.New("Failed to create logger")
+		return nil, errors.Wrap(err, "Failed to create logger")
+	}
+
+	// create the worker pools event sources may share, before the event sources referencing them
+	if err := newProcessor.createWorkerPools(newProcessor.configuration["worker_pools"]); err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker pools")
 	}
 
 	// create event sources
@@ -51,18 +84,209 @@ func NewProcessor(configurationPath string) (*Processor, error) {
 		return nil, errors.Wrapf(err, "Failed to create event sources")
 	}
 
+	// create the outputs to which the responses of processed events are written
+	newProcessor.outputBindings, err = newProcessor.createOutputBindings(newProcessor.eventSources)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create output bindings")
+	}
+
+	// create the store in which event sources' checkpoints are kept between runs
+	newProcessor.checkpointStore, err = newProcessor.createCheckpointStore(newProcessor.configuration["checkpoint"])
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create checkpoint store")
+	}
+
+	// event sources whose checkpoint advances while they run save it as it does
+	if newProcessor.checkpointStore != nil {
+		for _, eventSource := range newProcessor.eventSources {
+			eventSource.SetCheckpointSink(newProcessor.checkpointStore)
+		}
+	}
+
+	// create the administrative interface (e.g. metrics), if configured
+	newProcessor.webAdminServer, err = newProcessor.createWebAdminServer(newProcessor.configuration["web_admin"])
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create web admin server")
+	}
+
+	// read how long we wait for event sources to stop gracefully before forcing them to
+	newProcessor.stopTimeout = newProcessor.getStopTimeout()
+
 	return &newProcessor, nil
 }
 
+// starts all event sources and blocks until the processor is signaled to terminate, at which point
+// the event sources are stopped
 func (p *Processor) Start() error {
 
-	// iterate over all event sources and start them
+	// register for termination signals before starting, so that none are missed
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+
+	// start the administrative interface first, so that liveness is reported while event sources start
+	if p.webAdminServer != nil {
+		if err := p.webAdminServer.Start(); err != nil {
+			return errors.Wrap(err, "Failed to start web admin server")
+		}
+	}
+
+	// start all event sources from their last checkpoint
+	if err := p.startEventSources(); err != nil {
+		return err
+	}
+
+	if p.webAdminServer != nil {
+		p.webAdminServer.SetReady(true)
+	}
+
+	// wait for a termination signal
+	receivedSignal := <-signalChan
+
+	p.logger.InfoWith("Received signal, stopping", "signal", receivedSignal.String())
+
+	return p.Stop()
+}
+
+// stops all event sources, waiting up to the stop timeout for them to drain before forcing them to
+// stop. the checkpoints returned by the event sources are persisted
+func (p *Processor) Stop() error {
+	return p.stop(p.eventSources)
+}
+
+// starts the event sources. if one fails to start, those already started (and the web admin) are stopped
+func (p *Processor) startEventSources() error {
+	var startedEventSources []eventsource.EventSource
+
 	for _, eventSource := range p.eventSources {
-		eventSource.Start(nil)
+		err := p.startEventSource(eventSource)
+		if err == nil {
+			startedEventSources = append(startedEventSources, eventSource)
+			continue
+		}
+
+		if stopErr := p.stop(startedEventSources); stopErr != nil {
+			p.logger.WarnWith("Failed to stop after start failure", "err", stopErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (p *Processor) startEventSource(eventSource eventsource.EventSource) error {
+	checkpoint, err := p.getCheckpoint(eventSource)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get checkpoint of event source %s", eventSource.GetID())
+	}
+
+	if err := eventSource.Start(checkpoint); err != nil {
+		return errors.Wrapf(err, "Failed to start event source %s", eventSource.GetID())
+	}
+
+	return nil
+}
+
+func (p *Processor) stop(eventSources []eventsource.EventSource) error {
+	var stopErrors []error
+
+	type stopResult struct {
+		eventSource eventsource.EventSource
+		checkpoint  eventsource.Checkpoint
+		err         error
+	}
+
+	if p.webAdminServer != nil {
+		p.webAdminServer.SetReady(false)
 	}
 
-	// TODO: shutdown
-	select {}
+	stopResultsChan := make(chan stopResult, len(eventSources))
+	pendingEventSources := map[eventsource.EventSource]bool{}
+
+	// stop all event sources in parallel so that they drain together
+	for _, eventSource := range eventSources {
+		pendingEventSources[eventSource] = true
+
+		// events held by paused event sources must be let through for them to drain
+		if eventSource.IsPaused() {
+			eventSource.Resume()
+		}
+
+		go func(eventSource eventsource.EventSource) {
+			checkpoint, err := eventSource.Stop(false)
+
+			stopResultsChan <- stopResult{eventSource, checkpoint, err}
+		}(eventSource)
+	}
+
+	deadline := time.After(p.stopTimeout)
+
+	for len(pendingEventSources) > 0 {
+		select {
+		case result := <-stopResultsChan:
+			delete(pendingEventSources, result.eventSource)
+
+			if err := p.handleStopResult(result.eventSource, result.checkpoint, result.err); err != nil {
+				stopErrors = append(stopErrors, err)
+			}
+
+		case <-deadline:
+
+			// escalate - force whatever didn't drain in time to stop
+			for eventSource := range pendingEventSources {
+				p.logger.WarnWith("Event source didn't stop in time, forcing", "id", eventSource.GetID())
+
+				checkpoint, err := eventSource.Stop(true)
+				if err := p.handleStopResult(eventSource, checkpoint, err); err != nil {
+					stopErrors = append(stopErrors, err)
+				}
+			}
+
+			pendingEventSources = map[eventsource.EventSource]bool{}
+		}
+	}
+
+	// nothing is processed once the event sources are stopped, so their workers' runtimes can go. the
+	// workers of shared pools are stopped with the pools
+	for _, eventSource := range eventSources {
+		if workerAllocator := eventSource.GetWorkerAllocator(); workerAllocator != nil {
+			if err := workerAllocator.Stop(); err != nil {
+				stopErrors = append(stopErrors, errors.Wrapf(err, "Failed to stop workers of %s", eventSource.GetID()))
+			}
+		}
+	}
+
+	for _, workerPool := range p.workerPools {
+		if err := workerPool.Stop(); err != nil {
+			stopErrors = append(stopErrors, errors.Wrapf(err, "Failed to stop worker pool %s", workerPool.Name))
+		}
+	}
+
+	// nothing writes responses or dead letters once the event sources are stopped. the outputs get as long
+	// as the event sources did to write the responses they queued
+	if p.outputBindings != nil {
+		if err := p.outputBindings.Close(p.stopTimeout); err != nil {
+			stopErrors = append(stopErrors, errors.Wrap(err, "Failed to close outputs"))
+		}
+	}
+
+	for _, deadLetterSink := range p.deadLetterSinks {
+		if err := deadLetterSink.Close(); err != nil {
+			stopErrors = append(stopErrors, errors.Wrap(err, "Failed to close dead letter sink"))
+		}
+	}
+
+	if p.webAdminServer != nil {
+		if err := p.webAdminServer.Stop(); err != nil {
+			stopErrors = append(stopErrors, errors.Wrap(err, "Failed to stop web admin server"))
+		}
+	}
+
+	p.logger.InfoWith("Stopped", "errors", len(stopErrors))
+
+	if len(stopErrors) != 0 {
+		return errors.Wrap(stopErrors[0], "Failed to stop event sources")
+	}
 
 	return nil
 }
@@ -88,7 +312,7 @@ func (p *Processor) readConfiguration(configurationPath string) error {
 	rootConfigurationDir := filepath.Dir(configurationPath)
 
 	// read the configuration file sections, which may be in separate configuration files or inline
-	for _, sectionName := range []string{"event_sources", "function", "web_admin", "logger"} {
+	for _, sectionName := range []string{"event_sources", "function", "web_admin", "logger", "checkpoint", "worker_pools"} {
 
 		// try to get <section name>.config_path (e.g. function.config_path)
 		sectionConfigPath := p.configuration["root"].GetString(fmt.Sprintf("%s.config_path", sectionName))
@@ -114,13 +338,104 @@ func (p *Processor) readConfiguration(configurationPath string) error {
 
 func (p *Processor) createLogger(configuration *viper.Viper) (nuclio.Logger, error) {
 
-	// TODO: configuration stuff
-	return nucliozap.NewNuclioZap("processor", nucliozap.DebugLevel)
+	// if there's no logger section, this will create a debug level logger to stdout
+	return nucliozap.NewNuclioZapFromConfiguration("processor", configuration)
+}
+
+// creates the worker pools declared in worker_pools, e.g.:
+//
+//	worker_pools:
+//	  shared:
+//	    worker_allocator: elastic
+//	    max_workers: 16
+//	    allocation_policy: weighted
+//
+// event sources use a pool by setting worker_pool to its name (and, if weighted, worker_pool_weight)
+func (p *Processor) createWorkerPools(configuration *viper.Viper) error {
+
+	// if there are no worker pools, every event source has its own workers
+	if configuration == nil {
+		return nil
+	}
+
+	runtimeConfiguration, err := p.getRuntimeConfiguration()
+	if err != nil {
+		return errors.Wrap(err, "Failed to get runtime configuration")
+	}
+
+	for workerPoolName := range configuration.GetStringMap("") {
+		workerPoolConfiguration := configuration.Sub(workerPoolName)
+
+		// defaults
+		workerPoolConfiguration.SetDefault("worker_allocator", eventsource.WorkerAllocatorFixedPool)
+		workerPoolConfiguration.SetDefault("num_workers", 1)
+		workerPoolConfiguration.SetDefault("min_workers", 1)
+		workerPoolConfiguration.SetDefault("max_workers", workerPoolConfiguration.GetInt("num_workers"))
+		workerPoolConfiguration.SetDefault("worker_idle_timeout_ms", 60000)
+		workerPoolConfiguration.SetDefault("allocation_policy", worker.AllocationPolicyFairShare)
+
+		workerPoolLogger := p.logger.GetChild(workerPoolName).(nuclio.Logger)
+
+		var workerAllocator worker.WorkerAllocator
+		var capacity int
+
+		switch workerPoolConfiguration.GetString("worker_allocator") {
+		case eventsource.WorkerAllocatorFixedPool:
+			capacity = workerPoolConfiguration.GetInt("num_workers")
+
+			workerAllocator, err = worker.WorkerFactorySingleton.CreateFixedPoolWorkerAllocator(workerPoolLogger,
+				capacity,
+				runtimeConfiguration)
+
+		case eventsource.WorkerAllocatorElastic:
+			capacity = workerPoolConfiguration.GetInt("max_workers")
+
+			workerAllocator, err = worker.WorkerFactorySingleton.CreateElasticPoolWorkerAllocator(workerPoolLogger,
+				&worker.ElasticPoolConfiguration{
+					MinWorkers:  workerPoolConfiguration.GetInt("min_workers"),
+					MaxWorkers:  capacity,
+					IdleTimeout: time.Duration(workerPoolConfiguration.GetInt("worker_idle_timeout_ms")) * time.Millisecond,
+				},
+				runtimeConfiguration)
+
+		default:
+			return fmt.Errorf("Unknown worker allocator %s in worker pool %s",
+				workerPoolConfiguration.GetString("worker_allocator"),
+				workerPoolName)
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create worker allocator of worker pool %s", workerPoolName)
+		}
+
+		workerPool, err := worker.NewWorkerPool(p.logger,
+			workerPoolName,
+			workerAllocator,
+			capacity,
+			workerPoolConfiguration.GetString("allocation_policy"))
+
+		if err != nil {
+
+			// the pool doesn't own the allocator's workers unless it was created
+			if stopErr := workerAllocator.Stop(); stopErr != nil {
+				p.logger.WarnWith("Failed to stop worker allocator", "name", workerPoolName, "err", stopErr)
+			}
+
+			return errors.Wrapf(err, "Failed to create worker pool %s", workerPoolName)
+		}
+
+		p.logger.DebugWith("Created worker pool", "name", workerPoolName, "capacity", capacity)
+
+		p.workerPools = append(p.workerPools, workerPool)
+	}
+
+	return nil
 }
 
 func (p *Processor) createEventSources() ([]eventsource.EventSource, error) {
 	eventSources := []eventsource.EventSource{}
 	eventSourceConfigurations := make(map[string]interface{})
+	deadLetterQueues := map[string]string{}
 
 	// get the runtime configuration
 	runtimeConfiguration, err := p.getRuntimeConfiguration()
@@ -128,6 +443,12 @@ func (p *Processor) createEventSources() ([]eventsource.EventSource, error) {
 		return nil, errors.Wrap(err, "Failed to get runtime configuration")
 	}
 
+	// event sources reference the worker pools they share by name
+	workerPools := map[string]*worker.WorkerPool{}
+	for _, workerPool := range p.workerPools {
+		workerPools[workerPool.Name] = workerPool
+	}
+
 	// get configuration (root of event sources) if event sources exists in configuration. if it doesn't
 	// just skip and default event sources will be created
 	eventSourceConfigurationsViper := p.configuration["event_sources"]
@@ -141,19 +462,35 @@ func (p *Processor) createEventSources() ([]eventsource.EventSource, error) {
 		// set the ID of the event source
 		eventSourceConfiguration.Set("id", eventSourceID)
 
+		// skip event sources that were explicitly disabled
+		enabled, err := eventsource.IsEnabled(eventSourceConfiguration)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read event source configuration")
+		}
+
+		if !enabled {
+			p.logger.InfoWith("Skipping disabled event source", "id", eventSourceID)
+			continue
+		}
+
 		// create an event source based on event source configuration and runtime configuration
 		eventSource, err := eventsource.RegistrySingleton.NewEventSource(p.logger,
 			eventSourceConfiguration.GetString("kind"),
 			eventSourceConfiguration,
-			runtimeConfiguration)
+			runtimeConfiguration,
+			workerPools)
 
 		if err != nil {
-			return nil, errors.Wrapf(err, "Failed to create event sources")
+			return nil, errors.Wrapf(err, "Failed to create event source %s", eventSourceID)
 		}
 
 		// append to event sources (can be nil - ignore unknown event sources)
 		if eventSource != nil {
 			eventSources = append(eventSources, eventSource)
+
+			// dead letter sinks may refer to other event sources, so they're created once all event
+			// sources are
+			deadLetterQueues[eventSourceID] = eventSourceConfiguration.GetString("dlq")
 		}
 	}
 
@@ -166,9 +503,99 @@ func (p *Processor) createEventSources() ([]eventsource.EventSource, error) {
 	// augment with default event sources, if any were created
 	eventSources = append(eventSources, defaultEventSources...)
 
+	// set the sinks to which events that failed all retries are written
+	if err := p.setDeadLetterSinks(eventSources, deadLetterQueues); err != nil {
+		return nil, errors.Wrap(err, "Failed to set dead letter sinks")
+	}
+
 	return eventSources, nil
 }
 
+func (p *Processor) setDeadLetterSinks(eventSources []eventsource.EventSource,
+	deadLetterQueues map[string]string) error {
+
+	// the function's dead letter queue, if any, applies to event sources that don't declare their own
+	functionDeadLetterQueue := os.Getenv("NUCLIO_DLQ_STREAM_NAME")
+
+	for _, eventSource := range eventSources {
+		deadLetterQueue := deadLetterQueues[eventSource.GetID()]
+		if deadLetterQueue == "" {
+			deadLetterQueue = functionDeadLetterQueue
+		}
+
+		if deadLetterQueue == "" {
+			continue
+		}
+
+		deadLetterSink, err := p.createDeadLetterSink(eventSources, deadLetterQueue)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to create dead letter sink of event source %s", eventSource.GetID())
+		}
+
+		p.logger.DebugWith("Setting dead letter sink", "id", eventSource.GetID(), "dlq", deadLetterQueue)
+
+		eventSource.SetDeadLetterSink(deadLetterSink)
+
+		// closed once the event sources are stopped
+		p.deadLetterSinks = append(p.deadLetterSinks, deadLetterSink)
+	}
+
+	return nil
+}
+
+func (p *Processor) createDeadLetterSink(eventSources []eventsource.EventSource,
+	deadLetterQueue string) (eventsource.DeadLetterSink, error) {
+
+	sinkURL, err := url.Parse(deadLetterQueue)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", deadLetterQueue)
+	}
+
+	// if there's a scheme, it selects the kind of sink
+	if sinkURL.Scheme != "" {
+		return eventsource.DeadLetterSinkRegistrySingleton.NewDeadLetterSink(p.logger, sinkURL)
+	}
+
+	// otherwise, it's the ID of an event source through which dead letters are published
+	for _, eventSource := range eventSources {
+		if eventSource.GetID() != deadLetterQueue {
+			continue
+		}
+
+		publisher, isPublisher := eventSource.(eventsource.Publisher)
+		if !isPublisher {
+			return nil, fmt.Errorf("Event source %s (%s) can't publish dead letters",
+				deadLetterQueue,
+				eventSource.GetKind())
+		}
+
+		return eventsource.NewPublisherDeadLetterSink(publisher), nil
+	}
+
+	return nil, fmt.Errorf("No event source with ID %s", deadLetterQueue)
+}
+
+func (p *Processor) createOutputBindings(eventSources []eventsource.EventSource) (*output.Bindings, error) {
+	runtimeConfiguration, err := p.getRuntimeConfiguration()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get runtime configuration")
+	}
+
+	outputBindings, err := output.NewBindings(p.logger, runtimeConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	// responses are written by the event sources that received the events, once processed
+	if len(outputBindings.GetBindings()) != 0 {
+		for _, eventSource := range eventSources {
+			eventSource.SetOutputSink(outputBindings)
+		}
+	}
+
+	return outputBindings, nil
+}
+
 func (p *Processor) createDefaultEventSources(existingEventSources []eventsource.EventSource,
 	runtimeConfiguration *viper.Viper) ([]eventsource.EventSource, error) {
 	createdEventSources := []eventsource.EventSource{}
@@ -205,13 +632,15 @@ func (p *Processor) createDefaultHttpEventSource(runtimeConfiguration *viper.Vip
 
 	// populate default HTTP configuration
 	httpConfiguration := viper.New()
+	httpConfiguration.Set("id", "default_http")
 	httpConfiguration.Set("num_workers", 1)
 	httpConfiguration.Set("listen_address", listenAddress)
 
 	return eventsource.RegistrySingleton.NewEventSource(p.logger,
 		"http",
 		httpConfiguration,
-		runtimeConfiguration)
+		runtimeConfiguration,
+		nil)
 }
 
 func (p *Processor) getRuntimeConfiguration() (*viper.Viper, error) {
@@ -231,5 +660,84 @@ func (p *Processor) getRuntimeConfiguration() (*viper.Viper, error) {
 	// by default use golang
 	runtimeConfiguration.SetDefault("kind", "golang")
 
+	// how long the function may take to process an event before it's abandoned (0 - no deadline)
+	runtimeConfiguration.SetDefault("event_timeout_ms", 10000)
+
 	return runtimeConfiguration, nil
 }
+
+func (p *Processor) createCheckpointStore(configuration *viper.Viper) (checkpoint.Store, error) {
+
+	// if checkpoints aren't configured, event sources always start without one
+	if configuration == nil {
+		return nil, nil
+	}
+
+	// by default store checkpoints in a local file
+	configuration.SetDefault("kind", "file")
+
+	return checkpoint.RegistrySingleton.NewStore(p.logger.GetChild("checkpoint").(nuclio.Logger),
+		configuration.GetString("kind"),
+		configuration)
+}
+
+func (p *Processor) createWebAdminServer(configuration *viper.Viper) (*webadmin.Server, error) {
+
+	// if the web admin isn't configured, it isn't served
+	if configuration == nil {
+		return nil, nil
+	}
+
+	runtimeConfiguration, err := p.getRuntimeConfiguration()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get runtime configuration")
+	}
+
+	return webadmin.NewServer(p.logger,
+		webadmin.NewConfiguration(configuration),
+		p.configuration,
+		p.eventSources,
+		p.workerPools,
+		p.outputBindings,
+		runtimeConfiguration)
+}
+
+func (p *Processor) getCheckpoint(eventSource eventsource.EventSource) (eventsource.Checkpoint, error) {
+	if p.checkpointStore == nil {
+		return nil, nil
+	}
+
+	return p.checkpointStore.Get(eventSource.GetID())
+}
+
+func (p *Processor) handleStopResult(eventSource eventsource.EventSource,
+	checkpoint eventsource.Checkpoint,
+	stopError error) error {
+
+	if stopError != nil {
+		p.logger.WarnWith("Failed to stop event source", "id", eventSource.GetID(), "err", stopError)
+
+		return errors.Wrapf(stopError, "Failed to stop event source %s", eventSource.GetID())
+	}
+
+	if p.checkpointStore == nil {
+		return nil
+	}
+
+	// persist the checkpoint so that the event source resumes from it on next start
+	if err := p.checkpointStore.Set(eventSource.GetID(), checkpoint); err != nil {
+		return errors.Wrapf(err, "Failed to store checkpoint of event source %s", eventSource.GetID())
+	}
+
+	return nil
+}
+
+func (p *Processor) getStopTimeout() time.Duration {
+	stopTimeoutMs := 30000
+
+	if rootConfiguration := p.configuration["root"]; rootConfiguration != nil && rootConfiguration.IsSet("stop_timeout_ms") {
+		stopTimeoutMs = rootConfiguration.GetInt("stop_timeout_ms")
+	}
+
+	return time.Duration(stopTimeoutMs) * time.Millisecond
+}
@@ -0,0 +1,359 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+)
+
+// an event source whose graceful stop takes drainDuration, unless it's forced to stop first
+type testEventSource struct {
+	eventsource.AbstractEventSource
+	startError    error
+	drainDuration time.Duration
+	lock          sync.Mutex
+	started       bool
+	stopped       bool
+	forced        bool
+	forcedChan    chan struct{}
+}
+
+func newTestEventSource(id string, drainDuration time.Duration, startError error) *testEventSource {
+	return &testEventSource{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Kind: "test",
+			ID:   id,
+		},
+		startError:    startError,
+		drainDuration: drainDuration,
+		forcedChan:    make(chan struct{}),
+	}
+}
+
+func (tes *testEventSource) Start(checkpoint eventsource.Checkpoint) error {
+	tes.lock.Lock()
+	defer tes.lock.Unlock()
+
+	if tes.startError != nil {
+		return tes.startError
+	}
+
+	tes.started = true
+
+	return nil
+}
+
+func (tes *testEventSource) Stop(force bool) (eventsource.Checkpoint, error) {
+	checkpoint := "drained"
+
+	if force {
+		checkpoint = "forced"
+
+		tes.lock.Lock()
+		tes.forced = true
+		close(tes.forcedChan)
+		tes.lock.Unlock()
+	} else {
+		select {
+		case <-time.After(tes.drainDuration):
+		case <-tes.forcedChan:
+		}
+	}
+
+	tes.lock.Lock()
+	tes.stopped = true
+	tes.lock.Unlock()
+
+	return &checkpoint, nil
+}
+
+func (tes *testEventSource) getState() (bool, bool, bool) {
+	tes.lock.Lock()
+	defer tes.lock.Unlock()
+
+	return tes.started, tes.stopped, tes.forced
+}
+
+type testCheckpointStore struct {
+	lock        sync.Mutex
+	checkpoints map[string]string
+}
+
+func (tcs *testCheckpointStore) Get(eventSourceID string) (eventsource.Checkpoint, error) {
+	return nil, nil
+}
+
+func (tcs *testCheckpointStore) Set(eventSourceID string, checkpoint eventsource.Checkpoint) error {
+	tcs.lock.Lock()
+	defer tcs.lock.Unlock()
+
+	tcs.checkpoints[eventSourceID] = *checkpoint
+
+	return nil
+}
+
+type testDeadLetterSink struct {
+	closed bool
+}
+
+func (tdls *testDeadLetterSink) Write(deadLetter *eventsource.DeadLetter) error {
+	return nil
+}
+
+func (tdls *testDeadLetterSink) Close() error {
+	tdls.closed = true
+
+	return nil
+}
+
+// records whether its worker was stopped
+type testRuntime struct {
+	stopped bool
+}
+
+func (tr *testRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	return nil, nil
+}
+
+func (tr *testRuntime) Stop() error {
+	tr.stopped = true
+
+	return nil
+}
+
+type testRuntimeCreator struct{}
+
+func (trc *testRuntimeCreator) Create(logger nuclio.Logger, configuration *viper.Viper) (runtime.Runtime, error) {
+	return &testRuntime{}, nil
+}
+
+func init() {
+	runtime.RegistrySingleton.Register("test", &testRuntimeCreator{})
+}
+
+type ProcessorTestSuite struct {
+	suite.Suite
+	logger          nuclio.Logger
+	checkpointStore *testCheckpointStore
+}
+
+func (suite *ProcessorTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *ProcessorTestSuite) SetupTest() {
+	suite.checkpointStore = &testCheckpointStore{checkpoints: map[string]string{}}
+}
+
+func (suite *ProcessorTestSuite) TestStopPersistsCheckpoints() {
+	eventSources := []*testEventSource{
+		newTestEventSource("es1", 10*time.Millisecond, nil),
+		newTestEventSource("es2", 20*time.Millisecond, nil),
+	}
+
+	deadLetterSink := &testDeadLetterSink{}
+
+	processor := suite.createProcessor(time.Second, eventSources...)
+	processor.deadLetterSinks = []eventsource.DeadLetterSink{deadLetterSink}
+
+	suite.Require().NoError(processor.startEventSources())
+	suite.Require().NoError(processor.Stop())
+
+	suite.True(deadLetterSink.closed)
+
+	for _, eventSource := range eventSources {
+		_, stopped, forced := eventSource.getState()
+		suite.True(stopped)
+		suite.False(forced)
+	}
+
+	suite.Equal(map[string]string{"es1": "drained", "es2": "drained"}, suite.checkpointStore.checkpoints)
+}
+
+func (suite *ProcessorTestSuite) TestStopStopsWorkers() {
+	eventSourceRuntime := &testRuntime{}
+	workerPoolRuntime := &testRuntime{}
+
+	eventSource := newTestEventSource("es1", 0, nil)
+	eventSource.WorkerAllocator = suite.createWorkerAllocator(eventSourceRuntime)
+
+	workerPool, err := worker.NewWorkerPool(suite.logger,
+		"shared",
+		suite.createWorkerAllocator(workerPoolRuntime),
+		1,
+		worker.AllocationPolicyFairShare)
+
+	suite.Require().NoError(err)
+
+	processor := suite.createProcessor(time.Second, eventSource)
+	processor.workerPools = []*worker.WorkerPool{workerPool}
+
+	suite.Require().NoError(processor.startEventSources())
+	suite.Require().NoError(processor.Stop())
+
+	suite.True(eventSourceRuntime.stopped)
+	suite.True(workerPoolRuntime.stopped)
+}
+
+func (suite *ProcessorTestSuite) TestCreateWorkerPools() {
+	processor := suite.createProcessor(time.Second)
+
+	err := processor.createWorkerPools(suite.readWorkerPoolsConfiguration(`
+worker_pools:
+  fixed:
+    num_workers: 3
+  elastic:
+    worker_allocator: elastic
+    min_workers: 0
+    max_workers: 4
+    worker_idle_timeout_ms: 1000
+    allocation_policy: weighted
+`))
+
+	suite.Require().NoError(err)
+	suite.Len(processor.workerPools, 2)
+
+	workerPools := map[string]*worker.WorkerPool{}
+	for _, workerPool := range processor.workerPools {
+		workerPools[workerPool.Name] = workerPool
+	}
+
+	// the fixed pool creates its workers up front
+	fixedWorkerPool := workerPools["fixed"]
+	suite.Require().NotNil(fixedWorkerPool)
+	suite.Equal(3, fixedWorkerPool.GetCapacity())
+	suite.Len(fixedWorkerPool.GetAllocator().GetWorkers(), 3)
+	suite.Equal(worker.AllocationPolicyFairShare, fixedWorkerPool.GetAllocationPolicy())
+
+	// the elastic pool creates them as needed, up to its maximum
+	elasticWorkerPool := workerPools["elastic"]
+	suite.Require().NotNil(elasticWorkerPool)
+	suite.Equal(4, elasticWorkerPool.GetCapacity())
+	suite.Empty(elasticWorkerPool.GetAllocator().GetWorkers())
+	suite.Equal(worker.AllocationPolicyWeighted, elasticWorkerPool.GetAllocationPolicy())
+
+	for _, workerPool := range processor.workerPools {
+		suite.NoError(workerPool.Stop())
+	}
+}
+
+func (suite *ProcessorTestSuite) TestCreateWorkerPoolsInvalidConfiguration() {
+	for _, workerPoolsConfiguration := range []string{`
+worker_pools:
+  invalid:
+    worker_allocator: unknown
+`, `
+worker_pools:
+  invalid:
+    allocation_policy: unknown
+`, `
+worker_pools:
+  invalid:
+    num_workers: 0
+`} {
+		processor := suite.createProcessor(time.Second)
+
+		suite.Error(processor.createWorkerPools(suite.readWorkerPoolsConfiguration(workerPoolsConfiguration)))
+		suite.Empty(processor.workerPools)
+	}
+}
+
+func (suite *ProcessorTestSuite) TestStopForcesAfterTimeout() {
+	drainingEventSource := newTestEventSource("draining", 10*time.Millisecond, nil)
+	stuckEventSource := newTestEventSource("stuck", time.Hour, nil)
+
+	processor := suite.createProcessor(100*time.Millisecond, drainingEventSource, stuckEventSource)
+	suite.Require().NoError(processor.startEventSources())
+
+	stopStartTime := time.Now()
+	suite.Require().NoError(processor.Stop())
+	suite.True(time.Since(stopStartTime) < 5*time.Second)
+
+	_, stopped, forced := drainingEventSource.getState()
+	suite.True(stopped)
+	suite.False(forced)
+
+	_, stopped, forced = stuckEventSource.getState()
+	suite.True(stopped)
+	suite.True(forced)
+
+	suite.Equal(map[string]string{"draining": "drained", "stuck": "forced"}, suite.checkpointStore.checkpoints)
+}
+
+func (suite *ProcessorTestSuite) TestStartFailureStopsStartedEventSources() {
+	startedEventSource := newTestEventSource("started", 0, nil)
+	failingEventSource := newTestEventSource("failing", 0, errors.New("Start failed"))
+	pendingEventSource := newTestEventSource("pending", 0, nil)
+
+	processor := suite.createProcessor(time.Second, startedEventSource, failingEventSource, pendingEventSource)
+
+	err := processor.Start()
+	suite.Error(err)
+	suite.Contains(err.Error(), "Failed to start event source failing")
+
+	started, stopped, _ := startedEventSource.getState()
+	suite.True(started)
+	suite.True(stopped)
+
+	started, stopped, _ = pendingEventSource.getState()
+	suite.False(started)
+	suite.False(stopped)
+
+	// only what was started is stopped, and its checkpoint persisted
+	suite.Equal(map[string]string{"started": "drained"}, suite.checkpointStore.checkpoints)
+}
+
+func (suite *ProcessorTestSuite) createProcessor(stopTimeout time.Duration,
+	eventSources ...*testEventSource) *Processor {
+
+	functionConfiguration := viper.New()
+	functionConfiguration.Set("kind", "test")
+
+	processor := &Processor{
+		logger:          suite.logger,
+		configuration:   map[string]*viper.Viper{"function": functionConfiguration},
+		checkpointStore: suite.checkpointStore,
+		stopTimeout:     stopTimeout,
+	}
+
+	for _, eventSource := range eventSources {
+		processor.eventSources = append(processor.eventSources, eventSource)
+	}
+
+	return processor
+}
+
+// reads the worker_pools section the way the processor reads an inline section
+func (suite *ProcessorTestSuite) readWorkerPoolsConfiguration(rawConfiguration string) *viper.Viper {
+	rootConfiguration := viper.New()
+	rootConfiguration.SetConfigType("yaml")
+	suite.Require().NoError(rootConfiguration.ReadConfig(bytes.NewBufferString(rawConfiguration)))
+
+	return rootConfiguration.Sub("worker_pools")
+}
+
+func (suite *ProcessorTestSuite) createWorkerAllocator(runtimeInstance *testRuntime) worker.WorkerAllocator {
+	workerAllocator, err := worker.NewFixedPoolWorkerAllocator(suite.logger, []*worker.Worker{
+		worker.NewWorker(suite.logger, 0, runtimeInstance),
+	})
+
+	suite.Require().NoError(err)
+
+	return workerAllocator
+}
+
+func TestProcessorTestSuite(t *testing.T) {
+	suite.Run(t, new(ProcessorTestSuite))
+}
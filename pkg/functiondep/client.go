@@ -422,7 +422,7 @@ func (c *Client) getFunctionEnvironment(labels map[string]string,
 
 	env = append(env, v1.EnvVar{Name: "NUCLIO_REGION", Value: "local"})
 	env = append(env, v1.EnvVar{Name: "NUCLIO_LOG_STREAM_NAME", Value: "local"})
-	env = append(env, v1.EnvVar{Name: "NUCLIO_DLQ_STREAM_NAME", Value: ""})
+	env = append(env, v1.EnvVar{Name: "NUCLIO_DLQ_STREAM_NAME", Value: function.Spec.DlqStream})
 	env = append(env, v1.EnvVar{Name: "NUCLIO_FUNCTION_NAME", Value: labels["function"]})
 	env = append(env, v1.EnvVar{Name: "NUCLIO_FUNCTION_VERSION", Value: labels["version"]})
 	env = append(env, v1.EnvVar{Name: "NUCLIO_FUNCTION_MEMORY_SIZE", Value: "TBD"})
@@ -29,6 +29,7 @@ type Builder struct {
 
 const (
 	defaultBuilderImage     = "golang:1.8"
+	defaultRuntime          = "golang"
 	processorConfigFileName = "processor.yaml"
 	buildConfigFileName     = "build.yaml"
 )
@@ -36,9 +37,11 @@ const (
 type config struct {
 	Name    string `mapstructure:"name"`
 	Handler string `mapstructure:"handler"`
+	Runtime string `mapstructure:"kind"`
 	Build   struct {
-		Image    string   `mapstructure:"image"`
-		Packages []string `mapstructure:"packages"`
+		Image       string   `mapstructure:"image"`
+		Packages    []string `mapstructure:"packages"`
+		NpmPackages []string `mapstructure:"npm_packages"`
 	} `mapstructure:"build"`
 }
 
@@ -174,5 +177,8 @@ func (b *Builder) readConfig(processorConfigPath, buildFile string) (*config, er
 	if err := b.readBuildConfigFile(&c, buildFile); err != nil {
 		return nil, err
 	}
+	if c.Runtime == "" {
+		c.Runtime = defaultRuntime
+	}
 	return &c, nil
 }
@@ -223,9 +223,27 @@ func (d *dockerHelper) createProcessorImage() error {
 		dockerfile = "Dockerfile.jessie"
 	}
 
+	// handlers that aren't compiled into the processor are copied into the image along with their runtime
+	functionPath := d.env.getRelativeUserFunctionPath()
+	buildArgs := map[string]*string{}
+
+	switch d.env.config.Runtime {
+	case "python":
+		dockerfile = "Dockerfile.python"
+		buildArgs["NUCLIO_FUNCTION_PATH"] = &functionPath
+
+	case "nodejs":
+		npmPackages := strings.Join(d.env.config.Build.NpmPackages, " ")
+
+		dockerfile = "Dockerfile.nodejs"
+		buildArgs["NUCLIO_FUNCTION_PATH"] = &functionPath
+		buildArgs["NUCLIO_NPM_PACKAGES"] = &npmPackages
+	}
+
 	err = d.doBuild(d.env.outputName, buildContext, &types.ImageBuildOptions{
 		Tags:       []string{d.env.outputName},
 		Dockerfile: filepath.Join("hack", "processor", "build", dockerfile),
+		BuildArgs:  buildArgs,
 	})
 
 	if err != nil {
@@ -107,8 +107,8 @@ func (e *env) getNuclioSource() error {
 		}
 
 		if ref != nil {
-			workingDir := "e.nuclioDestDir"
-			_, err := e.cmdRunner.Run(&cmdrunner.RunOptions{WorkingDir: &workingDir}, "git checkout %s", ref)
+			workingDir := e.nuclioDestDir
+			_, err := e.cmdRunner.Run(&cmdrunner.RunOptions{WorkingDir: &workingDir}, "git checkout %s", *ref)
 
 			if err != nil {
 				return errors.Wrap(err, "Unable to checkout nuclio ref")
@@ -188,11 +188,21 @@ func (e *env) createUserFunctionPath() error {
 		e.logger.DebugWith("Processor config doesn't exist. Creating", "path", processorConfigFilePath)
 	}
 
+	// only go handlers are compiled into the processor. others are packaged alongside it
+	if e.config.Runtime != defaultRuntime {
+		return nil
+	}
+
 	registryPath := filepath.Join(append([]string{e.nuclioDestDir}, userFunctionRegistryPath...)...)
 
 	return e.writeRegistryFile(registryPath, e)
 }
 
+// returns the path of the function's copy, relative to the nuclio source
+func (e *env) getRelativeUserFunctionPath() string {
+	return filepath.Join(append(userFunctionPath, e.config.Name)...)
+}
+
 func (e *env) createDepsFile() error {
 	if len(e.config.Build.Packages) > 0 {
 		e.logger.DebugWith("Found packages to use as deps", "pkg", e.config.Build.Packages)
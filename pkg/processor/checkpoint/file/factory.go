@@ -0,0 +1,24 @@
+package file
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/checkpoint"
+
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	configuration *viper.Viper) (checkpoint.Store, error) {
+
+	// defaults
+	configuration.SetDefault("path", "/var/lib/nuclio/checkpoints.json")
+
+	return NewStore(parentLogger, configuration.GetString("path"))
+}
+
+// register factory
+func init() {
+	checkpoint.RegistrySingleton.Register("file", &factory{})
+}
@@ -0,0 +1,113 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/checkpoint"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+
+	"github.com/pkg/errors"
+)
+
+// stores the checkpoints of all event sources in a single JSON file, keyed by event source ID
+type store struct {
+	logger nuclio.Logger
+	path   string
+	lock   sync.Mutex
+}
+
+func NewStore(parentLogger nuclio.Logger, path string) (checkpoint.Store, error) {
+	if path == "" {
+		return nil, errors.New("File checkpoint store requires a path")
+	}
+
+	return &store{
+		logger: parentLogger.GetChild("file").(nuclio.Logger),
+		path:   path,
+	}, nil
+}
+
+func (s *store) Get(eventSourceID string) (eventsource.Checkpoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	checkpoints, err := s.readCheckpoints()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read checkpoints")
+	}
+
+	checkpoint, found := checkpoints[eventSourceID]
+	if !found {
+		return nil, nil
+	}
+
+	return eventsource.Checkpoint(&checkpoint), nil
+}
+
+func (s *store) Set(eventSourceID string, checkpoint eventsource.Checkpoint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	checkpoints, err := s.readCheckpoints()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read checkpoints")
+	}
+
+	// a nil checkpoint clears whatever was stored
+	if checkpoint == nil {
+		delete(checkpoints, eventSourceID)
+	} else {
+		checkpoints[eventSourceID] = *checkpoint
+	}
+
+	s.logger.DebugWith("Writing checkpoint", "id", eventSourceID, "path", s.path)
+
+	return s.writeCheckpoints(checkpoints)
+}
+
+func (s *store) readCheckpoints() (map[string]string, error) {
+	checkpoints := map[string]string{}
+
+	contents, err := ioutil.ReadFile(s.path)
+	if err != nil {
+
+		// no file simply means nothing was stored yet
+		if os.IsNotExist(err) {
+			return checkpoints, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &checkpoints); err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse %s", s.path)
+	}
+
+	return checkpoints, nil
+}
+
+func (s *store) writeCheckpoints(checkpoints map[string]string) error {
+	contents, err := json.Marshal(checkpoints)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode checkpoints")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return errors.Wrap(err, "Failed to create checkpoint directory")
+	}
+
+	// write to a temporary file and rename it over the previous one so that a crash mid-write
+	// doesn't leave a truncated file behind
+	temporaryPath := s.path + ".tmp"
+
+	if err := ioutil.WriteFile(temporaryPath, contents, 0644); err != nil {
+		return errors.Wrap(err, "Failed to write checkpoints")
+	}
+
+	return os.Rename(temporaryPath, s.path)
+}
@@ -0,0 +1,83 @@
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type StoreTestSuite struct {
+	suite.Suite
+	logger  nuclio.Logger
+	tempDir string
+}
+
+func (suite *StoreTestSuite) SetupTest() {
+	var err error
+
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.tempDir, err = ioutil.TempDir("", "checkpoint-test")
+	suite.Require().NoError(err)
+}
+
+func (suite *StoreTestSuite) TearDownTest() {
+	os.RemoveAll(suite.tempDir)
+}
+
+func (suite *StoreTestSuite) TestSetGet() {
+	path := filepath.Join(suite.tempDir, "nested", "checkpoints.json")
+
+	store, err := NewStore(suite.logger, path)
+	suite.Require().NoError(err)
+
+	// nothing stored yet
+	checkpoint, err := store.Get("rmq")
+	suite.NoError(err)
+	suite.Nil(checkpoint)
+
+	// set two checkpoints
+	first := "first"
+	second := "second"
+	suite.NoError(store.Set("rmq", eventsource.Checkpoint(&first)))
+	suite.NoError(store.Set("kafka", eventsource.Checkpoint(&second)))
+
+	// a new store on the same path should see both
+	store, err = NewStore(suite.logger, path)
+	suite.Require().NoError(err)
+
+	checkpoint, err = store.Get("rmq")
+	suite.NoError(err)
+	suite.Equal("first", *checkpoint)
+
+	checkpoint, err = store.Get("kafka")
+	suite.NoError(err)
+	suite.Equal("second", *checkpoint)
+
+	// clear one
+	suite.NoError(store.Set("rmq", nil))
+
+	checkpoint, err = store.Get("rmq")
+	suite.NoError(err)
+	suite.Nil(checkpoint)
+
+	checkpoint, err = store.Get("kafka")
+	suite.NoError(err)
+	suite.Equal("second", *checkpoint)
+}
+
+func (suite *StoreTestSuite) TestNoPath() {
+	store, err := NewStore(suite.logger, "")
+	suite.Error(err)
+	suite.Nil(store)
+}
+
+func TestStoreTestSuite(t *testing.T) {
+	suite.Run(t, new(StoreTestSuite))
+}
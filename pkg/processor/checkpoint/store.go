@@ -0,0 +1,16 @@
+package checkpoint
+
+import (
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+)
+
+// persists the checkpoints event sources return when stopped, so that they can resume from them when
+// the processor restarts
+type Store interface {
+
+	// get the checkpoint of an event source (nil - no checkpoint)
+	Get(eventSourceID string) (eventsource.Checkpoint, error)
+
+	// set the checkpoint of an event source (nil - clear checkpoint)
+	Set(eventSourceID string, checkpoint eventsource.Checkpoint) error
+}
@@ -0,0 +1,45 @@
+package eventsource
+
+import (
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// creates the allocator of the workers processing an event source's events, as configured. event sources
+// whose events are processed concurrently create their allocator with this
+func NewWorkerAllocator(logger nuclio.Logger,
+	configuration *Configuration,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (worker.WorkerAllocator, error) {
+
+	// workers of a shared pool are allocated through a member of the pool
+	if configuration.WorkerPool != "" {
+		workerPool, found := workerPools[configuration.WorkerPool]
+		if !found {
+			return nil, errors.Errorf("Event source %s references unknown worker pool %s",
+				configuration.ID,
+				configuration.WorkerPool)
+		}
+
+		return workerPool.NewMemberAllocator(configuration.ID, configuration.WorkerPoolWeight)
+	}
+
+	if configuration.WorkerAllocator == WorkerAllocatorElastic {
+		return worker.WorkerFactorySingleton.CreateElasticPoolWorkerAllocator(logger,
+			&worker.ElasticPoolConfiguration{
+				MinWorkers:  configuration.MinWorkers,
+				MaxWorkers:  configuration.NumWorkers,
+				IdleTimeout: time.Duration(configuration.WorkerIdleTimeoutMs) * time.Millisecond,
+			},
+			runtimeConfiguration)
+	}
+
+	return worker.WorkerFactorySingleton.CreateFixedPoolWorkerAllocator(logger,
+		configuration.NumWorkers,
+		runtimeConfiguration)
+}
@@ -0,0 +1,198 @@
+package eventsource
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+)
+
+// Connection keeps an event source consuming from a broker (or server) connected. it connects when the event
+// source starts, and whenever consuming stops short of the event source stopping it reconnects with
+// exponential backoff. the event source provides the functions creating and closing its connection's
+// resources, which are called under the connection's lock - the event source accesses the resources under
+// the same lock
+type Connection struct {
+	logger          nuclio.Logger
+	reconnectPolicy *RetryPolicy
+	connect         func() error
+	disconnect      func() error
+
+	lock        sync.Mutex
+	state       ConnectionState
+	stopChan    chan struct{}
+	stoppedChan chan struct{}
+}
+
+// NewConnection creates a connection whose resources are created by connect and closed by disconnect.
+// disconnect is called whenever the connection is lost or stopped, so it must do nothing if there's nothing
+// to close
+func NewConnection(logger nuclio.Logger,
+	reconnectBackoff time.Duration,
+	reconnectMaxBackoff time.Duration,
+	connect func() error,
+	disconnect func() error) *Connection {
+
+	return &Connection{
+		logger: logger,
+		reconnectPolicy: &RetryPolicy{
+			Backoff:    reconnectBackoff,
+			MaxBackoff: reconnectMaxBackoff,
+		},
+		connect:    connect,
+		disconnect: disconnect,
+		state:      ConnectionStateDisconnected,
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start connects and calls consume in a go routine until stopped, reconnecting whenever consume returns. the
+// first connection must succeed, so that misconfiguration is reported on start
+func (c *Connection) Start(consume func()) error {
+	if err := c.Connect(); err != nil {
+		return err
+	}
+
+	c.stoppedChan = make(chan struct{})
+
+	go c.run(consume)
+
+	return nil
+}
+
+// Stop keeps the connection from reconnecting, calls interrupt (if given) under the lock so that the event
+// source can stop consume from waiting for more messages, and waits for consume to return - unless asked not
+// to wait, or never started. the resources are then closed. a forced stop may follow a graceful one
+func (c *Connection) Stop(force bool, interrupt func()) error {
+	select {
+	case <-c.stopChan:
+	default:
+		close(c.stopChan)
+	}
+
+	if interrupt != nil {
+		c.lock.Lock()
+		interrupt()
+		c.lock.Unlock()
+	}
+
+	if !force && c.stoppedChan != nil {
+		<-c.stoppedChan
+	}
+
+	return c.Disconnect()
+}
+
+// Connect creates the resources, unless stopped
+func (c *Connection) Connect() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.Stopped() {
+		return errors.New("Stopped")
+	}
+
+	c.state = ConnectionStateConnecting
+
+	if err := c.connect(); err != nil {
+		c.state = ConnectionStateDisconnected
+
+		return err
+	}
+
+	c.state = ConnectionStateConnected
+
+	return nil
+}
+
+// Disconnect closes the resources
+func (c *Connection) Disconnect() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.state = ConnectionStateDisconnected
+
+	return c.disconnect()
+}
+
+// Lock guards the resources of the connection
+func (c *Connection) Lock() {
+	c.lock.Lock()
+}
+
+func (c *Connection) Unlock() {
+	c.lock.Unlock()
+}
+
+func (c *Connection) GetConnectionState() ConnectionState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.state
+}
+
+// Stopped returns whether the event source is stopping
+func (c *Connection) Stopped() bool {
+	select {
+	case <-c.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopChan is closed once the event source is stopping
+func (c *Connection) StopChan() <-chan struct{} {
+	return c.stopChan
+}
+
+func (c *Connection) run(consume func()) {
+	defer close(c.stoppedChan)
+
+	for {
+		consume()
+
+		if c.Stopped() {
+			return
+		}
+
+		c.logger.Warn("Connection lost")
+
+		if err := c.Disconnect(); err != nil {
+			c.logger.WarnWith("Failed to close lost connection", "err", err)
+		}
+
+		if !c.reconnect() {
+			return
+		}
+	}
+}
+
+// connects with exponential backoff until connected (returns true) or stopped (returns false)
+func (c *Connection) reconnect() bool {
+	for attempt := 1; ; attempt++ {
+		backoff := c.reconnectPolicy.GetBackoff(attempt)
+
+		c.logger.InfoWith("Reconnecting", "attempt", attempt, "backoff", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-c.stopChan:
+			return false
+		}
+
+		err := c.Connect()
+		if err == nil {
+			c.logger.InfoWith("Reconnected", "attempt", attempt)
+			return true
+		}
+
+		c.logger.WarnWith("Failed to reconnect", "attempt", attempt, "err", err)
+
+		if c.Stopped() {
+			return false
+		}
+	}
+}
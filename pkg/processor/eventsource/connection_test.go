@@ -0,0 +1,177 @@
+package eventsource
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// a connection whose connects fail while asked to, recording the connects and disconnects
+type testConnection struct {
+	lock           sync.Mutex
+	numConnects    int
+	numDisconnects int
+	numFailures    int
+	connected      bool
+}
+
+func (tc *testConnection) connect() error {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	tc.numConnects++
+
+	if tc.numFailures > 0 {
+		tc.numFailures--
+		return errors.New("Connection refused")
+	}
+
+	tc.connected = true
+
+	return nil
+}
+
+func (tc *testConnection) disconnect() error {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	if tc.connected {
+		tc.numDisconnects++
+		tc.connected = false
+	}
+
+	return nil
+}
+
+func (tc *testConnection) get() (int, int) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	return tc.numConnects, tc.numDisconnects
+}
+
+type ConnectionTestSuite struct {
+	suite.Suite
+	logger         nuclio.Logger
+	testConnection *testConnection
+	connection     *Connection
+}
+
+func (suite *ConnectionTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *ConnectionTestSuite) SetupTest() {
+	suite.testConnection = &testConnection{}
+	suite.connection = NewConnection(suite.logger,
+		10*time.Millisecond,
+		40*time.Millisecond,
+		suite.testConnection.connect,
+		suite.testConnection.disconnect)
+}
+
+func (suite *ConnectionTestSuite) TestReconnectsWithBackoff() {
+	consumedChan := make(chan struct{}, 10)
+	releaseChan := make(chan struct{})
+
+	// the first connection is lost once released, the next ones right away
+	suite.Require().NoError(suite.connection.Start(func() {
+		consumedChan <- struct{}{}
+		<-releaseChan
+	}))
+
+	suite.receive(consumedChan)
+
+	// reconnecting fails a few times
+	suite.testConnection.lock.Lock()
+	suite.testConnection.numFailures = 3
+	suite.testConnection.lock.Unlock()
+
+	reconnectStartTime := time.Now()
+	close(releaseChan)
+
+	suite.receive(consumedChan)
+
+	// 10 + 20 + 40 + 40 ms
+	suite.True(time.Since(reconnectStartTime) >= 110*time.Millisecond)
+
+	numConnects, numDisconnects := suite.testConnection.get()
+	suite.True(numConnects >= 5)
+	suite.True(numDisconnects >= 1)
+
+	suite.Require().NoError(suite.connection.Stop(false, nil))
+	suite.Equal(ConnectionStateDisconnected, suite.connection.GetConnectionState())
+}
+
+func (suite *ConnectionTestSuite) TestStopInterruptsConsuming() {
+	interruptChan := make(chan struct{})
+
+	suite.Require().NoError(suite.connection.Start(func() {
+		<-interruptChan
+	}))
+
+	suite.Equal(ConnectionStateConnected, suite.connection.GetConnectionState())
+
+	suite.Require().NoError(suite.connection.Stop(false, func() {
+		close(interruptChan)
+	}))
+
+	// not reconnected once stopped
+	numConnects, numDisconnects := suite.testConnection.get()
+	suite.Equal(1, numConnects)
+	suite.Equal(1, numDisconnects)
+	suite.Error(suite.connection.Connect())
+}
+
+func (suite *ConnectionTestSuite) TestStopWhileReconnecting() {
+	suite.testConnection.numFailures = 1
+
+	// the first connection must succeed
+	suite.Error(suite.connection.Start(func() {}))
+	suite.Equal(ConnectionStateDisconnected, suite.connection.GetConnectionState())
+
+	suite.Require().NoError(suite.connection.Start(func() {}))
+
+	// always failing to reconnect
+	suite.testConnection.lock.Lock()
+	suite.testConnection.numFailures = 1000
+	suite.testConnection.lock.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+
+	stoppedChan := make(chan struct{})
+
+	go func() {
+		suite.connection.Stop(false, nil)
+		close(stoppedChan)
+	}()
+
+	select {
+	case <-stoppedChan:
+	case <-time.After(time.Second):
+		suite.Fail("Stop blocked while reconnecting")
+	}
+}
+
+func (suite *ConnectionTestSuite) TestStopWithoutStart() {
+	suite.NoError(suite.connection.Stop(false, nil))
+	suite.True(suite.connection.Stopped())
+}
+
+func (suite *ConnectionTestSuite) receive(consumedChan chan struct{}) {
+	select {
+	case <-consumedChan:
+	case <-time.After(5 * time.Second):
+		suite.FailNow("Timed out waiting to consume")
+	}
+}
+
+func TestConnectionTestSuite(t *testing.T) {
+	suite.Run(t, new(ConnectionTestSuite))
+}
@@ -0,0 +1,61 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// the event sent on every tick. its timestamp is the time of the tick
+type Event struct {
+	nuclio.AbstractSync
+	body        []byte
+	contentType string
+	headers     map[string]interface{}
+	timestamp   time.Time
+}
+
+func (e *Event) GetContentType() string {
+	return e.contentType
+}
+
+func (e *Event) GetBody() []byte {
+	return e.body
+}
+
+func (e *Event) GetSize() int {
+	return len(e.body)
+}
+
+func (e *Event) GetTimestamp() time.Time {
+	return e.timestamp
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	return e.headers[key]
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return e.headers
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	value, found := e.headers[key]
+	if !found {
+		return nil
+	}
+
+	switch typedValue := value.(type) {
+	case []byte:
+		return typedValue
+	case string:
+		return []byte(typedValue)
+	default:
+		return []byte(fmt.Sprint(typedValue))
+	}
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	return string(e.GetHeaderByteSlice(key))
+}
@@ -0,0 +1,224 @@
+package cron
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type cron struct {
+	eventsource.AbstractEventSource
+	configuration *Configuration
+	event         Event
+	ticksChan     chan time.Time
+	stopChan      chan struct{}
+	stoppedChan   chan struct{}
+
+	// non zero while a tick is queued or being handled. accessed atomically
+	busy int32
+
+	// the last tick handled, in unix nanoseconds. accessed atomically
+	lastTick int64
+}
+
+func newEventSource(logger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	newEventSource := cron{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Logger:          logger,
+			WorkerAllocator: workerAllocator,
+			Class:           "async",
+			Kind:            "cron",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
+		},
+		configuration: configuration,
+		event: Event{
+			body:        configuration.EventBody,
+			contentType: configuration.EventContentType,
+			headers:     configuration.EventHeaders,
+		},
+		stopChan: make(chan struct{}),
+	}
+
+	return &newEventSource, nil
+}
+
+func (c *cron) Start(checkpoint eventsource.Checkpoint) error {
+	c.Logger.InfoWith("Starting",
+		"concurrencyPolicy", c.configuration.ConcurrencyPolicy,
+		"missedTicks", c.configuration.MissedTicks)
+
+	lastTick, err := decodeCheckpoint(checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "Failed to decode checkpoint")
+	}
+
+	if !lastTick.IsZero() {
+		atomic.StoreInt64(&c.lastTick, lastTick.UnixNano())
+	}
+
+	missedTicks, nextTick := c.getMissedTicks(lastTick, time.Now())
+
+	// make room for the missed ticks we fire, so that queueing them never blocks
+	queueSize := c.configuration.MaxQueuedTicks
+	if c.configuration.ConcurrencyPolicy == ConcurrencyPolicySkip {
+		queueSize = 1
+	}
+
+	if len(missedTicks) > queueSize {
+		queueSize = len(missedTicks)
+	}
+
+	c.ticksChan = make(chan time.Time, queueSize)
+	c.stoppedChan = make(chan struct{})
+
+	if len(missedTicks) != 0 {
+		c.Logger.InfoWith("Firing missed ticks", "num", len(missedTicks), "since", lastTick)
+
+		atomic.StoreInt32(&c.busy, 1)
+
+		for _, missedTick := range missedTicks {
+			c.ticksChan <- missedTick
+		}
+	}
+
+	go c.handleTicks()
+	go c.scheduleTicks(nextTick)
+
+	return nil
+}
+
+func (c *cron) Stop(force bool) (eventsource.Checkpoint, error) {
+	c.Logger.InfoWith("Stopping", "force", force)
+
+	// signal the scheduling and handling go routines to stop. a forced stop may follow a graceful one
+	select {
+	case <-c.stopChan:
+	default:
+		close(c.stopChan)
+	}
+
+	// let the tick being handled complete, unless we're asked not to wait. queued ticks are dropped, and
+	// are fired again on start if configured to fire missed ticks
+	if !force && c.stoppedChan != nil {
+		<-c.stoppedChan
+	}
+
+	lastTick := atomic.LoadInt64(&c.lastTick)
+	if lastTick == 0 {
+		return nil, nil
+	}
+
+	return encodeCheckpoint(time.Unix(0, lastTick).In(time.UTC)), nil
+}
+
+// returns the ticks since the last tick that should be fired according to the missed ticks policy, and the
+// first tick after now
+func (c *cron) getMissedTicks(lastTick time.Time, now time.Time) ([]time.Time, time.Time) {
+	var missedTicks []time.Time
+
+	// no checkpoint, nothing was missed
+	if lastTick.IsZero() {
+		return nil, c.configuration.Schedule.Next(now)
+	}
+
+	tick := c.configuration.Schedule.Next(lastTick)
+
+	for !tick.IsZero() && !tick.After(now) {
+
+		// keep only the most recent ones
+		if c.configuration.MissedTicks == MissedTicksFireAll || len(missedTicks) == 0 {
+			missedTicks = append(missedTicks, tick)
+		} else {
+			missedTicks[0] = tick
+		}
+
+		if len(missedTicks) > c.configuration.MaxMissedTicks {
+			missedTicks = missedTicks[1:]
+		}
+
+		tick = c.configuration.Schedule.Next(tick)
+	}
+
+	if c.configuration.MissedTicks == MissedTicksSkip {
+		missedTicks = nil
+	}
+
+	return missedTicks, tick
+}
+
+func (c *cron) scheduleTicks(nextTick time.Time) {
+	for !nextTick.IsZero() {
+		select {
+		case <-time.After(time.Until(nextTick)):
+		case <-c.stopChan:
+			return
+		}
+
+		c.queueTick(nextTick)
+
+		// don't fire ticks we fell behind on while running (e.g. the process was suspended)
+		now := time.Now()
+		for !nextTick.IsZero() && !nextTick.After(now) {
+			nextTick = c.configuration.Schedule.Next(nextTick)
+		}
+	}
+
+	c.Logger.Warn("Schedule has no more ticks")
+}
+
+func (c *cron) queueTick(tick time.Time) {
+	if c.configuration.ConcurrencyPolicy == ConcurrencyPolicySkip {
+		if !atomic.CompareAndSwapInt32(&c.busy, 0, 1) {
+			c.Logger.InfoWith("Skipping tick, previous tick is still being handled", "tick", tick)
+			return
+		}
+	}
+
+	select {
+	case c.ticksChan <- tick:
+	default:
+		c.Logger.WarnWith("Dropping tick, too many ticks queued", "tick", tick)
+	}
+}
+
+func (c *cron) handleTicks() {
+	defer close(c.stoppedChan)
+
+	for {
+		select {
+		case tick := <-c.ticksChan:
+			c.handleTick(tick)
+		case <-c.stopChan:
+			return
+		}
+	}
+}
+
+func (c *cron) handleTick(tick time.Time) {
+	c.event.timestamp = tick
+
+	_, submitError, processError := c.SubmitEventToWorker(&c.event, c.configuration.GetWorkerAllocationTimeout())
+	if submitError != nil || processError != nil {
+		c.Logger.WarnWith("Failed to handle tick",
+			"tick", tick,
+			"submitError", submitError,
+			"processError", processError)
+	}
+
+	atomic.StoreInt64(&c.lastTick, tick.UnixNano())
+
+	// allow the next tick in, unless ticks were already queued (e.g. missed ticks)
+	if len(c.ticksChan) == 0 {
+		atomic.StoreInt32(&c.busy, 0)
+	}
+}
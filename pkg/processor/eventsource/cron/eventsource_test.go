@@ -0,0 +1,181 @@
+package cron
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// records the ticks it handles, taking processingDuration to handle each
+type recordingRuntime struct {
+	lock               sync.Mutex
+	ticks              []time.Time
+	bodies             []string
+	processingDuration time.Duration
+}
+
+func (rr *recordingRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	time.Sleep(rr.processingDuration)
+
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	rr.ticks = append(rr.ticks, event.GetTimestamp())
+	rr.bodies = append(rr.bodies, string(event.GetBody())+"/"+event.GetHeaderString("x-source"))
+
+	return nil, nil
+}
+
+func (rr *recordingRuntime) getTicks() []time.Time {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	return append([]time.Time{}, rr.ticks...)
+}
+
+type EventSourceTestSuite struct {
+	suite.Suite
+	logger  nuclio.Logger
+	runtime *recordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	suite.runtime = &recordingRuntime{}
+}
+
+func (suite *EventSourceTestSuite) TestInterval() {
+	eventSource := suite.createEventSource(20*time.Millisecond, ConcurrencyPolicySkip, MissedTicksSkip)
+	suite.Require().NoError(eventSource.Start(nil))
+
+	time.Sleep(110 * time.Millisecond)
+
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	ticks := suite.runtime.getTicks()
+	suite.True(len(ticks) >= 3 && len(ticks) <= 6, "Unexpected number of ticks: %d", len(ticks))
+	suite.Equal("hello/cron", suite.runtime.bodies[0])
+
+	// the checkpoint is the last tick
+	suite.Require().NotNil(checkpoint)
+	lastTick, err := decodeCheckpoint(checkpoint)
+	suite.Require().NoError(err)
+	suite.True(lastTick.Equal(ticks[len(ticks)-1]))
+}
+
+func (suite *EventSourceTestSuite) TestSkipWhileRunning() {
+	suite.runtime.processingDuration = 100 * time.Millisecond
+
+	eventSource := suite.createEventSource(20*time.Millisecond, ConcurrencyPolicySkip, MissedTicksSkip)
+	suite.Require().NoError(eventSource.Start(nil))
+
+	time.Sleep(150 * time.Millisecond)
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	// ticks occurring while the first was handled were skipped
+	suite.True(len(suite.runtime.getTicks()) <= 2)
+}
+
+func (suite *EventSourceTestSuite) TestQueueWhileRunning() {
+	suite.runtime.processingDuration = 30 * time.Millisecond
+
+	eventSource := suite.createEventSource(10*time.Millisecond, ConcurrencyPolicyQueue, MissedTicksSkip)
+	suite.Require().NoError(eventSource.Start(nil))
+
+	time.Sleep(100 * time.Millisecond)
+	eventSource.Stop(true)
+
+	// ticks were queued rather than skipped, so the ones handled are consecutive
+	ticks := suite.runtime.getTicks()
+	suite.Require().True(len(ticks) >= 2)
+
+	for tickIndex := 1; tickIndex < len(ticks); tickIndex++ {
+		suite.Equal(10*time.Millisecond, ticks[tickIndex].Sub(ticks[tickIndex-1]))
+	}
+}
+
+func (suite *EventSourceTestSuite) TestMissedTicks() {
+	lastTick := time.Now().Add(-3*time.Hour - time.Minute)
+	checkpoint := encodeCheckpoint(lastTick)
+
+	for _, testCase := range []struct {
+		missedTicks      string
+		expectedNumTicks int
+	}{
+		{MissedTicksSkip, 0},
+		{MissedTicksFireOnce, 1},
+		{MissedTicksFireAll, 3},
+	} {
+		suite.runtime = &recordingRuntime{}
+
+		eventSource := suite.createEventSource(time.Hour, ConcurrencyPolicySkip, testCase.missedTicks)
+		suite.Require().NoError(eventSource.Start(checkpoint))
+
+		time.Sleep(50 * time.Millisecond)
+
+		newCheckpoint, err := eventSource.Stop(false)
+		suite.Require().NoError(err)
+
+		newLastTick, err := decodeCheckpoint(newCheckpoint)
+		suite.Require().NoError(err)
+
+		ticks := suite.runtime.getTicks()
+		suite.Len(ticks, testCase.expectedNumTicks, testCase.missedTicks)
+
+		// ticks are fired in order, and the last is the most recent missed one
+		if len(ticks) != 0 {
+			suite.True(ticks[len(ticks)-1].Equal(lastTick.Add(3 * time.Hour)))
+			suite.True(newLastTick.Equal(ticks[len(ticks)-1]))
+		} else {
+			suite.True(newLastTick.Equal(lastTick))
+		}
+	}
+}
+
+func (suite *EventSourceTestSuite) createEventSource(interval time.Duration,
+	concurrencyPolicy string,
+	missedTicks string) eventsource.EventSource {
+
+	workerAllocator, err := worker.NewSingletonWorkerAllocator(suite.logger,
+		worker.NewWorker(suite.logger, 0, suite.runtime))
+
+	suite.Require().NoError(err)
+
+	schedule, err := NewIntervalSchedule(interval)
+	suite.Require().NoError(err)
+
+	eventSource, err := newEventSource(suite.logger, workerAllocator, &Configuration{
+		Configuration: eventsource.Configuration{
+			ID: "cron1",
+		},
+		Schedule:          schedule,
+		ConcurrencyPolicy: concurrencyPolicy,
+		MaxQueuedTicks:    100,
+		MissedTicks:       missedTicks,
+		MaxMissedTicks:    100,
+		EventBody:         []byte("hello"),
+		EventHeaders:      map[string]interface{}{"x-source": "cron"},
+	})
+
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
@@ -0,0 +1,130 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// defaults
+	eventSourceConfiguration.SetDefault("timezone", "Local")
+	eventSourceConfiguration.SetDefault("concurrency_policy", ConcurrencyPolicySkip)
+	eventSourceConfiguration.SetDefault("max_queued_ticks", 100)
+	eventSourceConfiguration.SetDefault("missed_ticks", MissedTicksSkip)
+	eventSourceConfiguration.SetDefault("max_missed_ticks", 100)
+
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"schedule":           eventsource.ValueTypeString,
+		"interval":           eventsource.ValueTypeString,
+		"timezone":           eventsource.ValueTypeString,
+		"concurrency_policy": eventsource.ValueTypeString,
+		"max_queued_ticks":   eventsource.ValueTypeInt,
+		"missed_ticks":       eventsource.ValueTypeString,
+		"max_missed_ticks":   eventsource.ValueTypeInt,
+		"event":              eventsource.ValueTypeMap,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	schedule, err := f.createSchedule(eventSourceConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create schedule")
+	}
+
+	cronConfiguration := &Configuration{
+		Configuration:     *configuration,
+		Schedule:          schedule,
+		ConcurrencyPolicy: eventSourceConfiguration.GetString("concurrency_policy"),
+		MaxQueuedTicks:    eventSourceConfiguration.GetInt("max_queued_ticks"),
+		MissedTicks:       eventSourceConfiguration.GetString("missed_ticks"),
+		MaxMissedTicks:    eventSourceConfiguration.GetInt("max_missed_ticks"),
+		EventBody:         []byte(eventSourceConfiguration.GetString("event.body")),
+		EventContentType:  eventSourceConfiguration.GetString("event.content_type"),
+		EventHeaders:      cast.ToStringMap(eventSourceConfiguration.Get("event.headers")),
+	}
+
+	switch cronConfiguration.ConcurrencyPolicy {
+	case ConcurrencyPolicySkip, ConcurrencyPolicyQueue:
+	default:
+		return nil, fmt.Errorf("Invalid concurrency policy: %s", cronConfiguration.ConcurrencyPolicy)
+	}
+
+	switch cronConfiguration.MissedTicks {
+	case MissedTicksSkip, MissedTicksFireOnce, MissedTicksFireAll:
+	default:
+		return nil, fmt.Errorf("Invalid missed ticks policy: %s", cronConfiguration.MissedTicks)
+	}
+
+	// create logger parent
+	cronLogger := parentLogger.GetChild("cron").(nuclio.Logger)
+
+	var workerAllocator worker.WorkerAllocator
+
+	// ticks are handled one at a time, by a worker of our own unless we share a pool
+	if configuration.WorkerPool != "" {
+		workerAllocator, err = eventsource.NewWorkerAllocator(cronLogger, configuration, runtimeConfiguration, workerPools)
+	} else {
+		workerAllocator, err = worker.WorkerFactorySingleton.CreateSingletonPoolWorkerAllocator(cronLogger,
+			runtimeConfiguration)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	cronEventSource, err := newEventSource(cronLogger, workerAllocator, cronConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create cron event source")
+	}
+
+	return cronEventSource, nil
+}
+
+// creates a schedule from either a cron expression or a fixed interval
+func (f *factory) createSchedule(eventSourceConfiguration *viper.Viper) (Schedule, error) {
+	expression := eventSourceConfiguration.GetString("schedule")
+	interval := eventSourceConfiguration.GetString("interval")
+
+	if (expression == "") == (interval == "") {
+		return nil, errors.New("Exactly one of schedule and interval must be set")
+	}
+
+	if interval != "" {
+		parsedInterval, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid interval: %s", interval)
+		}
+
+		return NewIntervalSchedule(parsedInterval)
+	}
+
+	location, err := time.LoadLocation(eventSourceConfiguration.GetString("timezone"))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load timezone")
+	}
+
+	return NewCronSchedule(expression, location)
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("cron", &factory{})
+}
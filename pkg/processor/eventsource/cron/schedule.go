@@ -0,0 +1,281 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// returns the times at which a cron event source fires
+type Schedule interface {
+
+	// returns the first time the schedule fires after a given time
+	Next(after time.Time) time.Time
+}
+
+//
+// Interval schedule
+// Fires at a fixed interval
+//
+
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+func NewIntervalSchedule(interval time.Duration) (Schedule, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("Interval must be positive: %s", interval)
+	}
+
+	return &intervalSchedule{
+		interval: interval,
+	}, nil
+}
+
+func (is *intervalSchedule) Next(after time.Time) time.Time {
+	return after.Add(is.interval)
+}
+
+//
+// Cron schedule
+// Fires on standard cron expressions (minute hour day-of-month month day-of-week)
+//
+
+// the range of values of each field and the names it accepts, if any
+type field struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	minuteField     = field{"minute", 0, 59, nil}
+	hourField       = field{"hour", 0, 23, nil}
+	dayOfMonthField = field{"day of month", 1, 31, nil}
+	monthField      = field{"month", 1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+
+	// 7 is sunday as well, and is folded into 0
+	dayOfWeekField = field{"day of week", 0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// expressions that stand for common schedules
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronSchedule struct {
+	location *time.Location
+
+	// the values each field matches. a value matches if its bit is set
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+
+	// when both day fields are restricted, a day matching either one matches (as in standard cron)
+	daysOfMonthRestricted bool
+	daysOfWeekRestricted  bool
+}
+
+// parses a cron expression or descriptor (e.g. @daily, @every 5m), evaluated in the given location
+func NewCronSchedule(expression string, location *time.Location) (Schedule, error) {
+	var err error
+
+	expression = strings.TrimSpace(expression)
+
+	// @every <duration> is an interval
+	if strings.HasPrefix(expression, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(expression, "@every ")))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid interval in %s", expression)
+		}
+
+		return NewIntervalSchedule(interval)
+	}
+
+	if descriptorExpression, found := descriptors[expression]; found {
+		expression = descriptorExpression
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Expected 5 fields in cron expression, got %d: %s", len(fields), expression)
+	}
+
+	newCronSchedule := cronSchedule{
+		location:              location,
+		daysOfMonthRestricted: fields[2] != "*",
+		daysOfWeekRestricted:  fields[4] != "*",
+	}
+
+	for fieldIndex, fieldBits := range []struct {
+		field field
+		bits  *uint64
+	}{
+		{minuteField, &newCronSchedule.minutes},
+		{hourField, &newCronSchedule.hours},
+		{dayOfMonthField, &newCronSchedule.daysOfMonth},
+		{monthField, &newCronSchedule.months},
+		{dayOfWeekField, &newCronSchedule.daysOfWeek},
+	} {
+		*fieldBits.bits, err = parseField(fields[fieldIndex], fieldBits.field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid %s in %s", fieldBits.field.name, expression)
+		}
+	}
+
+	// fold sunday as 7 into sunday as 0
+	if newCronSchedule.daysOfWeek&(1<<7) != 0 {
+		newCronSchedule.daysOfWeek |= 1
+	}
+
+	return &newCronSchedule, nil
+}
+
+func (cs *cronSchedule) Next(after time.Time) time.Time {
+
+	// start at the minute following the given time, in the schedule's location
+	next := after.In(cs.location).Truncate(time.Minute).Add(time.Minute)
+
+	// expressions that never match (e.g. 30th of february) must not loop forever
+	limit := next.AddDate(5, 0, 0)
+
+	for next.Before(limit) {
+		if !cs.matches(cs.months, int(next.Month())) {
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, cs.location)
+			continue
+		}
+
+		if !cs.matchesDay(next) {
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, cs.location)
+			continue
+		}
+
+		if !cs.matches(cs.hours, next.Hour()) {
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, cs.location)
+			continue
+		}
+
+		if !cs.matches(cs.minutes, next.Minute()) {
+			next = next.Add(time.Minute)
+			continue
+		}
+
+		return next
+	}
+
+	return time.Time{}
+}
+
+func (cs *cronSchedule) matches(bits uint64, value int) bool {
+	return bits&(1<<uint(value)) != 0
+}
+
+func (cs *cronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonthMatches := cs.matches(cs.daysOfMonth, t.Day())
+	dayOfWeekMatches := cs.matches(cs.daysOfWeek, int(t.Weekday()))
+
+	if cs.daysOfMonthRestricted && cs.daysOfWeekRestricted {
+		return dayOfMonthMatches || dayOfWeekMatches
+	}
+
+	return dayOfMonthMatches && dayOfWeekMatches
+}
+
+// parses a comma separated list of values, ranges (a-b) and steps (*/n, a-b/n, a/n) into a bit per value
+func parseField(expression string, field field) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(expression, ",") {
+		step := 1
+		rangeExpression := part
+
+		if slashIndex := strings.Index(part, "/"); slashIndex != -1 {
+			var err error
+
+			rangeExpression = part[:slashIndex]
+
+			step, err = strconv.Atoi(part[slashIndex+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("Invalid step: %s", part)
+			}
+		}
+
+		start, end, err := parseRange(rangeExpression, field)
+		if err != nil {
+			return 0, err
+		}
+
+		// a/n means a through max, every n
+		if step != 1 && !strings.Contains(rangeExpression, "-") && rangeExpression != "*" {
+			end = field.max
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseRange(expression string, field field) (int, int, error) {
+	if expression == "*" {
+		return field.min, field.max, nil
+	}
+
+	bounds := strings.SplitN(expression, "-", 2)
+
+	start, err := parseValue(bounds[0], field)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(bounds) == 1 {
+		return start, start, nil
+	}
+
+	end, err := parseValue(bounds[1], field)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if end < start {
+		return 0, 0, fmt.Errorf("Invalid range: %s", expression)
+	}
+
+	return start, end, nil
+}
+
+func parseValue(expression string, field field) (int, error) {
+	if value, found := field.names[strings.ToLower(expression)]; found {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(expression)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value: %s", expression)
+	}
+
+	if value < field.min || value > field.max {
+		return 0, fmt.Errorf("Value %d out of range %d-%d", value, field.min, field.max)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,84 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ScheduleTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ScheduleTestSuite) TestCronSchedule() {
+	for _, testCase := range []struct {
+		expression string
+		after      string
+		next       string
+	}{
+		{"* * * * *", "2017-03-10T10:15:30Z", "2017-03-10T10:16:00Z"},
+		{"*/15 * * * *", "2017-03-10T10:15:00Z", "2017-03-10T10:30:00Z"},
+		{"0 3 * * *", "2017-03-10T10:15:00Z", "2017-03-11T03:00:00Z"},
+		{"30 8-10/2 * * *", "2017-03-10T08:31:00Z", "2017-03-10T10:30:00Z"},
+		{"0 0 1,15 * *", "2017-03-02T00:00:00Z", "2017-03-15T00:00:00Z"},
+		{"0 0 * feb mon", "2017-03-10T00:00:00Z", "2018-02-05T00:00:00Z"},
+		{"0 0 * * 7", "2017-03-10T00:00:00Z", "2017-03-12T00:00:00Z"},
+		{"5/20 * * * *", "2017-03-10T10:26:00Z", "2017-03-10T10:45:00Z"},
+
+		// either day field matches when both are restricted
+		{"0 0 13 * fri", "2017-03-10T00:00:00Z", "2017-03-13T00:00:00Z"},
+		{"@daily", "2017-12-31T23:59:00Z", "2018-01-01T00:00:00Z"},
+		{"@hourly", "2017-03-10T10:15:00Z", "2017-03-10T11:00:00Z"},
+		{"@every 90s", "2017-03-10T10:15:00Z", "2017-03-10T10:16:30Z"},
+
+		// never matches
+		{"0 0 30 2 *", "2017-03-10T00:00:00Z", "0001-01-01T00:00:00Z"},
+	} {
+		schedule, err := NewCronSchedule(testCase.expression, time.UTC)
+		suite.Require().NoError(err, testCase.expression)
+
+		suite.Equal(suite.parseTime(testCase.next),
+			schedule.Next(suite.parseTime(testCase.after)).In(time.UTC),
+			testCase.expression)
+	}
+}
+
+func (suite *ScheduleTestSuite) TestTimezone() {
+	location, err := time.LoadLocation("America/New_York")
+	suite.Require().NoError(err)
+
+	schedule, err := NewCronSchedule("0 9 * * *", location)
+	suite.Require().NoError(err)
+
+	// 9am in new york is 14:00 UTC during standard time
+	suite.Equal(suite.parseTime("2017-01-10T14:00:00Z"), schedule.Next(suite.parseTime("2017-01-10T12:00:00Z")).In(time.UTC))
+}
+
+func (suite *ScheduleTestSuite) TestInvalidExpressions() {
+	for _, expression := range []string{
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"@every forever",
+	} {
+		_, err := NewCronSchedule(expression, time.UTC)
+		suite.Error(err, expression)
+	}
+}
+
+func (suite *ScheduleTestSuite) parseTime(value string) time.Time {
+	parsedTime, err := time.Parse(time.RFC3339, value)
+	suite.Require().NoError(err)
+
+	return parsedTime
+}
+
+func TestScheduleTestSuite(t *testing.T) {
+	suite.Run(t, new(ScheduleTestSuite))
+}
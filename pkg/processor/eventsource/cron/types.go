@@ -0,0 +1,49 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+)
+
+// what to do with a tick that occurs while the previous one is still being handled
+const (
+	ConcurrencyPolicySkip  = "skip"
+	ConcurrencyPolicyQueue = "queue"
+)
+
+// what to do with ticks that were missed while the processor was down
+const (
+	MissedTicksSkip     = "skip"
+	MissedTicksFireOnce = "fire_once"
+	MissedTicksFireAll  = "fire_all"
+)
+
+type Configuration struct {
+	eventsource.Configuration
+	Schedule          Schedule
+	ConcurrencyPolicy string
+	MaxQueuedTicks    int
+	MissedTicks       string
+	MaxMissedTicks    int
+
+	// the event sent on every tick
+	EventBody        []byte
+	EventContentType string
+	EventHeaders     map[string]interface{}
+}
+
+// the checkpoint of a cron event source is the time of the last tick it handled
+func encodeCheckpoint(tick time.Time) eventsource.Checkpoint {
+	encodedTick := tick.Format(time.RFC3339Nano)
+
+	return &encodedTick
+}
+
+func decodeCheckpoint(checkpoint eventsource.Checkpoint) (time.Time, error) {
+	if checkpoint == nil || *checkpoint == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339Nano, *checkpoint)
+}
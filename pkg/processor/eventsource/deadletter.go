@@ -0,0 +1,182 @@
+package eventsource
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+
+	"github.com/pkg/errors"
+)
+
+// an event that could not be processed, along with why
+type DeadLetter struct {
+	EventSourceID   string                 `json:"event_source_id"`
+	EventSourceKind string                 `json:"event_source_kind"`
+	EventID         string                 `json:"event_id,omitempty"`
+	ContentType     string                 `json:"content_type,omitempty"`
+	Headers         map[string]interface{} `json:"headers,omitempty"`
+	Body            []byte                 `json:"body"`
+	Error           string                 `json:"error"`
+	Attempts        int                    `json:"attempts"`
+	Timestamp       time.Time              `json:"timestamp"`
+}
+
+func NewDeadLetter(eventSourceID string,
+	eventSourceKind string,
+	event nuclio.Event,
+	processError error,
+	attempts int) *DeadLetter {
+
+	deadLetter := DeadLetter{
+		EventSourceID:   eventSourceID,
+		EventSourceKind: eventSourceKind,
+		ContentType:     event.GetContentType(),
+		Headers:         event.GetHeaders(),
+		Body:            event.GetBody(),
+		Error:           processError.Error(),
+		Attempts:        attempts,
+		Timestamp:       time.Now(),
+	}
+
+	if event.GetID() != nil {
+		deadLetter.EventID = fmt.Sprintf("%s", *event.GetID())
+	}
+
+	return &deadLetter
+}
+
+// receives events that failed processing after all retries
+type DeadLetterSink interface {
+	Write(deadLetter *DeadLetter) error
+
+	// release the resources held by the sink (e.g. a file). called once the event sources are stopped
+	Close() error
+}
+
+// event sources that can publish to the system they consume from (e.g. a message broker) implement this,
+// allowing them to serve as another event source's dead letter sink
+type Publisher interface {
+	Publish(body []byte, contentType string) error
+}
+
+//
+// Dead letter sink registry
+// Sinks are keyed by the scheme of the URL that declares them (e.g. file:///var/log/nuclio/dlq)
+//
+
+type DeadLetterSinkCreator interface {
+	Create(logger nuclio.Logger, sinkURL *url.URL) (DeadLetterSink, error)
+}
+
+type DeadLetterSinkRegistry struct {
+	registry.Registry
+}
+
+// global singleton
+var DeadLetterSinkRegistrySingleton = DeadLetterSinkRegistry{
+	Registry: *registry.NewRegistry("dead_letter_sink"),
+}
+
+func (r *DeadLetterSinkRegistry) NewDeadLetterSink(logger nuclio.Logger, sinkURL *url.URL) (DeadLetterSink, error) {
+	registree, err := r.Get(sinkURL.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(DeadLetterSinkCreator).Create(logger, sinkURL)
+}
+
+//
+// Publisher sink
+// Publishes dead letters as JSON through another event source
+//
+
+type publisherDeadLetterSink struct {
+	publisher Publisher
+}
+
+func NewPublisherDeadLetterSink(publisher Publisher) DeadLetterSink {
+	return &publisherDeadLetterSink{
+		publisher: publisher,
+	}
+}
+
+func (pdls *publisherDeadLetterSink) Write(deadLetter *DeadLetter) error {
+	encodedDeadLetter, err := json.Marshal(deadLetter)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode dead letter")
+	}
+
+	return pdls.publisher.Publish(encodedDeadLetter, "application/json")
+}
+
+// the publisher is an event source, which is stopped on its own
+func (pdls *publisherDeadLetterSink) Close() error {
+	return nil
+}
+
+//
+// File sink
+// Appends dead letters to a local file, one JSON document per line
+//
+
+type fileDeadLetterSink struct {
+	logger nuclio.Logger
+	lock   sync.Mutex
+	file   *os.File
+}
+
+type fileDeadLetterSinkFactory struct{}
+
+func (f *fileDeadLetterSinkFactory) Create(parentLogger nuclio.Logger, sinkURL *url.URL) (DeadLetterSink, error) {
+	if sinkURL.Path == "" {
+		return nil, fmt.Errorf("File dead letter sink requires a path: %s", sinkURL.String())
+	}
+
+	if err := os.MkdirAll(filepath.Dir(sinkURL.Path), 0755); err != nil {
+		return nil, errors.Wrap(err, "Failed to create dead letter directory")
+	}
+
+	file, err := os.OpenFile(sinkURL.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s", sinkURL.Path)
+	}
+
+	return &fileDeadLetterSink{
+		logger: parentLogger.GetChild("file_dlq").(nuclio.Logger),
+		file:   file,
+	}, nil
+}
+
+func (fdls *fileDeadLetterSink) Write(deadLetter *DeadLetter) error {
+	encodedDeadLetter, err := json.Marshal(deadLetter)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode dead letter")
+	}
+
+	fdls.lock.Lock()
+	defer fdls.lock.Unlock()
+
+	_, err = fdls.file.Write(append(encodedDeadLetter, '\n'))
+
+	return err
+}
+
+func (fdls *fileDeadLetterSink) Close() error {
+	fdls.lock.Lock()
+	defer fdls.lock.Unlock()
+
+	return fdls.file.Close()
+}
+
+// register builtin sinks
+func init() {
+	DeadLetterSinkRegistrySingleton.Register("file", &fileDeadLetterSinkFactory{})
+}
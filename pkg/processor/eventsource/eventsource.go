@@ -1,7 +1,9 @@
 package eventsource
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	nuclio "github.com/nuclio/nuclio-sdk"
@@ -25,6 +27,71 @@ type EventSource interface {
 
 	// get specific kind of source (http, rabbit mq, etc)
 	GetKind() string
+
+	// get the ID of the source, as declared in configuration
+	GetID() string
+
+	// set where events that failed processing after all retries are written to
+	SetDeadLetterSink(deadLetterSink DeadLetterSink)
+
+	// set where the responses of successfully processed events are written to
+	SetOutputSink(outputSink OutputSink)
+
+	// set where checkpoints taken while running are saved to
+	SetCheckpointSink(checkpointSink CheckpointSink)
+
+	// get the allocator of the workers that process the source's events
+	GetWorkerAllocator() worker.WorkerAllocator
+
+	// get event handling statistics
+	GetStatistics() *Statistics
+
+	// get the number of events currently submitted to workers
+	GetNumInflightEvents() int
+
+	// stop handing events to workers until resumed
+	Pause() error
+
+	// resume handing events to workers
+	Resume() error
+
+	// true if paused
+	IsPaused() bool
+}
+
+// the state of an event source's connection to the system it consumes from
+type ConnectionState string
+
+const (
+	ConnectionStateConnecting   ConnectionState = "connecting"
+	ConnectionStateConnected    ConnectionState = "connected"
+	ConnectionStateDisconnected ConnectionState = "disconnected"
+)
+
+// implemented by event sources that hold a connection (e.g. to a broker), so that its state can be reported
+type ConnectionStateProvider interface {
+	GetConnectionState() ConnectionState
+}
+
+// receives the responses of events that were processed successfully (e.g. to deliver them downstream).
+// called before the event is acknowledged or responded to, so it must not block on delivery
+type OutputSink interface {
+	Write(eventSourceID string, event nuclio.Event, response interface{}) error
+}
+
+// saves the checkpoints of event sources that advance while running (e.g. as events are handled), so that
+// a crash doesn't lose what was handled since they started. the checkpoint returned when stopped is saved
+// regardless
+type CheckpointSink interface {
+	Set(eventSourceID string, checkpoint Checkpoint) error
+}
+
+// fields are updated atomically and must be read with atomic.LoadUint64
+type Statistics struct {
+	EventsHandledSuccess uint64
+	EventsHandledFailure uint64
+	EventsRetried        uint64
+	EventsDeadLettered   uint64
 }
 
 type AbstractEventSource struct {
@@ -32,6 +99,90 @@ type AbstractEventSource struct {
 	WorkerAllocator worker.WorkerAllocator
 	Class           string
 	Kind            string
+	ID              string
+
+	// failed events are retried according to this policy (nil - no retries)
+	RetryPolicy *RetryPolicy
+
+	// how long a worker may take to process an event, per attempt (0 - no deadline). events that time out
+	// fail with worker.ErrEventTimeout
+	EventTimeout time.Duration
+
+	// number of events currently submitted to workers. accessed atomically
+	inflightEvents int64
+
+	// non zero while paused. accessed atomically
+	paused int32
+
+	deadLetterSink DeadLetterSink
+	outputSink     OutputSink
+	checkpointSink CheckpointSink
+	statistics     Statistics
+}
+
+func (aes *AbstractEventSource) GetWorkerAllocator() worker.WorkerAllocator {
+	return aes.WorkerAllocator
+}
+
+func (aes *AbstractEventSource) GetStatistics() *Statistics {
+	return &aes.statistics
+}
+
+func (aes *AbstractEventSource) GetNumInflightEvents() int {
+	return int(atomic.LoadInt64(&aes.inflightEvents))
+}
+
+// events submitted while paused wait until the event source is resumed. event sources that can't hold
+// events (e.g. http) should check IsPaused and reject events instead
+func (aes *AbstractEventSource) Pause() error {
+	atomic.StoreInt32(&aes.paused, 1)
+
+	aes.Logger.InfoWith("Paused")
+
+	return nil
+}
+
+func (aes *AbstractEventSource) Resume() error {
+	atomic.StoreInt32(&aes.paused, 0)
+
+	aes.Logger.InfoWith("Resumed")
+
+	return nil
+}
+
+func (aes *AbstractEventSource) IsPaused() bool {
+	return atomic.LoadInt32(&aes.paused) != 0
+}
+
+func (aes *AbstractEventSource) SetDeadLetterSink(deadLetterSink DeadLetterSink) {
+	aes.deadLetterSink = deadLetterSink
+}
+
+func (aes *AbstractEventSource) SetOutputSink(outputSink OutputSink) {
+	aes.outputSink = outputSink
+}
+
+func (aes *AbstractEventSource) SetCheckpointSink(checkpointSink CheckpointSink) {
+	aes.checkpointSink = checkpointSink
+}
+
+// saves a checkpoint taken while running, if checkpoints are kept
+func (aes *AbstractEventSource) SaveCheckpoint(checkpoint Checkpoint) error {
+	if aes.checkpointSink == nil {
+		return nil
+	}
+
+	return aes.checkpointSink.Set(aes.ID, checkpoint)
+}
+
+// event sources that can't skip failed events (e.g. ones that commit an offset) use this to know whether
+// failed events are kept elsewhere
+func (aes *AbstractEventSource) HasDeadLetterSink() bool {
+	return aes.deadLetterSink != nil
+}
+
+func (aes *AbstractEventSource) GetID() string {
+	return aes.ID
 }
 
 func (aes *AbstractEventSource) GetClass() string {
@@ -42,14 +193,147 @@ func (aes *AbstractEventSource) GetKind() string {
 	return aes.Kind
 }
 
+// submits an event to a worker, retrying according to the retry policy. if processing fails on the last attempt,
+// the event is written to the dead letter sink. submit errors (e.g. no worker available) are retried but aren't
+// dead lettered, since they say nothing about the event itself
 func (aes *AbstractEventSource) SubmitEventToWorker(event nuclio.Event,
 	timeout time.Duration) (response interface{}, submitError error, processError error) {
 
+	// track the event so that stop can wait for it to complete, including retries
+	atomic.AddInt64(&aes.inflightEvents, 1)
+	defer atomic.AddInt64(&aes.inflightEvents, -1)
+
+	aes.waitWhilePaused()
+
+	for attempt := 1; ; attempt++ {
+		response, submitError, processError = aes.submitEventToWorker(event, timeout, attempt)
+
+		// if successful or out of retries, we're done
+		if (submitError == nil && processError == nil) || !aes.shouldRetry(attempt) {
+			aes.updateStatistics(submitError == nil && processError == nil)
+
+			if processError != nil {
+				aes.writeDeadLetter(event, processError, attempt)
+			} else if submitError == nil {
+				aes.writeOutput(event, response)
+			}
+
+			return
+		}
+
+		atomic.AddUint64(&aes.statistics.EventsRetried, 1)
+
+		aes.Logger.DebugWith("Retrying event",
+			"attempt", attempt,
+			"submitError", submitError,
+			"processError", processError)
+
+		time.Sleep(aes.RetryPolicy.GetBackoff(attempt))
+	}
+}
+
+// submits events to a single worker, retrying the events that failed according to the retry policy. events
+// which fail processing on the last attempt are written to the dead letter sink
+func (aes *AbstractEventSource) SubmitEventsToWorker(events []nuclio.Event,
+	timeout time.Duration) (responses []interface{}, submitError error, processErrors []error) {
+
+	// track the events so that stop can wait for them to complete, including retries
+	atomic.AddInt64(&aes.inflightEvents, int64(len(events)))
+	defer atomic.AddInt64(&aes.inflightEvents, -int64(len(events)))
+
+	aes.waitWhilePaused()
+
+	// the indices of the events in the current attempt
+	var pendingEventIndices []int
+	for eventIndex := range events {
+		pendingEventIndices = append(pendingEventIndices, eventIndex)
+	}
+
+	for attempt := 1; ; attempt++ {
+		pendingEvents := make([]nuclio.Event, 0, len(pendingEventIndices))
+		for _, eventIndex := range pendingEventIndices {
+			pendingEvents = append(pendingEvents, events[eventIndex])
+		}
+
+		attemptResponses, attemptSubmitError, attemptProcessErrors := aes.submitEventsToWorker(pendingEvents,
+			timeout,
+			attempt)
+
+		// a submit error fails the entire attempt
+		if attemptSubmitError != nil {
+			if aes.shouldRetry(attempt) {
+				atomic.AddUint64(&aes.statistics.EventsRetried, uint64(len(pendingEvents)))
+				time.Sleep(aes.RetryPolicy.GetBackoff(attempt))
+				continue
+			}
+
+			// if nothing was processed yet, the entire batch failed
+			if responses == nil {
+				atomic.AddUint64(&aes.statistics.EventsHandledFailure, uint64(len(events)))
+
+				return nil, attemptSubmitError, nil
+			}
+
+			// events processed in earlier attempts keep their results. only the events being retried fail
+			attemptResponses = make([]interface{}, len(pendingEvents))
+			attemptProcessErrors = make([]error, len(pendingEvents))
+
+			for pendingIndex := range attemptProcessErrors {
+				attemptProcessErrors[pendingIndex] = attemptSubmitError
+			}
+		}
+
+		// first attempt populates the results, subsequent attempts update the events that were retried
+		if responses == nil {
+			responses = attemptResponses
+			processErrors = attemptProcessErrors
+		} else {
+			for pendingIndex, eventIndex := range pendingEventIndices {
+				responses[eventIndex] = attemptResponses[pendingIndex]
+				processErrors[eventIndex] = attemptProcessErrors[pendingIndex]
+			}
+		}
+
+		// gather the events that failed in this attempt
+		var failedEventIndices []int
+		for _, eventIndex := range pendingEventIndices {
+			if processErrors[eventIndex] != nil {
+				failedEventIndices = append(failedEventIndices, eventIndex)
+			}
+		}
+
+		if len(failedEventIndices) == 0 || !aes.shouldRetry(attempt) {
+			atomic.AddUint64(&aes.statistics.EventsHandledSuccess, uint64(len(events)-len(failedEventIndices)))
+			atomic.AddUint64(&aes.statistics.EventsHandledFailure, uint64(len(failedEventIndices)))
+
+			for _, eventIndex := range failedEventIndices {
+				aes.writeDeadLetter(events[eventIndex], processErrors[eventIndex], attempt)
+			}
+
+			for eventIndex, event := range events {
+				if processErrors[eventIndex] == nil {
+					aes.writeOutput(event, responses[eventIndex])
+				}
+			}
+
+			return
+		}
+
+		atomic.AddUint64(&aes.statistics.EventsRetried, uint64(len(failedEventIndices)))
+		time.Sleep(aes.RetryPolicy.GetBackoff(attempt))
+		pendingEventIndices = failedEventIndices
+	}
+}
+
+func (aes *AbstractEventSource) submitEventToWorker(event nuclio.Event,
+	timeout time.Duration,
+	attempt int) (response interface{}, submitError error, processError error) {
+
 	defer func() {
 		if err := recover(); err != nil {
-			aes.Logger.ErrorWith("error during event handlers", "err", err)
+			aes.Logger.ErrorWith("error submitting event", "err", err)
 			response = nil
-			submitError = fmt.Errorf("error during event handler - %s", err)
+			submitError = fmt.Errorf("error submitting event - %s", err)
 			processError = nil
 		}
 	}()
@@ -66,23 +350,28 @@ func (aes *AbstractEventSource) SubmitEventToWorker(event nuclio.Event,
 	// release worker when we're done
 	defer aes.WorkerAllocator.Release(workerInstance)
 
-	response, err = workerInstance.ProcessEvent(event)
+	if attempt > 1 {
+		workerInstance.CountRetries(1)
+	}
+
+	response, err = aes.processEvent(workerInstance, event)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to process event"), nil
+		return nil, nil, errors.Wrap(err, "Failed to process event")
 	}
 
 	return response, nil, nil
 }
 
-func (aes *AbstractEventSource) SubmitEventsToWorker(events []nuclio.Event,
-	timeout time.Duration) (res []interface{}, err error, errs []error) {
+func (aes *AbstractEventSource) submitEventsToWorker(events []nuclio.Event,
+	timeout time.Duration,
+	attempt int) (res []interface{}, err error, errs []error) {
 
 	defer func() {
-		if err := recover(); err != nil {
-			aes.Logger.ErrorWith("error handling events", "err", err)
+		if recoveredErr := recover(); recoveredErr != nil {
+			aes.Logger.ErrorWith("error submitting events", "err", recoveredErr)
 
 			res = nil
-			err = fmt.Errorf("error handdling event - %s", err)
+			err = fmt.Errorf("error submitting events - %s", recoveredErr)
 			errs = nil
 		}
 	}()
@@ -105,10 +394,13 @@ func (aes *AbstractEventSource) SubmitEventsToWorker(events []nuclio.Event,
 	// release worker when we're done
 	defer aes.WorkerAllocator.Release(workerInstance)
 
+	if attempt > 1 {
+		workerInstance.CountRetries(len(events))
+	}
+
 	// iterate over events and process them at the worker
 	for _, event := range events {
-
-		response, err := workerInstance.ProcessEvent(event)
+		response, err := aes.processEvent(workerInstance, event)
 
 		// add response and error
 		eventResponses = append(eventResponses, response)
@@ -117,3 +409,87 @@ func (aes *AbstractEventSource) SubmitEventsToWorker(events []nuclio.Event,
 
 	return eventResponses, nil, eventErrors
 }
+
+// a handler that panics fails the event like one returning an error, so that the event is retried and dead
+// lettered rather than reported as not submitted (which broker-backed sources requeue indefinitely)
+func (aes *AbstractEventSource) processEvent(workerInstance *worker.Worker,
+	event nuclio.Event) (response interface{}, err error) {
+
+	ctx, cancel := aes.createEventContext()
+	defer cancel()
+
+	defer func() {
+		if recoveredErr := recover(); recoveredErr != nil {
+			aes.Logger.ErrorWith("Event handler panicked", "err", recoveredErr)
+
+			response = nil
+			err = fmt.Errorf("Event handler panicked: %v", recoveredErr)
+		}
+	}()
+
+	return workerInstance.ProcessEvent(ctx, event)
+}
+
+// each event gets its own deadline, starting once it's handed to a worker
+func (aes *AbstractEventSource) createEventContext() (context.Context, context.CancelFunc) {
+	if aes.EventTimeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+
+	return context.WithTimeout(context.Background(), aes.EventTimeout)
+}
+
+func (aes *AbstractEventSource) updateStatistics(success bool) {
+	if success {
+		atomic.AddUint64(&aes.statistics.EventsHandledSuccess, 1)
+	} else {
+		atomic.AddUint64(&aes.statistics.EventsHandledFailure, 1)
+	}
+}
+
+func (aes *AbstractEventSource) shouldRetry(attempt int) bool {
+	return aes.RetryPolicy != nil && attempt <= aes.RetryPolicy.MaxRetries
+}
+
+func (aes *AbstractEventSource) writeDeadLetter(event nuclio.Event, processError error, attempts int) {
+	if aes.deadLetterSink == nil {
+		return
+	}
+
+	deadLetter := NewDeadLetter(aes.ID, aes.Kind, event, processError, attempts)
+
+	if err := aes.deadLetterSink.Write(deadLetter); err != nil {
+		aes.Logger.WarnWith("Failed to write dead letter", "err", err, "processError", processError)
+		return
+	}
+
+	atomic.AddUint64(&aes.statistics.EventsDeadLettered, 1)
+
+	aes.Logger.DebugWith("Wrote dead letter", "attempts", attempts, "processError", processError)
+}
+
+func (aes *AbstractEventSource) waitWhilePaused() {
+	for aes.IsPaused() {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// a failure to write the response doesn't fail the event, since it was already processed. outputs retry
+// and count failed writes themselves
+func (aes *AbstractEventSource) writeOutput(event nuclio.Event, response interface{}) {
+	if aes.outputSink == nil || response == nil {
+		return
+	}
+
+	if err := aes.outputSink.Write(aes.ID, event, response); err != nil {
+		aes.Logger.WarnWith("Failed to write response to outputs", "err", err)
+	}
+}
+
+// blocks until all events submitted to workers have been processed. event sources call this from Stop
+// after they stop producing new events, unless asked to stop forcefully
+func (aes *AbstractEventSource) WaitForInflightEvents() {
+	for atomic.LoadInt64(&aes.inflightEvents) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
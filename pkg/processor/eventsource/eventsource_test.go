@@ -0,0 +1,385 @@
+package eventsource
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockRuntime struct {
+	mock.Mock
+
+	// the context of the last event processed
+	lastContext context.Context
+}
+
+func (mr *MockRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	mr.lastContext = ctx
+
+	args := mr.Called(event)
+	return args.Get(0), args.Error(1)
+}
+
+type MockDeadLetterSink struct {
+	mock.Mock
+}
+
+func (mdls *MockDeadLetterSink) Write(deadLetter *DeadLetter) error {
+	args := mdls.Called(deadLetter)
+	return args.Error(0)
+}
+
+func (mdls *MockDeadLetterSink) Close() error {
+	return nil
+}
+
+// fails the allocations after the first numAllocations
+type limitedAllocator struct {
+	worker.WorkerAllocator
+	numAllocations int
+}
+
+func (la *limitedAllocator) Allocate(timeout time.Duration) (*worker.Worker, error) {
+	if la.numAllocations == 0 {
+		return nil, errors.New("No more allocations")
+	}
+
+	la.numAllocations--
+
+	return la.WorkerAllocator.Allocate(timeout)
+}
+
+type EventSourceTestSuite struct {
+	suite.Suite
+	logger          nuclio.Logger
+	mockRuntime     *MockRuntime
+	mockSink        *MockDeadLetterSink
+	eventSource     *AbstractEventSource
+	processingError error
+}
+
+func (suite *EventSourceTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.processingError = errors.New("Processing error")
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	suite.mockRuntime = &MockRuntime{}
+	suite.mockSink = &MockDeadLetterSink{}
+
+	workerAllocator, err := worker.NewFixedPoolWorkerAllocator(suite.logger, []*worker.Worker{
+		worker.NewWorker(suite.logger, 0, suite.mockRuntime),
+	})
+
+	suite.Require().NoError(err)
+
+	suite.eventSource = &AbstractEventSource{
+		Logger:          suite.logger,
+		WorkerAllocator: workerAllocator,
+		Class:           "async",
+		Kind:            "test",
+		ID:              "test1",
+		RetryPolicy: &RetryPolicy{
+			MaxRetries: 2,
+			Backoff:    time.Millisecond,
+			MaxBackoff: 2 * time.Millisecond,
+		},
+	}
+
+	suite.eventSource.SetDeadLetterSink(suite.mockSink)
+}
+
+func (suite *EventSourceTestSuite) TestRetrySucceeds() {
+	event := &nuclio.AbstractSync{}
+
+	// fail twice, then succeed
+	suite.mockRuntime.On("ProcessEvent", event).Return(nil, suite.processingError).Twice()
+	suite.mockRuntime.On("ProcessEvent", event).Return("response", nil).Once()
+
+	response, submitError, processError := suite.eventSource.SubmitEventToWorker(event, time.Second)
+	suite.NoError(submitError)
+	suite.NoError(processError)
+	suite.Equal("response", response)
+
+	// the worker counts the attempts after the first
+	suite.Equal(uint64(2), suite.getNumRetries())
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+	suite.mockSink.AssertNotCalled(suite.T(), "Write", mock.Anything)
+}
+
+func (suite *EventSourceTestSuite) TestRetryExhaustedWritesDeadLetter() {
+	event := &nuclio.AbstractSync{}
+
+	// fail on all 3 attempts (1 + 2 retries)
+	suite.mockRuntime.On("ProcessEvent", event).Return(nil, suite.processingError).Times(3)
+	suite.mockSink.On("Write", mock.MatchedBy(func(deadLetter *DeadLetter) bool {
+		return deadLetter.Attempts == 3 &&
+			deadLetter.EventSourceID == "test1" &&
+			deadLetter.EventSourceKind == "test" &&
+			deadLetter.EventID != ""
+	})).Return(nil).Once()
+
+	_, submitError, processError := suite.eventSource.SubmitEventToWorker(event, time.Second)
+	suite.NoError(submitError)
+	suite.Error(processError)
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+	suite.mockSink.AssertExpectations(suite.T())
+}
+
+func (suite *EventSourceTestSuite) TestEventTimeout() {
+	event := &nuclio.AbstractSync{}
+
+	suite.mockRuntime.On("ProcessEvent", event).Return("response", nil).Twice()
+
+	// without a timeout, events have no deadline
+	suite.eventSource.SubmitEventToWorker(event, time.Second)
+
+	_, hasDeadline := suite.mockRuntime.lastContext.Deadline()
+	suite.False(hasDeadline)
+
+	suite.eventSource.EventTimeout = time.Minute
+	submitTime := time.Now()
+
+	suite.eventSource.SubmitEventToWorker(event, time.Second)
+
+	deadline, hasDeadline := suite.mockRuntime.lastContext.Deadline()
+	suite.True(hasDeadline)
+	suite.WithinDuration(submitTime.Add(time.Minute), deadline, time.Second)
+
+	// the context is done once the event is processed
+	suite.Error(suite.mockRuntime.lastContext.Err())
+}
+
+func (suite *EventSourceTestSuite) TestBatchRetriesOnlyFailedEvents() {
+	succeedingEvent := &nuclio.AbstractSync{}
+	failingEvent := &nuclio.AbstractSync{}
+
+	// the succeeding event is processed once, the failing one on every attempt
+	suite.mockRuntime.On("ProcessEvent", succeedingEvent).Return("ok", nil).Once()
+	suite.mockRuntime.On("ProcessEvent", failingEvent).Return(nil, suite.processingError).Times(3)
+	suite.mockSink.On("Write", mock.Anything).Return(nil).Once()
+
+	responses, submitError, processErrors := suite.eventSource.SubmitEventsToWorker([]nuclio.Event{
+		succeedingEvent,
+		failingEvent,
+	}, time.Second)
+
+	suite.NoError(submitError)
+	suite.Equal("ok", responses[0])
+	suite.NoError(processErrors[0])
+	suite.Error(processErrors[1])
+
+	// only the failing event was retried
+	suite.Equal(uint64(2), suite.getNumRetries())
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+	suite.mockSink.AssertExpectations(suite.T())
+}
+
+func (suite *EventSourceTestSuite) TestBatchRetrySubmitErrorKeepsProcessedEvents() {
+	succeedingEvent := &nuclio.AbstractSync{}
+	failingEvent := &nuclio.AbstractSync{}
+
+	// the retries of the failing event can't be submitted
+	suite.eventSource.WorkerAllocator = &limitedAllocator{
+		WorkerAllocator: suite.eventSource.WorkerAllocator,
+		numAllocations:  1,
+	}
+
+	suite.mockRuntime.On("ProcessEvent", succeedingEvent).Return("ok", nil).Once()
+	suite.mockRuntime.On("ProcessEvent", failingEvent).Return(nil, suite.processingError).Once()
+	suite.mockSink.On("Write", mock.Anything).Return(nil).Once()
+
+	responses, submitError, processErrors := suite.eventSource.SubmitEventsToWorker([]nuclio.Event{
+		succeedingEvent,
+		failingEvent,
+	}, time.Second)
+
+	suite.NoError(submitError)
+	suite.Equal([]interface{}{"ok", nil}, responses)
+	suite.NoError(processErrors[0])
+	suite.Contains(processErrors[1].Error(), "No more allocations")
+
+	suite.Equal(uint64(1), suite.eventSource.GetStatistics().EventsHandledSuccess)
+	suite.Equal(uint64(1), suite.eventSource.GetStatistics().EventsHandledFailure)
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+	suite.mockSink.AssertExpectations(suite.T())
+}
+
+func (suite *EventSourceTestSuite) TestPanicRetriedAndDeadLettered() {
+	event := &nuclio.AbstractSync{}
+
+	// panic on all 3 attempts
+	suite.mockRuntime.On("ProcessEvent", event).Run(func(args mock.Arguments) {
+		panic("boom")
+	}).Times(3)
+
+	suite.mockSink.On("Write", mock.MatchedBy(func(deadLetter *DeadLetter) bool {
+		return deadLetter.Attempts == 3
+	})).Return(nil).Once()
+
+	// a panic is a processing error, not a failure to submit
+	_, submitError, processError := suite.eventSource.SubmitEventToWorker(event, time.Second)
+	suite.NoError(submitError)
+	suite.Require().Error(processError)
+	suite.Contains(processError.Error(), "boom")
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+	suite.mockSink.AssertExpectations(suite.T())
+}
+
+func (suite *EventSourceTestSuite) TestBatchPanicFailsOnlyPanickingEvent() {
+	succeedingEvent := &nuclio.AbstractSync{}
+	panickingEvent := &nuclio.AbstractSync{}
+
+	suite.mockRuntime.On("ProcessEvent", succeedingEvent).Return("ok", nil).Once()
+	suite.mockRuntime.On("ProcessEvent", panickingEvent).Run(func(args mock.Arguments) {
+		panic("boom")
+	}).Times(3)
+
+	suite.mockSink.On("Write", mock.Anything).Return(nil).Once()
+
+	responses, submitError, processErrors := suite.eventSource.SubmitEventsToWorker([]nuclio.Event{
+		succeedingEvent,
+		panickingEvent,
+	}, time.Second)
+
+	suite.NoError(submitError)
+	suite.Equal("ok", responses[0])
+	suite.NoError(processErrors[0])
+	suite.Require().Error(processErrors[1])
+	suite.Contains(processErrors[1].Error(), "boom")
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+	suite.mockSink.AssertExpectations(suite.T())
+}
+
+func (suite *EventSourceTestSuite) TestFileDeadLetterSink() {
+	tempDir, err := ioutil.TempDir("", "dead-letter-test")
+	suite.Require().NoError(err)
+
+	defer os.RemoveAll(tempDir)
+
+	sinkURL, err := url.Parse("file://" + filepath.Join(tempDir, "dlq", "dead-letters.json"))
+	suite.Require().NoError(err)
+
+	deadLetterSink, err := DeadLetterSinkRegistrySingleton.NewDeadLetterSink(suite.logger, sinkURL)
+	suite.Require().NoError(err)
+
+	deadLetter := NewDeadLetter("test1", "test", &nuclio.AbstractSync{}, suite.processingError, 3)
+	suite.Require().NoError(deadLetterSink.Write(deadLetter))
+	suite.Require().NoError(deadLetterSink.Close())
+
+	// the file is released once closed
+	suite.Error(deadLetterSink.Write(deadLetter))
+
+	contents, err := ioutil.ReadFile(sinkURL.Path)
+	suite.Require().NoError(err)
+	suite.Contains(string(contents), `"error":"Processing error"`)
+}
+
+func (suite *EventSourceTestSuite) TestBackoff() {
+	retryPolicy := RetryPolicy{
+		MaxRetries: 10,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: time.Second,
+	}
+
+	suite.Equal(100*time.Millisecond, retryPolicy.GetBackoff(1))
+	suite.Equal(200*time.Millisecond, retryPolicy.GetBackoff(2))
+	suite.Equal(800*time.Millisecond, retryPolicy.GetBackoff(4))
+	suite.Equal(time.Second, retryPolicy.GetBackoff(5))
+	suite.Equal(time.Second, retryPolicy.GetBackoff(10))
+}
+
+func (suite *EventSourceTestSuite) TestMaxHandlingTime() {
+	retryPolicy := RetryPolicy{
+		MaxRetries: 3,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: 300 * time.Millisecond,
+	}
+
+	// 4 attempts of a second, and 100 + 200 + 300 ms between them
+	suite.Equal(4600*time.Millisecond, retryPolicy.GetMaxHandlingTime(time.Second))
+	suite.Equal(600*time.Millisecond, retryPolicy.GetMaxHandlingTime(0))
+}
+
+func (suite *EventSourceTestSuite) TestPauseHoldsEvents() {
+	event := &nuclio.AbstractSync{}
+	doneChan := make(chan struct{})
+
+	suite.mockRuntime.On("ProcessEvent", event).Return("response", nil).Once()
+
+	suite.eventSource.Pause()
+
+	go func() {
+		suite.eventSource.SubmitEventToWorker(event, time.Second)
+		close(doneChan)
+	}()
+
+	// the event must be held (but counted as inflight) while paused
+	time.Sleep(50 * time.Millisecond)
+	suite.Equal(1, suite.eventSource.GetNumInflightEvents())
+	suite.mockRuntime.AssertNotCalled(suite.T(), "ProcessEvent", event)
+
+	suite.eventSource.Resume()
+
+	select {
+	case <-doneChan:
+	case <-time.After(time.Second):
+		suite.Fail("Event not processed after resume")
+	}
+
+	suite.Equal(0, suite.eventSource.GetNumInflightEvents())
+	suite.mockRuntime.AssertExpectations(suite.T())
+}
+
+func (suite *EventSourceTestSuite) TestWorkerAllocatorOfWorkerPool() {
+	workerPool, err := worker.NewWorkerPool(suite.logger,
+		"shared",
+		suite.eventSource.WorkerAllocator,
+		1,
+		worker.AllocationPolicyFairShare)
+
+	suite.Require().NoError(err)
+
+	configuration := &Configuration{ID: "test1", WorkerPool: "shared", WorkerPoolWeight: 1}
+
+	workerAllocator, err := NewWorkerAllocator(suite.logger,
+		configuration,
+		nil,
+		map[string]*worker.WorkerPool{"shared": workerPool})
+
+	suite.Require().NoError(err)
+	suite.Equal(workerPool, workerAllocator.(worker.PoolMemberAllocator).GetWorkerPool())
+
+	// only the pools the processor created are known
+	_, err = NewWorkerAllocator(suite.logger, configuration, nil, nil)
+	suite.Error(err)
+}
+
+func (suite *EventSourceTestSuite) getNumRetries() uint64 {
+	workerInstance := suite.eventSource.WorkerAllocator.GetWorkers()[0]
+
+	return atomic.LoadUint64(&workerInstance.GetStatistics().Retry)
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
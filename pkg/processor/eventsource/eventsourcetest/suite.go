@@ -0,0 +1,169 @@
+package eventsourcetest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// RecordingRuntime records what it's given to process, as returned by its record function. events may be
+// reused by event sources once processed, so they aren't recorded as is
+type RecordingRuntime struct {
+	lock    sync.Mutex
+	records []interface{}
+	record  func(event nuclio.Event) interface{}
+	respond func(event nuclio.Event, previousRecords []interface{}) (interface{}, error)
+}
+
+// NewRecordingRuntime creates a runtime recording what record returns for each event, and responding with
+// what respond returns given the event and the records of the events processed before it. respond may be nil,
+// in which case all events succeed
+func NewRecordingRuntime(record func(event nuclio.Event) interface{},
+	respond func(event nuclio.Event, previousRecords []interface{}) (interface{}, error)) *RecordingRuntime {
+
+	return &RecordingRuntime{
+		record:  record,
+		respond: respond,
+	}
+}
+
+func (rr *RecordingRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	previousRecords := rr.records
+	rr.records = append(rr.records, rr.record(event))
+
+	if rr.respond == nil {
+		return nil, nil
+	}
+
+	return rr.respond(event, previousRecords)
+}
+
+// GetRecords returns the records of the events processed so far
+func (rr *RecordingRuntime) GetRecords() []interface{} {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	return append([]interface{}{}, rr.records...)
+}
+
+// GetNumRecords returns the number of events processed so far
+func (rr *RecordingRuntime) GetNumRecords() int {
+	rr.lock.Lock()
+	defer rr.lock.Unlock()
+
+	return len(rr.records)
+}
+
+// AbstractEventSourceTestSuite holds what the tests of the different event sources share. the event sources
+// started by a test are stopped when it ends
+type AbstractEventSourceTestSuite struct {
+	suite.Suite
+	Logger       nuclio.Logger
+	EventSources []eventsource.EventSource
+}
+
+func (suite *AbstractEventSourceTestSuite) SetupSuite() {
+	suite.Logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *AbstractEventSourceTestSuite) TearDownTest() {
+	suite.StopEventSources()
+}
+
+// CreateConfiguration returns the configuration shared by all event sources
+func (suite *AbstractEventSourceTestSuite) CreateConfiguration(id string, numWorkers int) eventsource.Configuration {
+	return eventsource.Configuration{
+		ID:                        id,
+		NumWorkers:                numWorkers,
+		WorkerAllocationTimeoutMs: 1000,
+	}
+}
+
+// CreateWorkerAllocator returns a fixed pool of workers, all running the given runtime
+func (suite *AbstractEventSourceTestSuite) CreateWorkerAllocator(runtimeInstance runtime.Runtime,
+	numWorkers int) worker.WorkerAllocator {
+
+	var workers []*worker.Worker
+
+	for workerIndex := 0; workerIndex < numWorkers; workerIndex++ {
+		workers = append(workers, worker.NewWorker(suite.Logger, workerIndex, runtimeInstance))
+	}
+
+	workerAllocator, err := worker.NewFixedPoolWorkerAllocator(suite.Logger, workers)
+	suite.Require().NoError(err)
+
+	return workerAllocator
+}
+
+// StartEventSource starts the event source from the checkpoint, stopping it when the test ends
+func (suite *AbstractEventSourceTestSuite) StartEventSource(eventSource eventsource.EventSource,
+	checkpoint eventsource.Checkpoint) eventsource.EventSource {
+
+	suite.Require().NoError(eventSource.Start(checkpoint))
+
+	suite.EventSources = append(suite.EventSources, eventSource)
+
+	return eventSource
+}
+
+// StopEventSources stops the event sources started so far
+func (suite *AbstractEventSourceTestSuite) StopEventSources() {
+	for _, eventSource := range suite.EventSources {
+		eventSource.Stop(false)
+	}
+
+	suite.EventSources = nil
+}
+
+// WaitFor fails the test if the condition isn't met within a few seconds
+func (suite *AbstractEventSourceTestSuite) WaitFor(condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			suite.FailNow("Timed out waiting for condition")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// WaitForNumRecords waits until the runtime processed at least the given number of events
+func (suite *AbstractEventSourceTestSuite) WaitForNumRecords(runtimeInstance *RecordingRuntime, numRecords int) {
+	suite.WaitFor(func() bool { return runtimeInstance.GetNumRecords() >= numRecords })
+}
+
+// ExpectNumRecords verifies that the runtime processes exactly the given number of events, giving the event
+// source a little while to produce more
+func (suite *AbstractEventSourceTestSuite) ExpectNumRecords(runtimeInstance *RecordingRuntime, numRecords int) {
+	time.Sleep(200 * time.Millisecond)
+
+	suite.Equal(numRecords, runtimeInstance.GetNumRecords())
+}
+
+// ExpectStopReturns verifies that stopping the event source doesn't block, e.g. when it never started
+func (suite *AbstractEventSourceTestSuite) ExpectStopReturns(eventSource eventsource.EventSource) {
+	stoppedChan := make(chan struct{})
+
+	go func() {
+		eventSource.Stop(false)
+		close(stoppedChan)
+	}()
+
+	select {
+	case <-stoppedChan:
+	case <-time.After(5 * time.Second):
+		suite.Fail("Stop blocked")
+	}
+}
@@ -13,6 +13,7 @@ import (
 type generator struct {
 	eventsource.AbstractEventSource
 	configuration *Configuration
+	stopChan      chan struct{}
 }
 
 func newEventSource(logger nuclio.Logger,
@@ -31,8 +32,12 @@ func newEventSource(logger nuclio.Logger,
 			WorkerAllocator: workerAllocator,
 			Class:           "sync",
 			Kind:            "generator",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
 		},
 		configuration: configuration,
+		stopChan:      make(chan struct{}),
 	}
 
 	return &newEventSource, nil
@@ -53,17 +58,30 @@ func (g *generator) Start(checkpoint eventsource.Checkpoint) error {
 }
 
 func (g *generator) Stop(force bool) (eventsource.Checkpoint, error) {
+	g.Logger.InfoWith("Stopping", "force", force)
 
-	// TODO
+	// signal all generating go routines to stop. a forced stop may follow a graceful one
+	select {
+	case <-g.stopChan:
+	default:
+		close(g.stopChan)
+	}
+
+	// wait for events already generated, unless we're asked not to wait
+	if !force {
+		g.WaitForInflightEvents()
+	}
+
+	// generated events are random, nothing to resume from
 	return nil, nil
 }
 
 func (g *generator) generateEvents() error {
 	event := nuclio.AbstractSync{}
 
-	// for ever (for now)
+	// until stopped
 	for {
-		g.SubmitEventToWorker(&event, 10*time.Second)
+		g.SubmitEventToWorker(&event, g.configuration.GetWorkerAllocationTimeout())
 
 		var sleepMs int
 
@@ -74,7 +92,11 @@ func (g *generator) generateEvents() error {
 			sleepMs = g.configuration.MinDelayMs
 		}
 
-		// sleep a bit
-		time.Sleep(time.Duration(sleepMs) * time.Millisecond)
+		// sleep a bit, or bail if we're stopped
+		select {
+		case <-time.After(time.Duration(sleepMs) * time.Millisecond):
+		case <-g.stopChan:
+			return nil
+		}
 	}
 }
@@ -13,23 +13,31 @@ type factory struct{}
 
 func (f *factory) Create(parentLogger nuclio.Logger,
 	eventSourceConfiguration *viper.Viper,
-	runtimeConfiguration *viper.Viper) (eventsource.EventSource, error) {
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
 
 	// defaults
-	eventSourceConfiguration.SetDefault("num_workers", "1")
 	eventSourceConfiguration.SetDefault("min_delay_ms", "3000")
 	eventSourceConfiguration.SetDefault("max_delay_ms", "3000")
 
-	// get how many workers are required
-	numWorkers := eventSourceConfiguration.GetInt("num_workers")
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"min_delay_ms": eventsource.ValueTypeInt,
+		"max_delay_ms": eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
 
 	// create logger parent
 	generatorLogger := parentLogger.GetChild("generator").(nuclio.Logger)
 
 	// create worker allocator
-	workerAllocator, err := worker.WorkerFactorySingleton.CreateFixedPoolWorkerAllocator(generatorLogger,
-		numWorkers,
-		runtimeConfiguration)
+	workerAllocator, err := eventsource.NewWorkerAllocator(generatorLogger,
+		configuration,
+		runtimeConfiguration,
+		workerPools)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create worker allocator")
@@ -39,8 +47,7 @@ func (f *factory) Create(parentLogger nuclio.Logger,
 	generatorEventSource, err := newEventSource(generatorLogger,
 		workerAllocator,
 		&Configuration{
-			*eventsource.NewConfiguration(eventSourceConfiguration),
-			numWorkers,
+			*configuration,
 			eventSourceConfiguration.GetInt("min_delay_ms"),
 			eventSourceConfiguration.GetInt("max_delay_ms"),
 		})
@@ -4,7 +4,6 @@ import "github.com/nuclio/nuclio/pkg/processor/eventsource"
 
 type Configuration struct {
 	eventsource.Configuration
-	NumWorkers int
 	MinDelayMs int
 	MaxDelayMs int
 }
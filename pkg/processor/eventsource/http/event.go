@@ -1,13 +1,17 @@
 package http
 
 import (
+	"mime/multipart"
+	"time"
+
 	"github.com/nuclio/nuclio-sdk"
 	"github.com/nuclio/nuclio/pkg/util/common"
 
 	"github.com/valyala/fasthttp"
 )
 
-// allows accessing fasthttp.RequestCtx as a event.Sync
+// allows accessing fasthttp.RequestCtx as a event.Sync. handlers can type assert the event to access form
+// fields (e.g. event.(interface{ GetFieldString(string) string }))
 type Event struct {
 	nuclio.AbstractSync
 	ctx *fasthttp.RequestCtx
@@ -21,8 +25,124 @@ func (e *Event) GetBody() []byte {
 	return e.ctx.Request.Body()
 }
 
+func (e *Event) GetSize() int {
+	return len(e.ctx.Request.Body())
+}
+
+// returns the value of a header as a string, or nil if the request doesn't have it
+func (e *Event) GetHeader(key string) interface{} {
+	value := e.ctx.Request.Header.Peek(key)
+	if value == nil {
+		return nil
+	}
+
+	return string(value)
+}
+
 func (e *Event) GetHeaderByteSlice(key string) []byte {
 
 	// TODO: copy underlying by default? huge gotcha
 	return e.ctx.Request.Header.Peek(key)
 }
+
+func (e *Event) GetHeaderString(key string) string {
+	return string(e.ctx.Request.Header.Peek(key))
+}
+
+// returns all headers as strings, keyed by their canonical name (e.g. Content-Type)
+func (e *Event) GetHeaders() map[string]interface{} {
+	headers := map[string]interface{}{}
+
+	e.ctx.Request.Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = string(value)
+	})
+
+	return headers
+}
+
+// returns the time the request was received
+func (e *Event) GetTimestamp() time.Time {
+	return e.ctx.Time()
+}
+
+func (e *Event) GetPath() string {
+	return string(e.ctx.Path())
+}
+
+// returns the full URL of the request, including the host and query
+func (e *Event) GetURL() string {
+	return e.ctx.URI().String()
+}
+
+func (e *Event) GetMethod() string {
+	return string(e.ctx.Method())
+}
+
+func (e *Event) GetHostAddress() string {
+	return string(e.ctx.Host())
+}
+
+func (e *Event) GetRemoteAddress() string {
+	return e.ctx.RemoteAddr().String()
+}
+
+// returns the query arguments as strings. arguments that appear more than once are returned as []string
+func (e *Event) GetQuery() map[string]interface{} {
+	return argsToMap(e.ctx.QueryArgs())
+}
+
+// returns a field of a url encoded or multipart form, or an empty string if the form doesn't have it
+func (e *Event) GetFieldString(key string) string {
+	if value := e.ctx.PostArgs().Peek(key); value != nil {
+		return string(value)
+	}
+
+	multipartForm, err := e.ctx.MultipartForm()
+	if err == nil && len(multipartForm.Value[key]) != 0 {
+		return multipartForm.Value[key][0]
+	}
+
+	return ""
+}
+
+// returns the fields of a url encoded or multipart form, as GetQuery returns query arguments
+func (e *Event) GetFields() map[string]interface{} {
+	fields := argsToMap(e.ctx.PostArgs())
+
+	multipartForm, err := e.ctx.MultipartForm()
+	if err != nil {
+		return fields
+	}
+
+	for key, values := range multipartForm.Value {
+		if len(values) == 1 {
+			fields[key] = values[0]
+		} else {
+			fields[key] = values
+		}
+	}
+
+	return fields
+}
+
+// returns a file uploaded in a multipart form
+func (e *Event) GetFieldFile(key string) (*multipart.FileHeader, error) {
+	return e.ctx.FormFile(key)
+}
+
+func argsToMap(args *fasthttp.Args) map[string]interface{} {
+	argsMap := map[string]interface{}{}
+
+	args.VisitAll(func(key, value []byte) {
+		switch existingValue := argsMap[string(key)].(type) {
+		case nil:
+			argsMap[string(key)] = string(value)
+		case string:
+			argsMap[string(key)] = []string{existingValue, string(value)}
+		case []string:
+			argsMap[string(key)] = append(existingValue, string(value))
+		}
+	})
+
+	return argsMap
+}
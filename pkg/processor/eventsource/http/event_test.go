@@ -0,0 +1,108 @@
+package http
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/valyala/fasthttp"
+)
+
+type EventTestSuite struct {
+	suite.Suite
+}
+
+func (suite *EventTestSuite) TestRequestData() {
+	request := fasthttp.Request{}
+	request.Header.SetMethod("PUT")
+	request.SetRequestURI("http://example.com:8080/users/12?verbose=true&tag=a&tag=b")
+	request.Header.SetContentType("application/json")
+	request.Header.Set("X-Custom", "value")
+	request.SetBodyString(`{"name": "foo"}`)
+
+	event := suite.createEvent(&request)
+
+	suite.Equal("PUT", event.GetMethod())
+	suite.Equal("/users/12", event.GetPath())
+	suite.Equal("http://example.com:8080/users/12?verbose=true&tag=a&tag=b", event.GetURL())
+	suite.Equal("example.com:8080", event.GetHostAddress())
+	suite.Equal("10.0.0.1:5000", event.GetRemoteAddress())
+	suite.Equal("application/json", event.GetContentType())
+	suite.Equal(`{"name": "foo"}`, string(event.GetBody()))
+	suite.Equal(15, event.GetSize())
+	suite.False(event.GetTimestamp().IsZero())
+
+	suite.Equal("value", event.GetHeader("X-Custom"))
+	suite.Equal("value", event.GetHeaderString("x-custom"))
+	suite.Nil(event.GetHeader("X-Missing"))
+	suite.Equal("value", event.GetHeaders()["X-Custom"])
+	suite.Equal("application/json", event.GetHeaders()["Content-Type"])
+
+	suite.Equal(map[string]interface{}{
+		"verbose": "true",
+		"tag":     []string{"a", "b"},
+	}, event.GetQuery())
+}
+
+func (suite *EventTestSuite) TestURLEncodedForm() {
+	request := fasthttp.Request{}
+	request.Header.SetMethod("POST")
+	request.SetRequestURI("/form")
+	request.Header.SetContentType("application/x-www-form-urlencoded")
+	request.SetBodyString("name=foo&age=30")
+
+	event := suite.createEvent(&request)
+
+	suite.Equal("foo", event.GetFieldString("name"))
+	suite.Equal("", event.GetFieldString("missing"))
+	suite.Equal(map[string]interface{}{"name": "foo", "age": "30"}, event.GetFields())
+}
+
+func (suite *EventTestSuite) TestMultipartForm() {
+	var body bytes.Buffer
+
+	multipartWriter := multipart.NewWriter(&body)
+	multipartWriter.WriteField("name", "foo")
+
+	fileWriter, err := multipartWriter.CreateFormFile("upload", "data.txt")
+	suite.Require().NoError(err)
+	fileWriter.Write([]byte("file contents"))
+	multipartWriter.Close()
+
+	request := fasthttp.Request{}
+	request.Header.SetMethod("POST")
+	request.SetRequestURI("/upload")
+	request.Header.SetContentType(multipartWriter.FormDataContentType())
+	request.SetBody(body.Bytes())
+
+	event := suite.createEvent(&request)
+
+	suite.Equal("foo", event.GetFieldString("name"))
+	suite.Equal(map[string]interface{}{"name": "foo"}, event.GetFields())
+
+	fileHeader, err := event.GetFieldFile("upload")
+	suite.Require().NoError(err)
+	suite.Equal("data.txt", fileHeader.Filename)
+
+	file, err := fileHeader.Open()
+	suite.Require().NoError(err)
+	defer file.Close()
+
+	contents, err := ioutil.ReadAll(file)
+	suite.Require().NoError(err)
+	suite.Equal("file contents", string(contents))
+}
+
+func (suite *EventTestSuite) createEvent(request *fasthttp.Request) *Event {
+	ctx := fasthttp.RequestCtx{}
+	ctx.Init(request, &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}, nil)
+
+	return &Event{ctx: &ctx}
+}
+
+func TestEventTestSuite(t *testing.T) {
+	suite.Run(t, new(EventTestSuite))
+}
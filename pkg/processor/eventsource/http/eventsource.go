@@ -1,21 +1,31 @@
 package http
 
 import (
-	"errors"
+	"math"
+	"net"
 	net_http "net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/nuclio/nuclio-sdk"
 	"github.com/nuclio/nuclio/pkg/processor/eventsource"
 	"github.com/nuclio/nuclio/pkg/processor/worker"
 
+	"github.com/pkg/errors"
 	"github.com/valyala/fasthttp"
 )
 
 type http struct {
 	eventsource.AbstractEventSource
 	configuration *Configuration
-	event         Event
+	listener      net.Listener
+
+	// requests are handled concurrently, each with its own event. events are pooled to avoid allocating
+	// one per request
+	eventPool sync.Pool
+
+	workerAllocationTimeout time.Duration
 }
 
 func newEventSource(logger nuclio.Logger,
@@ -34,36 +44,89 @@ func newEventSource(logger nuclio.Logger,
 			WorkerAllocator: workerAllocator,
 			Class:           "sync",
 			Kind:            "http",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
 		},
 		configuration: configuration,
-		event:         Event{},
+		eventPool: sync.Pool{
+			New: func() interface{} {
+				return &Event{}
+			},
+		},
+		workerAllocationTimeout: configuration.GetWorkerAllocationTimeout(),
 	}
 
 	return &newEventSource, nil
 }
 
 func (h *http) Start(checkpoint eventsource.Checkpoint) error {
+	var err error
+
 	h.Logger.InfoWith("Starting", "listenAddress", h.configuration.ListenAddress)
 
-	// start listening
-	go fasthttp.ListenAndServe(h.configuration.ListenAddress, h.requestHandler)
+	// bind here rather than in the serving go routine so that we can close the listener on stop
+	h.listener, err = net.Listen("tcp4", h.configuration.ListenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to listen on %s", h.configuration.ListenAddress)
+	}
+
+	// start serving
+	go fasthttp.Serve(h.listener, h.requestHandler)
 
 	return nil
 }
 
 func (h *http) Stop(force bool) (eventsource.Checkpoint, error) {
+	h.Logger.InfoWith("Stopping", "force", force)
 
-	// TODO
+	// stop accepting new connections
+	if h.listener != nil {
+		h.listener.Close()
+	}
+
+	// let requests already submitted to workers complete, unless we're asked not to wait
+	if !force {
+		h.WaitForInflightEvents()
+	}
+
+	// http has no notion of a position to resume from
 	return nil, nil
 }
 
 func (h *http) requestHandler(ctx *fasthttp.RequestCtx) {
+
+	// requests can't be held while paused, so have the client retry them
+	if h.IsPaused() {
+		ctx.Response.Header.Set("Retry-After", h.getRetryAfter())
+		ctx.Response.SetStatusCode(net_http.StatusServiceUnavailable)
+		return
+	}
+
+	event := h.eventPool.Get().(*Event)
+
 	// attach the context to the event
-	h.event.ctx = ctx
+	event.ctx = ctx
 
-	response, submitError, processError := h.SubmitEventToWorker(&h.event, 10*time.Second)
+	response, submitError, processError := h.SubmitEventToWorker(event, h.workerAllocationTimeout)
+
+	// the event must not be used once returned to the pool. the response doesn't reference it
+	*event = Event{}
+	h.eventPool.Put(event)
+
+	// all workers are busy, have the client retry later
+	if errors.Cause(submitError) == worker.ErrAllocationTimeout {
+		ctx.Response.Header.Set("Retry-After", h.getRetryAfter())
+		ctx.Response.SetStatusCode(net_http.StatusServiceUnavailable)
+		return
+	}
+
+	// the handler didn't respond in time
+	if errors.Cause(processError) == worker.ErrEventTimeout {
+		ctx.Response.SetStatusCode(net_http.StatusGatewayTimeout)
+		return
+	}
 
-	// TODO: treat submit / process error differently?
 	if submitError != nil || processError != nil {
 		ctx.Response.SetStatusCode(net_http.StatusInternalServerError)
 		return
@@ -95,3 +158,13 @@ func (h *http) requestHandler(ctx *fasthttp.RequestCtx) {
 		ctx.Write(typedResponse)
 	}
 }
+
+// clients are asked to retry after the time a request waits for a worker, in whole seconds
+func (h *http) getRetryAfter() string {
+	retryAfterSeconds := int(math.Ceil(h.workerAllocationTimeout.Seconds()))
+	if retryAfterSeconds < 1 {
+		retryAfterSeconds = 1
+	}
+
+	return strconv.Itoa(retryAfterSeconds)
+}
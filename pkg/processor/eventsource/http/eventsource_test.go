@@ -0,0 +1,246 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	net_http "net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+	"github.com/valyala/fasthttp"
+)
+
+// responds with the request's ID header and body
+type echoRuntime struct {
+
+	// if set, events are processed once it's closed or their deadline expires
+	blockChan chan struct{}
+
+	// take a random short time to respond, so that requests interleave
+	interleave bool
+}
+
+func (er *echoRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	if er.blockChan != nil {
+		select {
+		case <-er.blockChan:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else if er.interleave {
+		time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+	}
+
+	return nuclio.Response{
+		StatusCode:  net_http.StatusOK,
+		ContentType: "text/plain",
+		Body:        []byte(event.GetHeaderString("X-Request-Id") + ":" + string(event.GetBody())),
+	}, nil
+}
+
+type EventSourceTestSuite struct {
+	suite.Suite
+	logger nuclio.Logger
+}
+
+func (suite *EventSourceTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.InfoLevel)
+}
+
+func (suite *EventSourceTestSuite) TestParallelRequests() {
+	httpEventSource := suite.createEventSource(&echoRuntime{interleave: true}, 8, 10*time.Second)
+	suite.Require().NoError(httpEventSource.Start(nil))
+	defer httpEventSource.Stop(true)
+
+	url := fmt.Sprintf("http://%s/", httpEventSource.listener.Addr().String())
+	waitGroup := sync.WaitGroup{}
+
+	// failures are reported here, since the test can only be failed from its own go routine
+	errChan := make(chan error, 200)
+
+	// each response must echo its own request, not that of a concurrent one
+	for requestIndex := 0; requestIndex < 200; requestIndex++ {
+		waitGroup.Add(1)
+
+		go func(requestIndex int) {
+			defer waitGroup.Done()
+
+			requestID := fmt.Sprintf("%d", requestIndex)
+			body := fmt.Sprintf("body-%d", requestIndex)
+
+			responseBody, err := suite.post(url, requestID, body)
+			if err != nil {
+				errChan <- err
+				return
+			}
+
+			if responseBody != requestID+":"+body {
+				errChan <- fmt.Errorf("Request %s got response %s", requestID, responseBody)
+			}
+		}(requestIndex)
+	}
+
+	waitGroup.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		suite.NoError(err)
+	}
+}
+
+func (suite *EventSourceTestSuite) TestAllocationTimeout() {
+	runtime := &echoRuntime{blockChan: make(chan struct{})}
+
+	httpEventSource := suite.createEventSource(runtime, 1, 50*time.Millisecond)
+	suite.Require().NoError(httpEventSource.Start(nil))
+	defer httpEventSource.Stop(true)
+
+	url := fmt.Sprintf("http://%s/", httpEventSource.listener.Addr().String())
+
+	// occupy the only worker
+	firstResponseChan := make(chan *net_http.Response, 1)
+	firstErrChan := make(chan error, 1)
+
+	go func() {
+		response, err := net_http.Get(url)
+
+		firstResponseChan <- response
+		firstErrChan <- err
+	}()
+
+	for httpEventSource.GetNumInflightEvents() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	response, err := net_http.Get(url)
+	suite.Require().NoError(err)
+	response.Body.Close()
+
+	suite.Equal(net_http.StatusServiceUnavailable, response.StatusCode)
+	suite.Equal("1", response.Header.Get("Retry-After"))
+
+	// release the worker
+	close(runtime.blockChan)
+
+	response = <-firstResponseChan
+	suite.Require().NoError(<-firstErrChan)
+	response.Body.Close()
+	suite.Equal(net_http.StatusOK, response.StatusCode)
+}
+
+func (suite *EventSourceTestSuite) TestEventTimeout() {
+	runtime := &echoRuntime{blockChan: make(chan struct{})}
+	defer close(runtime.blockChan)
+
+	httpEventSource := suite.createEventSource(runtime, 1, time.Second)
+	httpEventSource.EventTimeout = 20 * time.Millisecond
+
+	suite.Require().NoError(httpEventSource.Start(nil))
+	defer httpEventSource.Stop(true)
+
+	response, err := net_http.Get(fmt.Sprintf("http://%s/", httpEventSource.listener.Addr().String()))
+	suite.Require().NoError(err)
+	response.Body.Close()
+
+	suite.Equal(net_http.StatusGatewayTimeout, response.StatusCode)
+}
+
+// posts a request with the given ID, returning the response body if the request succeeded
+func (suite *EventSourceTestSuite) post(url string, requestID string, body string) (string, error) {
+	request, err := net_http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+
+	request.Header.Set("X-Request-Id", requestID)
+
+	response, err := net_http.DefaultClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if response.StatusCode != net_http.StatusOK {
+		return "", fmt.Errorf("Request %s failed with status %d", requestID, response.StatusCode)
+	}
+
+	return string(responseBody), nil
+}
+
+func (suite *EventSourceTestSuite) createEventSource(runtime *echoRuntime,
+	numWorkers int,
+	workerAllocationTimeout time.Duration) *http {
+
+	return createEventSource(suite.logger, runtime, numWorkers, workerAllocationTimeout).(*http)
+}
+
+func createEventSource(logger nuclio.Logger,
+	runtime *echoRuntime,
+	numWorkers int,
+	workerAllocationTimeout time.Duration) eventsource.EventSource {
+
+	var workers []*worker.Worker
+
+	for workerIndex := 0; workerIndex < numWorkers; workerIndex++ {
+		workers = append(workers, worker.NewWorker(logger, workerIndex, runtime))
+	}
+
+	workerAllocator, err := worker.NewFixedPoolWorkerAllocator(logger, workers)
+	if err != nil {
+		panic(err)
+	}
+
+	httpEventSource, err := newEventSource(logger, workerAllocator, &Configuration{
+		Configuration: eventsource.Configuration{
+			ID:                        "http1",
+			WorkerAllocationTimeoutMs: int(workerAllocationTimeout / time.Millisecond),
+		},
+		ListenAddress: "127.0.0.1:0",
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	return httpEventSource
+}
+
+func BenchmarkParallelRequests(b *testing.B) {
+	logger, _ := nucliozap.NewNuclioZap("test", nucliozap.InfoLevel)
+	httpEventSource := createEventSource(logger, &echoRuntime{}, 8, 10*time.Second).(*http)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	// drive the handler directly to measure the event source rather than the network
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := fasthttp.RequestCtx{}
+		ctx.Request.Header.Set("X-Request-Id", "1")
+		ctx.Request.SetBodyString("body")
+
+		for pb.Next() {
+			httpEventSource.requestHandler(&ctx)
+			ctx.Response.Reset()
+		}
+	})
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
@@ -13,22 +13,29 @@ type factory struct{}
 
 func (f *factory) Create(parentLogger nuclio.Logger,
 	eventSourceConfiguration *viper.Viper,
-	runtimeConfiguration *viper.Viper) (eventsource.EventSource, error) {
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
 
 	// defaults
-	eventSourceConfiguration.SetDefault("num_workers", 1)
 	eventSourceConfiguration.SetDefault("listen_address", ":1967")
 
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"listen_address": eventsource.ValueTypeString,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
 	// create logger parent
 	httpLogger := parentLogger.GetChild("http").(nuclio.Logger)
 
-	// get how many workers are required
-	numWorkers := eventSourceConfiguration.GetInt("num_workers")
-
 	// create worker allocator
-	workerAllocator, err := worker.WorkerFactorySingleton.CreateFixedPoolWorkerAllocator(httpLogger,
-		numWorkers,
-		runtimeConfiguration)
+	workerAllocator, err := eventsource.NewWorkerAllocator(httpLogger,
+		configuration,
+		runtimeConfiguration,
+		workerPools)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create worker allocator")
@@ -38,7 +45,7 @@ func (f *factory) Create(parentLogger nuclio.Logger,
 	httpEventSource, err := newEventSource(httpLogger,
 		workerAllocator,
 		&Configuration{
-			*eventsource.NewConfiguration(eventSourceConfiguration),
+			*configuration,
 			eventSourceConfiguration.GetString("listen_address"),
 		})
 
@@ -0,0 +1,207 @@
+package kafka
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// an in process broker, holding topics and consumer group offsets in memory
+type memoryBroker struct {
+	lock sync.Mutex
+
+	// messages of each partition of each topic
+	topics map[string][][]*Message
+
+	// offsets committed by groups, keyed by topic/group
+	committedOffsets map[string]map[int]int64
+
+	// partitions assigned to members, keyed by topic/group
+	assignedPartitions map[string]map[int]bool
+
+	// closed and replaced whenever a message is produced, waking up fetchers
+	producedChan chan struct{}
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{
+		topics:             map[string][][]*Message{},
+		committedOffsets:   map[string]map[int]int64{},
+		assignedPartitions: map[string]map[int]bool{},
+		producedChan:       make(chan struct{}),
+	}
+}
+
+func (mb *memoryBroker) createTopic(topic string, numPartitions int) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	mb.topics[topic] = make([][]*Message, numPartitions)
+}
+
+func (mb *memoryBroker) produce(topic string, partition int, key string, value string) {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	mb.topics[topic][partition] = append(mb.topics[topic][partition], &Message{
+		Topic:     topic,
+		Partition: partition,
+		Offset:    int64(len(mb.topics[topic][partition])),
+		Key:       []byte(key),
+		Value:     []byte(value),
+		Headers:   map[string][]byte{"source": []byte("test")},
+		Timestamp: time.Now(),
+	})
+
+	close(mb.producedChan)
+	mb.producedChan = make(chan struct{})
+}
+
+func (mb *memoryBroker) getCommittedOffset(topic string, group string, partition int) int64 {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	offset, found := mb.committedOffsets[topic+"/"+group][partition]
+	if !found {
+		return OffsetNone
+	}
+
+	return offset
+}
+
+// each client is a consumer group member
+type memoryClient struct {
+	broker          *memoryBroker
+	partitions      []int
+	numJoins        int
+	rebalancingChan chan struct{}
+}
+
+func (mc *memoryClient) JoinGroup(topic string, group string) ([]int, error) {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	partitions, found := mc.broker.topics[topic]
+	if !found {
+		return nil, fmt.Errorf("No such topic: %s", topic)
+	}
+
+	mc.numJoins++
+	mc.partitions = nil
+	mc.rebalancingChan = make(chan struct{})
+
+	groupKey := topic + "/" + group
+	if mc.broker.assignedPartitions[groupKey] == nil {
+		mc.broker.assignedPartitions[groupKey] = map[int]bool{}
+		mc.broker.committedOffsets[groupKey] = map[int]int64{}
+	}
+
+	// members get the partitions no other member was assigned
+	for partition := range partitions {
+		if !mc.broker.assignedPartitions[groupKey][partition] {
+			mc.broker.assignedPartitions[groupKey][partition] = true
+			mc.partitions = append(mc.partitions, partition)
+		}
+	}
+
+	return mc.partitions, nil
+}
+
+func (mc *memoryClient) LeaveGroup(topic string, group string) error {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	mc.releasePartitions(topic, group)
+
+	return nil
+}
+
+func (mc *memoryClient) Rebalancing() <-chan struct{} {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	return mc.rebalancingChan
+}
+
+// revokes the member's partitions, as the broker would when another member joins
+func (mc *memoryClient) rebalance(topic string, group string) {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	mc.releasePartitions(topic, group)
+	close(mc.rebalancingChan)
+}
+
+func (mc *memoryClient) getNumJoins() int {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	return mc.numJoins
+}
+
+func (mc *memoryClient) releasePartitions(topic string, group string) {
+	for _, partition := range mc.partitions {
+		delete(mc.broker.assignedPartitions[topic+"/"+group], partition)
+	}
+
+	mc.partitions = nil
+}
+
+func (mc *memoryClient) GetCommittedOffset(topic string, group string, partition int) (int64, error) {
+	return mc.broker.getCommittedOffset(topic, group, partition), nil
+}
+
+func (mc *memoryClient) CommitOffset(topic string, group string, partition int, offset int64) error {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	mc.broker.committedOffsets[topic+"/"+group][partition] = offset
+
+	return nil
+}
+
+func (mc *memoryClient) GetOffsetRange(topic string, partition int) (int64, int64, error) {
+	mc.broker.lock.Lock()
+	defer mc.broker.lock.Unlock()
+
+	return 0, int64(len(mc.broker.topics[topic][partition])), nil
+}
+
+func (mc *memoryClient) Fetch(topic string,
+	partition int,
+	offset int64,
+	maxMessages int,
+	timeout time.Duration) ([]*Message, error) {
+
+	deadline := time.After(timeout)
+
+	for {
+		mc.broker.lock.Lock()
+		messages := mc.broker.topics[topic][partition]
+		producedChan := mc.broker.producedChan
+		mc.broker.lock.Unlock()
+
+		if offset > int64(len(messages)) {
+			return nil, ErrOffsetOutOfRange
+		}
+
+		if offset < int64(len(messages)) {
+			endOffset := offset + int64(maxMessages)
+			if endOffset > int64(len(messages)) {
+				endOffset = int64(len(messages))
+			}
+
+			return messages[offset:endOffset], nil
+		}
+
+		select {
+		case <-producedChan:
+		case <-deadline:
+			return []*Message{}, nil
+		}
+	}
+}
+
+func (mc *memoryClient) Close() error {
+	return nil
+}
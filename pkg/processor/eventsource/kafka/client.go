@@ -0,0 +1,86 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+
+	"github.com/pkg/errors"
+)
+
+// returned by GetCommittedOffset for partitions the group never committed an offset for
+const OffsetNone int64 = -1
+
+// returned by Fetch for offsets the partition no longer (e.g. due to retention) or doesn't yet hold
+var ErrOffsetOutOfRange = errors.New("Offset out of range")
+
+// a message consumed from a topic partition
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string][]byte
+	Timestamp time.Time
+}
+
+// a connection to the brokers, consuming a topic as a member of a consumer group. the kafka event source
+// is written against this so that the wire protocol implementation can be swapped (e.g. for an in process
+// broker in tests)
+type Client interface {
+
+	// joins the consumer group of a topic. returns the partitions assigned to this member
+	JoinGroup(topic string, group string) ([]int, error)
+
+	// closed once the group rebalances (e.g. a member joined or left), after which the member must stop
+	// consuming the partitions it was assigned and join the group again
+	Rebalancing() <-chan struct{}
+
+	// leaves the consumer group, releasing the partitions assigned to this member
+	LeaveGroup(topic string, group string) error
+
+	// returns the offset the group committed for a partition, or OffsetNone
+	GetCommittedOffset(topic string, group string, partition int) (int64, error)
+
+	// commits the offset of the next message the group should consume from a partition
+	CommitOffset(topic string, group string, partition int, offset int64) error
+
+	// returns the offset of the oldest message in a partition and the offset the next message will get
+	GetOffsetRange(topic string, partition int) (int64, int64, error)
+
+	// returns up to maxMessages messages of a partition, starting at offset. waits up to timeout for
+	// messages to become available, returning an empty slice if none did. returns ErrOffsetOutOfRange if the
+	// partition doesn't hold offset
+	Fetch(topic string, partition int, offset int64, maxMessages int, timeout time.Duration) ([]*Message, error)
+
+	Close() error
+}
+
+//
+// Client registry
+// Clients are keyed by the client kind in the event source configuration
+//
+
+type ClientCreator interface {
+	Create(logger nuclio.Logger, brokers []string) (Client, error)
+}
+
+type ClientRegistry struct {
+	registry.Registry
+}
+
+// global singleton
+var ClientRegistrySingleton = ClientRegistry{
+	Registry: *registry.NewRegistry("kafka_client"),
+}
+
+func (r *ClientRegistry) NewClient(logger nuclio.Logger, kind string, brokers []string) (Client, error) {
+	registree, err := r.Get(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(ClientCreator).Create(logger, brokers)
+}
@@ -0,0 +1,1069 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPort = "9092"
+	clientID    = "nuclio"
+
+	// how long connecting, and a request (on top of the time the broker is allowed to block on it), may take
+	connectTimeout = 10 * time.Second
+	requestTimeout = 30 * time.Second
+
+	// a member that doesn't heartbeat for sessionTimeout is removed from the group. on rebalance, members have
+	// rebalanceTimeout to stop consuming and join again
+	sessionTimeout   = 10 * time.Second
+	rebalanceTimeout = 60 * time.Second
+
+	// the number of bytes a fetch may return per partition. brokers return at least one batch, even if larger
+	maxFetchBytes = 1024 * 1024
+
+	// joining is retried this many times when the group rebalances (e.g. other members join) meanwhile
+	maxJoinAttempts = 5
+)
+
+// how often members heartbeat, well within the session timeout. tests shorten it to see rebalances quickly
+var heartbeatInterval = 3 * time.Second
+
+//
+// A client speaking the Kafka protocol over TCP (https://kafka.apache.org/protocol). Partitions are fetched
+// from their leaders, each over its own connection since fetches block. Records are read uncommitted and
+// may be compressed with gzip, snappy or lz4. Partitions are assigned to the group's members by range
+//
+
+type conn struct {
+	logger          nuclio.Logger
+	brokers         []string
+	connsLock       sync.Mutex
+	conns           map[string]*brokerConn
+	closed          bool
+	metadataLock    sync.Mutex
+	brokerAddresses map[int32]string
+
+	// the leader of each partition of each topic
+	leaders map[string]map[int]int32
+
+	// the group membership, replaced whenever the member joins
+	groupLock         sync.Mutex
+	coordinator       string
+	memberID          string
+	generationID      int32
+	rebalancingChan   chan struct{}
+	heartbeatStopChan chan struct{}
+	heartbeatDoneChan chan struct{}
+}
+
+func newConn(parentLogger nuclio.Logger, brokers []string) (*conn, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("Kafka client requires at least one broker")
+	}
+
+	newConn := &conn{
+		logger:          parentLogger.GetChild("conn").(nuclio.Logger),
+		conns:           map[string]*brokerConn{},
+		brokerAddresses: map[int32]string{},
+		leaders:         map[string]map[int]int32{},
+		rebalancingChan: make(chan struct{}),
+	}
+
+	for _, broker := range brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			broker = net.JoinHostPort(broker, defaultPort)
+		}
+
+		newConn.brokers = append(newConn.brokers, broker)
+	}
+
+	return newConn, nil
+}
+
+func (c *conn) JoinGroup(topic string, group string) ([]int, error) {
+	c.stopHeartbeat()
+
+	for attempt := 1; ; attempt++ {
+		partitions, err := c.joinGroup(topic, group)
+		if err == nil {
+			return partitions, nil
+		}
+
+		if attempt == maxJoinAttempts || !isRetriableGroupError(err) {
+			return nil, err
+		}
+
+		c.logger.DebugWith("Group changed while joining, retrying", "group", group, "err", err)
+	}
+}
+
+func (c *conn) LeaveGroup(topic string, group string) error {
+	c.stopHeartbeat()
+
+	c.groupLock.Lock()
+	memberID := c.memberID
+	c.memberID = ""
+	c.groupLock.Unlock()
+
+	// never joined
+	if memberID == "" {
+		return nil
+	}
+
+	request := encoder{}
+	request.putString(group)
+	request.putString(memberID)
+
+	response, err := c.requestCoordinator(group, apiKeyLeaveGroup, &request, requestTimeout)
+	if err != nil {
+		return errors.Wrap(err, "Failed to leave group")
+	}
+
+	return errorFromCode(response.getInt16())
+}
+
+func (c *conn) Rebalancing() <-chan struct{} {
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	return c.rebalancingChan
+}
+
+func (c *conn) GetCommittedOffset(topic string, group string, partition int) (int64, error) {
+	request := encoder{}
+	request.putString(group)
+	request.putArrayLength(1)
+	request.putString(topic)
+	request.putArrayLength(1)
+	request.putInt32(int32(partition))
+
+	response, err := c.requestCoordinator(group, apiKeyOffsetFetch, &request, requestTimeout)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to fetch committed offset")
+	}
+
+	offset, errorCode := int64(OffsetNone), errorCodeNone
+
+	for topicIndex, numTopics := 0, response.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+		response.getString() // topic
+
+		for partitionIndex, numPartitions := 0, response.getArrayLength(); partitionIndex < numPartitions; partitionIndex++ {
+			response.getInt32() // partition
+			offset = response.getInt64()
+			response.getString() // metadata
+			errorCode = response.getInt16()
+		}
+	}
+
+	if response.err != nil {
+		return 0, response.err
+	}
+
+	if err := c.checkGroupError(errorCode); err != nil {
+		return 0, err
+	}
+
+	// groups that never committed an offset for the partition have -1
+	if offset < 0 {
+		return OffsetNone, nil
+	}
+
+	return offset, nil
+}
+
+func (c *conn) CommitOffset(topic string, group string, partition int, offset int64) error {
+	c.groupLock.Lock()
+	memberID, generationID := c.memberID, c.generationID
+	c.groupLock.Unlock()
+
+	request := encoder{}
+	request.putString(group)
+	request.putInt32(generationID)
+	request.putString(memberID)
+	request.putInt64(-1) // retention time (the broker's default)
+	request.putArrayLength(1)
+	request.putString(topic)
+	request.putArrayLength(1)
+	request.putInt32(int32(partition))
+	request.putInt64(offset)
+	request.putString("") // metadata
+
+	response, err := c.requestCoordinator(group, apiKeyOffsetCommit, &request, requestTimeout)
+	if err != nil {
+		return errors.Wrap(err, "Failed to commit offset")
+	}
+
+	errorCode := errorCodeNone
+
+	for topicIndex, numTopics := 0, response.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+		response.getString() // topic
+
+		for partitionIndex, numPartitions := 0, response.getArrayLength(); partitionIndex < numPartitions; partitionIndex++ {
+			response.getInt32() // partition
+			errorCode = response.getInt16()
+		}
+	}
+
+	if response.err != nil {
+		return response.err
+	}
+
+	return c.checkGroupError(errorCode)
+}
+
+func (c *conn) GetOffsetRange(topic string, partition int) (int64, int64, error) {
+	var offsets [2]int64
+
+	// the earliest and latest offsets are requested by timestamps -2 and -1
+	for offsetIndex, timestamp := range []int64{-2, -1} {
+		request := encoder{}
+		request.putInt32(-1) // replica ID
+		request.putArrayLength(1)
+		request.putString(topic)
+		request.putArrayLength(1)
+		request.putInt32(int32(partition))
+		request.putInt64(timestamp)
+
+		response, err := c.requestLeader(topic, partition, apiKeyListOffsets, &request, requestTimeout)
+		if err != nil {
+			return 0, 0, errors.Wrap(err, "Failed to list offsets")
+		}
+
+		errorCode := errorCodeNone
+
+		for topicIndex, numTopics := 0, response.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+			response.getString() // topic
+
+			for partitionIndex, numPartitions := 0, response.getArrayLength(); partitionIndex < numPartitions; partitionIndex++ {
+				response.getInt32() // partition
+				errorCode = response.getInt16()
+				response.getInt64() // timestamp
+				offsets[offsetIndex] = response.getInt64()
+			}
+		}
+
+		if response.err != nil {
+			return 0, 0, response.err
+		}
+
+		if err := c.checkLeaderError(topic, errorCode); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return offsets[0], offsets[1], nil
+}
+
+func (c *conn) Fetch(topic string,
+	partition int,
+	offset int64,
+	maxMessages int,
+	timeout time.Duration) ([]*Message, error) {
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		messages, nextOffset, err := c.fetch(topic, partition, offset, time.Until(deadline))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(messages) > maxMessages {
+			messages = messages[:maxMessages]
+		}
+
+		// records that hold no messages (e.g. transaction markers) are skipped by fetching again past them
+		if len(messages) != 0 || nextOffset <= offset || time.Now().After(deadline) {
+			return messages, nil
+		}
+
+		offset = nextOffset
+	}
+}
+
+func (c *conn) Close() error {
+	c.connsLock.Lock()
+	c.closed = true
+
+	// interrupts the requests in flight, including those of the heartbeat
+	for connKey, connection := range c.conns {
+		connection.close()
+		delete(c.conns, connKey)
+	}
+
+	c.connsLock.Unlock()
+
+	c.stopHeartbeat()
+
+	return nil
+}
+
+func (c *conn) fetch(topic string, partition int, offset int64, timeout time.Duration) ([]*Message, int64, error) {
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	request := encoder{}
+	request.putInt32(-1) // replica ID
+	request.putInt32(int32(timeout / time.Millisecond))
+	request.putInt32(1) // min bytes
+	request.putInt32(maxFetchBytes)
+	request.putInt8(0) // isolation level (read uncommitted)
+	request.putArrayLength(1)
+	request.putString(topic)
+	request.putArrayLength(1)
+	request.putInt32(int32(partition))
+	request.putInt64(offset)
+	request.putInt32(maxFetchBytes)
+
+	response, err := c.requestLeader(topic, partition, apiKeyFetch, &request, timeout+requestTimeout)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Failed to fetch")
+	}
+
+	var records []byte
+	errorCode := errorCodeNone
+
+	response.getInt32() // throttle time
+
+	for topicIndex, numTopics := 0, response.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+		response.getString() // topic
+
+		for partitionIndex, numPartitions := 0, response.getArrayLength(); partitionIndex < numPartitions; partitionIndex++ {
+			response.getInt32() // partition
+			errorCode = response.getInt16()
+			response.getInt64() // high watermark
+			response.getInt64() // last stable offset
+
+			for abortedIndex, numAborted := 0, response.getArrayLength(); abortedIndex < numAborted; abortedIndex++ {
+				response.getInt64() // producer ID
+				response.getInt64() // first offset
+			}
+
+			records = response.getBytes()
+		}
+	}
+
+	if response.err != nil {
+		return nil, 0, response.err
+	}
+
+	if errorCode == errorCodeOffsetOutOfRange {
+		return nil, 0, ErrOffsetOutOfRange
+	}
+
+	if err := c.checkLeaderError(topic, errorCode); err != nil {
+		return nil, 0, err
+	}
+
+	return parseRecords(topic, partition, records, offset)
+}
+
+//
+// Group membership
+//
+
+func (c *conn) joinGroup(topic string, group string) ([]int, error) {
+	c.groupLock.Lock()
+	memberID := c.memberID
+	c.groupLock.Unlock()
+
+	// members declare the topics they consume
+	subscription := encoder{}
+	subscription.putInt16(0) // version
+	subscription.putArrayLength(1)
+	subscription.putString(topic)
+	subscription.putBytes(nil) // user data
+
+	request := encoder{}
+	request.putString(group)
+	request.putInt32(int32(sessionTimeout / time.Millisecond))
+	request.putInt32(int32(rebalanceTimeout / time.Millisecond))
+	request.putString(memberID)
+	request.putString("consumer")
+	request.putArrayLength(1)
+	request.putString("range")
+	request.putBytes(subscription.buffer)
+
+	// the broker replies once all members joined, which they have the rebalance timeout to do
+	response, err := c.requestCoordinator(group, apiKeyJoinGroup, &request, rebalanceTimeout+requestTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to join group")
+	}
+
+	response.getInt32() // throttle time
+	errorCode := response.getInt16()
+	generationID := response.getInt32()
+	response.getString() // protocol
+	leaderID := response.getString()
+	memberID = response.getString()
+
+	members := map[string][]string{}
+
+	for memberIndex, numMembers := 0, response.getArrayLength(); memberIndex < numMembers; memberIndex++ {
+		groupMemberID := response.getString()
+		members[groupMemberID] = decodeSubscription(response.getBytes())
+	}
+
+	if response.err != nil {
+		return nil, response.err
+	}
+
+	if errorCode == errorCodeUnknownMemberID {
+		c.setMembership("", 0)
+	}
+
+	if err := c.checkCoordinatorError(errorCode); err != nil {
+		return nil, err
+	}
+
+	c.setMembership(memberID, generationID)
+
+	// the leader assigns partitions to all members
+	var assignments map[string][]int
+
+	if memberID == leaderID {
+		numPartitions, err := c.getNumPartitions(topic)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to get partitions")
+		}
+
+		assignments = assignRange(topic, numPartitions, members)
+	}
+
+	partitions, err := c.syncGroup(topic, group, memberID, generationID, assignments)
+	if err != nil {
+		return nil, err
+	}
+
+	c.startHeartbeat(group, memberID, generationID)
+
+	return partitions, nil
+}
+
+// sends the assignments (if leader) and returns the partitions assigned to this member
+func (c *conn) syncGroup(topic string,
+	group string,
+	memberID string,
+	generationID int32,
+	assignments map[string][]int) ([]int, error) {
+
+	request := encoder{}
+	request.putString(group)
+	request.putInt32(generationID)
+	request.putString(memberID)
+	request.putArrayLength(len(assignments))
+
+	for assignedMemberID, partitions := range assignments {
+		assignment := encoder{}
+		assignment.putInt16(0) // version
+		assignment.putArrayLength(1)
+		assignment.putString(topic)
+		assignment.putArrayLength(len(partitions))
+
+		for _, partition := range partitions {
+			assignment.putInt32(int32(partition))
+		}
+
+		assignment.putBytes(nil) // user data
+
+		request.putString(assignedMemberID)
+		request.putBytes(assignment.buffer)
+	}
+
+	response, err := c.requestCoordinator(group, apiKeySyncGroup, &request, rebalanceTimeout+requestTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to sync group")
+	}
+
+	errorCode := response.getInt16()
+	assignment := decoder{buffer: response.getBytes()}
+
+	if response.err != nil {
+		return nil, response.err
+	}
+
+	if err := c.checkCoordinatorError(errorCode); err != nil {
+		return nil, err
+	}
+
+	// members that were assigned nothing get an empty assignment
+	partitions := []int{}
+
+	if len(assignment.buffer) == 0 {
+		return partitions, nil
+	}
+
+	assignment.getInt16() // version
+
+	for topicIndex, numTopics := 0, assignment.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+		assignedTopic := assignment.getString()
+
+		for partitionIndex, numPartitions := 0, assignment.getArrayLength(); partitionIndex < numPartitions; partitionIndex++ {
+			partition := int(assignment.getInt32())
+
+			if assignedTopic == topic {
+				partitions = append(partitions, partition)
+			}
+		}
+	}
+
+	if assignment.err != nil {
+		return nil, errors.Wrap(assignment.err, "Failed to decode assignment")
+	}
+
+	return partitions, nil
+}
+
+func (c *conn) setMembership(memberID string, generationID int32) {
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	c.memberID = memberID
+	c.generationID = generationID
+
+	// a new generation gets a new rebalancing channel
+	select {
+	case <-c.rebalancingChan:
+		c.rebalancingChan = make(chan struct{})
+	default:
+	}
+}
+
+// signals that the member must join the group again
+func (c *conn) signalRebalance() {
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	select {
+	case <-c.rebalancingChan:
+	default:
+		close(c.rebalancingChan)
+	}
+}
+
+func (c *conn) startHeartbeat(group string, memberID string, generationID int32) {
+	c.groupLock.Lock()
+	defer c.groupLock.Unlock()
+
+	c.heartbeatStopChan = make(chan struct{})
+	c.heartbeatDoneChan = make(chan struct{})
+
+	go c.heartbeat(group, memberID, generationID, c.heartbeatStopChan, c.heartbeatDoneChan)
+}
+
+func (c *conn) stopHeartbeat() {
+	c.groupLock.Lock()
+	heartbeatStopChan, heartbeatDoneChan := c.heartbeatStopChan, c.heartbeatDoneChan
+	c.heartbeatStopChan, c.heartbeatDoneChan = nil, nil
+	c.groupLock.Unlock()
+
+	if heartbeatStopChan != nil {
+		close(heartbeatStopChan)
+		<-heartbeatDoneChan
+	}
+}
+
+// heartbeats keep the member in the group, and are how it learns that the group is rebalancing
+func (c *conn) heartbeat(group string,
+	memberID string,
+	generationID int32,
+	stopChan chan struct{},
+	doneChan chan struct{}) {
+
+	defer close(doneChan)
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stopChan:
+			return
+		}
+
+		request := encoder{}
+		request.putString(group)
+		request.putInt32(generationID)
+		request.putString(memberID)
+
+		response, err := c.requestCoordinator(group, apiKeyHeartbeat, &request, requestTimeout)
+		if err != nil {
+			c.logger.WarnWith("Failed to heartbeat", "group", group, "err", err)
+			continue
+		}
+
+		if err := c.checkGroupError(response.getInt16()); err != nil {
+			if err.(brokerError).isRebalanceError() {
+				c.logger.InfoWith("Group is rebalancing", "group", group, "err", err)
+				return
+			}
+
+			c.logger.WarnWith("Heartbeat failed", "group", group, "err", err)
+		}
+	}
+}
+
+// handles the errors of requests made as a member of the group. rebalances are signaled, and coordinator
+// errors cause it to be looked up again on the next request
+func (c *conn) checkGroupError(errorCode int16) error {
+	err := c.checkCoordinatorError(errorCode)
+
+	if brokerErr, isBrokerError := err.(brokerError); isBrokerError && brokerErr.isRebalanceError() {
+		c.signalRebalance()
+	}
+
+	return err
+}
+
+func (c *conn) checkCoordinatorError(errorCode int16) error {
+	err := errorFromCode(errorCode)
+
+	if brokerErr, isBrokerError := err.(brokerError); isBrokerError && brokerErr.isCoordinatorError() {
+		c.groupLock.Lock()
+		c.coordinator = ""
+		c.groupLock.Unlock()
+	}
+
+	return err
+}
+
+func isRetriableGroupError(err error) bool {
+	brokerErr, isBrokerError := errors.Cause(err).(brokerError)
+
+	return isBrokerError && (brokerErr.isRebalanceError() || brokerErr.isCoordinatorError())
+}
+
+// returns the topics a member subscribed to
+func decodeSubscription(encodedSubscription []byte) []string {
+	var topics []string
+
+	subscription := decoder{buffer: encodedSubscription}
+	subscription.getInt16() // version
+
+	for topicIndex, numTopics := 0, subscription.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+		topics = append(topics, subscription.getString())
+	}
+
+	return topics
+}
+
+// assigns each member subscribed to the topic a consecutive range of its partitions. members are ordered by
+// ID, and the first ones get an extra partition if they can't be divided evenly
+func assignRange(topic string, numPartitions int, members map[string][]string) map[string][]int {
+	var subscribedMemberIDs []string
+
+	assignments := map[string][]int{}
+
+	for memberID, topics := range members {
+		assignments[memberID] = []int{}
+
+		for _, subscribedTopic := range topics {
+			if subscribedTopic == topic {
+				subscribedMemberIDs = append(subscribedMemberIDs, memberID)
+			}
+		}
+	}
+
+	sort.Strings(subscribedMemberIDs)
+
+	partition := 0
+
+	for memberIndex, memberID := range subscribedMemberIDs {
+		numAssigned := numPartitions / len(subscribedMemberIDs)
+		if memberIndex < numPartitions%len(subscribedMemberIDs) {
+			numAssigned++
+		}
+
+		for ; numAssigned > 0; numAssigned-- {
+			assignments[memberID] = append(assignments[memberID], partition)
+			partition++
+		}
+	}
+
+	return assignments
+}
+
+//
+// Metadata
+//
+
+func (c *conn) getNumPartitions(topic string) (int, error) {
+	if err := c.refreshMetadata(topic); err != nil {
+		return 0, err
+	}
+
+	c.metadataLock.Lock()
+	defer c.metadataLock.Unlock()
+
+	return len(c.leaders[topic]), nil
+}
+
+func (c *conn) getLeaderAddress(topic string, partition int) (string, error) {
+	c.metadataLock.Lock()
+	leader, found := c.leaders[topic][partition]
+	c.metadataLock.Unlock()
+
+	if !found {
+		if err := c.refreshMetadata(topic); err != nil {
+			return "", err
+		}
+
+		c.metadataLock.Lock()
+		leader, found = c.leaders[topic][partition]
+		c.metadataLock.Unlock()
+
+		if !found {
+			return "", fmt.Errorf("No leader for partition %d of %s", partition, topic)
+		}
+	}
+
+	c.metadataLock.Lock()
+	defer c.metadataLock.Unlock()
+
+	return c.brokerAddresses[leader], nil
+}
+
+// reads the brokers and the leaders of the topic's partitions from the first broker that replies
+func (c *conn) refreshMetadata(topic string) error {
+	var lastErr error
+
+	for _, broker := range c.brokers {
+		request := encoder{}
+		request.putArrayLength(1)
+		request.putString(topic)
+
+		response, err := c.request("metadata", broker, apiKeyMetadata, &request, requestTimeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		brokerAddresses := map[int32]string{}
+
+		for brokerIndex, numBrokers := 0, response.getArrayLength(); brokerIndex < numBrokers; brokerIndex++ {
+			nodeID := response.getInt32()
+			host := response.getString()
+			port := response.getInt32()
+			response.getString() // rack
+
+			brokerAddresses[nodeID] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+
+		response.getInt32() // controller ID
+
+		leaders := map[int]int32{}
+		topicErrorCode := errorCodeNone
+
+		for topicIndex, numTopics := 0, response.getArrayLength(); topicIndex < numTopics; topicIndex++ {
+			topicErrorCode = response.getInt16()
+			response.getString() // topic
+			response.getInt8()   // internal
+
+			for partitionIndex, numPartitions := 0, response.getArrayLength(); partitionIndex < numPartitions; partitionIndex++ {
+				response.getInt16() // error code
+				partition := int(response.getInt32())
+				leader := response.getInt32()
+
+				// replicas and in sync replicas
+				for replicaSetIndex := 0; replicaSetIndex < 2; replicaSetIndex++ {
+					for replicaIndex, numReplicas := 0, response.getArrayLength(); replicaIndex < numReplicas; replicaIndex++ {
+						response.getInt32()
+					}
+				}
+
+				// partitions without a leader (-1) are left out, to be looked up again when they're used
+				if leader >= 0 {
+					leaders[partition] = leader
+				}
+			}
+		}
+
+		if response.err != nil {
+			lastErr = response.err
+			continue
+		}
+
+		if err := errorFromCode(topicErrorCode); err != nil {
+			return errors.Wrapf(err, "Failed to get metadata of %s", topic)
+		}
+
+		c.metadataLock.Lock()
+		c.brokerAddresses = brokerAddresses
+		c.leaders[topic] = leaders
+		c.metadataLock.Unlock()
+
+		return nil
+	}
+
+	return errors.Wrap(lastErr, "Failed to get metadata from all brokers")
+}
+
+func (c *conn) checkLeaderError(topic string, errorCode int16) error {
+	err := errorFromCode(errorCode)
+
+	if brokerErr, isBrokerError := err.(brokerError); isBrokerError && brokerErr.isLeaderError() {
+		c.metadataLock.Lock()
+		delete(c.leaders, topic)
+		c.metadataLock.Unlock()
+	}
+
+	return err
+}
+
+//
+// Requests
+//
+
+func (c *conn) requestLeader(topic string,
+	partition int,
+	apiKey int16,
+	request *encoder,
+	timeout time.Duration) (*decoder, error) {
+
+	address, err := c.getLeaderAddress(topic, partition)
+	if err != nil {
+		return nil, err
+	}
+
+	// fetches block, so each partition is fetched over its own connection
+	connKey := "leader"
+	if apiKey == apiKeyFetch {
+		connKey = fmt.Sprintf("fetch/%s/%d", topic, partition)
+	}
+
+	response, err := c.request(connKey, address, apiKey, request, timeout)
+	if err != nil {
+
+		// the leader may have moved
+		c.metadataLock.Lock()
+		delete(c.leaders, topic)
+		c.metadataLock.Unlock()
+	}
+
+	return response, err
+}
+
+func (c *conn) requestCoordinator(group string,
+	apiKey int16,
+	request *encoder,
+	timeout time.Duration) (*decoder, error) {
+
+	c.groupLock.Lock()
+	coordinator := c.coordinator
+	c.groupLock.Unlock()
+
+	if coordinator == "" {
+		var err error
+
+		if coordinator, err = c.findCoordinator(group); err != nil {
+			return nil, errors.Wrap(err, "Failed to find coordinator")
+		}
+	}
+
+	// heartbeats have their own connection, so that they aren't held up behind a join
+	connKey := "coordinator"
+	if apiKey == apiKeyHeartbeat {
+		connKey = "heartbeat"
+	}
+
+	response, err := c.request(connKey, coordinator, apiKey, request, timeout)
+	if err != nil {
+		c.groupLock.Lock()
+		c.coordinator = ""
+		c.groupLock.Unlock()
+	}
+
+	return response, err
+}
+
+func (c *conn) findCoordinator(group string) (string, error) {
+	var lastErr error
+
+	for _, broker := range c.brokers {
+		request := encoder{}
+		request.putString(group)
+
+		response, err := c.request("metadata", broker, apiKeyFindCoordinator, &request, requestTimeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		errorCode := response.getInt16()
+		response.getInt32() // node ID
+		host := response.getString()
+		port := response.getInt32()
+
+		if response.err != nil {
+			lastErr = response.err
+			continue
+		}
+
+		if err := errorFromCode(errorCode); err != nil {
+			return "", err
+		}
+
+		coordinator := net.JoinHostPort(host, strconv.Itoa(int(port)))
+
+		c.groupLock.Lock()
+		c.coordinator = coordinator
+		c.groupLock.Unlock()
+
+		return coordinator, nil
+	}
+
+	return "", lastErr
+}
+
+// sends a request over the connection with the given key, dialing the address if there's no such connection.
+// connections that fail are dropped, to be dialed again by the next request
+func (c *conn) request(connKey string,
+	address string,
+	apiKey int16,
+	request *encoder,
+	timeout time.Duration) (*decoder, error) {
+
+	connKey += "@" + address
+
+	c.connsLock.Lock()
+
+	if c.closed {
+		c.connsLock.Unlock()
+		return nil, errors.New("Client is closed")
+	}
+
+	connection, found := c.conns[connKey]
+	if !found {
+		connection = &brokerConn{address: address}
+		c.conns[connKey] = connection
+	}
+
+	c.connsLock.Unlock()
+
+	response, err := connection.request(apiKey, request, timeout)
+	if err != nil {
+		c.connsLock.Lock()
+		if c.conns[connKey] == connection {
+			delete(c.conns, connKey)
+		}
+		c.connsLock.Unlock()
+
+		connection.close()
+	}
+
+	return response, err
+}
+
+// a connection to a single broker, over which one request is sent at a time
+type brokerConn struct {
+	address           string
+	requestLock       sync.Mutex
+	lastCorrelationID int32
+
+	// closing a connection interrupts the request being sent over it, so it's guarded separately
+	netConnLock sync.Mutex
+	netConn     net.Conn
+	closed      bool
+}
+
+func (bc *brokerConn) request(apiKey int16, request *encoder, timeout time.Duration) (*decoder, error) {
+	bc.requestLock.Lock()
+	defer bc.requestLock.Unlock()
+
+	netConn, err := bc.getNetConn()
+	if err != nil {
+		return nil, err
+	}
+
+	bc.lastCorrelationID++
+
+	// requests are prefixed by their size and a header
+	frame := encoder{}
+	frame.putInt32(0)
+	frame.putInt16(apiKey)
+	frame.putInt16(apiVersions[apiKey])
+	frame.putInt32(bc.lastCorrelationID)
+	frame.putString(clientID)
+	frame.buffer = append(frame.buffer, request.buffer...)
+
+	binary.BigEndian.PutUint32(frame.buffer, uint32(len(frame.buffer)-4))
+
+	netConn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := netConn.Write(frame.buffer); err != nil {
+		return nil, errors.Wrap(err, "Failed to write request")
+	}
+
+	sizeBuffer := make([]byte, 4)
+	if _, err := io.ReadFull(netConn, sizeBuffer); err != nil {
+		return nil, errors.Wrap(err, "Failed to read response size")
+	}
+
+	responseBuffer := make([]byte, binary.BigEndian.Uint32(sizeBuffer))
+	if _, err := io.ReadFull(netConn, responseBuffer); err != nil {
+		return nil, errors.Wrap(err, "Failed to read response")
+	}
+
+	response := &decoder{buffer: responseBuffer}
+
+	if correlationID := response.getInt32(); correlationID != bc.lastCorrelationID {
+		return nil, fmt.Errorf("Expected response to request %d, got %d", bc.lastCorrelationID, correlationID)
+	}
+
+	return response, nil
+}
+
+// dials the broker on the first request
+func (bc *brokerConn) getNetConn() (net.Conn, error) {
+	bc.netConnLock.Lock()
+	defer bc.netConnLock.Unlock()
+
+	if bc.closed {
+		return nil, errors.New("Connection is closed")
+	}
+
+	if bc.netConn == nil {
+		netConn, err := net.DialTimeout("tcp", bc.address, connectTimeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to dial %s", bc.address)
+		}
+
+		bc.netConn = netConn
+	}
+
+	return bc.netConn, nil
+}
+
+func (bc *brokerConn) close() {
+	bc.netConnLock.Lock()
+	defer bc.netConnLock.Unlock()
+
+	bc.closed = true
+
+	if bc.netConn != nil {
+		bc.netConn.Close()
+	}
+}
+
+type connCreator struct{}
+
+func (cc *connCreator) Create(logger nuclio.Logger, brokers []string) (Client, error) {
+	return newConn(logger, brokers)
+}
+
+// register the protocol implementation as the default client
+func init() {
+	ClientRegistrySingleton.Register("kafka", &connCreator{})
+}
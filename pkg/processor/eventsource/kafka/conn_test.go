@@ -0,0 +1,341 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConnTestSuite struct {
+	suite.Suite
+	logger                    nuclio.Logger
+	server                    *testServer
+	conns                     []*conn
+	originalHeartbeatInterval time.Duration
+}
+
+func (suite *ConnTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	// members learn of rebalances by heartbeating
+	suite.originalHeartbeatInterval = heartbeatInterval
+	heartbeatInterval = 20 * time.Millisecond
+}
+
+func (suite *ConnTestSuite) TearDownSuite() {
+	heartbeatInterval = suite.originalHeartbeatInterval
+}
+
+func (suite *ConnTestSuite) SetupTest() {
+	var err error
+
+	suite.server, err = newTestServer()
+	suite.Require().NoError(err)
+
+	suite.server.createTopic("events", 4)
+}
+
+func (suite *ConnTestSuite) TearDownTest() {
+	for _, conn := range suite.conns {
+		conn.Close()
+	}
+
+	suite.conns = nil
+	suite.server.close()
+}
+
+func (suite *ConnTestSuite) TestBrokers() {
+	_, err := newConn(suite.logger, nil)
+	suite.Error(err)
+
+	// the default port is added to brokers without one
+	conn, err := newConn(suite.logger, []string{"kafka-0", "kafka-1:9093"})
+	suite.Require().NoError(err)
+	suite.Equal([]string{"kafka-0:9092", "kafka-1:9093"}, conn.brokers)
+}
+
+func (suite *ConnTestSuite) TestFetchCompressedBatches() {
+	suite.server.produce("events", 1, compressionNone, "a", "b")
+	suite.server.produce("events", 1, compressionGzip, "c", "d")
+	suite.server.produce("events", 1, compressionSnappy, "e")
+
+	conn := suite.createConn()
+
+	for _, testCase := range []struct {
+		offset         int64
+		maxMessages    int
+		expectedValues []string
+	}{
+		{0, 10, []string{"a", "b", "c", "d", "e"}},
+
+		// messages before the offset are skipped, though their batch is returned
+		{3, 10, []string{"d", "e"}},
+		{1, 2, []string{"b", "c"}},
+	} {
+		messages, err := conn.Fetch("events", 1, testCase.offset, testCase.maxMessages, time.Second)
+		suite.Require().NoError(err, testCase.offset)
+
+		var values []string
+
+		for messageIndex, message := range messages {
+			values = append(values, string(message.Value))
+
+			suite.Equal("events", message.Topic)
+			suite.Equal(1, message.Partition)
+			suite.Equal(testCase.offset+int64(messageIndex), message.Offset)
+			suite.Equal("key", string(message.Key))
+			suite.Equal("test", string(message.Headers["source"]))
+		}
+
+		suite.Equal(testCase.expectedValues, values, testCase.offset)
+	}
+}
+
+func (suite *ConnTestSuite) TestFetchWaitsForMessages() {
+	conn := suite.createConn()
+
+	// nothing is produced in time. the broker is asked to wait for what's left of the timeout
+	fetchStartTime := time.Now()
+	messages, err := conn.Fetch("events", 0, 0, 10, 100*time.Millisecond)
+	suite.Require().NoError(err)
+	suite.Empty(messages)
+	suite.True(time.Since(fetchStartTime) >= 80*time.Millisecond)
+
+	// produced while fetching
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		suite.server.produce("events", 0, compressionNone, "late")
+	}()
+
+	messages, err = conn.Fetch("events", 0, 0, 10, 5*time.Second)
+	suite.Require().NoError(err)
+	suite.Require().Len(messages, 1)
+	suite.Equal("late", string(messages[0].Value))
+}
+
+func (suite *ConnTestSuite) TestOffsetRange() {
+	suite.server.produce("events", 2, compressionNone, "a", "b", "c", "d", "e")
+
+	conn := suite.createConn()
+
+	earliestOffset, latestOffset, err := conn.GetOffsetRange("events", 2)
+	suite.Require().NoError(err)
+	suite.Equal(int64(0), earliestOffset)
+	suite.Equal(int64(5), latestOffset)
+
+	// retention deleted the first messages
+	suite.server.deleteBefore("events", 2, 3)
+
+	_, err = conn.Fetch("events", 2, 1, 10, time.Second)
+	suite.Equal(ErrOffsetOutOfRange, err)
+
+	earliestOffset, _, err = conn.GetOffsetRange("events", 2)
+	suite.Require().NoError(err)
+	suite.Equal(int64(3), earliestOffset)
+
+	_, err = conn.Fetch("events", 2, 6, 10, time.Second)
+	suite.Equal(ErrOffsetOutOfRange, err)
+}
+
+func (suite *ConnTestSuite) TestCommit() {
+	conn := suite.createConn()
+
+	partitions, err := conn.JoinGroup("events", "group")
+	suite.Require().NoError(err)
+	suite.Equal([]int{0, 1, 2, 3}, partitions)
+
+	committedOffset, err := conn.GetCommittedOffset("events", "group", 1)
+	suite.Require().NoError(err)
+	suite.Equal(OffsetNone, committedOffset)
+
+	suite.Require().NoError(conn.CommitOffset("events", "group", 1, 7))
+
+	committedOffset, err = conn.GetCommittedOffset("events", "group", 1)
+	suite.Require().NoError(err)
+	suite.Equal(int64(7), committedOffset)
+
+	serverOffset, found := suite.server.getCommittedOffset("group", "events", 1)
+	suite.True(found)
+	suite.Equal(int64(7), serverOffset)
+
+	// other groups track their own offsets
+	committedOffset, err = conn.GetCommittedOffset("events", "other", 1)
+	suite.Require().NoError(err)
+	suite.Equal(OffsetNone, committedOffset)
+
+	suite.Require().NoError(conn.LeaveGroup("events", "group"))
+	suite.Empty(suite.server.getMemberIDs("group"))
+}
+
+func (suite *ConnTestSuite) TestRebalance() {
+	firstConn := suite.createConn()
+	secondConn := suite.createConn()
+
+	partitions, err := firstConn.JoinGroup("events", "group")
+	suite.Require().NoError(err)
+	suite.Equal([]int{0, 1, 2, 3}, partitions)
+
+	firstRebalancingChan := firstConn.Rebalancing()
+
+	// the second member joining blocks until the first joins again, which it learns of by heartbeating
+	secondJoinResultChan := suite.joinGroupAsync(secondConn)
+	suite.expectRebalancing(firstRebalancingChan)
+
+	// the first member's generation ended, so it can't commit
+	suite.Error(firstConn.CommitOffset("events", "group", 0, 1))
+
+	partitions, err = firstConn.JoinGroup("events", "group")
+	suite.Require().NoError(err)
+	suite.Equal([]int{0, 1}, partitions)
+
+	secondJoinResult := <-secondJoinResultChan
+	suite.Require().NoError(secondJoinResult.err)
+	suite.Equal([]int{2, 3}, secondJoinResult.partitions)
+
+	// both are members of the new generation
+	suite.NoError(firstConn.CommitOffset("events", "group", 0, 1))
+	suite.NoError(secondConn.CommitOffset("events", "group", 2, 1))
+
+	select {
+	case <-firstConn.Rebalancing():
+		suite.Fail("Rebalancing signaled for the new generation")
+	default:
+	}
+
+	// the second member leaving hands its partitions back to the first
+	secondRebalancingChan := firstConn.Rebalancing()
+	suite.Require().NoError(secondConn.LeaveGroup("events", "group"))
+	suite.expectRebalancing(secondRebalancingChan)
+
+	partitions, err = firstConn.JoinGroup("events", "group")
+	suite.Require().NoError(err)
+	suite.Equal([]int{0, 1, 2, 3}, partitions)
+}
+
+func (suite *ConnTestSuite) TestJoinRetriedWhileRebalancing() {
+	conn := suite.createConn()
+
+	suite.server.failNext(apiKeySyncGroup, errorCodeRebalanceInProgress)
+
+	partitions, err := conn.JoinGroup("events", "group")
+	suite.Require().NoError(err)
+	suite.Equal([]int{0, 1, 2, 3}, partitions)
+	suite.Equal(2, suite.server.getNumRequests(apiKeyJoinGroup))
+}
+
+func (suite *ConnTestSuite) TestCoordinatorMoved() {
+	conn := suite.createConn()
+
+	_, err := conn.JoinGroup("events", "group")
+	suite.Require().NoError(err)
+
+	suite.server.failNext(apiKeyOffsetCommit, errorCodeNotCoordinator)
+	suite.Error(conn.CommitOffset("events", "group", 0, 1))
+
+	// the coordinator is looked up again
+	suite.Require().NoError(conn.CommitOffset("events", "group", 0, 1))
+	suite.Equal(2, suite.server.getNumRequests(apiKeyFindCoordinator))
+}
+
+func (suite *ConnTestSuite) TestLeaderMoved() {
+	suite.server.produce("events", 0, compressionNone, "a")
+
+	conn := suite.createConn()
+
+	suite.server.failNext(apiKeyFetch, errorCodeNotLeaderForPartition)
+
+	_, err := conn.Fetch("events", 0, 0, 10, time.Second)
+	suite.Error(err)
+
+	// the leader is looked up again
+	messages, err := conn.Fetch("events", 0, 0, 10, time.Second)
+	suite.Require().NoError(err)
+	suite.Len(messages, 1)
+	suite.Equal(2, suite.server.getNumRequests(apiKeyMetadata))
+}
+
+func (suite *ConnTestSuite) TestDroppedConnectionRedialed() {
+	suite.server.produce("events", 0, compressionNone, "a")
+
+	conn := suite.createConn()
+
+	_, err := conn.Fetch("events", 0, 0, 10, time.Second)
+	suite.Require().NoError(err)
+
+	suite.server.dropConnections()
+
+	// the next request over each dropped connection fails: the fetch, and then looking up the leader again
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err = conn.Fetch("events", 0, 0, 10, time.Second)
+		suite.Error(err, attempt)
+	}
+
+	// connections are dialed again by the requests that follow
+
+	messages, err := conn.Fetch("events", 0, 0, 10, time.Second)
+	suite.Require().NoError(err)
+	suite.Len(messages, 1)
+}
+
+func (suite *ConnTestSuite) TestCloseInterruptsFetch() {
+	conn := suite.createConn()
+
+	fetchErrChan := make(chan error, 1)
+
+	go func() {
+		_, err := conn.Fetch("events", 0, 0, 10, time.Minute)
+		fetchErrChan <- err
+	}()
+
+	// let the fetch block on the server
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case err := <-fetchErrChan:
+		suite.Error(err)
+	case <-time.After(5 * time.Second):
+		suite.Fail("Close didn't interrupt the fetch")
+	}
+}
+
+type joinResult struct {
+	partitions []int
+	err        error
+}
+
+func (suite *ConnTestSuite) createConn() *conn {
+	conn, err := newConn(suite.logger, []string{suite.server.address()})
+	suite.Require().NoError(err)
+
+	suite.conns = append(suite.conns, conn)
+
+	return conn
+}
+
+func (suite *ConnTestSuite) joinGroupAsync(conn *conn) chan joinResult {
+	joinResultChan := make(chan joinResult, 1)
+
+	go func() {
+		partitions, err := conn.JoinGroup("events", "group")
+		joinResultChan <- joinResult{partitions, err}
+	}()
+
+	return joinResultChan
+}
+
+func (suite *ConnTestSuite) expectRebalancing(rebalancingChan <-chan struct{}) {
+	select {
+	case <-rebalancingChan:
+	case <-time.After(5 * time.Second):
+		suite.FailNow("Rebalance not signaled")
+	}
+}
+
+func TestConnTestSuite(t *testing.T) {
+	suite.Run(t, new(ConnTestSuite))
+}
@@ -0,0 +1,73 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// allows accessing a Message. besides the message headers, the following headers are available:
+// topic (string), partition (int), offset (int64), key ([]byte) and timestamp (time.Time)
+type Event struct {
+	nuclio.AbstractSync
+	message *Message
+	headers map[string]interface{}
+}
+
+func (e *Event) setMessage(message *Message) {
+	e.message = message
+	e.headers = map[string]interface{}{}
+
+	for headerKey, headerValue := range message.Headers {
+		e.headers[headerKey] = headerValue
+	}
+
+	e.headers["topic"] = message.Topic
+	e.headers["partition"] = message.Partition
+	e.headers["offset"] = message.Offset
+	e.headers["key"] = message.Key
+	e.headers["timestamp"] = message.Timestamp
+}
+
+func (e *Event) GetBody() []byte {
+	return e.message.Value
+}
+
+func (e *Event) GetSize() int {
+	return len(e.message.Value)
+}
+
+func (e *Event) GetTimestamp() time.Time {
+	return e.message.Timestamp
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	return e.headers[key]
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return e.headers
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	value, found := e.headers[key]
+	if !found {
+		return nil
+	}
+
+	switch typedValue := value.(type) {
+	case []byte:
+		return typedValue
+	case string:
+		return []byte(typedValue)
+	case time.Time:
+		return []byte(typedValue.Format(time.RFC3339Nano))
+	default:
+		return []byte(fmt.Sprint(typedValue))
+	}
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	return string(e.GetHeaderByteSlice(key))
+}
@@ -0,0 +1,341 @@
+package kafka
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type kafka struct {
+	eventsource.AbstractEventSource
+	configuration *Configuration
+	client        Client
+	stopChan      chan struct{}
+	stoppedChan   chan struct{}
+
+	// the offsets committed by each partition consumer, returned as the checkpoint on stop
+	committedOffsetsLock sync.Mutex
+	committedOffsets     map[int]int64
+}
+
+func newEventSource(parentLogger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	client Client,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	// partitions are consumed concurrently, so the allocator must be shareable
+	if !workerAllocator.Shareable() {
+		return nil, errors.New("Kafka event source requires a shareable worker allocator")
+	}
+
+	newEventSource := kafka{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Logger:          parentLogger,
+			WorkerAllocator: workerAllocator,
+			Class:           "async",
+			Kind:            "kafka",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
+		},
+		configuration:    configuration,
+		client:           client,
+		stopChan:         make(chan struct{}),
+		committedOffsets: map[int]int64{},
+	}
+
+	return &newEventSource, nil
+}
+
+func (k *kafka) Start(checkpoint eventsource.Checkpoint) error {
+	k.Logger.InfoWith("Starting",
+		"brokers", k.configuration.Brokers,
+		"topic", k.configuration.Topic,
+		"consumerGroup", k.configuration.ConsumerGroup)
+
+	checkpointOffsets, err := k.decodeCheckpoint(checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "Failed to decode checkpoint")
+	}
+
+	partitions, err := k.client.JoinGroup(k.configuration.Topic, k.configuration.ConsumerGroup)
+	if err != nil {
+		return errors.Wrap(err, "Failed to join consumer group")
+	}
+
+	k.stoppedChan = make(chan struct{})
+
+	go k.consume(partitions, checkpointOffsets)
+
+	return nil
+}
+
+func (k *kafka) Stop(force bool) (eventsource.Checkpoint, error) {
+	k.Logger.InfoWith("Stopping", "force", force)
+
+	// signal partition consumers to stop. a forced stop may follow a graceful one
+	select {
+	case <-k.stopChan:
+	default:
+		close(k.stopChan)
+	}
+
+	// let the messages being processed be committed, unless we're asked not to wait (or never started)
+	if !force && k.stoppedChan != nil {
+		<-k.stoppedChan
+	}
+
+	if err := k.client.LeaveGroup(k.configuration.Topic, k.configuration.ConsumerGroup); err != nil {
+		k.Logger.WarnWith("Failed to leave consumer group", "err", err)
+	}
+
+	if err := k.client.Close(); err != nil {
+		return nil, errors.Wrap(err, "Failed to close client")
+	}
+
+	return k.encodeCheckpoint()
+}
+
+// consumes the partitions assigned to the member until stopped. when the group rebalances, the partitions are
+// released (once the messages being processed are committed) and the group is joined again
+func (k *kafka) consume(partitions []int, checkpointOffsets map[int]int64) {
+	defer close(k.stoppedChan)
+
+	for {
+		k.Logger.DebugWith("Joined consumer group", "partitions", partitions)
+
+		rebalancingChan := k.client.Rebalancing()
+		sessionStopChan := make(chan struct{})
+
+		var consumersWaitGroup sync.WaitGroup
+
+		for _, partition := range partitions {
+			consumersWaitGroup.Add(1)
+
+			go func(partition int) {
+				defer consumersWaitGroup.Done()
+
+				k.consumePartition(partition, checkpointOffsets, sessionStopChan)
+			}(partition)
+		}
+
+		select {
+		case <-rebalancingChan:
+		case <-k.stopChan:
+		}
+
+		close(sessionStopChan)
+		consumersWaitGroup.Wait()
+
+		if k.stopped(k.stopChan) {
+			return
+		}
+
+		k.Logger.InfoWith("Consumer group is rebalancing, joining again")
+
+		// keep trying to join, since the event source has no other way to recover
+		for {
+			var err error
+
+			partitions, err = k.client.JoinGroup(k.configuration.Topic, k.configuration.ConsumerGroup)
+			if err == nil {
+				break
+			}
+
+			k.Logger.WarnWith("Failed to join consumer group", "err", err)
+
+			if !k.waitForBackoff(k.stopChan) {
+				return
+			}
+		}
+	}
+}
+
+// the group's committed offset takes precedence over the checkpoint, which is used when the group has none
+// (e.g. the group was deleted). if neither exist, consumption starts from the configured initial offset
+func (k *kafka) getStartOffset(partition int, checkpointOffsets map[int]int64) (int64, error) {
+	committedOffset, err := k.client.GetCommittedOffset(k.configuration.Topic, k.configuration.ConsumerGroup, partition)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get committed offset")
+	}
+
+	if committedOffset != OffsetNone {
+		return committedOffset, nil
+	}
+
+	if checkpointOffset, found := checkpointOffsets[partition]; found {
+		return checkpointOffset, nil
+	}
+
+	return k.getInitialOffset(partition)
+}
+
+func (k *kafka) getInitialOffset(partition int) (int64, error) {
+	oldestOffset, newestOffset, err := k.client.GetOffsetRange(k.configuration.Topic, partition)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to get offset range")
+	}
+
+	if k.configuration.InitialOffset == InitialOffsetLatest {
+		return newestOffset, nil
+	}
+
+	return oldestOffset, nil
+}
+
+// consumes a partition in order, committing the offset of every message once it's handled. a message is
+// handled if it was processed successfully or dead lettered. otherwise, it's fetched again after a backoff so
+// that no message is skipped
+func (k *kafka) consumePartition(partition int, checkpointOffsets map[int]int64, sessionStopChan chan struct{}) {
+	var event Event
+	var offset int64
+	var err error
+
+	for {
+		if offset, err = k.getStartOffset(partition, checkpointOffsets); err == nil {
+			break
+		}
+
+		k.Logger.WarnWith("Failed to get start offset", "partition", partition, "err", err)
+
+		if !k.waitForBackoff(sessionStopChan) {
+			return
+		}
+	}
+
+	fetchTimeout := time.Duration(k.configuration.FetchTimeoutMs) * time.Millisecond
+
+	for !k.stopped(sessionStopChan) {
+		messages, err := k.client.Fetch(k.configuration.Topic,
+			partition,
+			offset,
+			k.configuration.BatchSize,
+			fetchTimeout)
+
+		// the messages may have been deleted (e.g. by retention), in which case we skip to the initial offset
+		if err == ErrOffsetOutOfRange {
+			k.Logger.WarnWith("Offset out of range, resetting", "partition", partition, "offset", offset)
+
+			if initialOffset, err := k.getInitialOffset(partition); err == nil {
+				offset = initialOffset
+				continue
+			}
+		}
+
+		if err != nil {
+			k.Logger.WarnWith("Failed to fetch messages", "partition", partition, "offset", offset, "err", err)
+
+			k.waitForBackoff(sessionStopChan)
+			continue
+		}
+
+		for _, message := range messages {
+			if k.stopped(sessionStopChan) {
+				return
+			}
+
+			event.setMessage(message)
+
+			_, submitError, processError := k.SubmitEventToWorker(&event, k.configuration.GetWorkerAllocationTimeout())
+
+			if submitError != nil || (processError != nil && !k.HasDeadLetterSink()) {
+				k.Logger.WarnWith("Failed to handle message, will fetch it again",
+					"partition", partition,
+					"offset", message.Offset,
+					"submitError", submitError,
+					"processError", processError)
+
+				k.waitForBackoff(sessionStopChan)
+				break
+			}
+
+			offset = message.Offset + 1
+
+			if err := k.commitOffset(partition, offset); err != nil {
+				k.Logger.WarnWith("Failed to commit offset", "partition", partition, "offset", offset, "err", err)
+			}
+		}
+	}
+}
+
+func (k *kafka) commitOffset(partition int, offset int64) error {
+	if err := k.client.CommitOffset(k.configuration.Topic, k.configuration.ConsumerGroup, partition, offset); err != nil {
+		return err
+	}
+
+	k.committedOffsetsLock.Lock()
+	k.committedOffsets[partition] = offset
+	k.committedOffsetsLock.Unlock()
+
+	return nil
+}
+
+func (k *kafka) stopped(stopChan chan struct{}) bool {
+	select {
+	case <-stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// returns false if stopped while waiting
+func (k *kafka) waitForBackoff(stopChan chan struct{}) bool {
+	select {
+	case <-time.After(time.Duration(k.configuration.RetryBackoffMs) * time.Millisecond):
+		return true
+	case <-stopChan:
+		return false
+	}
+}
+
+// checkpoints are JSON objects mapping partitions to the offset of the next message to consume
+func (k *kafka) encodeCheckpoint() (eventsource.Checkpoint, error) {
+	encodedOffsets := map[string]int64{}
+
+	k.committedOffsetsLock.Lock()
+	for partition, offset := range k.committedOffsets {
+		encodedOffsets[strconv.Itoa(partition)] = offset
+	}
+	k.committedOffsetsLock.Unlock()
+
+	encodedCheckpoint, err := json.Marshal(encodedOffsets)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode checkpoint")
+	}
+
+	checkpoint := string(encodedCheckpoint)
+
+	return &checkpoint, nil
+}
+
+func (k *kafka) decodeCheckpoint(checkpoint eventsource.Checkpoint) (map[int]int64, error) {
+	offsets := map[int]int64{}
+
+	if checkpoint == nil || *checkpoint == "" {
+		return offsets, nil
+	}
+
+	encodedOffsets := map[string]int64{}
+	if err := json.Unmarshal([]byte(*checkpoint), &encodedOffsets); err != nil {
+		return nil, err
+	}
+
+	for encodedPartition, offset := range encodedOffsets {
+		partition, err := strconv.Atoi(encodedPartition)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid partition %s", encodedPartition)
+		}
+
+		offsets[partition] = offset
+	}
+
+	return offsets, nil
+}
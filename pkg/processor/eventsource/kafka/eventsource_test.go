@@ -0,0 +1,268 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type processedMessage struct {
+	value     string
+	key       string
+	partition int
+	offset    int64
+	header    string
+}
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	broker  *memoryBroker
+	client  *memoryClient
+	runtime *eventsourcetest.RecordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	suite.broker = newMemoryBroker()
+	suite.broker.createTopic("events", 2)
+	suite.runtime = eventsourcetest.NewRecordingRuntime(suite.recordMessage, nil)
+}
+
+func (suite *EventSourceTestSuite) TestConsumeAndCommit() {
+	suite.broker.produce("events", 0, "k0", "a")
+	suite.broker.produce("events", 0, "k1", "b")
+	suite.broker.produce("events", 1, "k2", "c")
+
+	eventSource := suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(nil))
+
+	suite.WaitForNumRecords(suite.runtime, 3)
+
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.JSONEq(`{"0": 2, "1": 1}`, *checkpoint)
+
+	suite.Equal(int64(2), suite.broker.getCommittedOffset("events", "group1", 0))
+	suite.Equal(int64(1), suite.broker.getCommittedOffset("events", "group1", 1))
+
+	// partitions are consumed in order, and message metadata is available as headers
+	for _, message := range suite.getProcessedMessages() {
+		if message.value == "b" {
+			suite.Equal(processedMessage{"b", "k1", 0, 1, "test"}, message)
+		}
+	}
+}
+
+func (suite *EventSourceTestSuite) TestResumeFromCommittedOffset() {
+	suite.broker.produce("events", 0, "", "a")
+
+	eventSource := suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(nil))
+	suite.WaitForNumRecords(suite.runtime, 1)
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	suite.broker.produce("events", 0, "", "b")
+
+	// a new member of the same group only gets the messages the group didn't commit
+	eventSource = suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(nil))
+	suite.WaitForNumRecords(suite.runtime, 2)
+
+	_, err = eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	processedMessages := suite.getProcessedMessages()
+	suite.Require().Len(processedMessages, 2)
+	suite.Equal("b", processedMessages[1].value)
+}
+
+func (suite *EventSourceTestSuite) TestStartFromCheckpoint() {
+	suite.broker.produce("events", 0, "", "a")
+	suite.broker.produce("events", 0, "", "b")
+
+	// the group never committed, so the checkpoint is used
+	checkpoint := `{"0": 1}`
+
+	eventSource := suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(&checkpoint))
+	suite.WaitForNumRecords(suite.runtime, 1)
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	processedMessages := suite.getProcessedMessages()
+	suite.Require().Len(processedMessages, 1)
+	suite.Equal("b", processedMessages[0].value)
+}
+
+func (suite *EventSourceTestSuite) TestFailedMessageNotCommitted() {
+	// fail the first message once
+	suite.runtime = eventsourcetest.NewRecordingRuntime(suite.recordMessage,
+		func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+			if string(event.GetBody()) == "a" && len(previousRecords) == 0 {
+				return nil, errors.New("Processing error")
+			}
+
+			return nil, nil
+		})
+
+	suite.broker.produce("events", 0, "", "a")
+	suite.broker.produce("events", 0, "", "b")
+
+	eventSource := suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(nil))
+
+	// a is processed twice, since its offset wasn't committed when it failed
+	suite.WaitForNumRecords(suite.runtime, 3)
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	processedMessages := suite.getProcessedMessages()
+	suite.Equal("a", processedMessages[0].value)
+	suite.Equal("a", processedMessages[1].value)
+	suite.Equal("b", processedMessages[2].value)
+	suite.Equal(int64(2), suite.broker.getCommittedOffset("events", "group1", 0))
+}
+
+func (suite *EventSourceTestSuite) TestOffsetOutOfRangeResets() {
+	suite.broker.produce("events", 0, "", "a")
+	suite.broker.produce("events", 0, "", "b")
+
+	// the checkpoint is past the partition's messages, so consumption resets to the earliest offset
+	checkpoint := `{"0": 5}`
+
+	eventSource := suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(&checkpoint))
+	suite.WaitForNumRecords(suite.runtime, 2)
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	suite.Equal(int64(2), suite.broker.getCommittedOffset("events", "group1", 0))
+}
+
+func (suite *EventSourceTestSuite) TestRebalanceJoinsAgain() {
+	suite.broker.produce("events", 0, "", "a")
+	suite.broker.produce("events", 1, "", "b")
+
+	eventSource := suite.createEventSource("group1")
+	suite.Require().NoError(eventSource.Start(nil))
+	suite.WaitForNumRecords(suite.runtime, 2)
+
+	suite.client.rebalance("events", "group1")
+
+	// the partitions are consumed again once the member joins, from the offsets it committed
+	suite.WaitFor(func() bool { return suite.client.getNumJoins() >= 2 })
+
+	suite.broker.produce("events", 0, "", "c")
+	suite.broker.produce("events", 1, "", "d")
+	suite.WaitForNumRecords(suite.runtime, 4)
+
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.JSONEq(`{"0": 2, "1": 2}`, *checkpoint)
+
+	processedValues := []string{}
+	for _, processedMessage := range suite.getProcessedMessages() {
+		processedValues = append(processedValues, processedMessage.value)
+	}
+
+	suite.Len(processedValues, 4)
+	suite.Subset(processedValues, []string{"a", "b", "c", "d"})
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	suite.ExpectStopReturns(suite.createEventSource("group1"))
+}
+
+func (suite *EventSourceTestSuite) TestConsumeOverTheWire() {
+	server, err := newTestServer()
+	suite.Require().NoError(err)
+
+	defer server.close()
+
+	server.createTopic("events", 2)
+	server.produce("events", 0, compressionGzip, "a", "b")
+	server.produce("events", 1, compressionSnappy, "c")
+
+	client, err := newConn(suite.Logger, []string{server.address()})
+	suite.Require().NoError(err)
+
+	defer client.Close()
+
+	eventSource := suite.createEventSourceWithClient(client, "group1")
+	suite.Require().NoError(eventSource.Start(nil))
+	suite.WaitForNumRecords(suite.runtime, 3)
+
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.JSONEq(`{"0": 2, "1": 1}`, *checkpoint)
+
+	for partition, expectedOffset := range []int64{2, 1} {
+		committedOffset, found := server.getCommittedOffset("group1", "events", partition)
+		suite.True(found, partition)
+		suite.Equal(expectedOffset, committedOffset, partition)
+	}
+
+	suite.Contains(suite.getProcessedMessages(), processedMessage{"b", "key", 0, 1, "test"})
+}
+
+func (suite *EventSourceTestSuite) createEventSource(consumerGroup string) eventsource.EventSource {
+	suite.client = &memoryClient{broker: suite.broker}
+
+	return suite.createEventSourceWithClient(suite.client, consumerGroup)
+}
+
+func (suite *EventSourceTestSuite) createEventSourceWithClient(client Client,
+	consumerGroup string) eventsource.EventSource {
+
+	eventSource, err := newEventSource(suite.Logger,
+		suite.CreateWorkerAllocator(suite.runtime, 2),
+		client,
+		&Configuration{
+			Configuration: eventsource.Configuration{
+				ID:             "kafka1",
+				RetryBackoffMs: 10,
+			},
+			Topic:          "events",
+			ConsumerGroup:  consumerGroup,
+			BatchSize:      10,
+			InitialOffset:  InitialOffsetEarliest,
+			FetchTimeoutMs: 50,
+		})
+
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+func (suite *EventSourceTestSuite) recordMessage(event nuclio.Event) interface{} {
+	return processedMessage{
+		value:     string(event.GetBody()),
+		key:       event.GetHeaderString("key"),
+		partition: event.GetHeader("partition").(int),
+		offset:    event.GetHeader("offset").(int64),
+		header:    event.GetHeaderString("source"),
+	}
+}
+
+func (suite *EventSourceTestSuite) getProcessedMessages() []processedMessage {
+	var processedMessages []processedMessage
+
+	for _, record := range suite.runtime.GetRecords() {
+		processedMessages = append(processedMessages, record.(processedMessage))
+	}
+
+	return processedMessages
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
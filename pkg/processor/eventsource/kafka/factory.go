@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"fmt"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// defaults
+	eventSourceConfiguration.SetDefault("client", "kafka")
+	eventSourceConfiguration.SetDefault("consumer_group", "nuclio")
+	eventSourceConfiguration.SetDefault("batch_size", 1)
+	eventSourceConfiguration.SetDefault("initial_offset", InitialOffsetEarliest)
+	eventSourceConfiguration.SetDefault("fetch_timeout_ms", 1000)
+
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"client":           eventsource.ValueTypeString,
+		"brokers":          eventsource.ValueTypeStringSlice,
+		"topic":            eventsource.ValueTypeString,
+		"consumer_group":   eventsource.ValueTypeString,
+		"batch_size":       eventsource.ValueTypeInt,
+		"initial_offset":   eventsource.ValueTypeString,
+		"fetch_timeout_ms": eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	kafkaConfiguration := &Configuration{
+		Configuration:  *configuration,
+		ClientKind:     eventSourceConfiguration.GetString("client"),
+		Brokers:        eventSourceConfiguration.GetStringSlice("brokers"),
+		Topic:          eventSourceConfiguration.GetString("topic"),
+		ConsumerGroup:  eventSourceConfiguration.GetString("consumer_group"),
+		BatchSize:      eventSourceConfiguration.GetInt("batch_size"),
+		InitialOffset:  eventSourceConfiguration.GetString("initial_offset"),
+		FetchTimeoutMs: eventSourceConfiguration.GetInt("fetch_timeout_ms"),
+	}
+
+	if kafkaConfiguration.Topic == "" {
+		return nil, fmt.Errorf("Kafka event source %s requires a topic", configuration.ID)
+	}
+
+	if kafkaConfiguration.InitialOffset != InitialOffsetEarliest && kafkaConfiguration.InitialOffset != InitialOffsetLatest {
+		return nil, fmt.Errorf("Invalid initial offset: %s", kafkaConfiguration.InitialOffset)
+	}
+
+	// create logger parent
+	kafkaLogger := parentLogger.GetChild("kafka").(nuclio.Logger)
+
+	// create the client through which we consume
+	client, err := ClientRegistrySingleton.NewClient(kafkaLogger, kafkaConfiguration.ClientKind, kafkaConfiguration.Brokers)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create kafka client")
+	}
+
+	// partitions are consumed concurrently, sharing a pool of workers
+	workerAllocator, err := eventsource.NewWorkerAllocator(kafkaLogger,
+		configuration,
+		runtimeConfiguration,
+		workerPools)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	kafkaEventSource, err := newEventSource(kafkaLogger, workerAllocator, client, kafkaConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create kafka event source")
+	}
+
+	return kafkaEventSource, nil
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("kafka", &factory{})
+}
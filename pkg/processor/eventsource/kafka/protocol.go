@@ -0,0 +1,703 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/pkg/errors"
+)
+
+// the requests the client sends (https://kafka.apache.org/protocol), and the version of each. the versions
+// are the oldest ones supported by all brokers since 0.11, through 4.x
+const (
+	apiKeyFetch           int16 = 1
+	apiKeyListOffsets     int16 = 2
+	apiKeyMetadata        int16 = 3
+	apiKeyOffsetCommit    int16 = 8
+	apiKeyOffsetFetch     int16 = 9
+	apiKeyFindCoordinator int16 = 10
+	apiKeyJoinGroup       int16 = 11
+	apiKeyHeartbeat       int16 = 12
+	apiKeyLeaveGroup      int16 = 13
+	apiKeySyncGroup       int16 = 14
+)
+
+var apiVersions = map[int16]int16{
+	apiKeyFetch:           4,
+	apiKeyListOffsets:     1,
+	apiKeyMetadata:        1,
+	apiKeyOffsetCommit:    2,
+	apiKeyOffsetFetch:     1,
+	apiKeyFindCoordinator: 0,
+	apiKeyJoinGroup:       2,
+	apiKeyHeartbeat:       0,
+	apiKeyLeaveGroup:      0,
+	apiKeySyncGroup:       0,
+}
+
+// the error codes the client acts on
+const (
+	errorCodeNone                       int16 = 0
+	errorCodeOffsetOutOfRange           int16 = 1
+	errorCodeUnknownTopicOrPartition    int16 = 3
+	errorCodeLeaderNotAvailable         int16 = 5
+	errorCodeNotLeaderForPartition      int16 = 6
+	errorCodeCoordinatorLoadInProgress  int16 = 14
+	errorCodeCoordinatorNotAvailable    int16 = 15
+	errorCodeNotCoordinator             int16 = 16
+	errorCodeIllegalGeneration          int16 = 22
+	errorCodeUnknownMemberID            int16 = 25
+	errorCodeRebalanceInProgress        int16 = 27
+	errorCodeFencedLeaderEpoch          int16 = 74
+	errorCodeUnknownLeaderEpoch         int16 = 75
+	errorCodeOffsetNotAvailable         int16 = 78
+	errorCodeUnsupportedCompressionType int16 = 76
+)
+
+// an error code returned by a broker
+type brokerError int16
+
+func (be brokerError) Error() string {
+	return fmt.Sprintf("Broker returned error code %d", int16(be))
+}
+
+// the coordinator moved or isn't ready, so it should be looked up again
+func (be brokerError) isCoordinatorError() bool {
+	switch int16(be) {
+	case errorCodeCoordinatorLoadInProgress, errorCodeCoordinatorNotAvailable, errorCodeNotCoordinator:
+		return true
+	}
+
+	return false
+}
+
+// the partition leader moved or isn't known, so the metadata should be refreshed
+func (be brokerError) isLeaderError() bool {
+	switch int16(be) {
+	case errorCodeUnknownTopicOrPartition,
+		errorCodeLeaderNotAvailable,
+		errorCodeNotLeaderForPartition,
+		errorCodeFencedLeaderEpoch,
+		errorCodeUnknownLeaderEpoch,
+		errorCodeOffsetNotAvailable:
+		return true
+	}
+
+	return false
+}
+
+// the member's generation ended, so it must join the group again
+func (be brokerError) isRebalanceError() bool {
+	switch int16(be) {
+	case errorCodeIllegalGeneration, errorCodeUnknownMemberID, errorCodeRebalanceInProgress:
+		return true
+	}
+
+	return false
+}
+
+func errorFromCode(errorCode int16) error {
+	if errorCode == errorCodeNone {
+		return nil
+	}
+
+	return brokerError(errorCode)
+}
+
+//
+// Encoding
+// Integers are big endian. strings and byte arrays are prefixed by their length (-1 - null), as are arrays
+//
+
+type encoder struct {
+	buffer []byte
+}
+
+func (e *encoder) putInt8(value int8) {
+	e.buffer = append(e.buffer, byte(value))
+}
+
+func (e *encoder) putInt16(value int16) {
+	e.buffer = append(e.buffer, byte(value>>8), byte(value))
+}
+
+func (e *encoder) putInt32(value int32) {
+	e.buffer = append(e.buffer, byte(value>>24), byte(value>>16), byte(value>>8), byte(value))
+}
+
+func (e *encoder) putInt64(value int64) {
+	e.putInt32(int32(value >> 32))
+	e.putInt32(int32(value))
+}
+
+func (e *encoder) putString(value string) {
+	e.putInt16(int16(len(value)))
+	e.buffer = append(e.buffer, value...)
+}
+
+func (e *encoder) putBytes(value []byte) {
+	if value == nil {
+		e.putInt32(-1)
+		return
+	}
+
+	e.putInt32(int32(len(value)))
+	e.buffer = append(e.buffer, value...)
+}
+
+func (e *encoder) putArrayLength(length int) {
+	e.putInt32(int32(length))
+}
+
+// reads a response. the first read past the end of the buffer sets err, after which reads return zero values
+type decoder struct {
+	buffer []byte
+	err    error
+}
+
+func (d *decoder) take(length int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if length < 0 || length > len(d.buffer) {
+		d.err = errors.New("Response is truncated")
+		return nil
+	}
+
+	value := d.buffer[:length]
+	d.buffer = d.buffer[length:]
+
+	return value
+}
+
+func (d *decoder) getInt8() int8 {
+	value := d.take(1)
+	if value == nil {
+		return 0
+	}
+
+	return int8(value[0])
+}
+
+func (d *decoder) getInt16() int16 {
+	value := d.take(2)
+	if value == nil {
+		return 0
+	}
+
+	return int16(binary.BigEndian.Uint16(value))
+}
+
+func (d *decoder) getInt32() int32 {
+	value := d.take(4)
+	if value == nil {
+		return 0
+	}
+
+	return int32(binary.BigEndian.Uint32(value))
+}
+
+func (d *decoder) getInt64() int64 {
+	value := d.take(8)
+	if value == nil {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(value))
+}
+
+// null strings are returned as empty
+func (d *decoder) getString() string {
+	length := d.getInt16()
+	if length < 0 {
+		return ""
+	}
+
+	return string(d.take(int(length)))
+}
+
+func (d *decoder) getBytes() []byte {
+	length := d.getInt32()
+	if length < 0 {
+		return nil
+	}
+
+	return d.take(int(length))
+}
+
+// null arrays are returned as empty
+func (d *decoder) getArrayLength() int {
+	length := d.getInt32()
+	if length < 0 {
+		return 0
+	}
+
+	// each element takes at least a byte, so this guards against allocating for a corrupt length
+	if int(length) > len(d.buffer) {
+		d.err = errors.New("Array exceeds response")
+		return 0
+	}
+
+	return int(length)
+}
+
+// records encode integers as zigzag varints
+func (d *decoder) getVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	value, length := binary.Varint(d.buffer)
+	if length <= 0 {
+		d.err = errors.New("Malformed varint")
+		return 0
+	}
+
+	d.buffer = d.buffer[length:]
+
+	return value
+}
+
+func (d *decoder) getVarintBytes() []byte {
+	length := d.getVarint()
+	if length < 0 {
+		return nil
+	}
+
+	return d.take(int(length))
+}
+
+//
+// Records
+// Fetched as record batches (magic 2) or, if written by old producers, as message sets (magic 0 and 1)
+//
+
+const (
+	compressionNone   = 0
+	compressionGzip   = 1
+	compressionSnappy = 2
+	compressionLZ4    = 3
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// returns the messages at or after fromOffset, and the offset following the last record read (including
+// records that aren't returned, like those of transaction control batches)
+func parseRecords(topic string, partition int, records []byte, fromOffset int64) ([]*Message, int64, error) {
+	var messages []*Message
+
+	nextOffset := fromOffset
+
+	// the first 17 bytes of both formats are the offset, the length and then the magic at the same position
+	for len(records) >= 17 {
+		length := int(int32(binary.BigEndian.Uint32(records[8:])))
+
+		// the broker may cut the last batch short
+		if length < 0 || 12+length > len(records) {
+			break
+		}
+
+		batch := records[:12+length]
+		records = records[12+length:]
+
+		var batchMessages []*Message
+		var batchNextOffset int64
+		var err error
+
+		switch magic := int8(batch[16]); magic {
+		case 2:
+			batchMessages, batchNextOffset, err = parseRecordBatch(topic, partition, batch)
+		case 0, 1:
+			batchMessages, batchNextOffset, err = parseMessageSet(topic, partition, batch)
+		default:
+			err = fmt.Errorf("Unknown magic %d", magic)
+		}
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, message := range batchMessages {
+			if message.Offset >= fromOffset {
+				messages = append(messages, message)
+			}
+		}
+
+		if batchNextOffset > nextOffset {
+			nextOffset = batchNextOffset
+		}
+	}
+
+	return messages, nextOffset, nil
+}
+
+func parseRecordBatch(topic string, partition int, batch []byte) ([]*Message, int64, error) {
+	batchDecoder := decoder{buffer: batch}
+
+	baseOffset := batchDecoder.getInt64()
+	batchDecoder.getInt32() // length
+	batchDecoder.getInt32() // partition leader epoch
+	batchDecoder.getInt8()  // magic
+	checksum := uint32(batchDecoder.getInt32())
+
+	if crc32.Checksum(batchDecoder.buffer, crc32cTable) != checksum {
+		return nil, 0, errors.New("Record batch checksum mismatch")
+	}
+
+	attributes := batchDecoder.getInt16()
+	lastOffsetDelta := batchDecoder.getInt32()
+	firstTimestamp := batchDecoder.getInt64()
+	maxTimestamp := batchDecoder.getInt64()
+	batchDecoder.getInt64() // producer ID
+	batchDecoder.getInt16() // producer epoch
+	batchDecoder.getInt32() // base sequence
+	numRecords := batchDecoder.getInt32()
+
+	if batchDecoder.err != nil {
+		return nil, 0, batchDecoder.err
+	}
+
+	nextOffset := baseOffset + int64(lastOffsetDelta) + 1
+
+	// control batches mark transaction boundaries, and hold no messages
+	if attributes&0x20 != 0 {
+		return nil, nextOffset, nil
+	}
+
+	recordsBuffer, err := decompress(int(attributes&0x7), batchDecoder.buffer)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "Failed to decompress record batch")
+	}
+
+	// the broker stamps all records with the same time if the topic uses log append time
+	logAppendTime := attributes&0x8 != 0
+
+	recordsDecoder := decoder{buffer: recordsBuffer}
+	messages := make([]*Message, 0, numRecords)
+
+	for recordIndex := 0; recordIndex < int(numRecords); recordIndex++ {
+		record := decoder{buffer: recordsDecoder.getVarintBytes()}
+
+		record.getInt8() // attributes
+		timestampDelta := record.getVarint()
+		offsetDelta := record.getVarint()
+
+		message := &Message{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    baseOffset + offsetDelta,
+			Key:       record.getVarintBytes(),
+			Value:     record.getVarintBytes(),
+			Timestamp: getTimestamp(firstTimestamp + timestampDelta),
+		}
+
+		if logAppendTime {
+			message.Timestamp = getTimestamp(maxTimestamp)
+		}
+
+		numHeaders := int(record.getVarint())
+		if numHeaders > 0 {
+			message.Headers = map[string][]byte{}
+		}
+
+		for headerIndex := 0; headerIndex < numHeaders && record.err == nil; headerIndex++ {
+			key := string(record.getVarintBytes())
+			message.Headers[key] = record.getVarintBytes()
+		}
+
+		if recordsDecoder.err != nil || record.err != nil {
+			return nil, 0, errors.New("Malformed record")
+		}
+
+		messages = append(messages, message)
+	}
+
+	return messages, nextOffset, nil
+}
+
+// a message set is a sequence of messages, each holding a single record or, if compressed, a nested message set
+func parseMessageSet(topic string, partition int, messageSet []byte) ([]*Message, int64, error) {
+	var messages []*Message
+	var nextOffset int64
+
+	for len(messageSet) >= 12 {
+		messageDecoder := decoder{buffer: messageSet}
+
+		offset := messageDecoder.getInt64()
+		length := int(messageDecoder.getInt32())
+
+		if length < 0 || 12+length > len(messageSet) {
+			break
+		}
+
+		messageDecoder.buffer = messageSet[12 : 12+length]
+		messageSet = messageSet[12+length:]
+
+		messageDecoder.getInt32() // crc
+		magic := messageDecoder.getInt8()
+		attributes := messageDecoder.getInt8()
+
+		var timestamp time.Time
+		if magic == 1 {
+			timestamp = getTimestamp(messageDecoder.getInt64())
+		}
+
+		key := messageDecoder.getBytes()
+		value := messageDecoder.getBytes()
+
+		if messageDecoder.err != nil {
+			return nil, 0, errors.New("Malformed message")
+		}
+
+		if compression := int(attributes & 0x7); compression != compressionNone {
+			innerMessageSet, err := decompress(compression, value)
+			if err != nil {
+				return nil, 0, errors.Wrap(err, "Failed to decompress message set")
+			}
+
+			innerMessages, _, err := parseMessageSet(topic, partition, innerMessageSet)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			// in magic 1, the offsets of the inner messages are relative, and the wrapper's is that of the last
+			if magic == 1 && len(innerMessages) != 0 {
+				baseOffset := offset - innerMessages[len(innerMessages)-1].Offset
+
+				for _, innerMessage := range innerMessages {
+					innerMessage.Offset += baseOffset
+				}
+			}
+
+			messages = append(messages, innerMessages...)
+		} else {
+			messages = append(messages, &Message{
+				Topic:     topic,
+				Partition: partition,
+				Offset:    offset,
+				Key:       key,
+				Value:     value,
+				Timestamp: timestamp,
+			})
+		}
+
+		nextOffset = offset + 1
+	}
+
+	return messages, nextOffset, nil
+}
+
+func decompress(compression int, data []byte) ([]byte, error) {
+	switch compression {
+	case compressionNone:
+		return data, nil
+
+	case compressionGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		return ioutil.ReadAll(reader)
+
+	case compressionSnappy:
+		return decompressSnappy(data)
+
+	case compressionLZ4:
+		return decompressLZ4(data)
+	}
+
+	return nil, fmt.Errorf("Unsupported compression codec %d", compression)
+}
+
+// the java client frames snappy blocks the way xerial's snappy-java does: a header, and then each block
+// prefixed by its length. other clients write a single unframed block
+var xerialHeader = []byte{0x82, 'S', 'N', 'A', 'P', 'P', 'Y', 0}
+
+func decompressSnappy(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, xerialHeader) {
+		return snappy.Decode(nil, data)
+	}
+
+	var decompressed []byte
+
+	// skip the header, version and compatible version
+	blocksDecoder := decoder{buffer: data[16:]}
+
+	for len(blocksDecoder.buffer) != 0 {
+		block := blocksDecoder.take(int(blocksDecoder.getInt32()))
+		if blocksDecoder.err != nil {
+			return nil, blocksDecoder.err
+		}
+
+		decompressedBlock, err := snappy.Decode(nil, block)
+		if err != nil {
+			return nil, err
+		}
+
+		decompressed = append(decompressed, decompressedBlock...)
+	}
+
+	return decompressed, nil
+}
+
+// kafka uses the LZ4 frame format (https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md). checksums
+// aren't verified, since brokers before 0.10 computed the header checksum wrong
+func decompressLZ4(data []byte) ([]byte, error) {
+	frameDecoder := decoder{buffer: data}
+
+	if uint32(frameDecoder.getInt32()) != 0x04224d18 {
+		return nil, errors.New("Invalid LZ4 frame magic")
+	}
+
+	flags := uint8(frameDecoder.getInt8())
+	frameDecoder.getInt8() // block maximum size
+
+	blockChecksums := flags&0x10 != 0
+
+	// content size, if present, and the header checksum
+	if flags&0x08 != 0 {
+		frameDecoder.take(8)
+	}
+
+	frameDecoder.take(1)
+
+	var decompressed []byte
+
+	for frameDecoder.err == nil {
+		encodedBlockSize := frameDecoder.take(4)
+		if encodedBlockSize == nil {
+			break
+		}
+
+		blockSize := binary.LittleEndian.Uint32(encodedBlockSize)
+
+		// end mark
+		if blockSize == 0 {
+			break
+		}
+
+		block := frameDecoder.take(int(blockSize & 0x7fffffff))
+
+		if blockChecksums {
+			frameDecoder.take(4)
+		}
+
+		if frameDecoder.err != nil {
+			break
+		}
+
+		// the high bit marks blocks that were stored uncompressed
+		if blockSize&0x80000000 != 0 {
+			decompressed = append(decompressed, block...)
+			continue
+		}
+
+		var err error
+
+		decompressed, err = decompressLZ4Block(decompressed, block)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if frameDecoder.err != nil {
+		return nil, errors.New("Truncated LZ4 frame")
+	}
+
+	return decompressed, nil
+}
+
+// appends the block's contents to output. blocks are sequences of literals followed by matches, which copy
+// from the data decompressed so far (including that of previous blocks, if the frame links them)
+func decompressLZ4Block(output []byte, block []byte) ([]byte, error) {
+	readLength := func(length int) (int, error) {
+		for length >= 15 || length == 0 {
+			if len(block) == 0 {
+				return 0, errors.New("Truncated LZ4 block")
+			}
+
+			extra := int(block[0])
+			block = block[1:]
+			length += extra
+
+			if extra != 255 {
+				break
+			}
+		}
+
+		return length, nil
+	}
+
+	for len(block) != 0 {
+		token := block[0]
+		block = block[1:]
+
+		literalsLength := int(token >> 4)
+		if literalsLength == 15 {
+			var err error
+
+			if literalsLength, err = readLength(literalsLength); err != nil {
+				return nil, err
+			}
+		}
+
+		if literalsLength > len(block) {
+			return nil, errors.New("Truncated LZ4 literals")
+		}
+
+		output = append(output, block[:literalsLength]...)
+		block = block[literalsLength:]
+
+		// the last sequence has only literals
+		if len(block) == 0 {
+			break
+		}
+
+		if len(block) < 2 {
+			return nil, errors.New("Truncated LZ4 match")
+		}
+
+		matchOffset := int(binary.LittleEndian.Uint16(block))
+		block = block[2:]
+
+		matchLength := int(token & 0xf)
+		if matchLength == 15 {
+			var err error
+
+			if matchLength, err = readLength(matchLength); err != nil {
+				return nil, err
+			}
+		}
+
+		matchLength += 4
+
+		if matchOffset == 0 || matchOffset > len(output) {
+			return nil, errors.New("Invalid LZ4 match offset")
+		}
+
+		// matches may overlap the output they produce, so copy byte by byte
+		matchStart := len(output) - matchOffset
+		for matchIndex := 0; matchIndex < matchLength; matchIndex++ {
+			output = append(output, output[matchStart+matchIndex])
+		}
+	}
+
+	return output, nil
+}
+
+// timestamps are in milliseconds since the epoch (-1 - none)
+func getTimestamp(timestampMs int64) time.Time {
+	if timestampMs < 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, timestampMs*int64(time.Millisecond))
+}
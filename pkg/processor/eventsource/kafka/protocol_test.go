@@ -0,0 +1,233 @@
+package kafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProtocolTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ProtocolTestSuite) TestParseRecordBatch() {
+	records := encodeRecordBatch(10, compressionNone, []string{"a", "b", "c"})
+
+	// messages before the fetched offset are skipped, since brokers return whole batches
+	messages, nextOffset, err := parseRecords("events", 1, records, 11)
+	suite.Require().NoError(err)
+	suite.Equal(int64(13), nextOffset)
+	suite.Require().Len(messages, 2)
+
+	suite.Equal("events", messages[0].Topic)
+	suite.Equal(1, messages[0].Partition)
+	suite.Equal(int64(11), messages[0].Offset)
+	suite.Equal("key", string(messages[0].Key))
+	suite.Equal("b", string(messages[0].Value))
+	suite.Equal("test", string(messages[0].Headers["source"]))
+	suite.Equal(int64(1500000000001), messages[0].Timestamp.UnixNano()/1000000)
+}
+
+func (suite *ProtocolTestSuite) TestParseCompressedRecordBatches() {
+	for _, compression := range []int{compressionGzip, compressionSnappy} {
+		messages, _, err := parseRecords("events", 0, encodeRecordBatch(0, compression, []string{"a", "b"}), 0)
+		suite.Require().NoError(err)
+		suite.Require().Len(messages, 2)
+		suite.Equal("b", string(messages[1].Value))
+	}
+}
+
+func (suite *ProtocolTestSuite) TestParseTruncatedRecords() {
+	records := encodeRecordBatch(0, compressionNone, []string{"a"})
+	records = append(records, encodeRecordBatch(1, compressionNone, []string{"b"})...)
+
+	// the broker may cut the last batch short, in which case only the whole batches are returned
+	messages, nextOffset, err := parseRecords("events", 0, records[:len(records)-5], 0)
+	suite.Require().NoError(err)
+	suite.Require().Len(messages, 1)
+	suite.Equal(int64(1), nextOffset)
+
+	// corrupt batches are rejected
+	records[len(records)-1]++
+
+	_, _, err = parseRecords("events", 0, records, 0)
+	suite.Error(err)
+}
+
+func (suite *ProtocolTestSuite) TestParseControlBatch() {
+	records := encodeRecordBatch(5, compressionNone, []string{"marker"})
+
+	// mark as a control batch and recompute the checksum
+	binary.BigEndian.PutUint16(records[21:], 0x20)
+	binary.BigEndian.PutUint32(records[17:], crc32.Checksum(records[21:], crc32cTable))
+
+	messages, nextOffset, err := parseRecords("events", 0, records, 5)
+	suite.Require().NoError(err)
+	suite.Empty(messages)
+	suite.Equal(int64(6), nextOffset)
+}
+
+func (suite *ProtocolTestSuite) TestParseCompressedMessageSet() {
+	innerMessageSet := encodeMessage(0, compressionNone, []byte("a"))
+	innerMessageSet = append(innerMessageSet, encodeMessage(1, compressionNone, []byte("b"))...)
+
+	compressedMessageSet := bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(&compressedMessageSet)
+	gzipWriter.Write(innerMessageSet)
+	gzipWriter.Close()
+
+	// the wrapper has the offset of the last inner message, whose offsets are relative
+	messages, nextOffset, err := parseRecords("events", 0, encodeMessage(21, compressionGzip, compressedMessageSet.Bytes()), 0)
+	suite.Require().NoError(err)
+	suite.Equal(int64(22), nextOffset)
+	suite.Require().Len(messages, 2)
+	suite.Equal(int64(20), messages[0].Offset)
+	suite.Equal("a", string(messages[0].Value))
+	suite.Equal(int64(21), messages[1].Offset)
+	suite.Equal("b", string(messages[1].Value))
+}
+
+func (suite *ProtocolTestSuite) TestDecompressXerialSnappy() {
+	framed := append([]byte{}, xerialHeader...)
+	framed = append(framed, 0, 0, 0, 1, 0, 0, 0, 1)
+
+	for _, block := range []string{"hello ", "world"} {
+		encodedBlock := snappy.Encode(nil, []byte(block))
+		framed = append(framed, 0, 0, 0, byte(len(encodedBlock)))
+		framed = append(framed, encodedBlock...)
+	}
+
+	decompressed, err := decompress(compressionSnappy, framed)
+	suite.Require().NoError(err)
+	suite.Equal("hello world", string(decompressed))
+}
+
+func (suite *ProtocolTestSuite) TestDecompressLZ4() {
+	block := []byte{
+
+		// 3 literals and a match of 9 bytes, 3 bytes back
+		0x35, 'a', 'b', 'c', 3, 0,
+
+		// a last literal
+		0x10, 'd',
+	}
+
+	frame := []byte{0x04, 0x22, 0x4d, 0x18, 0x60, 0x40, 0x82}
+	frame = append(frame, byte(len(block)), 0, 0, 0)
+	frame = append(frame, block...)
+
+	// a block stored uncompressed, and the end mark
+	frame = append(frame, 2, 0, 0, 0x80, 'e', 'f')
+	frame = append(frame, 0, 0, 0, 0)
+
+	decompressed, err := decompress(compressionLZ4, frame)
+	suite.Require().NoError(err)
+	suite.Equal("abcabcabcabcdef", string(decompressed))
+
+	_, err = decompress(compressionLZ4, frame[:10])
+	suite.Error(err)
+}
+
+func (suite *ProtocolTestSuite) TestAssignRange() {
+	assignments := assignRange("events", 5, map[string][]string{
+		"member-b": {"events"},
+		"member-a": {"events"},
+		"member-c": {"other"},
+	})
+
+	suite.Equal(map[string][]int{
+		"member-a": {0, 1, 2},
+		"member-b": {3, 4},
+		"member-c": {},
+	}, assignments)
+}
+
+// encodes a record batch holding a record per value, with timestamps starting at 1500000000000
+func encodeRecordBatch(baseOffset int64, compression int, values []string) []byte {
+	var records []byte
+
+	for recordIndex, value := range values {
+		record := []byte{0} // attributes
+		record = appendVarint(record, int64(recordIndex))
+		record = appendVarint(record, int64(recordIndex))
+		record = appendVarintBytes(record, []byte("key"))
+		record = appendVarintBytes(record, []byte(value))
+		record = appendVarint(record, 1)
+		record = appendVarintBytes(record, []byte("source"))
+		record = appendVarintBytes(record, []byte("test"))
+
+		records = appendVarint(records, int64(len(record)))
+		records = append(records, record...)
+	}
+
+	switch compression {
+	case compressionGzip:
+		compressedRecords := bytes.Buffer{}
+		gzipWriter := gzip.NewWriter(&compressedRecords)
+		gzipWriter.Write(records)
+		gzipWriter.Close()
+
+		records = compressedRecords.Bytes()
+
+	case compressionSnappy:
+		records = snappy.Encode(nil, records)
+	}
+
+	// the fields following the checksum, which covers them
+	checksummed := encoder{}
+	checksummed.putInt16(int16(compression))
+	checksummed.putInt32(int32(len(values) - 1))
+	checksummed.putInt64(1500000000000)
+	checksummed.putInt64(1500000000000 + int64(len(values)-1))
+	checksummed.putInt64(-1) // producer ID
+	checksummed.putInt16(-1) // producer epoch
+	checksummed.putInt32(-1) // base sequence
+	checksummed.putInt32(int32(len(values)))
+	checksummed.buffer = append(checksummed.buffer, records...)
+
+	batch := encoder{}
+	batch.putInt64(baseOffset)
+	batch.putInt32(int32(9 + len(checksummed.buffer)))
+	batch.putInt32(0) // partition leader epoch
+	batch.putInt8(2)  // magic
+	batch.putInt32(int32(crc32.Checksum(checksummed.buffer, crc32cTable)))
+	batch.buffer = append(batch.buffer, checksummed.buffer...)
+
+	return batch.buffer
+}
+
+// encodes a magic 1 message
+func encodeMessage(offset int64, compression int, value []byte) []byte {
+	message := encoder{}
+	message.putInt32(0) // crc
+	message.putInt8(1)  // magic
+	message.putInt8(int8(compression))
+	message.putInt64(1500000000000)
+	message.putBytes(nil) // key
+	message.putBytes(value)
+
+	messageSet := encoder{}
+	messageSet.putInt64(offset)
+	messageSet.putBytes(message.buffer)
+
+	return messageSet.buffer
+}
+
+func appendVarint(buffer []byte, value int64) []byte {
+	encodedValue := make([]byte, binary.MaxVarintLen64)
+
+	return append(buffer, encodedValue[:binary.PutVarint(encodedValue, value)]...)
+}
+
+func appendVarintBytes(buffer []byte, value []byte) []byte {
+	return append(appendVarint(buffer, int64(len(value))), value...)
+}
+
+func TestProtocolTestSuite(t *testing.T) {
+	suite.Run(t, new(ProtocolTestSuite))
+}
@@ -0,0 +1,719 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// a partition's log, as the record batches produced to it
+type testPartition struct {
+	batches     [][]byte
+	startOffset int64
+	endOffset   int64
+}
+
+// a consumer group. members join the generation being formed, which completes once all of them joined
+type testGroup struct {
+	generationID int32
+	leaderID     string
+	rebalancing  bool
+
+	// the subscription of each member, and whether it joined the generation being formed
+	members map[string][]byte
+	joined  map[string]bool
+
+	// the assignment of each member, once the leader sent them
+	assignments map[string][]byte
+
+	// committed offsets, keyed by topic/partition
+	offsets map[string]int64
+}
+
+// a single broker speaking the Kafka protocol over TCP, leading all partitions and coordinating all groups.
+// connections sending requests in versions other than the client's are dropped
+type testServer struct {
+	listener net.Listener
+	lock     sync.Mutex
+	cond     *sync.Cond
+	closed   bool
+	conns    []net.Conn
+
+	topics          map[string][]*testPartition
+	groups          map[string]*testGroup
+	nextMemberIndex int
+
+	// the number of requests received of each API key, and error codes to fail the next ones with
+	numRequests    map[int16]int
+	injectedErrors map[int16][]int16
+}
+
+func newTestServer() (*testServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	newTestServer := &testServer{
+		listener:       listener,
+		topics:         map[string][]*testPartition{},
+		groups:         map[string]*testGroup{},
+		numRequests:    map[int16]int{},
+		injectedErrors: map[int16][]int16{},
+	}
+
+	newTestServer.cond = sync.NewCond(&newTestServer.lock)
+
+	go newTestServer.accept()
+
+	return newTestServer, nil
+}
+
+func (ts *testServer) address() string {
+	return ts.listener.Addr().String()
+}
+
+func (ts *testServer) close() {
+	ts.listener.Close()
+	ts.dropConnections()
+
+	ts.lock.Lock()
+	ts.closed = true
+	ts.cond.Broadcast()
+	ts.lock.Unlock()
+}
+
+func (ts *testServer) createTopic(topic string, numPartitions int) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for partitionIndex := 0; partitionIndex < numPartitions; partitionIndex++ {
+		ts.topics[topic] = append(ts.topics[topic], &testPartition{})
+	}
+}
+
+// appends a record batch holding the values, compressed with the given codec
+func (ts *testServer) produce(topic string, partition int, compression int, values ...string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	testPartition := ts.topics[topic][partition]
+	testPartition.batches = append(testPartition.batches,
+		encodeRecordBatch(testPartition.endOffset, compression, values))
+	testPartition.endOffset += int64(len(values))
+
+	ts.cond.Broadcast()
+}
+
+// deletes the messages before the offset, as retention does
+func (ts *testServer) deleteBefore(topic string, partition int, offset int64) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.topics[topic][partition].startOffset = offset
+}
+
+// fails the next request of the API key with the error code
+func (ts *testServer) failNext(apiKey int16, errorCode int16) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.injectedErrors[apiKey] = append(ts.injectedErrors[apiKey], errorCode)
+}
+
+func (ts *testServer) getNumRequests(apiKey int16) int {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	return ts.numRequests[apiKey]
+}
+
+func (ts *testServer) getCommittedOffset(group string, topic string, partition int) (int64, bool) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	offset, found := ts.getGroup(group).offsets[topic+"/"+strconv.Itoa(partition)]
+
+	return offset, found
+}
+
+func (ts *testServer) getMemberIDs(group string) []string {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	var memberIDs []string
+
+	for memberID := range ts.getGroup(group).members {
+		memberIDs = append(memberIDs, memberID)
+	}
+
+	sort.Strings(memberIDs)
+
+	return memberIDs
+}
+
+// closes the connections of all clients, which redial on their next request
+func (ts *testServer) dropConnections() {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for _, conn := range ts.conns {
+		conn.Close()
+	}
+
+	ts.conns = nil
+}
+
+func (ts *testServer) accept() {
+	for {
+		conn, err := ts.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		ts.lock.Lock()
+		ts.conns = append(ts.conns, conn)
+		ts.lock.Unlock()
+
+		go ts.serve(conn)
+	}
+}
+
+func (ts *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		sizeBuffer := make([]byte, 4)
+		if _, err := io.ReadFull(conn, sizeBuffer); err != nil {
+			return
+		}
+
+		requestBuffer := make([]byte, binary.BigEndian.Uint32(sizeBuffer))
+		if _, err := io.ReadFull(conn, requestBuffer); err != nil {
+			return
+		}
+
+		request := &decoder{buffer: requestBuffer}
+		apiKey := request.getInt16()
+		apiVersion := request.getInt16()
+		correlationID := request.getInt32()
+		request.getString() // client ID
+
+		if expectedVersion, known := apiVersions[apiKey]; !known || apiVersion != expectedVersion {
+			return
+		}
+
+		responseBody := ts.handle(apiKey, request)
+		if responseBody == nil || request.err != nil {
+			return
+		}
+
+		response := encoder{}
+		response.putInt32(int32(4 + len(responseBody.buffer)))
+		response.putInt32(correlationID)
+		response.buffer = append(response.buffer, responseBody.buffer...)
+
+		if _, err := conn.Write(response.buffer); err != nil {
+			return
+		}
+	}
+}
+
+// returns the body of the response, or nil to drop the connection
+func (ts *testServer) handle(apiKey int16, request *decoder) *encoder {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.numRequests[apiKey]++
+
+	injectedErrorCode := errorCodeNone
+
+	if injectedErrors := ts.injectedErrors[apiKey]; len(injectedErrors) != 0 {
+		injectedErrorCode = injectedErrors[0]
+		ts.injectedErrors[apiKey] = injectedErrors[1:]
+	}
+
+	switch apiKey {
+	case apiKeyMetadata:
+		return ts.handleMetadata(request)
+	case apiKeyFindCoordinator:
+		return ts.handleFindCoordinator(request)
+	case apiKeyListOffsets:
+		return ts.handleListOffsets(request)
+	case apiKeyFetch:
+		return ts.handleFetch(request, injectedErrorCode)
+	case apiKeyJoinGroup:
+		return ts.handleJoinGroup(request)
+	case apiKeySyncGroup:
+		return ts.handleSyncGroup(request, injectedErrorCode)
+	case apiKeyHeartbeat:
+		return ts.handleHeartbeat(request)
+	case apiKeyLeaveGroup:
+		return ts.handleLeaveGroup(request)
+	case apiKeyOffsetCommit:
+		return ts.handleOffsetCommit(request, injectedErrorCode)
+	case apiKeyOffsetFetch:
+		return ts.handleOffsetFetch(request)
+	}
+
+	return nil
+}
+
+func (ts *testServer) handleMetadata(request *decoder) *encoder {
+	host, port, _ := net.SplitHostPort(ts.address())
+	portNumber, _ := strconv.Atoi(port)
+
+	response := &encoder{}
+	response.putArrayLength(1)
+	response.putInt32(1) // node ID
+	response.putString(host)
+	response.putInt32(int32(portNumber))
+	response.putInt16(-1) // rack
+	response.putInt32(1)  // controller ID
+
+	numTopics := request.getArrayLength()
+	response.putArrayLength(numTopics)
+
+	for topicIndex := 0; topicIndex < numTopics; topicIndex++ {
+		topic := request.getString()
+		partitions, found := ts.topics[topic]
+
+		if found {
+			response.putInt16(errorCodeNone)
+		} else {
+			response.putInt16(errorCodeUnknownTopicOrPartition)
+		}
+
+		response.putString(topic)
+		response.putInt8(0) // internal
+		response.putArrayLength(len(partitions))
+
+		for partition := range partitions {
+			response.putInt16(errorCodeNone)
+			response.putInt32(int32(partition))
+			response.putInt32(1) // leader
+
+			// replicas and in sync replicas
+			for replicaSetIndex := 0; replicaSetIndex < 2; replicaSetIndex++ {
+				response.putArrayLength(1)
+				response.putInt32(1)
+			}
+		}
+	}
+
+	return response
+}
+
+func (ts *testServer) handleFindCoordinator(request *decoder) *encoder {
+	request.getString() // group
+
+	host, port, _ := net.SplitHostPort(ts.address())
+	portNumber, _ := strconv.Atoi(port)
+
+	response := &encoder{}
+	response.putInt16(errorCodeNone)
+	response.putInt32(1) // node ID
+	response.putString(host)
+	response.putInt32(int32(portNumber))
+
+	return response
+}
+
+func (ts *testServer) handleListOffsets(request *decoder) *encoder {
+	request.getInt32() // replica ID
+
+	response := &encoder{}
+
+	numTopics := request.getArrayLength()
+	response.putArrayLength(numTopics)
+
+	for topicIndex := 0; topicIndex < numTopics; topicIndex++ {
+		topic := request.getString()
+		response.putString(topic)
+
+		numPartitions := request.getArrayLength()
+		response.putArrayLength(numPartitions)
+
+		for partitionIndex := 0; partitionIndex < numPartitions; partitionIndex++ {
+			partition := request.getInt32()
+			timestamp := request.getInt64()
+			testPartition := ts.topics[topic][partition]
+
+			response.putInt32(partition)
+			response.putInt16(errorCodeNone)
+			response.putInt64(-1) // timestamp
+
+			// the earliest offset is requested by -2, the latest by -1
+			if timestamp == -2 {
+				response.putInt64(testPartition.startOffset)
+			} else {
+				response.putInt64(testPartition.endOffset)
+			}
+		}
+	}
+
+	return response
+}
+
+// returns the batches holding the messages from the offset. waits up to the max wait for them to be produced
+func (ts *testServer) handleFetch(request *decoder, injectedErrorCode int16) *encoder {
+	request.getInt32() // replica ID
+	maxWait := time.Duration(request.getInt32()) * time.Millisecond
+	request.getInt32() // min bytes
+	request.getInt32() // max bytes
+	request.getInt8()  // isolation level
+	request.getArrayLength()
+	topic := request.getString()
+	request.getArrayLength()
+	partition := request.getInt32()
+	offset := request.getInt64()
+	request.getInt32() // partition max bytes
+
+	testPartition := ts.topics[topic][partition]
+	errorCode := injectedErrorCode
+
+	if errorCode == errorCodeNone && (offset < testPartition.startOffset || offset > testPartition.endOffset) {
+		errorCode = errorCodeOffsetOutOfRange
+	}
+
+	// wake up once the max wait passed, unless a message was produced before
+	deadline := time.Now().Add(maxWait)
+	deadlineTimer := time.AfterFunc(maxWait, func() {
+		ts.lock.Lock()
+		ts.cond.Broadcast()
+		ts.lock.Unlock()
+	})
+
+	defer deadlineTimer.Stop()
+
+	for errorCode == errorCodeNone && offset == testPartition.endOffset && time.Now().Before(deadline) && !ts.closed {
+		ts.cond.Wait()
+	}
+
+	var records []byte
+
+	if errorCode == errorCodeNone {
+		batchOffset := int64(0)
+
+		for _, batch := range testPartition.batches {
+			numRecords := int64(binary.BigEndian.Uint32(batch[57:]))
+
+			if batchOffset+numRecords > offset {
+				records = append(records, batch...)
+			}
+
+			batchOffset += numRecords
+		}
+	}
+
+	response := &encoder{}
+	response.putInt32(0) // throttle time
+	response.putArrayLength(1)
+	response.putString(topic)
+	response.putArrayLength(1)
+	response.putInt32(partition)
+	response.putInt16(errorCode)
+	response.putInt64(testPartition.endOffset) // high watermark
+	response.putInt64(testPartition.endOffset) // last stable offset
+	response.putArrayLength(0)                 // aborted transactions
+	response.putBytes(records)
+
+	return response
+}
+
+func (ts *testServer) handleJoinGroup(request *decoder) *encoder {
+	group := ts.getGroup(request.getString())
+	request.getInt32() // session timeout
+	request.getInt32() // rebalance timeout
+	memberID := request.getString()
+	request.getString() // protocol type
+
+	var subscription []byte
+
+	for protocolIndex, numProtocols := 0, request.getArrayLength(); protocolIndex < numProtocols; protocolIndex++ {
+		request.getString() // protocol
+		subscription = request.getBytes()
+	}
+
+	if memberID == "" {
+		ts.nextMemberIndex++
+		memberID = fmt.Sprintf("member-%d", ts.nextMemberIndex)
+	} else if _, found := group.members[memberID]; !found {
+		return encodeJoinGroupResponse(errorCodeUnknownMemberID, 0, "", memberID, nil)
+	}
+
+	// a new generation forms, which the other members learn of when they next heartbeat or commit
+	group.members[memberID] = subscription
+	group.joined[memberID] = true
+	group.rebalancing = true
+	group.assignments = nil
+
+	generationID := group.generationID
+	ts.completeGeneration(group)
+
+	for group.generationID == generationID && !ts.closed {
+		ts.cond.Wait()
+	}
+
+	if ts.closed {
+		return nil
+	}
+
+	// the leader is told of all members, to assign their partitions
+	var members map[string][]byte
+
+	if memberID == group.leaderID {
+		members = group.members
+	}
+
+	return encodeJoinGroupResponse(errorCodeNone, group.generationID, group.leaderID, memberID, members)
+}
+
+// the generation is formed once all members joined it. the member with the lowest ID leads it
+func (ts *testServer) completeGeneration(group *testGroup) {
+	var memberIDs []string
+
+	for memberID := range group.members {
+		if !group.joined[memberID] {
+			return
+		}
+
+		memberIDs = append(memberIDs, memberID)
+	}
+
+	sort.Strings(memberIDs)
+
+	group.generationID++
+	group.rebalancing = false
+	group.joined = map[string]bool{}
+
+	if len(memberIDs) != 0 {
+		group.leaderID = memberIDs[0]
+	}
+
+	ts.cond.Broadcast()
+}
+
+func (ts *testServer) handleSyncGroup(request *decoder, injectedErrorCode int16) *encoder {
+	group := ts.getGroup(request.getString())
+	generationID := request.getInt32()
+	memberID := request.getString()
+
+	assignments := map[string][]byte{}
+
+	for assignmentIndex, numAssignments := 0, request.getArrayLength(); assignmentIndex < numAssignments; assignmentIndex++ {
+		assignedMemberID := request.getString()
+		assignments[assignedMemberID] = request.getBytes()
+	}
+
+	response := &encoder{}
+
+	errorCode := injectedErrorCode
+	if errorCode == errorCodeNone {
+		errorCode = group.checkMember(memberID, generationID)
+	}
+
+	if errorCode != errorCodeNone {
+		response.putInt16(errorCode)
+		response.putBytes(nil)
+
+		return response
+	}
+
+	// the leader sends the assignments of all members, which the others wait for
+	if memberID == group.leaderID {
+		group.assignments = assignments
+		ts.cond.Broadcast()
+	}
+
+	for group.assignments == nil && group.generationID == generationID && !ts.closed {
+		ts.cond.Wait()
+	}
+
+	if ts.closed {
+		return nil
+	}
+
+	if group.generationID != generationID {
+		response.putInt16(errorCodeRebalanceInProgress)
+		response.putBytes(nil)
+
+		return response
+	}
+
+	response.putInt16(errorCodeNone)
+	response.putBytes(group.assignments[memberID])
+
+	return response
+}
+
+func (ts *testServer) handleHeartbeat(request *decoder) *encoder {
+	group := ts.getGroup(request.getString())
+	generationID := request.getInt32()
+	memberID := request.getString()
+
+	response := &encoder{}
+	response.putInt16(group.checkMember(memberID, generationID))
+
+	return response
+}
+
+func (ts *testServer) handleLeaveGroup(request *decoder) *encoder {
+	group := ts.getGroup(request.getString())
+	memberID := request.getString()
+
+	response := &encoder{}
+
+	if _, found := group.members[memberID]; !found {
+		response.putInt16(errorCodeUnknownMemberID)
+		return response
+	}
+
+	delete(group.members, memberID)
+	delete(group.joined, memberID)
+
+	// the remaining members must join again to take over the partitions of the one that left
+	if len(group.members) != 0 {
+		group.rebalancing = true
+		group.assignments = nil
+		ts.completeGeneration(group)
+	}
+
+	response.putInt16(errorCodeNone)
+
+	return response
+}
+
+func (ts *testServer) handleOffsetCommit(request *decoder, injectedErrorCode int16) *encoder {
+	group := ts.getGroup(request.getString())
+	generationID := request.getInt32()
+	memberID := request.getString()
+	request.getInt64() // retention time
+
+	errorCode := injectedErrorCode
+	if errorCode == errorCodeNone {
+		errorCode = group.checkMember(memberID, generationID)
+	}
+
+	response := &encoder{}
+
+	numTopics := request.getArrayLength()
+	response.putArrayLength(numTopics)
+
+	for topicIndex := 0; topicIndex < numTopics; topicIndex++ {
+		topic := request.getString()
+		response.putString(topic)
+
+		numPartitions := request.getArrayLength()
+		response.putArrayLength(numPartitions)
+
+		for partitionIndex := 0; partitionIndex < numPartitions; partitionIndex++ {
+			partition := request.getInt32()
+			offset := request.getInt64()
+			request.getString() // metadata
+
+			if errorCode == errorCodeNone {
+				group.offsets[topic+"/"+strconv.Itoa(int(partition))] = offset
+			}
+
+			response.putInt32(partition)
+			response.putInt16(errorCode)
+		}
+	}
+
+	return response
+}
+
+func (ts *testServer) handleOffsetFetch(request *decoder) *encoder {
+	group := ts.getGroup(request.getString())
+
+	response := &encoder{}
+
+	numTopics := request.getArrayLength()
+	response.putArrayLength(numTopics)
+
+	for topicIndex := 0; topicIndex < numTopics; topicIndex++ {
+		topic := request.getString()
+		response.putString(topic)
+
+		numPartitions := request.getArrayLength()
+		response.putArrayLength(numPartitions)
+
+		for partitionIndex := 0; partitionIndex < numPartitions; partitionIndex++ {
+			partition := request.getInt32()
+
+			offset, found := group.offsets[topic+"/"+strconv.Itoa(int(partition))]
+			if !found {
+				offset = -1
+			}
+
+			response.putInt32(partition)
+			response.putInt64(offset)
+			response.putString("") // metadata
+			response.putInt16(errorCodeNone)
+		}
+	}
+
+	return response
+}
+
+// called under the lock
+func (ts *testServer) getGroup(groupID string) *testGroup {
+	group, found := ts.groups[groupID]
+	if !found {
+		group = &testGroup{
+			members: map[string][]byte{},
+			joined:  map[string]bool{},
+			offsets: map[string]int64{},
+		}
+
+		ts.groups[groupID] = group
+	}
+
+	return group
+}
+
+// returns the error code of requests made by a member of a generation
+func (tg *testGroup) checkMember(memberID string, generationID int32) int16 {
+	if _, found := tg.members[memberID]; !found {
+		return errorCodeUnknownMemberID
+	}
+
+	if tg.rebalancing {
+		return errorCodeRebalanceInProgress
+	}
+
+	if generationID != tg.generationID {
+		return errorCodeIllegalGeneration
+	}
+
+	return errorCodeNone
+}
+
+func encodeJoinGroupResponse(errorCode int16,
+	generationID int32,
+	leaderID string,
+	memberID string,
+	members map[string][]byte) *encoder {
+
+	response := &encoder{}
+	response.putInt32(0) // throttle time
+	response.putInt16(errorCode)
+	response.putInt32(generationID)
+	response.putString("range")
+	response.putString(leaderID)
+	response.putString(memberID)
+	response.putArrayLength(len(members))
+
+	for groupMemberID, subscription := range members {
+		response.putString(groupMemberID)
+		response.putBytes(subscription)
+	}
+
+	return response
+}
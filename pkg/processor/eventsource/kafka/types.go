@@ -0,0 +1,23 @@
+package kafka
+
+import "github.com/nuclio/nuclio/pkg/processor/eventsource"
+
+const (
+	InitialOffsetEarliest = "earliest"
+	InitialOffsetLatest   = "latest"
+)
+
+type Configuration struct {
+	eventsource.Configuration
+	ClientKind    string
+	Brokers       []string
+	Topic         string
+	ConsumerGroup string
+
+	// the most messages fetched from a partition at once
+	BatchSize int
+
+	// where partitions without a committed offset or checkpoint are consumed from (earliest / latest)
+	InitialOffset  string
+	FetchTimeoutMs int
+}
@@ -0,0 +1,383 @@
+package mqtt
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+)
+
+// an embedded broker speaking enough of MQTT 3.1.1 for the event source: authentication, clean and persistent
+// sessions, wildcard subscriptions and QoS 0/1/2 delivery, with unacknowledged messages delivered again when
+// a session resumes
+type testBroker struct {
+	listener net.Listener
+
+	// required of clients, if set
+	username string
+	password string
+
+	lock     sync.Mutex
+	sessions map[string]*testSession
+}
+
+type testSession struct {
+	clean         bool
+	subscriptions map[string]byte
+	lastPacketID  uint16
+
+	// nil while the client is disconnected
+	conn *testBrokerConn
+
+	// QoS 1/2 messages sent (or kept while disconnected) and not acknowledged (PUBACK / PUBREC) yet, in the
+	// order they were published
+	unackedMessages []*Message
+
+	// QoS 2 messages released (PUBREL) and not completed (PUBCOMP) yet, and the number completed
+	unreleasedPacketIDs map[uint16]bool
+	numCompleted        int
+
+	// the number of messages acknowledged before a message delivered earlier
+	numOutOfOrderAcks int
+}
+
+type testBrokerConn struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+}
+
+func newTestBroker(username string, password string) (*testBroker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	broker := &testBroker{
+		listener: listener,
+		username: username,
+		password: password,
+		sessions: map[string]*testSession{},
+	}
+
+	go broker.accept()
+
+	return broker, nil
+}
+
+func (tb *testBroker) url() string {
+	return "tcp://" + tb.listener.Addr().String()
+}
+
+func (tb *testBroker) close() {
+	tb.listener.Close()
+	tb.disconnectClients()
+}
+
+// drops all connections, keeping persistent sessions
+func (tb *testBroker) disconnectClients() {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	for _, session := range tb.sessions {
+		if session.conn != nil {
+			session.conn.conn.Close()
+		}
+	}
+}
+
+// delivers a message to every session subscribed to its topic, at the lower of the message's QoS and the
+// subscription's. QoS 1/2 messages are kept for disconnected persistent sessions
+func (tb *testBroker) publish(topic string, payload string, qos byte, retained bool) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	for _, session := range tb.sessions {
+		subscriptionQoS, subscribed := session.getSubscriptionQoS(topic)
+		if !subscribed {
+			continue
+		}
+
+		message := &Message{
+			Topic:    topic,
+			QoS:      qos,
+			Retained: retained,
+			Payload:  []byte(payload),
+		}
+
+		if subscriptionQoS < message.QoS {
+			message.QoS = subscriptionQoS
+		}
+
+		if message.QoS > 0 {
+			session.lastPacketID++
+			message.PacketID = session.lastPacketID
+			session.unackedMessages = append(session.unackedMessages, message)
+		}
+
+		if session.conn != nil {
+			session.conn.write(encodePublish(message))
+		}
+	}
+}
+
+func (tb *testBroker) isConnected(clientID string) bool {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	session, found := tb.sessions[clientID]
+
+	return found && session.conn != nil
+}
+
+func (tb *testBroker) getNumUnacked(clientID string) int {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	return len(tb.sessions[clientID].unackedMessages)
+}
+
+func (tb *testBroker) getNumCompleted(clientID string) int {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	return tb.sessions[clientID].numCompleted
+}
+
+func (tb *testBroker) getNumOutOfOrderAcks(clientID string) int {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	return tb.sessions[clientID].numOutOfOrderAcks
+}
+
+func (tb *testBroker) accept() {
+	for {
+		conn, err := tb.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go tb.serve(&testBrokerConn{conn: conn})
+	}
+}
+
+func (tb *testBroker) serve(brokerConn *testBrokerConn) {
+	defer brokerConn.conn.Close()
+
+	reader := bufio.NewReader(brokerConn.conn)
+
+	connectPacket, err := readPacket(reader)
+	if err != nil || connectPacket.packetType != packetTypeConnect {
+		return
+	}
+
+	clientID, session := tb.connect(brokerConn, connectPacket)
+	if session == nil {
+		return
+	}
+
+	defer tb.disconnect(clientID, session, brokerConn)
+
+	for {
+		receivedPacket, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch receivedPacket.packetType {
+		case packetTypeSubscribe:
+			tb.subscribe(session, brokerConn, receivedPacket)
+
+		case packetTypePuback, packetTypePubrec, packetTypePubcomp:
+			packetID, _, _ := readUint16(receivedPacket.body)
+			tb.acknowledge(session, brokerConn, receivedPacket.packetType, packetID)
+
+		case packetTypePingreq:
+			brokerConn.write(encodePacket(packetTypePingresp, 0, nil))
+
+		case packetTypeDisconnect:
+			return
+		}
+	}
+}
+
+// authenticates the client and attaches it to its session, answering with CONNACK. returns a nil session
+// if the connection was refused
+func (tb *testBroker) connect(brokerConn *testBrokerConn, connectPacket *packet) (string, *testSession) {
+
+	// skip the protocol name and level to get to the flags, the keep alive and the client ID
+	_, body, _ := readString(connectPacket.body)
+	connectFlags := body[1]
+	clientID, body, _ := readString(body[4:])
+
+	var username, password string
+
+	if connectFlags&0x80 != 0 {
+		username, body, _ = readString(body)
+	}
+
+	if connectFlags&0x40 != 0 {
+		password, _, _ = readString(body)
+	}
+
+	if tb.username != "" && (username != tb.username || password != tb.password) {
+		brokerConn.write(encodePacket(packetTypeConnack, 0, []byte{0, 4}))
+		return "", nil
+	}
+
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	clean := connectFlags&0x02 != 0
+	session, sessionPresent := tb.sessions[clientID]
+
+	if !sessionPresent || clean {
+		session = &testSession{
+			clean:               clean,
+			subscriptions:       map[string]byte{},
+			unreleasedPacketIDs: map[uint16]bool{},
+		}
+
+		tb.sessions[clientID] = session
+	}
+
+	// a client taking over its session from another connection
+	if session.conn != nil {
+		session.conn.conn.Close()
+	}
+
+	session.conn = brokerConn
+
+	var sessionPresentFlag byte
+	if sessionPresent && !clean {
+		sessionPresentFlag = 1
+	}
+
+	brokerConn.write(encodePacket(packetTypeConnack, 0, []byte{sessionPresentFlag, 0}))
+
+	// resume the session, delivering what wasn't acknowledged
+	for _, message := range session.unackedMessages {
+		message.Duplicate = true
+		brokerConn.write(encodePublish(message))
+	}
+
+	for packetID := range session.unreleasedPacketIDs {
+		brokerConn.write(encodeAck(packetTypePubrel, packetID))
+	}
+
+	return clientID, session
+}
+
+func (tb *testBroker) disconnect(clientID string, session *testSession, brokerConn *testBrokerConn) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	// the session may have been taken over
+	if session.conn != brokerConn {
+		return
+	}
+
+	session.conn = nil
+
+	if session.clean {
+		delete(tb.sessions, clientID)
+	}
+}
+
+func (tb *testBroker) subscribe(session *testSession, brokerConn *testBrokerConn, subscribePacket *packet) {
+	packetID, body, _ := readUint16(subscribePacket.body)
+	suback := appendUint16(nil, packetID)
+
+	tb.lock.Lock()
+
+	for len(body) > 0 {
+		var topic string
+
+		topic, body, _ = readString(body)
+		session.subscriptions[topic] = body[0]
+		suback = append(suback, body[0])
+		body = body[1:]
+	}
+
+	tb.lock.Unlock()
+
+	brokerConn.write(encodePacket(packetTypeSuback, 0, suback))
+}
+
+func (tb *testBroker) acknowledge(session *testSession, brokerConn *testBrokerConn, packetType byte, packetID uint16) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	switch packetType {
+	case packetTypePuback, packetTypePubrec:
+		for messageIndex, message := range session.unackedMessages {
+			if message.PacketID == packetID {
+				if messageIndex != 0 {
+					session.numOutOfOrderAcks++
+				}
+
+				session.unackedMessages = append(session.unackedMessages[:messageIndex],
+					session.unackedMessages[messageIndex+1:]...)
+				break
+			}
+		}
+
+		if packetType == packetTypePubrec {
+			session.unreleasedPacketIDs[packetID] = true
+			brokerConn.write(encodeAck(packetTypePubrel, packetID))
+		}
+
+	case packetTypePubcomp:
+		if session.unreleasedPacketIDs[packetID] {
+			delete(session.unreleasedPacketIDs, packetID)
+			session.numCompleted++
+		}
+	}
+}
+
+// returns the highest QoS of the session's subscriptions that match a topic
+func (ts *testSession) getSubscriptionQoS(topic string) (byte, bool) {
+	var qos byte
+	var subscribed bool
+
+	for filter, subscriptionQoS := range ts.subscriptions {
+		if matchTopic(filter, topic) {
+			subscribed = true
+
+			if subscriptionQoS > qos {
+				qos = subscriptionQoS
+			}
+		}
+	}
+
+	return qos, subscribed
+}
+
+func (tbc *testBrokerConn) write(data []byte) {
+	tbc.writeLock.Lock()
+	defer tbc.writeLock.Unlock()
+
+	tbc.conn.Write(data)
+}
+
+// + matches a single level, # matches any number of trailing levels (including none)
+func matchTopic(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for levelIndex, filterLevel := range filterLevels {
+		if filterLevel == "#" {
+			return true
+		}
+
+		if levelIndex >= len(topicLevels) {
+			return false
+		}
+
+		if filterLevel != "+" && filterLevel != topicLevels[levelIndex] {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
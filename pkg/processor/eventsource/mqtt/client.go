@@ -0,0 +1,96 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+)
+
+// a message published to a topic we're subscribed to
+type Message struct {
+	Topic    string
+	QoS      byte
+	Retained bool
+
+	// set if the broker may have delivered the message before (e.g. it wasn't acknowledged)
+	Duplicate bool
+
+	// identifies QoS 1/2 messages in their acknowledgement
+	PacketID uint16
+
+	Payload []byte
+}
+
+// a topic filter, which may hold wildcards (+ for a single level, # for any number of trailing levels), and
+// the maximum QoS of the messages delivered for it
+type Subscription struct {
+	Topic string
+	QoS   byte
+}
+
+type ClientOptions struct {
+
+	// tcp://host:port, or ssl://host:port for TLS
+	BrokerURL string
+
+	// brokers keep the subscriptions and undelivered messages of a client ID across connections, unless
+	// the session is clean
+	ClientID     string
+	CleanSession bool
+
+	Username string
+	Password string
+
+	// used for ssl:// URLs
+	TLSConfig *tls.Config
+
+	KeepAlive time.Duration
+}
+
+// a connection to an MQTT broker. the mqtt event source is written against this so that the protocol
+// implementation can be swapped
+type Client interface {
+
+	// subscribes to topics, returning once the broker accepted all subscriptions
+	Subscribe(subscriptions []Subscription) error
+
+	// the messages received, including ones the broker kept for our session while we were disconnected
+	Messages() <-chan *Message
+
+	// acknowledges a QoS 1/2 message, so that the broker doesn't deliver it again
+	Ack(message *Message) error
+
+	// closed once the connection is lost or closed
+	Done() <-chan struct{}
+
+	Close() error
+}
+
+//
+// Client registry
+// Clients are keyed by the client kind in the event source configuration
+//
+
+type ClientCreator interface {
+	Create(logger nuclio.Logger, options *ClientOptions) (Client, error)
+}
+
+type ClientRegistry struct {
+	registry.Registry
+}
+
+// global singleton
+var ClientRegistrySingleton = ClientRegistry{
+	Registry: *registry.NewRegistry("mqtt_client"),
+}
+
+func (r *ClientRegistry) NewClient(logger nuclio.Logger, kind string, options *ClientOptions) (Client, error) {
+	registree, err := r.Get(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(ClientCreator).Create(logger, options)
+}
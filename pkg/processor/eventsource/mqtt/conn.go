@@ -0,0 +1,491 @@
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// how long connecting, including the handshake, and subscribing may take
+	connectTimeout = 10 * time.Second
+
+	// how long a write may block (e.g. on a broker that stopped reading) before the connection is dropped
+	writeTimeout = 10 * time.Second
+
+	// a connection whose pings go unanswered this many times is dropped
+	maxPingsOutstanding = 2
+)
+
+// the reasons a broker may refuse a connection, by CONNACK return code
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+//
+// A client speaking MQTT 3.1.1 over TCP, optionally with TLS
+//
+
+type conn struct {
+	logger   nuclio.Logger
+	options  *ClientOptions
+	netConn  net.Conn
+	reader   *bufio.Reader
+	messages chan *Message
+
+	// writes of different go routines must not interleave
+	writeLock sync.Mutex
+
+	// subscribe waits for the broker's acknowledgement on this
+	subackChan   chan *packet
+	lastPacketID uint16
+
+	// QoS 1/2 messages received and not acknowledged yet, in the order they were received. acknowledgements
+	// must be sent in this order (MQTT 3.1.1 section 4.6), so those of messages handled early wait for the
+	// messages before them
+	ackLock     sync.Mutex
+	pendingAcks []*pendingAck
+
+	// QoS 2 messages we acknowledged receiving (PUBREC) and the broker didn't release (PUBREL) yet. the broker
+	// may deliver these again, but they must not be handled again
+	unreleasedLock     sync.Mutex
+	unreleasedMessages map[uint16]bool
+
+	// pings sent and not answered yet, and whether the reader is blocked handing a message over (in which case
+	// ping responses aren't read). accessed atomically
+	pingsOutstanding int32
+	delivering       int32
+
+	closeOnce sync.Once
+	closeChan chan struct{}
+	doneChan  chan struct{}
+}
+
+type pendingAck struct {
+	message *Message
+	acked   bool
+}
+
+// connects and completes the handshake, returning once the broker accepted our connection
+func newConn(parentLogger nuclio.Logger, options *ClientOptions) (*conn, error) {
+	netConn, err := dial(options)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to dial broker")
+	}
+
+	newConn := &conn{
+		logger:             parentLogger,
+		options:            options,
+		netConn:            netConn,
+		reader:             bufio.NewReader(netConn),
+		messages:           make(chan *Message),
+		subackChan:         make(chan *packet, 1),
+		unreleasedMessages: map[uint16]bool{},
+		closeChan:          make(chan struct{}),
+		doneChan:           make(chan struct{}),
+	}
+
+	if err := newConn.handshake(); err != nil {
+		netConn.Close()
+		return nil, errors.Wrap(err, "Failed to complete handshake")
+	}
+
+	go newConn.read()
+
+	if options.KeepAlive > 0 {
+		go newConn.ping()
+	}
+
+	return newConn, nil
+}
+
+func (c *conn) Subscribe(subscriptions []Subscription) error {
+	body := appendUint16(nil, c.nextPacketID())
+
+	for _, subscription := range subscriptions {
+		body = appendString(body, subscription.Topic)
+		body = append(body, subscription.QoS)
+	}
+
+	if err := c.write(encodePacket(packetTypeSubscribe, 0x02, body)); err != nil {
+		return errors.Wrap(err, "Failed to send subscribe")
+	}
+
+	var suback *packet
+
+	select {
+	case suback = <-c.subackChan:
+	case <-c.doneChan:
+		return errors.New("Connection lost while subscribing")
+	case <-time.After(connectTimeout):
+		return errors.New("Timed out waiting for subscribe acknowledgement")
+	}
+
+	// the packet ID is followed by the QoS granted to each subscription, or a failure code
+	if len(suback.body) != 2+len(subscriptions) {
+		return errors.New("Malformed subscribe acknowledgement")
+	}
+
+	for subscriptionIndex, returnCode := range suback.body[2:] {
+		if returnCode == subackFailureCode {
+			return errors.Errorf("Broker refused subscription to %s", subscriptions[subscriptionIndex].Topic)
+		}
+	}
+
+	return nil
+}
+
+func (c *conn) Messages() <-chan *Message {
+	return c.messages
+}
+
+// QoS 1 messages are acknowledged with PUBACK. QoS 2 ones with PUBREC, after which the broker releases
+// them (PUBREL) and we complete the exchange (PUBCOMP). the acknowledgement is sent once all messages received
+// before this one were acknowledged
+func (c *conn) Ack(message *Message) error {
+	if message.QoS == 0 {
+		return nil
+	}
+
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+
+	for _, pendingAck := range c.pendingAcks {
+		if pendingAck.message == message {
+			pendingAck.acked = true
+
+			return c.sendAcks()
+		}
+	}
+
+	return errors.Errorf("Message %d isn't pending acknowledgement", message.PacketID)
+}
+
+// adds a message that must be acknowledged, in the order received
+func (c *conn) addPendingAck(message *Message, acked bool) error {
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+
+	c.pendingAcks = append(c.pendingAcks, &pendingAck{message: message, acked: acked})
+
+	return c.sendAcks()
+}
+
+// sends the acknowledgements of the messages acknowledged so far, up to the first that wasn't. called under
+// the ack lock
+func (c *conn) sendAcks() error {
+	for len(c.pendingAcks) != 0 && c.pendingAcks[0].acked {
+		message := c.pendingAcks[0].message
+		c.pendingAcks = c.pendingAcks[1:]
+
+		if message.QoS == 1 {
+			if err := c.write(encodeAck(packetTypePuback, message.PacketID)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		c.unreleasedLock.Lock()
+		c.unreleasedMessages[message.PacketID] = true
+		c.unreleasedLock.Unlock()
+
+		if err := c.write(encodeAck(packetTypePubrec, message.PacketID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *conn) Done() <-chan struct{} {
+	return c.doneChan
+}
+
+func (c *conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.closeChan)
+
+		// let the broker know we left, so that it doesn't publish our will (if any). best effort
+		c.write(encodePacket(packetTypeDisconnect, 0, nil))
+
+		err = c.netConn.Close()
+	})
+
+	<-c.doneChan
+
+	return err
+}
+
+func dial(options *ClientOptions) (net.Conn, error) {
+	parsedURL, err := url.Parse(options.BrokerURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse URL")
+	}
+
+	switch parsedURL.Scheme {
+	case "tcp", "mqtt":
+		return net.DialTimeout("tcp", withDefaultPort(parsedURL, "1883"), connectTimeout)
+
+	case "ssl", "tls", "mqtts":
+		tlsConfig := &tls.Config{}
+		if options.TLSConfig != nil {
+			tlsConfig = options.TLSConfig.Clone()
+		}
+
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = parsedURL.Hostname()
+		}
+
+		dialer := &net.Dialer{Timeout: connectTimeout}
+
+		return tls.DialWithDialer(dialer, "tcp", withDefaultPort(parsedURL, "8883"), tlsConfig)
+	}
+
+	return nil, errors.Errorf("Unsupported scheme %s", parsedURL.Scheme)
+}
+
+func withDefaultPort(parsedURL *url.URL, defaultPort string) string {
+	if parsedURL.Port() == "" {
+		return net.JoinHostPort(parsedURL.Hostname(), defaultPort)
+	}
+
+	return parsedURL.Host
+}
+
+func (c *conn) handshake() error {
+	c.netConn.SetDeadline(time.Now().Add(connectTimeout))
+	defer c.netConn.SetDeadline(time.Time{})
+
+	var connectFlags byte
+
+	if c.options.CleanSession {
+		connectFlags |= 0x02
+	}
+
+	if c.options.Username != "" {
+		connectFlags |= 0x80
+	}
+
+	if c.options.Password != "" {
+		connectFlags |= 0x40
+	}
+
+	// protocol name and level (4 - 3.1.1), flags, keep alive and the payload
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, connectFlags)
+	body = appendUint16(body, uint16(c.options.KeepAlive/time.Second))
+	body = appendString(body, c.options.ClientID)
+
+	if c.options.Username != "" {
+		body = appendString(body, c.options.Username)
+	}
+
+	if c.options.Password != "" {
+		body = appendString(body, c.options.Password)
+	}
+
+	if err := c.write(encodePacket(packetTypeConnect, 0, body)); err != nil {
+		return errors.Wrap(err, "Failed to send connect")
+	}
+
+	connack, err := readPacket(c.reader)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read connect acknowledgement")
+	}
+
+	if connack.packetType != packetTypeConnack || len(connack.body) != 2 {
+		return errors.Errorf("Expected connect acknowledgement, got packet type %d", connack.packetType)
+	}
+
+	if returnCode := connack.body[1]; returnCode != 0 {
+		reason, found := connackErrors[returnCode]
+		if !found {
+			reason = "unknown reason"
+		}
+
+		return errors.Errorf("Broker refused connection: %s (%d)", reason, returnCode)
+	}
+
+	c.logger.DebugWith("Connected", "sessionPresent", connack.body[0]&0x01 != 0)
+
+	return nil
+}
+
+// reads and handles the broker's packets until the connection is closed
+func (c *conn) read() {
+	defer close(c.doneChan)
+
+	for {
+		receivedPacket, err := readPacket(c.reader)
+		if err != nil {
+			if !c.closed() {
+				c.logger.WarnWith("Connection lost", "err", err)
+
+				c.netConn.Close()
+			}
+
+			return
+		}
+
+		if err := c.handlePacket(receivedPacket); err != nil {
+			c.logger.WarnWith("Failed to handle packet, closing connection",
+				"err", err,
+				"packetType", receivedPacket.packetType)
+
+			c.netConn.Close()
+			return
+		}
+	}
+}
+
+func (c *conn) handlePacket(receivedPacket *packet) error {
+	switch receivedPacket.packetType {
+	case packetTypePublish:
+		message, err := decodePublish(receivedPacket)
+		if err != nil {
+			return err
+		}
+
+		// a QoS 2 message we already handled, delivered again since our PUBREC was lost
+		if message.QoS == 2 && c.isUnreleased(message.PacketID) {
+			return c.addPendingAck(message, true)
+		}
+
+		if message.QoS != 0 {
+			if err := c.addPendingAck(message, false); err != nil {
+				return err
+			}
+		}
+
+		// a subscriber that's behind keeps us from reading, which is how we apply back pressure
+		atomic.StoreInt32(&c.delivering, 1)
+
+		select {
+		case c.messages <- message:
+		case <-c.closeChan:
+		}
+
+		atomic.StoreInt32(&c.delivering, 0)
+
+	case packetTypePubrel:
+		packetID, _, err := readUint16(receivedPacket.body)
+		if err != nil {
+			return err
+		}
+
+		c.unreleasedLock.Lock()
+		delete(c.unreleasedMessages, packetID)
+		c.unreleasedLock.Unlock()
+
+		return c.write(encodeAck(packetTypePubcomp, packetID))
+
+	case packetTypeSuback:
+		select {
+		case c.subackChan <- receivedPacket:
+		default:
+		}
+
+	case packetTypePingresp:
+		atomic.StoreInt32(&c.pingsOutstanding, 0)
+	}
+
+	return nil
+}
+
+// pings the broker at half the keep alive interval, so that it doesn't drop us and so that a connection
+// that silently died is detected
+func (c *conn) ping() {
+	ticker := time.NewTicker(c.options.KeepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.doneChan:
+			return
+		}
+
+		// unanswered pings say nothing about the broker while we're not reading
+		if atomic.LoadInt32(&c.delivering) != 0 {
+			atomic.StoreInt32(&c.pingsOutstanding, 0)
+		}
+
+		if atomic.AddInt32(&c.pingsOutstanding, 1) > maxPingsOutstanding {
+			c.logger.Warn("Broker stopped answering pings, closing connection")
+
+			c.netConn.Close()
+			return
+		}
+
+		if err := c.write(encodePacket(packetTypePingreq, 0, nil)); err != nil {
+			c.logger.WarnWith("Failed to ping broker", "err", err)
+		}
+	}
+}
+
+func (c *conn) isUnreleased(packetID uint16) bool {
+	c.unreleasedLock.Lock()
+	defer c.unreleasedLock.Unlock()
+
+	return c.unreleasedMessages[packetID]
+}
+
+// packet IDs are non zero
+func (c *conn) nextPacketID() uint16 {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.lastPacketID++
+	if c.lastPacketID == 0 {
+		c.lastPacketID = 1
+	}
+
+	return c.lastPacketID
+}
+
+func (c *conn) write(data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	_, err := c.netConn.Write(data)
+
+	return err
+}
+
+func (c *conn) closed() bool {
+	select {
+	case <-c.closeChan:
+		return true
+	default:
+		return false
+	}
+}
+
+type connCreator struct{}
+
+func (cc *connCreator) Create(logger nuclio.Logger, options *ClientOptions) (Client, error) {
+	return newConn(logger, options)
+}
+
+// register the protocol implementation as the default client
+func init() {
+	ClientRegistrySingleton.Register("mqtt", &connCreator{})
+}
@@ -0,0 +1,322 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// the broker side of a single connection, driven packet by packet by the test
+type scriptedBroker struct {
+	listener net.Listener
+	connChan chan net.Conn
+	conn     net.Conn
+	reader   *bufio.Reader
+
+	// signaled once the connection was accepted (or refused)
+	acceptedChan chan struct{}
+}
+
+type ConnTestSuite struct {
+	suite.Suite
+	logger nuclio.Logger
+	broker *scriptedBroker
+}
+
+func (suite *ConnTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *ConnTestSuite) SetupTest() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+
+	suite.broker = &scriptedBroker{
+		listener:     listener,
+		connChan:     make(chan net.Conn, 1),
+		acceptedChan: make(chan struct{}),
+	}
+
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			suite.broker.connChan <- conn
+		}
+	}()
+}
+
+func (suite *ConnTestSuite) TearDownTest() {
+	suite.broker.listener.Close()
+
+	if suite.broker.conn != nil {
+		suite.broker.conn.Close()
+	}
+}
+
+func (suite *ConnTestSuite) TestRemainingLength() {
+	for _, remainingLength := range []int{0, 1, 127, 128, 16383, 16384, 2097151, 2097152} {
+		body := bytes.Repeat([]byte{'x'}, remainingLength)
+
+		readPacket, err := readPacket(bufio.NewReader(bytes.NewReader(encodePacket(packetTypePublish, 0x03, body))))
+		suite.Require().NoError(err, remainingLength)
+		suite.Equal(packetTypePublish, readPacket.packetType, remainingLength)
+		suite.Equal(byte(0x03), readPacket.flags, remainingLength)
+		suite.Equal(body, readPacket.body, remainingLength)
+	}
+
+	// the remaining length spans at most 4 bytes
+	_, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01})))
+	suite.Error(err)
+}
+
+func (suite *ConnTestSuite) TestDecodePublish() {
+	message := &Message{
+		Topic:     "sensors/kitchen",
+		QoS:       1,
+		Retained:  true,
+		Duplicate: true,
+		PacketID:  513,
+		Payload:   []byte("21"),
+	}
+
+	encodedPublish := encodePublish(message)
+
+	readPacket, err := readPacket(bufio.NewReader(bytes.NewReader(encodedPublish)))
+	suite.Require().NoError(err)
+
+	decodedMessage, err := decodePublish(readPacket)
+	suite.Require().NoError(err)
+	suite.Equal(message, decodedMessage)
+
+	// QoS 3 is reserved
+	readPacket.flags |= 0x06
+	_, err = decodePublish(readPacket)
+	suite.Error(err)
+
+	// a topic longer than the packet
+	_, err = decodePublish(&packet{packetType: packetTypePublish, body: []byte{0, 10, 'a'}})
+	suite.Error(err)
+}
+
+func (suite *ConnTestSuite) TestConnectRefused() {
+	go suite.acceptConnect(5)
+
+	_, err := newConn(suite.logger, suite.createClientOptions())
+	<-suite.broker.acceptedChan
+
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "not authorized")
+}
+
+func (suite *ConnTestSuite) TestSubscribe() {
+	conn := suite.connect()
+	defer conn.Close()
+
+	subscribeErrChan := make(chan error, 1)
+
+	go func() {
+		subscribeErrChan <- conn.Subscribe([]Subscription{{"allowed/#", 1}, {"forbidden/+", 2}})
+	}()
+
+	subscribePacket := suite.readPacket()
+	suite.Require().Equal(packetTypeSubscribe, subscribePacket.packetType)
+	suite.Equal(byte(0x02), subscribePacket.flags)
+
+	packetID, body, err := readUint16(subscribePacket.body)
+	suite.Require().NoError(err)
+
+	topic, body, err := readString(body)
+	suite.Require().NoError(err)
+	suite.Equal("allowed/#", topic)
+	suite.Equal(byte(1), body[0])
+
+	topic, body, err = readString(body[1:])
+	suite.Require().NoError(err)
+	suite.Equal("forbidden/+", topic)
+	suite.Equal(byte(2), body[0])
+
+	// the second subscription is refused
+	suite.write(encodePacket(packetTypeSuback, 0, append(appendUint16(nil, packetID), 1, subackFailureCode)))
+
+	err = <-subscribeErrChan
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "forbidden/+")
+}
+
+func (suite *ConnTestSuite) TestAcksInReceiveOrder() {
+	conn := suite.connect()
+	defer conn.Close()
+
+	suite.write(encodePublish(&Message{Topic: "events", QoS: 1, PacketID: 1, Payload: []byte("first")}))
+	suite.write(encodePublish(&Message{Topic: "events", QoS: 2, PacketID: 2, Payload: []byte("second")}))
+	suite.write(encodePublish(&Message{Topic: "events", QoS: 1, PacketID: 3, Payload: []byte("third")}))
+
+	firstMessage := suite.receiveMessage(conn)
+	secondMessage := suite.receiveMessage(conn)
+	thirdMessage := suite.receiveMessage(conn)
+
+	suite.Equal("second", string(secondMessage.Payload))
+
+	// handled in reverse order. nothing is acknowledged until the first message is
+	suite.Require().NoError(conn.Ack(thirdMessage))
+	suite.Require().NoError(conn.Ack(secondMessage))
+	suite.expectNoPacket()
+
+	suite.Require().NoError(conn.Ack(firstMessage))
+
+	suite.Equal(encodeAck(packetTypePuback, 1), suite.readEncodedPacket())
+	suite.Equal(encodeAck(packetTypePubrec, 2), suite.readEncodedPacket())
+	suite.Equal(encodeAck(packetTypePuback, 3), suite.readEncodedPacket())
+
+	// a message is acknowledged once
+	suite.Error(conn.Ack(firstMessage))
+}
+
+func (suite *ConnTestSuite) TestQoS2DeliveredAgainBeforeRelease() {
+	conn := suite.connect()
+	defer conn.Close()
+
+	message := &Message{Topic: "events", QoS: 2, PacketID: 7, Payload: []byte("once")}
+
+	suite.write(encodePublish(message))
+	suite.Require().NoError(conn.Ack(suite.receiveMessage(conn)))
+	suite.Equal(encodeAck(packetTypePubrec, 7), suite.readEncodedPacket())
+
+	// our PUBREC was lost, as far as the broker knows. the message is acknowledged again, not handled again
+	message.Duplicate = true
+	suite.write(encodePublish(message))
+	suite.Equal(encodeAck(packetTypePubrec, 7), suite.readEncodedPacket())
+
+	select {
+	case <-conn.Messages():
+		suite.Fail("Message delivered again before it was released")
+	default:
+	}
+
+	suite.write(encodeAck(packetTypePubrel, 7))
+	suite.Equal(encodeAck(packetTypePubcomp, 7), suite.readEncodedPacket())
+
+	// released, so the packet ID may be reused for a new message
+	message.Duplicate = false
+	message.Payload = []byte("new")
+	suite.write(encodePublish(message))
+	suite.Equal("new", string(suite.receiveMessage(conn).Payload))
+}
+
+func (suite *ConnTestSuite) TestUnansweredPingsDropConnection() {
+	options := suite.createClientOptions()
+	options.KeepAlive = 100 * time.Millisecond
+
+	go suite.acceptConnect(0)
+
+	conn, err := newConn(suite.logger, options)
+	<-suite.broker.acceptedChan
+
+	suite.Require().NoError(err)
+	defer conn.Close()
+
+	// pings are read, but never answered
+	suite.Equal(packetTypePingreq, suite.readPacket().packetType)
+
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		suite.Fail("Connection not dropped when pings went unanswered")
+	}
+}
+
+func (suite *ConnTestSuite) createClientOptions() *ClientOptions {
+	return &ClientOptions{
+		BrokerURL:    "tcp://" + suite.broker.listener.Addr().String(),
+		ClientID:     "client1",
+		CleanSession: true,
+		Username:     "user",
+		Password:     "secret",
+	}
+}
+
+// connects, with the broker accepting the connection
+func (suite *ConnTestSuite) connect() *conn {
+	go suite.acceptConnect(0)
+
+	conn, err := newConn(suite.logger, suite.createClientOptions())
+	<-suite.broker.acceptedChan
+
+	suite.Require().NoError(err)
+
+	return conn
+}
+
+// reads the CONNECT packet, verifying what the client sent, and answers with the return code. called from
+// a go routine, so it doesn't fail the test itself
+func (suite *ConnTestSuite) acceptConnect(returnCode byte) {
+	defer close(suite.broker.acceptedChan)
+
+	suite.broker.conn = <-suite.broker.connChan
+	suite.broker.reader = bufio.NewReader(suite.broker.conn)
+
+	connectPacket, err := readPacket(suite.broker.reader)
+	if err != nil || connectPacket.packetType != packetTypeConnect {
+		return
+	}
+
+	// the protocol name and level, and the clean session, username and password flags
+	expectedHeader := append(appendString(nil, "MQTT"), 4, 0x02|0x80|0x40)
+
+	if !bytes.HasPrefix(connectPacket.body, expectedHeader) {
+		return
+	}
+
+	suite.broker.conn.Write(encodePacket(packetTypeConnack, 0, []byte{0, returnCode}))
+}
+
+func (suite *ConnTestSuite) write(data []byte) {
+	_, err := suite.broker.conn.Write(data)
+	suite.Require().NoError(err)
+}
+
+func (suite *ConnTestSuite) readPacket() *packet {
+	suite.broker.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	readPacket, err := readPacket(suite.broker.reader)
+	suite.Require().NoError(err)
+
+	return readPacket
+}
+
+func (suite *ConnTestSuite) readEncodedPacket() []byte {
+	readPacket := suite.readPacket()
+
+	return encodePacket(readPacket.packetType, readPacket.flags, readPacket.body)
+}
+
+func (suite *ConnTestSuite) expectNoPacket() {
+	suite.broker.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+
+	_, err := suite.broker.reader.Peek(1)
+	suite.Error(err)
+
+	suite.broker.conn.SetReadDeadline(time.Time{})
+}
+
+func (suite *ConnTestSuite) receiveMessage(conn *conn) *Message {
+	select {
+	case message := <-conn.Messages():
+		return message
+	case <-time.After(5 * time.Second):
+		suite.FailNow("Timed out waiting for message")
+	}
+
+	return nil
+}
+
+func TestConnTestSuite(t *testing.T) {
+	suite.Run(t, new(ConnTestSuite))
+}
@@ -0,0 +1,59 @@
+package mqtt
+
+import (
+	"fmt"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// allows accessing a Message. the following headers are available: topic (string), qos (int), retained and
+// duplicate (bool)
+type Event struct {
+	nuclio.AbstractSync
+	message *Message
+}
+
+func (e *Event) GetBody() []byte {
+	return e.message.Payload
+}
+
+func (e *Event) GetSize() int {
+	return len(e.message.Payload)
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	switch key {
+	case "topic":
+		return e.message.Topic
+	case "qos":
+		return int(e.message.QoS)
+	case "retained":
+		return e.message.Retained
+	case "duplicate":
+		return e.message.Duplicate
+	default:
+		return nil
+	}
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return map[string]interface{}{
+		"topic":     e.message.Topic,
+		"qos":       int(e.message.QoS),
+		"retained":  e.message.Retained,
+		"duplicate": e.message.Duplicate,
+	}
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	return []byte(e.GetHeaderString(key))
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	value := e.GetHeader(key)
+	if value == nil {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,260 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type mqtt struct {
+	eventsource.AbstractEventSource
+	configuration *Configuration
+	clientOptions *ClientOptions
+	subscriptions []Subscription
+
+	// the client is replaced when reconnecting, and is accessed under the connection's lock
+	connection *eventsource.Connection
+	client     Client
+
+	// the handlers of the current connection's messages
+	handlersWaitGroup *sync.WaitGroup
+}
+
+func newEventSource(parentLogger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	// messages are handled concurrently, so the allocator must be shareable
+	if !workerAllocator.Shareable() {
+		return nil, errors.New("MQTT event source requires a shareable worker allocator")
+	}
+
+	clientOptions, err := newClientOptions(configuration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create client options")
+	}
+
+	newEventSource := &mqtt{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Logger:          parentLogger,
+			WorkerAllocator: workerAllocator,
+			Class:           "async",
+			Kind:            "mqtt",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
+		},
+		configuration: configuration,
+		clientOptions: clientOptions,
+	}
+
+	newEventSource.connection = eventsource.NewConnection(parentLogger,
+		time.Duration(configuration.ReconnectBackoffMs)*time.Millisecond,
+		time.Duration(configuration.ReconnectMaxBackoffMs)*time.Millisecond,
+		newEventSource.connect,
+		newEventSource.disconnect)
+
+	for _, topic := range configuration.Topics {
+		newEventSource.subscriptions = append(newEventSource.subscriptions, Subscription{
+			Topic: topic,
+			QoS:   byte(configuration.QoS),
+		})
+	}
+
+	return newEventSource, nil
+}
+
+func (m *mqtt) Start(checkpoint eventsource.Checkpoint) error {
+	m.Logger.InfoWith("Starting",
+		"brokerUrl", m.configuration.BrokerURL,
+		"topics", m.configuration.Topics,
+		"qos", m.configuration.QoS,
+		"clientID", m.configuration.ClientID,
+		"cleanSession", m.configuration.CleanSession,
+		"numWorkers", m.configuration.NumWorkers)
+
+	// the first connection must succeed, so that misconfiguration is reported on start
+	if err := m.connection.Start(m.consume); err != nil {
+		return errors.Wrap(err, "Failed to connect to broker")
+	}
+
+	return nil
+}
+
+func (m *mqtt) Stop(force bool) (eventsource.Checkpoint, error) {
+	m.Logger.InfoWith("Stopping", "force", force)
+
+	// let the messages being processed be acknowledged, unless we're asked not to wait. the broker delivers
+	// unacknowledged QoS 1/2 messages again once our session resumes
+	if err := m.connection.Stop(force, nil); err != nil {
+		return nil, errors.Wrap(err, "Failed to close connection to broker")
+	}
+
+	// the broker tracks our session
+	return nil, nil
+}
+
+func (m *mqtt) GetConnectionState() eventsource.ConnectionState {
+	return m.connection.GetConnectionState()
+}
+
+// waits for the messages of the current connection to be handled, until it's lost or we're stopped
+func (m *mqtt) consume() {
+	m.connection.Lock()
+	handlersWaitGroup := m.handlersWaitGroup
+	m.connection.Unlock()
+
+	handlersWaitGroup.Wait()
+}
+
+// subscribes to all topics on a new client. subscribing again is harmless for a session the broker kept.
+// called under the connection's lock
+func (m *mqtt) connect() error {
+	client, err := ClientRegistrySingleton.NewClient(m.Logger, m.configuration.ClientKind, m.clientOptions)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create client")
+	}
+
+	// the broker may deliver messages before acknowledging the subscriptions (e.g. those it kept for our
+	// session), so handle them from the start - as many concurrently as we have workers
+	handlersWaitGroup := &sync.WaitGroup{}
+
+	for handlerIndex := 0; handlerIndex < m.configuration.NumWorkers; handlerIndex++ {
+		handlersWaitGroup.Add(1)
+
+		go func() {
+			defer handlersWaitGroup.Done()
+
+			m.handleMessages(client)
+		}()
+	}
+
+	if err := client.Subscribe(m.subscriptions); err != nil {
+
+		// don't leak a connection whose subscriptions failed, or its handlers
+		client.Close()
+		handlersWaitGroup.Wait()
+
+		return errors.Wrap(err, "Failed to subscribe")
+	}
+
+	m.client = client
+	m.handlersWaitGroup = handlersWaitGroup
+
+	return nil
+}
+
+// called under the connection's lock
+func (m *mqtt) disconnect() error {
+
+	// nothing to close if we never connected, or already disconnected
+	if m.client == nil {
+		return nil
+	}
+
+	client := m.client
+	m.client = nil
+
+	return client.Close()
+}
+
+// handles the messages received on a connection, until it's lost or we're stopped. QoS 1/2 messages are
+// acknowledged once handled - processed successfully or dead lettered. the client acknowledges messages in the
+// order they were received, so a message that failed can't be left unacknowledged without holding back the
+// acknowledgements of all those after it. instead, the connection is dropped for the broker to deliver the
+// unacknowledged messages again once our session resumes - or, with a clean session the broker doesn't keep,
+// the message is acknowledged and lost
+func (m *mqtt) handleMessages(client Client) {
+	var event Event
+
+	for {
+		var message *Message
+
+		select {
+		case message = <-client.Messages():
+		case <-client.Done():
+			return
+		case <-m.connection.StopChan():
+			return
+		}
+
+		// bind to message
+		event.message = message
+
+		// submit to worker. this retries and dead letters the message according to configuration
+		_, submitError, processError := m.SubmitEventToWorker(&event, m.configuration.GetWorkerAllocationTimeout())
+
+		if submitError != nil || (processError != nil && !m.HasDeadLetterSink()) {
+			if message.QoS != 0 && !m.configuration.CleanSession {
+				m.Logger.WarnWith("Failed to handle message, reconnecting for it to be delivered again",
+					"topic", message.Topic,
+					"qos", message.QoS,
+					"submitError", submitError,
+					"processError", processError)
+
+				client.Close()
+				return
+			}
+
+			m.Logger.WarnWith("Failed to handle message, dropping it",
+				"topic", message.Topic,
+				"qos", message.QoS,
+				"submitError", submitError,
+				"processError", processError)
+		}
+
+		if message.QoS == 0 {
+			continue
+		}
+
+		if err := client.Ack(message); err != nil {
+			m.Logger.WarnWith("Failed to acknowledge message", "err", err, "topic", message.Topic)
+		}
+	}
+}
+
+func newClientOptions(configuration *Configuration) (*ClientOptions, error) {
+	clientOptions := &ClientOptions{
+		BrokerURL:    configuration.BrokerURL,
+		ClientID:     configuration.ClientID,
+		CleanSession: configuration.CleanSession,
+		Username:     configuration.Username,
+		Password:     configuration.Password,
+		KeepAlive:    time.Duration(configuration.KeepAliveSeconds) * time.Second,
+		TLSConfig: &tls.Config{
+			InsecureSkipVerify: configuration.TLSInsecureSkipVerify,
+		},
+	}
+
+	if configuration.TLSCAFile != "" {
+		caCertificate, err := ioutil.ReadFile(configuration.TLSCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read CA file")
+		}
+
+		clientOptions.TLSConfig.RootCAs = x509.NewCertPool()
+
+		if !clientOptions.TLSConfig.RootCAs.AppendCertsFromPEM(caCertificate) {
+			return nil, errors.Errorf("No certificates found in %s", configuration.TLSCAFile)
+		}
+	}
+
+	if configuration.TLSCertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(configuration.TLSCertFile, configuration.TLSKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to load client certificate")
+		}
+
+		clientOptions.TLSConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return clientOptions, nil
+}
@@ -0,0 +1,216 @@
+package mqtt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type processedMessage struct {
+	topic     string
+	qos       int
+	retained  bool
+	duplicate bool
+	body      string
+}
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	broker  *testBroker
+	runtime *eventsourcetest.RecordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	var err error
+
+	suite.broker, err = newTestBroker("user", "secret")
+	suite.Require().NoError(err)
+
+	// records the messages it processes. fails a message whose body is "flaky" the first time it's processed,
+	// and takes a while to process one whose body is "slow"
+	suite.runtime = eventsourcetest.NewRecordingRuntime(func(event nuclio.Event) interface{} {
+		return processedMessage{
+			topic:     event.GetHeaderString("topic"),
+			qos:       event.GetHeader("qos").(int),
+			retained:  event.GetHeader("retained").(bool),
+			duplicate: event.GetHeader("duplicate").(bool),
+			body:      string(event.GetBody()),
+		}
+	}, func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+		switch string(event.GetBody()) {
+		case "flaky":
+			if !event.GetHeader("duplicate").(bool) {
+				return nil, errors.New("Processing error")
+			}
+		case "slow":
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		return nil, nil
+	})
+}
+
+func (suite *EventSourceTestSuite) TearDownTest() {
+	suite.StopEventSources()
+	suite.broker.close()
+}
+
+func (suite *EventSourceTestSuite) TestHeadersAndWildcards() {
+	configuration := suite.createConfiguration("client1", 1)
+	configuration.Topics = []string{"sensors/+/temperature", "alerts/#"}
+	suite.startEventSource(configuration)
+
+	suite.broker.publish("sensors/kitchen/temperature", "21", 1, true)
+	suite.broker.publish("sensors/kitchen/humidity", "40", 1, false)
+	suite.broker.publish("alerts/fire/kitchen", "now", 0, false)
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+
+	// the humidity isn't subscribed to
+	processedMessages := suite.getProcessedMessages()
+	suite.Len(processedMessages, 2)
+	suite.Contains(processedMessages, processedMessage{"sensors/kitchen/temperature", 1, true, false, "21"})
+	suite.Contains(processedMessages, processedMessage{"alerts/fire/kitchen", 0, false, false, "now"})
+
+	suite.waitForNumUnacked("client1", 0)
+}
+
+func (suite *EventSourceTestSuite) TestFailedMessageDeliveredAgain() {
+	eventSource := suite.startEventSource(suite.createConfiguration("client1", 1))
+
+	suite.broker.publish("events", "flaky", 1, false)
+
+	// the failed message isn't acknowledged, and the connection is dropped for the broker to deliver it again
+	// when the session resumes
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.waitForNumUnacked("client1", 0)
+
+	suite.Equal(processedMessage{"events", 1, false, true, "flaky"}, suite.getProcessedMessages()[1])
+	suite.Equal(0, suite.broker.getNumOutOfOrderAcks("client1"))
+	suite.Equal(eventsource.ConnectionStateConnected, eventSource.(eventsource.ConnectionStateProvider).GetConnectionState())
+}
+
+func (suite *EventSourceTestSuite) TestFailedMessageDroppedWithCleanSession() {
+	configuration := suite.createConfiguration("client1", 1)
+	configuration.CleanSession = true
+	suite.startEventSource(configuration)
+
+	suite.broker.publish("events", "flaky", 1, false)
+	suite.broker.publish("events", "steady", 1, false)
+
+	// the broker wouldn't deliver it again, so it's acknowledged
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.waitForNumUnacked("client1", 0)
+	suite.ExpectNumRecords(suite.runtime, 2)
+}
+
+func (suite *EventSourceTestSuite) TestAcksInOrder() {
+	suite.startEventSource(suite.createConfiguration("client1", 1))
+
+	// the second message is handled (by the other worker) before the first
+	suite.broker.publish("events", "slow", 1, false)
+	suite.broker.publish("events", "fast", 1, false)
+	suite.broker.publish("events", "fast", 1, false)
+
+	suite.WaitForNumRecords(suite.runtime, 3)
+	suite.waitForNumUnacked("client1", 0)
+
+	suite.Equal(0, suite.broker.getNumOutOfOrderAcks("client1"))
+}
+
+func (suite *EventSourceTestSuite) TestQoS2() {
+	suite.startEventSource(suite.createConfiguration("client1", 2))
+
+	suite.broker.publish("events", "once", 2, false)
+
+	// the exchange completes once the message was handled
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.WaitFor(func() bool { return suite.broker.getNumCompleted("client1") == 1 })
+
+	suite.Equal(0, suite.broker.getNumUnacked("client1"))
+	suite.Equal(2, suite.getProcessedMessages()[0].qos)
+}
+
+func (suite *EventSourceTestSuite) TestPersistentSession() {
+	eventSource := suite.startEventSource(suite.createConfiguration("client1", 1))
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	suite.EventSources = nil
+
+	// published while we're away, kept by the broker for our session
+	suite.broker.publish("events", "missed", 1, false)
+
+	suite.startEventSource(suite.createConfiguration("client1", 1))
+
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.Equal("missed", suite.getProcessedMessages()[0].body)
+}
+
+func (suite *EventSourceTestSuite) TestAuthentication() {
+	configuration := suite.createConfiguration("client1", 1)
+	configuration.Password = "wrong"
+
+	eventSource := suite.createEventSource(configuration)
+
+	err := eventSource.Start(nil)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "bad user name or password")
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	suite.ExpectStopReturns(suite.createEventSource(suite.createConfiguration("client1", 1)))
+}
+
+func (suite *EventSourceTestSuite) createConfiguration(clientID string, qos int) *Configuration {
+	return &Configuration{
+		Configuration:         suite.CreateConfiguration("mqtt1", 2),
+		ClientKind:            "mqtt",
+		BrokerURL:             suite.broker.url(),
+		Topics:                []string{"events"},
+		QoS:                   qos,
+		ClientID:              clientID,
+		Username:              "user",
+		Password:              "secret",
+		KeepAliveSeconds:      60,
+		ReconnectBackoffMs:    10,
+		ReconnectMaxBackoffMs: 100,
+	}
+}
+
+func (suite *EventSourceTestSuite) createEventSource(configuration *Configuration) eventsource.EventSource {
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 2), configuration)
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+// returns once subscribed
+func (suite *EventSourceTestSuite) startEventSource(configuration *Configuration) eventsource.EventSource {
+	return suite.StartEventSource(suite.createEventSource(configuration), nil)
+}
+
+func (suite *EventSourceTestSuite) getProcessedMessages() []processedMessage {
+	var processedMessages []processedMessage
+
+	for _, record := range suite.runtime.GetRecords() {
+		processedMessages = append(processedMessages, record.(processedMessage))
+	}
+
+	return processedMessages
+}
+
+func (suite *EventSourceTestSuite) waitForNumUnacked(clientID string, numUnacked int) {
+	suite.WaitFor(func() bool { return suite.broker.getNumUnacked(clientID) == numUnacked })
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
@@ -0,0 +1,127 @@
+package mqtt
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// a configured client ID asks for a persistent session. otherwise, the session is clean and the client ID
+	// need only be unique among the function's replicas
+	if !eventSourceConfiguration.IsSet("client_id") {
+		hostname, _ := os.Hostname()
+
+		eventSourceConfiguration.SetDefault("client_id", fmt.Sprintf("nuclio-%s-%s",
+			eventSourceConfiguration.GetString("id"),
+			hostname))
+
+		eventSourceConfiguration.SetDefault("clean_session", true)
+	}
+
+	// defaults
+	eventSourceConfiguration.SetDefault("client", "mqtt")
+	eventSourceConfiguration.SetDefault("url", "tcp://127.0.0.1:1883")
+	eventSourceConfiguration.SetDefault("qos", 1)
+	eventSourceConfiguration.SetDefault("keep_alive_s", 60)
+	eventSourceConfiguration.SetDefault("reconnect_backoff_ms", 500)
+	eventSourceConfiguration.SetDefault("reconnect_max_backoff_ms", 30000)
+
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"client":                   eventsource.ValueTypeString,
+		"url":                      eventsource.ValueTypeString,
+		"topics":                   eventsource.ValueTypeStringSlice,
+		"topic":                    eventsource.ValueTypeString,
+		"qos":                      eventsource.ValueTypeInt,
+		"client_id":                eventsource.ValueTypeString,
+		"clean_session":            eventsource.ValueTypeBool,
+		"username":                 eventsource.ValueTypeString,
+		"password":                 eventsource.ValueTypeString,
+		"tls_ca_file":              eventsource.ValueTypeString,
+		"tls_cert_file":            eventsource.ValueTypeString,
+		"tls_key_file":             eventsource.ValueTypeString,
+		"tls_insecure_skip_verify": eventsource.ValueTypeBool,
+		"keep_alive_s":             eventsource.ValueTypeInt,
+		"reconnect_backoff_ms":     eventsource.ValueTypeInt,
+		"reconnect_max_backoff_ms": eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	mqttConfiguration := &Configuration{
+		Configuration:         *configuration,
+		ClientKind:            eventSourceConfiguration.GetString("client"),
+		BrokerURL:             eventSourceConfiguration.GetString("url"),
+		Topics:                eventSourceConfiguration.GetStringSlice("topics"),
+		QoS:                   eventSourceConfiguration.GetInt("qos"),
+		ClientID:              eventSourceConfiguration.GetString("client_id"),
+		CleanSession:          eventSourceConfiguration.GetBool("clean_session"),
+		Username:              eventSourceConfiguration.GetString("username"),
+		Password:              eventSourceConfiguration.GetString("password"),
+		TLSCAFile:             eventSourceConfiguration.GetString("tls_ca_file"),
+		TLSCertFile:           eventSourceConfiguration.GetString("tls_cert_file"),
+		TLSKeyFile:            eventSourceConfiguration.GetString("tls_key_file"),
+		TLSInsecureSkipVerify: eventSourceConfiguration.GetBool("tls_insecure_skip_verify"),
+		KeepAliveSeconds:      eventSourceConfiguration.GetInt("keep_alive_s"),
+		ReconnectBackoffMs:    eventSourceConfiguration.GetInt("reconnect_backoff_ms"),
+		ReconnectMaxBackoffMs: eventSourceConfiguration.GetInt("reconnect_max_backoff_ms"),
+	}
+
+	// the topic key may be used for a single topic
+	if len(mqttConfiguration.Topics) == 0 && eventSourceConfiguration.GetString("topic") != "" {
+		mqttConfiguration.Topics = []string{eventSourceConfiguration.GetString("topic")}
+	}
+
+	if len(mqttConfiguration.Topics) == 0 {
+		return nil, fmt.Errorf("MQTT event source %s requires topics", configuration.ID)
+	}
+
+	if mqttConfiguration.QoS < 0 || mqttConfiguration.QoS > 2 {
+		return nil, fmt.Errorf("Invalid QoS: %d", mqttConfiguration.QoS)
+	}
+
+	if mqttConfiguration.ReconnectBackoffMs <= 0 {
+		return nil, errors.New("Reconnect backoff must be positive")
+	}
+
+	// create logger parent
+	mqttLogger := parentLogger.GetChild("mqtt").(nuclio.Logger)
+
+	// messages are processed concurrently, one per worker
+	workerAllocator, err := eventsource.NewWorkerAllocator(mqttLogger,
+		configuration,
+		runtimeConfiguration,
+		workerPools)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	mqttEventSource, err := newEventSource(mqttLogger, workerAllocator, mqttConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create MQTT event source")
+	}
+
+	return mqttEventSource, nil
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("mqtt", &factory{})
+}
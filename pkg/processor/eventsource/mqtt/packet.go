@@ -0,0 +1,192 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// MQTT 3.1.1 control packet types (http://docs.oasis-open.org/mqtt/mqtt/v3.1.1/mqtt-v3.1.1.html)
+const (
+	packetTypeConnect    byte = 1
+	packetTypeConnack    byte = 2
+	packetTypePublish    byte = 3
+	packetTypePuback     byte = 4
+	packetTypePubrec     byte = 5
+	packetTypePubrel     byte = 6
+	packetTypePubcomp    byte = 7
+	packetTypeSubscribe  byte = 8
+	packetTypeSuback     byte = 9
+	packetTypePingreq    byte = 12
+	packetTypePingresp   byte = 13
+	packetTypeDisconnect byte = 14
+
+	// returned in SUBACK for subscriptions the broker refused
+	subackFailureCode byte = 0x80
+)
+
+type packet struct {
+	packetType byte
+	flags      byte
+	body       []byte
+}
+
+// reads the fixed header (type, flags and the remaining length) and the rest of the packet
+func readPacket(reader *bufio.Reader) (*packet, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// the remaining length is encoded in up to 4 bytes, 7 bits each, least significant first
+	remainingLength := 0
+
+	for multiplier := 1; ; multiplier *= 128 {
+		encodedByte, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		remainingLength += int(encodedByte&0x7f) * multiplier
+
+		if encodedByte&0x80 == 0 {
+			break
+		}
+
+		if multiplier == 128*128*128 {
+			return nil, errors.New("Malformed remaining length")
+		}
+	}
+
+	body := make([]byte, remainingLength)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+
+	return &packet{
+		packetType: header >> 4,
+		flags:      header & 0x0f,
+		body:       body,
+	}, nil
+}
+
+func encodePacket(packetType byte, flags byte, body []byte) []byte {
+	encodedPacket := []byte{packetType<<4 | flags}
+
+	remainingLength := len(body)
+
+	for {
+		encodedByte := byte(remainingLength % 128)
+		remainingLength /= 128
+
+		if remainingLength > 0 {
+			encodedByte |= 0x80
+		}
+
+		encodedPacket = append(encodedPacket, encodedByte)
+
+		if remainingLength == 0 {
+			break
+		}
+	}
+
+	return append(encodedPacket, body...)
+}
+
+// strings are prefixed by their length, as a big endian uint16
+func appendString(buffer []byte, value string) []byte {
+	buffer = appendUint16(buffer, uint16(len(value)))
+
+	return append(buffer, value...)
+}
+
+func appendUint16(buffer []byte, value uint16) []byte {
+	return append(buffer, byte(value>>8), byte(value))
+}
+
+// returns the string at the start of the buffer and the rest of the buffer
+func readString(buffer []byte) (string, []byte, error) {
+	length, buffer, err := readUint16(buffer)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(buffer) < int(length) {
+		return "", nil, errors.New("String exceeds packet")
+	}
+
+	return string(buffer[:length]), buffer[length:], nil
+}
+
+func readUint16(buffer []byte) (uint16, []byte, error) {
+	if len(buffer) < 2 {
+		return 0, nil, errors.New("Packet too short")
+	}
+
+	return binary.BigEndian.Uint16(buffer), buffer[2:], nil
+}
+
+// encodes a PUBLISH packet. the packet ID is only sent for QoS 1/2
+func encodePublish(message *Message) []byte {
+	flags := message.QoS << 1
+
+	if message.Duplicate {
+		flags |= 0x08
+	}
+
+	if message.Retained {
+		flags |= 0x01
+	}
+
+	body := appendString(nil, message.Topic)
+
+	if message.QoS > 0 {
+		body = appendUint16(body, message.PacketID)
+	}
+
+	return encodePacket(packetTypePublish, flags, append(body, message.Payload...))
+}
+
+func decodePublish(publishPacket *packet) (*Message, error) {
+	message := &Message{
+		QoS:       (publishPacket.flags >> 1) & 0x03,
+		Retained:  publishPacket.flags&0x01 != 0,
+		Duplicate: publishPacket.flags&0x08 != 0,
+	}
+
+	if message.QoS > 2 {
+		return nil, errors.Errorf("Invalid QoS %d", message.QoS)
+	}
+
+	topic, remainingBody, err := readString(publishPacket.body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read topic")
+	}
+
+	message.Topic = topic
+
+	if message.QoS > 0 {
+		message.PacketID, remainingBody, err = readUint16(remainingBody)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read packet ID")
+		}
+	}
+
+	message.Payload = remainingBody
+
+	return message, nil
+}
+
+// encodes PUBACK, PUBREC, PUBREL and PUBCOMP, which only hold a packet ID
+func encodeAck(packetType byte, packetID uint16) []byte {
+	var flags byte
+
+	// PUBREL has reserved flags
+	if packetType == packetTypePubrel {
+		flags = 0x02
+	}
+
+	return encodePacket(packetType, flags, appendUint16(nil, packetID))
+}
@@ -0,0 +1,38 @@
+package mqtt
+
+import "github.com/nuclio/nuclio/pkg/processor/eventsource"
+
+type Configuration struct {
+	eventsource.Configuration
+	ClientKind string
+
+	// tcp://host:port, or ssl://host:port for TLS
+	BrokerURL string
+
+	// the topic filters subscribed to, which may hold wildcards (e.g. sensors/+/temperature, alerts/#),
+	// and the maximum QoS (0, 1 or 2) of the messages delivered for them
+	Topics []string
+	QoS    int
+
+	// the broker keeps the subscriptions and the QoS 1/2 messages of a client ID while it's disconnected,
+	// unless the session is clean. sessions are clean unless a client ID is configured. QoS 1/2 messages that
+	// fail (and aren't dead lettered) are delivered again by reconnecting, so with a clean session - which the
+	// broker doesn't keep - they're lost
+	ClientID     string
+	CleanSession bool
+
+	Username string
+	Password string
+
+	// a CA to verify the broker with (the system's CAs if empty) and a client certificate to present
+	TLSCAFile             string
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSInsecureSkipVerify bool
+
+	KeepAliveSeconds int
+
+	// the wait before the first reconnection attempt. doubles with every attempt, up to the max
+	ReconnectBackoffMs    int
+	ReconnectMaxBackoffMs int
+}
@@ -0,0 +1,60 @@
+package nats
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+)
+
+// a message received on a subject
+type Message struct {
+	Subject string
+
+	// the subject the publisher expects a reply on, if any (e.g. a request)
+	Reply string
+
+	Data []byte
+}
+
+// a connection to a NATS server. the nats event source is written against this so that the protocol
+// implementation can be swapped (e.g. for one with TLS)
+type Client interface {
+
+	// subscribes to a subject, which may hold wildcards, as a member of a queue group (empty - none).
+	// each message is delivered to a single member of the group. messages are sent to the given channel
+	Subscribe(subject string, queueGroup string, messages chan<- *Message) error
+
+	// publishes a message, asking for replies on replySubject (empty - none)
+	Publish(subject string, replySubject string, data []byte) error
+
+	// closed once the connection is lost or closed
+	Done() <-chan struct{}
+
+	Close() error
+}
+
+//
+// Client registry
+// Clients are keyed by the client kind in the event source configuration
+//
+
+type ClientCreator interface {
+	Create(logger nuclio.Logger, url string) (Client, error)
+}
+
+type ClientRegistry struct {
+	registry.Registry
+}
+
+// global singleton
+var ClientRegistrySingleton = ClientRegistry{
+	Registry: *registry.NewRegistry("nats_client"),
+}
+
+func (r *ClientRegistry) NewClient(logger nuclio.Logger, kind string, url string) (Client, error) {
+	registree, err := r.Get(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(ClientCreator).Create(logger, url)
+}
@@ -0,0 +1,380 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPort = "4222"
+
+	// how long connecting, including the handshake, may take
+	connectTimeout = 5 * time.Second
+
+	// how long a write may block (e.g. on a server that stopped reading) before the connection is dropped
+	writeTimeout = 5 * time.Second
+
+	// the server is pinged this often
+	pingInterval = 20 * time.Second
+
+	// a connection whose pings go unanswered this many times is dropped
+	maxPingsOutstanding = 2
+)
+
+//
+// A client speaking the NATS text protocol over TCP (https://nats.io/documentation/internals/nats-protocol)
+//
+
+type conn struct {
+	logger  nuclio.Logger
+	netConn net.Conn
+	reader  *bufio.Reader
+
+	// how often the server is pinged
+	pingInterval time.Duration
+
+	// writes of different go routines must not interleave
+	writeLock sync.Mutex
+
+	subscriptionsLock sync.Mutex
+	subscriptions     map[int]chan<- *Message
+	lastSid           int
+
+	// pings sent and not answered yet, and whether the reader is blocked handing a message over (in which case
+	// pongs aren't read). accessed atomically
+	pingsOutstanding int32
+	delivering       int32
+
+	closeOnce sync.Once
+	closeChan chan struct{}
+	doneChan  chan struct{}
+}
+
+// connects and completes the handshake, returning once the server acknowledged our connection
+func newConn(parentLogger nuclio.Logger, serverURL string) (*conn, error) {
+	return newConnWithPingInterval(parentLogger, serverURL, pingInterval)
+}
+
+func newConnWithPingInterval(parentLogger nuclio.Logger,
+	serverURL string,
+	pingInterval time.Duration) (*conn, error) {
+
+	parsedURL, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse URL")
+	}
+
+	if parsedURL.Scheme != "nats" {
+		return nil, errors.Errorf("Unsupported scheme %s", parsedURL.Scheme)
+	}
+
+	address := parsedURL.Host
+	if parsedURL.Port() == "" {
+		address = net.JoinHostPort(parsedURL.Hostname(), defaultPort)
+	}
+
+	netConn, err := net.DialTimeout("tcp", address, connectTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to dial server")
+	}
+
+	newConn := &conn{
+		logger:        parentLogger,
+		netConn:       netConn,
+		reader:        bufio.NewReader(netConn),
+		pingInterval:  pingInterval,
+		subscriptions: map[int]chan<- *Message{},
+		closeChan:     make(chan struct{}),
+		doneChan:      make(chan struct{}),
+	}
+
+	if err := newConn.handshake(parsedURL.User); err != nil {
+		netConn.Close()
+		return nil, errors.Wrap(err, "Failed to complete handshake")
+	}
+
+	go newConn.read()
+	go newConn.ping()
+
+	return newConn, nil
+}
+
+func (c *conn) Subscribe(subject string, queueGroup string, messages chan<- *Message) error {
+	c.subscriptionsLock.Lock()
+	c.lastSid++
+	sid := c.lastSid
+	c.subscriptions[sid] = messages
+	c.subscriptionsLock.Unlock()
+
+	command := fmt.Sprintf("SUB %s %d\r\n", subject, sid)
+	if queueGroup != "" {
+		command = fmt.Sprintf("SUB %s %s %d\r\n", subject, queueGroup, sid)
+	}
+
+	return c.write([]byte(command))
+}
+
+func (c *conn) Publish(subject string, replySubject string, data []byte) error {
+	command := fmt.Sprintf("PUB %s %d\r\n", subject, len(data))
+	if replySubject != "" {
+		command = fmt.Sprintf("PUB %s %s %d\r\n", subject, replySubject, len(data))
+	}
+
+	frame := make([]byte, 0, len(command)+len(data)+2)
+	frame = append(frame, command...)
+	frame = append(frame, data...)
+	frame = append(frame, "\r\n"...)
+
+	return c.write(frame)
+}
+
+func (c *conn) Done() <-chan struct{} {
+	return c.doneChan
+}
+
+func (c *conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.closeChan)
+		err = c.netConn.Close()
+	})
+
+	<-c.doneChan
+
+	return err
+}
+
+func (c *conn) handshake(user *url.Userinfo) error {
+	c.netConn.SetDeadline(time.Now().Add(connectTimeout))
+	defer c.netConn.SetDeadline(time.Time{})
+
+	// the server introduces itself first
+	op, _, err := c.readOp()
+	if err != nil {
+		return errors.Wrap(err, "Failed to read server info")
+	}
+
+	if op != "INFO" {
+		return errors.Errorf("Expected INFO, got %s", op)
+	}
+
+	options := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "nuclio",
+		"lang":     "go",
+		"protocol": 1,
+	}
+
+	if user != nil {
+		options["user"] = user.Username()
+		options["pass"], _ = user.Password()
+	}
+
+	encodedOptions, err := json.Marshal(options)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode options")
+	}
+
+	// the server answers the ping once it processed our connect (or fails it, e.g. due to bad credentials)
+	if err := c.write([]byte(fmt.Sprintf("CONNECT %s\r\nPING\r\n", encodedOptions))); err != nil {
+		return errors.Wrap(err, "Failed to connect")
+	}
+
+	for {
+		op, args, err := c.readOp()
+		if err != nil {
+			return errors.Wrap(err, "Failed to read connect response")
+		}
+
+		switch op {
+		case "PONG":
+			return nil
+		case "-ERR":
+			return errors.Errorf("Server refused connection: %s", args)
+		}
+	}
+}
+
+// reads and handles server operations until the connection is closed
+func (c *conn) read() {
+	defer close(c.doneChan)
+
+	for {
+		op, args, err := c.readOp()
+		if err != nil {
+			if !c.closed() {
+				c.logger.WarnWith("Connection lost", "err", err)
+
+				c.netConn.Close()
+			}
+
+			return
+		}
+
+		switch op {
+		case "MSG":
+			if err := c.handleMessage(args); err != nil {
+				c.logger.WarnWith("Failed to read message, closing connection", "err", err)
+
+				c.netConn.Close()
+				return
+			}
+
+		case "PING":
+			if err := c.write([]byte("PONG\r\n")); err != nil {
+				c.logger.WarnWith("Failed to answer ping", "err", err)
+			}
+
+		case "PONG":
+			atomic.StoreInt32(&c.pingsOutstanding, 0)
+
+		case "-ERR":
+			c.logger.WarnWith("Server reported an error", "err", args)
+		}
+	}
+}
+
+// reads MSG <subject> <sid> [reply-to] <#bytes> followed by the payload
+func (c *conn) handleMessage(args string) error {
+	fields := strings.Fields(args)
+	if len(fields) != 3 && len(fields) != 4 {
+		return errors.Errorf("Malformed MSG arguments: %s", args)
+	}
+
+	sid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return errors.Wrapf(err, "Malformed sid: %s", fields[1])
+	}
+
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return errors.Errorf("Malformed size: %s", fields[len(fields)-1])
+	}
+
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return errors.Wrap(err, "Failed to read payload")
+	}
+
+	message := &Message{
+		Subject: fields[0],
+		Data:    payload[:size],
+	}
+
+	if len(fields) == 4 {
+		message.Reply = fields[2]
+	}
+
+	c.subscriptionsLock.Lock()
+	messages, found := c.subscriptions[sid]
+	c.subscriptionsLock.Unlock()
+
+	if !found {
+		return nil
+	}
+
+	// a subscriber that's behind keeps us from reading, which eventually makes the server drop us
+	atomic.StoreInt32(&c.delivering, 1)
+
+	select {
+	case messages <- message:
+	case <-c.closeChan:
+	}
+
+	atomic.StoreInt32(&c.delivering, 0)
+
+	return nil
+}
+
+// pings the server periodically, so that a connection that silently died is detected
+func (c *conn) ping() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.doneChan:
+			return
+		}
+
+		// unanswered pings say nothing about the server while we're not reading
+		if atomic.LoadInt32(&c.delivering) != 0 {
+			atomic.StoreInt32(&c.pingsOutstanding, 0)
+		}
+
+		if atomic.AddInt32(&c.pingsOutstanding, 1) > maxPingsOutstanding {
+			c.logger.Warn("Server stopped answering pings, closing connection")
+
+			c.netConn.Close()
+			return
+		}
+
+		if err := c.write([]byte("PING\r\n")); err != nil {
+			c.logger.WarnWith("Failed to ping server", "err", err)
+		}
+	}
+}
+
+// reads an operation line, returning the operation (upper cased) and its arguments
+func (c *conn) readOp() (string, string, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return "", "", err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+
+	op, args := line, ""
+	if separatorIndex := strings.IndexAny(line, " \t"); separatorIndex != -1 {
+		op, args = line[:separatorIndex], strings.TrimSpace(line[separatorIndex+1:])
+	}
+
+	return strings.ToUpper(op), args, nil
+}
+
+func (c *conn) write(data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.netConn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	_, err := c.netConn.Write(data)
+
+	return err
+}
+
+func (c *conn) closed() bool {
+	select {
+	case <-c.closeChan:
+		return true
+	default:
+		return false
+	}
+}
+
+type connCreator struct{}
+
+func (cc *connCreator) Create(logger nuclio.Logger, url string) (Client, error) {
+	return newConn(logger, url)
+}
+
+// register the protocol implementation as the default client
+func init() {
+	ClientRegistrySingleton.Register("nats", &connCreator{})
+}
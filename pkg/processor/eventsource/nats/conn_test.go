@@ -0,0 +1,202 @@
+package nats
+
+import (
+	"bytes"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConnTestSuite struct {
+	suite.Suite
+	logger       nuclio.Logger
+	server       *testServer
+	pingInterval time.Duration
+}
+
+func (suite *ConnTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	// ping often, so that unanswered pings are noticed quickly
+	suite.pingInterval = 20 * time.Millisecond
+}
+
+func (suite *ConnTestSuite) SetupTest() {
+	var err error
+
+	suite.server, err = newTestServer()
+	suite.Require().NoError(err)
+}
+
+func (suite *ConnTestSuite) TearDownTest() {
+	suite.server.close()
+}
+
+func (suite *ConnTestSuite) TestSlowSubscriberKeepsConnection() {
+	subscriberConn := suite.createConn()
+	defer subscriberConn.Close()
+
+	publisherConn := suite.createConn()
+	defer publisherConn.Close()
+
+	// nothing is read from the subscription for a while
+	messages := make(chan *Message)
+	suite.Require().NoError(subscriberConn.Subscribe("slow", "", messages))
+	suite.Require().NoError(suite.server.waitForSubscriptions(1))
+
+	suite.Require().NoError(publisherConn.Publish("slow", "", []byte("first")))
+	suite.Require().NoError(publisherConn.Publish("slow", "", []byte("second")))
+
+	// the pongs to the pings sent meanwhile are stuck behind the second message, but the server is fine
+	time.Sleep(10 * suite.pingInterval)
+
+	suite.Equal("first", string(suite.receiveMessage(messages).Data))
+	suite.Equal("second", string(suite.receiveMessage(messages).Data))
+
+	// the reader only notices a dropped connection once it's no longer blocked by the subscriber
+	select {
+	case <-subscriberConn.Done():
+		suite.FailNow("Connection dropped while the subscriber was behind")
+	case <-time.After(10 * suite.pingInterval):
+	}
+}
+
+func (suite *ConnTestSuite) TestUnansweredPingsDropConnection() {
+	conn := suite.createConn()
+	defer conn.Close()
+
+	suite.server.ignorePings()
+
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		suite.Fail("Connection not dropped when pings went unanswered")
+	}
+}
+
+func (suite *ConnTestSuite) TestPublishSubscribe() {
+	conn := suite.createConn()
+	defer conn.Close()
+
+	messages := make(chan *Message, 10)
+	suite.Require().NoError(conn.Subscribe("orders.*", "", messages))
+	suite.Require().NoError(suite.server.waitForSubscriptions(1))
+
+	// payloads are sized, so they may hold line breaks and span many reads
+	largePayload := bytes.Repeat([]byte("0123456789"), 100000)
+
+	for _, testCase := range []struct {
+		subject string
+		reply   string
+		data    []byte
+	}{
+		{"orders.new", "", []byte("hello")},
+		{"orders.new", "replies", []byte("line\r\nbreak")},
+		{"orders.empty", "", []byte{}},
+		{"orders.large", "", largePayload},
+	} {
+		suite.Require().NoError(conn.Publish(testCase.subject, testCase.reply, testCase.data))
+
+		message := suite.receiveMessage(messages)
+		suite.Equal(testCase.subject, message.Subject, testCase.subject)
+		suite.Equal(testCase.reply, message.Reply, testCase.subject)
+		suite.Equal(testCase.data, message.Data, testCase.subject)
+	}
+}
+
+func (suite *ConnTestSuite) TestCredentials() {
+	var err error
+
+	suite.server.close()
+	suite.server, err = newTestServerWithCredentials("user", "secret")
+	suite.Require().NoError(err)
+
+	serverURL, err := url.Parse(suite.server.url())
+	suite.Require().NoError(err)
+
+	// refused with the wrong password
+	serverURL.User = url.UserPassword("user", "wrong")
+	_, err = newConnWithPingInterval(suite.logger, serverURL.String(), suite.pingInterval)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "Authorization Violation")
+
+	serverURL.User = url.UserPassword("user", "secret")
+	conn, err := newConnWithPingInterval(suite.logger, serverURL.String(), suite.pingInterval)
+	suite.Require().NoError(err)
+	conn.Close()
+}
+
+func (suite *ConnTestSuite) TestUnsupportedScheme() {
+	_, err := newConn(suite.logger, "tls://"+suite.server.listener.Addr().String())
+	suite.Error(err)
+}
+
+func (suite *ConnTestSuite) TestMalformedMessageDropsConnection() {
+	conn := suite.createConn()
+	defer conn.Close()
+
+	messages := make(chan *Message, 10)
+	suite.Require().NoError(conn.Subscribe("orders", "", messages))
+	suite.Require().NoError(suite.server.waitForSubscriptions(1))
+
+	suite.server.writeToClients("MSG orders 1 not-a-size\r\n")
+
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		suite.Fail("Connection not dropped on a malformed message")
+	}
+
+	suite.Empty(messages)
+}
+
+func (suite *ConnTestSuite) TestCloseWhileDelivering() {
+	conn := suite.createConn()
+
+	// nothing is ever read from the subscription
+	suite.Require().NoError(conn.Subscribe("orders", "", make(chan *Message)))
+	suite.Require().NoError(suite.server.waitForSubscriptions(1))
+	suite.Require().NoError(conn.Publish("orders", "", []byte("stuck")))
+
+	time.Sleep(50 * time.Millisecond)
+
+	closedChan := make(chan struct{})
+
+	go func() {
+		conn.Close()
+		close(closedChan)
+	}()
+
+	select {
+	case <-closedChan:
+	case <-time.After(5 * time.Second):
+		suite.Fail("Close blocked while delivering a message")
+	}
+}
+
+func (suite *ConnTestSuite) createConn() *conn {
+	newConn, err := newConnWithPingInterval(suite.logger, suite.server.url(), suite.pingInterval)
+	suite.Require().NoError(err)
+
+	return newConn
+}
+
+func (suite *ConnTestSuite) receiveMessage(messages chan *Message) *Message {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		suite.FailNow("Timed out waiting for message")
+	}
+
+	return nil
+}
+
+func TestConnTestSuite(t *testing.T) {
+	suite.Run(t, new(ConnTestSuite))
+}
@@ -0,0 +1,47 @@
+package nats
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// allows accessing a Message. the following headers are available: subject and reply (both strings)
+type Event struct {
+	nuclio.AbstractSync
+	message *Message
+}
+
+func (e *Event) GetBody() []byte {
+	return e.message.Data
+}
+
+func (e *Event) GetSize() int {
+	return len(e.message.Data)
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	switch key {
+	case "subject":
+		return e.message.Subject
+	case "reply":
+		return e.message.Reply
+	default:
+		return nil
+	}
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return map[string]interface{}{
+		"subject": e.message.Subject,
+		"reply":   e.message.Reply,
+	}
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	return []byte(e.GetHeaderString(key))
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	value, _ := e.GetHeader(key).(string)
+
+	return value
+}
@@ -0,0 +1,216 @@
+package nats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type nats struct {
+	eventsource.AbstractEventSource
+	configuration *Configuration
+
+	// the client and the channel its subscriptions deliver to are replaced when reconnecting, and are
+	// accessed under the connection's lock
+	connection *eventsource.Connection
+	client     Client
+	messages   chan *Message
+}
+
+func newEventSource(parentLogger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	// messages are handled concurrently, so the allocator must be shareable
+	if !workerAllocator.Shareable() {
+		return nil, errors.New("NATS event source requires a shareable worker allocator")
+	}
+
+	newEventSource := &nats{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Logger:          parentLogger,
+			WorkerAllocator: workerAllocator,
+			Class:           "async",
+			Kind:            "nats",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
+		},
+		configuration: configuration,
+	}
+
+	newEventSource.connection = eventsource.NewConnection(parentLogger,
+		time.Duration(configuration.ReconnectBackoffMs)*time.Millisecond,
+		time.Duration(configuration.ReconnectMaxBackoffMs)*time.Millisecond,
+		newEventSource.connect,
+		newEventSource.disconnect)
+
+	return newEventSource, nil
+}
+
+func (n *nats) Start(checkpoint eventsource.Checkpoint) error {
+	n.Logger.InfoWith("Starting",
+		"url", n.configuration.URL,
+		"subjects", n.configuration.Subjects,
+		"queueGroup", n.configuration.QueueGroup,
+		"numWorkers", n.configuration.NumWorkers)
+
+	// the first connection must succeed, so that misconfiguration is reported on start
+	if err := n.connection.Start(n.consume); err != nil {
+		return errors.Wrap(err, "Failed to connect to server")
+	}
+
+	return nil
+}
+
+func (n *nats) Stop(force bool) (eventsource.Checkpoint, error) {
+	n.Logger.InfoWith("Stopping", "force", force)
+
+	// let the messages being processed be replied to, unless we're asked not to wait. messages received but
+	// not handled yet are lost, as NATS doesn't redeliver
+	if err := n.connection.Stop(force, nil); err != nil {
+		return nil, errors.Wrap(err, "Failed to close connection to server")
+	}
+
+	return nil, nil
+}
+
+func (n *nats) GetConnectionState() eventsource.ConnectionState {
+	return n.connection.GetConnectionState()
+}
+
+// publishes a message to the publish subject, allowing other event sources to use us as their dead letter
+// sink. NATS messages carry no headers, so the content type is dropped
+func (n *nats) Publish(body []byte, contentType string) error {
+	n.connection.Lock()
+	defer n.connection.Unlock()
+
+	if n.client == nil {
+		return errors.New("Can't publish while not connected to the server")
+	}
+
+	if n.configuration.PublishSubject == "" {
+		return errors.New("Can't publish without a publish subject")
+	}
+
+	return n.client.Publish(n.configuration.PublishSubject, "", body)
+}
+
+// handles the messages of the current connection until it's lost or we're stopped
+func (n *nats) consume() {
+	n.connection.Lock()
+	client := n.client
+	messages := n.messages
+	n.connection.Unlock()
+
+	// handle as many messages concurrently as we have workers. all handlers consume the messages of all
+	// subscriptions
+	handlersWaitGroup := sync.WaitGroup{}
+
+	for handlerIndex := 0; handlerIndex < n.configuration.NumWorkers; handlerIndex++ {
+		handlersWaitGroup.Add(1)
+
+		go func() {
+			defer handlersWaitGroup.Done()
+
+			n.handleMessages(client, messages)
+		}()
+	}
+
+	handlersWaitGroup.Wait()
+}
+
+// subscribes to all subjects on a new client. called under the connection's lock
+func (n *nats) connect() error {
+	client, err := ClientRegistrySingleton.NewClient(n.Logger, n.configuration.ClientKind, n.configuration.URL)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create client")
+	}
+
+	// holds a message per handler, so that handlers don't wait for the next one to be read
+	messages := make(chan *Message, n.configuration.NumWorkers)
+
+	for _, subject := range n.configuration.Subjects {
+		if err := client.Subscribe(subject, n.configuration.QueueGroup, messages); err != nil {
+
+			// don't leak a connection whose subscriptions failed
+			client.Close()
+
+			return errors.Wrapf(err, "Failed to subscribe to %s", subject)
+		}
+	}
+
+	n.client = client
+	n.messages = messages
+
+	return nil
+}
+
+// called under the connection's lock
+func (n *nats) disconnect() error {
+
+	// nothing to close if we never connected, or already disconnected
+	if n.client == nil {
+		return nil
+	}
+
+	client := n.client
+	n.client = nil
+
+	return client.Close()
+}
+
+// handles the messages received on a connection, until it's lost or we're stopped. replies are published
+// on the same connection
+func (n *nats) handleMessages(client Client, messages <-chan *Message) {
+	var event Event
+
+	for {
+		var message *Message
+
+		select {
+		case message = <-messages:
+		case <-client.Done():
+			return
+		case <-n.connection.StopChan():
+			return
+		}
+
+		// bind to message
+		event.message = message
+
+		// submit to worker. this retries and dead letters the message according to configuration
+		response, submitError, processError := n.SubmitEventToWorker(&event, n.configuration.GetWorkerAllocationTimeout())
+
+		if submitError != nil {
+			n.Logger.WarnWith("Failed to submit message to worker", "err", submitError, "subject", message.Subject)
+
+			processError = submitError
+		} else if processError != nil {
+			n.Logger.WarnWith("Failed to process message", "err", processError, "subject", message.Subject)
+		}
+
+		if message.Reply != "" {
+			n.reply(client, message, response, processError)
+		}
+	}
+}
+
+// publishes the response (or error) to the subject the caller asked us to reply on. a failure to reply
+// doesn't fail the message, since the handler already processed it
+func (n *nats) reply(client Client, message *Message, response interface{}, processError error) {
+	body, err := newReplyBody(response, processError)
+	if err != nil {
+		n.Logger.WarnWith("Failed to create reply", "err", err, "reply", message.Reply)
+		return
+	}
+
+	if err := client.Publish(message.Reply, "", body); err != nil {
+		n.Logger.WarnWith("Failed to publish reply", "err", err, "reply", message.Reply)
+	}
+}
@@ -0,0 +1,188 @@
+package nats
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	server *testServer
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	var err error
+
+	suite.server, err = newTestServer()
+	suite.Require().NoError(err)
+}
+
+func (suite *EventSourceTestSuite) TearDownTest() {
+	suite.StopEventSources()
+	suite.server.close()
+}
+
+func (suite *EventSourceTestSuite) TestRequestReply() {
+	runtime := suite.createRuntime()
+	suite.startEventSource(runtime, "group")
+
+	client := suite.createClient()
+	defer client.Close()
+
+	replies := suite.subscribeToReplies(client)
+
+	suite.Require().NoError(client.Publish("orders.new", "replies", []byte("hello")))
+	suite.Equal("handled:hello", suite.waitForReply(replies))
+
+	// the caller is told that processing failed
+	suite.Require().NoError(client.Publish("orders.new", "replies", []byte("fail")))
+	suite.JSONEq(`{"error": "Failed to process event: Processing error"}`, suite.waitForReply(replies))
+
+	// subjects outside the wildcard aren't consumed
+	suite.Require().NoError(client.Publish("payments.new", "replies", []byte("ignored")))
+	suite.Require().NoError(client.Publish("orders.old", "replies", []byte("last")))
+	suite.Equal("handled:last", suite.waitForReply(replies))
+
+	suite.Equal([]string{"orders.new", "orders.new", "orders.old"}, suite.getProcessedSubjects(runtime))
+}
+
+func (suite *EventSourceTestSuite) TestQueueGroups() {
+	firstMemberRuntime := suite.createRuntime()
+	secondMemberRuntime := suite.createRuntime()
+	otherGroupRuntime := suite.createRuntime()
+
+	suite.startEventSource(firstMemberRuntime, "group")
+	suite.startEventSource(secondMemberRuntime, "group")
+	suite.startEventSource(otherGroupRuntime, "other-group")
+
+	client := suite.createClient()
+	defer client.Close()
+
+	for messageIndex := 0; messageIndex < 10; messageIndex++ {
+		suite.Require().NoError(client.Publish("orders.new", "", []byte("order")))
+	}
+
+	// every group gets every message, shared between its members
+	suite.WaitForNumRecords(otherGroupRuntime, 10)
+	suite.WaitForNumRecords(firstMemberRuntime, 5)
+	suite.WaitForNumRecords(secondMemberRuntime, 5)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// and each message is processed by a single member
+	suite.Len(suite.getProcessedSubjects(firstMemberRuntime), 5)
+	suite.Len(suite.getProcessedSubjects(secondMemberRuntime), 5)
+}
+
+func (suite *EventSourceTestSuite) TestReconnect() {
+	runtime := suite.createRuntime()
+	eventSource := suite.startEventSource(runtime, "group")
+
+	suite.server.disconnectClients()
+
+	// the event source reconnects and subscribes again
+	suite.Require().NoError(suite.server.waitForSubscriptions(1))
+
+	client := suite.createClient()
+	defer client.Close()
+
+	replies := suite.subscribeToReplies(client)
+
+	suite.Require().NoError(client.Publish("orders.new", "replies", []byte("again")))
+	suite.Equal("handled:again", suite.waitForReply(replies))
+	suite.Equal(eventsource.ConnectionStateConnected, eventSource.(eventsource.ConnectionStateProvider).GetConnectionState())
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	suite.ExpectStopReturns(suite.createEventSource(suite.createRuntime(), ""))
+}
+
+// records the subjects of the messages it processes and responds with their body. fails messages whose body
+// is "fail"
+func (suite *EventSourceTestSuite) createRuntime() *eventsourcetest.RecordingRuntime {
+	return eventsourcetest.NewRecordingRuntime(func(event nuclio.Event) interface{} {
+		return event.GetHeaderString("subject")
+	}, func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+		if string(event.GetBody()) == "fail" {
+			return nil, errors.New("Processing error")
+		}
+
+		return nuclio.Response{Body: append([]byte("handled:"), event.GetBody()...)}, nil
+	})
+}
+
+func (suite *EventSourceTestSuite) getProcessedSubjects(runtime *eventsourcetest.RecordingRuntime) []string {
+	var processedSubjects []string
+
+	for _, record := range runtime.GetRecords() {
+		processedSubjects = append(processedSubjects, record.(string))
+	}
+
+	return processedSubjects
+}
+
+func (suite *EventSourceTestSuite) createEventSource(runtime *eventsourcetest.RecordingRuntime,
+	queueGroup string) eventsource.EventSource {
+
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(runtime, 2), &Configuration{
+		Configuration:         suite.CreateConfiguration("nats1", 2),
+		ClientKind:            "nats",
+		URL:                   suite.server.url(),
+		Subjects:              []string{"orders.*"},
+		QueueGroup:            queueGroup,
+		ReconnectBackoffMs:    10,
+		ReconnectMaxBackoffMs: 100,
+	})
+
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+// returns once subscribed
+func (suite *EventSourceTestSuite) startEventSource(runtime *eventsourcetest.RecordingRuntime,
+	queueGroup string) eventsource.EventSource {
+
+	eventSource := suite.StartEventSource(suite.createEventSource(runtime, queueGroup), nil)
+	suite.Require().NoError(suite.server.waitForSubscriptions(len(suite.EventSources)))
+
+	return eventSource
+}
+
+func (suite *EventSourceTestSuite) createClient() Client {
+	client, err := newConn(suite.Logger, suite.server.url())
+	suite.Require().NoError(err)
+
+	return client
+}
+
+// the server handles a connection's operations in order, so the subscription is in place for what the
+// client publishes next
+func (suite *EventSourceTestSuite) subscribeToReplies(client Client) chan *Message {
+	replies := make(chan *Message, 10)
+	suite.Require().NoError(client.Subscribe("replies", "", replies))
+
+	return replies
+}
+
+func (suite *EventSourceTestSuite) waitForReply(replies chan *Message) string {
+	select {
+	case reply := <-replies:
+		return string(reply.Data)
+	case <-time.After(5 * time.Second):
+		suite.FailNow("Timed out waiting for reply")
+	}
+
+	return ""
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
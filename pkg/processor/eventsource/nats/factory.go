@@ -0,0 +1,99 @@
+package nats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// defaults. replicas of a function share the event source ID, and so the queue group
+	eventSourceConfiguration.SetDefault("client", "nats")
+	eventSourceConfiguration.SetDefault("url", "nats://127.0.0.1:4222")
+	eventSourceConfiguration.SetDefault("queue_group", "nuclio-"+eventSourceConfiguration.GetString("id"))
+	eventSourceConfiguration.SetDefault("reconnect_backoff_ms", 500)
+	eventSourceConfiguration.SetDefault("reconnect_max_backoff_ms", 30000)
+
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"client":                   eventsource.ValueTypeString,
+		"url":                      eventsource.ValueTypeString,
+		"subjects":                 eventsource.ValueTypeStringSlice,
+		"topic":                    eventsource.ValueTypeString,
+		"queue_group":              eventsource.ValueTypeString,
+		"publish_subject":          eventsource.ValueTypeString,
+		"reconnect_backoff_ms":     eventsource.ValueTypeInt,
+		"reconnect_max_backoff_ms": eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	natsConfiguration := &Configuration{
+		Configuration:         *configuration,
+		ClientKind:            eventSourceConfiguration.GetString("client"),
+		URL:                   eventSourceConfiguration.GetString("url"),
+		Subjects:              eventSourceConfiguration.GetStringSlice("subjects"),
+		QueueGroup:            eventSourceConfiguration.GetString("queue_group"),
+		PublishSubject:        eventSourceConfiguration.GetString("publish_subject"),
+		ReconnectBackoffMs:    eventSourceConfiguration.GetInt("reconnect_backoff_ms"),
+		ReconnectMaxBackoffMs: eventSourceConfiguration.GetInt("reconnect_max_backoff_ms"),
+	}
+
+	// the topic key may be used for a single subject
+	if len(natsConfiguration.Subjects) == 0 && eventSourceConfiguration.GetString("topic") != "" {
+		natsConfiguration.Subjects = []string{eventSourceConfiguration.GetString("topic")}
+	}
+
+	if len(natsConfiguration.Subjects) == 0 {
+		return nil, fmt.Errorf("NATS event source %s requires subjects", configuration.ID)
+	}
+
+	// publish so that we consume what we publish, unless the first subject is a wildcard
+	if natsConfiguration.PublishSubject == "" && !strings.ContainsAny(natsConfiguration.Subjects[0], "*>") {
+		natsConfiguration.PublishSubject = natsConfiguration.Subjects[0]
+	}
+
+	if natsConfiguration.ReconnectBackoffMs <= 0 {
+		return nil, errors.New("Reconnect backoff must be positive")
+	}
+
+	// create logger parent
+	natsLogger := parentLogger.GetChild("nats").(nuclio.Logger)
+
+	// messages are processed concurrently, one per worker
+	workerAllocator, err := eventsource.NewWorkerAllocator(natsLogger,
+		configuration,
+		runtimeConfiguration,
+		workerPools)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	natsEventSource, err := newEventSource(natsLogger, workerAllocator, natsConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create NATS event source")
+	}
+
+	return natsEventSource, nil
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("nats", &factory{})
+}
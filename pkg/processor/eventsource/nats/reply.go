@@ -0,0 +1,32 @@
+package nats
+
+import (
+	"encoding/json"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// the body of replies to messages whose processing failed. NATS messages carry no headers, so callers tell
+// these apart by their body
+type replyErrorEnvelope struct {
+	Error string `json:"error"`
+}
+
+// creates the body of the reply to a message from the handler's response or processing error
+func newReplyBody(response interface{}, processError error) ([]byte, error) {
+	if processError != nil {
+		return json.Marshal(&replyErrorEnvelope{Error: processError.Error()})
+	}
+
+	switch typedResponse := response.(type) {
+	case nuclio.Response:
+		return typedResponse.Body, nil
+	case []byte:
+		return typedResponse, nil
+	case string:
+		return []byte(typedResponse), nil
+	}
+
+	// callers are waiting for a reply, even if there's nothing to say
+	return []byte{}, nil
+}
@@ -0,0 +1,293 @@
+package nats
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// an embedded server speaking enough of the NATS protocol for the event source: authentication, subscriptions
+// with wildcards and queue groups (served round robin), publishing with reply subjects and pings
+type testServer struct {
+	listener net.Listener
+
+	// non zero while pings are ignored, as by a server that stopped responding. accessed atomically
+	ignoringPings int32
+
+	// required of clients, if set
+	username string
+	password string
+
+	lock          sync.Mutex
+	clients       map[*testServerClient]bool
+	subscriptions []*testServerSubscription
+
+	// the index of the member of each queue group that gets the next message
+	nextQueueMember map[string]int
+}
+
+type testServerClient struct {
+	conn      net.Conn
+	writeLock sync.Mutex
+}
+
+type testServerSubscription struct {
+	client     *testServerClient
+	subject    string
+	queueGroup string
+	sid        string
+}
+
+func newTestServer() (*testServer, error) {
+	return newTestServerWithCredentials("", "")
+}
+
+func newTestServerWithCredentials(username string, password string) (*testServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &testServer{
+		listener:        listener,
+		username:        username,
+		password:        password,
+		clients:         map[*testServerClient]bool{},
+		nextQueueMember: map[string]int{},
+	}
+
+	go server.accept()
+
+	return server, nil
+}
+
+func (ts *testServer) url() string {
+	return "nats://" + ts.listener.Addr().String()
+}
+
+func (ts *testServer) close() {
+	ts.listener.Close()
+	ts.disconnectClients()
+}
+
+// writes raw protocol to all connections
+func (ts *testServer) writeToClients(data string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for client := range ts.clients {
+		client.write(data)
+	}
+}
+
+// drops all connections, as a restarting server would
+func (ts *testServer) disconnectClients() {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for client := range ts.clients {
+		client.conn.Close()
+	}
+
+	ts.clients = map[*testServerClient]bool{}
+	ts.subscriptions = nil
+}
+
+func (ts *testServer) ignorePings() {
+	atomic.StoreInt32(&ts.ignoringPings, 1)
+}
+
+func (ts *testServer) getNumSubscriptions() int {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	return len(ts.subscriptions)
+}
+
+// waits for subscriptions to be registered, since clients don't wait for the server to process them
+func (ts *testServer) waitForSubscriptions(numSubscriptions int) error {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for ts.getNumSubscriptions() < numSubscriptions {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for %d subscriptions", numSubscriptions)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return nil
+}
+
+func (ts *testServer) accept() {
+	for {
+		conn, err := ts.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		client := &testServerClient{conn: conn}
+
+		ts.lock.Lock()
+		ts.clients[client] = true
+		ts.lock.Unlock()
+
+		go ts.serve(client)
+	}
+}
+
+func (ts *testServer) serve(client *testServerClient) {
+	defer ts.removeClient(client)
+
+	reader := bufio.NewReader(client.conn)
+
+	client.write(`INFO {"server_id":"test","version":"1.0.0","max_payload":1048576}` + "\r\n")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "CONNECT":
+			options := struct {
+				User string `json:"user"`
+				Pass string `json:"pass"`
+			}{}
+
+			json.Unmarshal([]byte(strings.TrimSpace(line[len(fields[0]):])), &options)
+
+			if ts.username != "" && (options.User != ts.username || options.Pass != ts.password) {
+				client.write("-ERR 'Authorization Violation'\r\n")
+				return
+			}
+
+		case "PING":
+			if atomic.LoadInt32(&ts.ignoringPings) == 0 {
+				client.write("PONG\r\n")
+			}
+
+		case "SUB":
+			subscription := &testServerSubscription{client: client, subject: fields[1], sid: fields[len(fields)-1]}
+			if len(fields) == 4 {
+				subscription.queueGroup = fields[2]
+			}
+
+			ts.lock.Lock()
+			ts.subscriptions = append(ts.subscriptions, subscription)
+			ts.lock.Unlock()
+
+		case "PUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+
+			reply := ""
+			if len(fields) == 4 {
+				reply = fields[2]
+			}
+
+			ts.route(fields[1], reply, payload[:size])
+		}
+	}
+}
+
+// delivers a message to every matching subscription outside a queue group, and to one member of every
+// matching queue group
+func (ts *testServer) route(subject string, reply string, payload []byte) {
+	ts.lock.Lock()
+
+	var recipients []*testServerSubscription
+	queueGroupMembers := map[string][]*testServerSubscription{}
+
+	for _, subscription := range ts.subscriptions {
+		if !matchSubject(subscription.subject, subject) {
+			continue
+		}
+
+		if subscription.queueGroup == "" {
+			recipients = append(recipients, subscription)
+		} else {
+			queueGroupMembers[subscription.queueGroup] = append(queueGroupMembers[subscription.queueGroup], subscription)
+		}
+	}
+
+	for queueGroup, members := range queueGroupMembers {
+		memberIndex := ts.nextQueueMember[queueGroup] % len(members)
+		ts.nextQueueMember[queueGroup]++
+
+		recipients = append(recipients, members[memberIndex])
+	}
+
+	ts.lock.Unlock()
+
+	for _, recipient := range recipients {
+		if reply == "" {
+			recipient.client.write(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", subject, recipient.sid, len(payload), payload))
+		} else {
+			recipient.client.write(fmt.Sprintf("MSG %s %s %s %d\r\n%s\r\n", subject, recipient.sid, reply, len(payload), payload))
+		}
+	}
+}
+
+func (ts *testServer) removeClient(client *testServerClient) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	client.conn.Close()
+	delete(ts.clients, client)
+
+	var remainingSubscriptions []*testServerSubscription
+	for _, subscription := range ts.subscriptions {
+		if subscription.client != client {
+			remainingSubscriptions = append(remainingSubscriptions, subscription)
+		}
+	}
+
+	ts.subscriptions = remainingSubscriptions
+}
+
+func (tsc *testServerClient) write(data string) {
+	tsc.writeLock.Lock()
+	defer tsc.writeLock.Unlock()
+
+	tsc.conn.Write([]byte(data))
+}
+
+// * matches a single token, > matches one or more trailing tokens
+func matchSubject(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+
+	for tokenIndex, patternToken := range patternTokens {
+		if patternToken == ">" {
+			return len(subjectTokens) > tokenIndex
+		}
+
+		if tokenIndex >= len(subjectTokens) {
+			return false
+		}
+
+		if patternToken != "*" && patternToken != subjectTokens[tokenIndex] {
+			return false
+		}
+	}
+
+	return len(patternTokens) == len(subjectTokens)
+}
@@ -0,0 +1,22 @@
+package nats
+
+import "github.com/nuclio/nuclio/pkg/processor/eventsource"
+
+type Configuration struct {
+	eventsource.Configuration
+	ClientKind string
+	URL        string
+
+	// the subjects subscribed to, which may hold wildcards (e.g. orders.*, metrics.>)
+	Subjects []string
+
+	// processors subscribed in the same queue group share messages rather than each getting a copy
+	QueueGroup string
+
+	// the subject of messages published through the event source (e.g. dead letters)
+	PublishSubject string
+
+	// the wait before the first reconnection attempt. doubles with every attempt, up to the max
+	ReconnectBackoffMs    int
+	ReconnectMaxBackoffMs int
+}
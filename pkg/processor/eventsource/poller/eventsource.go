@@ -6,14 +6,14 @@ import (
 	"github.com/nuclio/nuclio-sdk"
 	"github.com/nuclio/nuclio/pkg/processor/eventsource"
 	"github.com/nuclio/nuclio/pkg/processor/worker"
-
-	"github.com/pkg/errors"
 )
 
 type AbstractPoller struct {
 	eventsource.AbstractEventSource
 	configuration *Configuration
 	poller        Poller
+	stopChan      chan struct{}
+	stoppedChan   chan struct{}
 }
 
 func NewAbstractPoller(logger nuclio.Logger,
@@ -26,8 +26,12 @@ func NewAbstractPoller(logger nuclio.Logger,
 			WorkerAllocator: workerAllocator,
 			Class:           "batch",
 			Kind:            "poller",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
 		},
 		configuration: configuration,
+		stopChan:      make(chan struct{}),
 	}
 }
 
@@ -37,6 +41,7 @@ func (ap *AbstractPoller) SetPoller(poller Poller) {
 }
 
 func (ap *AbstractPoller) Start(checkpoint eventsource.Checkpoint) error {
+	ap.stoppedChan = make(chan struct{})
 
 	// process one cycle at a time (don't getNewEvents again while processing)
 	go ap.getEventsSingleCycle()
@@ -45,11 +50,34 @@ func (ap *AbstractPoller) Start(checkpoint eventsource.Checkpoint) error {
 }
 
 func (ap *AbstractPoller) Stop(force bool) (eventsource.Checkpoint, error) {
+	ap.Logger.InfoWith("Stopping", "force", force)
+
+	// signal the polling go routine to stop after the current batch. a forced stop may follow a graceful one
+	select {
+	case <-ap.stopChan:
+	default:
+		close(ap.stopChan)
+	}
+
+	// let the current batch complete and be post processed, unless we're asked not to wait. if we never
+	// started, there's nothing to wait for
+	if !force && ap.stoppedChan != nil {
+		<-ap.stoppedChan
+	}
 
-	// TODO
+	// pollers persist their position in the polled resource during post processing
 	return nil, nil
 }
 
+func (ap *AbstractPoller) stopped() bool {
+	select {
+	case <-ap.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
 // in this strategy, we trigger getNewEvents once, process all the events it creates (while getNewEvents is producing
 // and only then re-trigger getNewEvents. in the future we'll probably have getNewEvents producing in the background
 func (ap *AbstractPoller) getEventsSingleCycle() {
@@ -58,6 +86,9 @@ func (ap *AbstractPoller) getEventsSingleCycle() {
 
 	eventsChan := make(chan nuclio.Event)
 
+	// indicate to stop that the last batch was post processed
+	defer close(ap.stoppedChan)
+
 	for {
 		eventCycleCompleted := false
 
@@ -75,31 +106,40 @@ func (ap *AbstractPoller) getEventsSingleCycle() {
 				time.Duration(ap.configuration.MaxBatchWaitMs)*time.Millisecond)
 
 			if err != nil {
-				errors.Wrap(err, "Failed to gather event batch")
+				ap.Logger.WarnWith("Failed to gather event batch", "err", err)
 				continue
-
-				// TODO
 			}
 
-			ap.Logger.DebugWith("Got events", "num", len(eventBatch))
+			// the batch wait may expire before the poll produced anything
+			if len(eventBatch) != 0 {
+				ap.Logger.DebugWith("Got events", "num", len(eventBatch))
 
-			// send the batch to the worker
-			// eventResponses, submitError, eventErrors := ap.SubmitEventsToWorker(eventBatch, 10 * time.Second)
-			eventResponses, submitError, eventErrors := ap.SubmitEventsToWorker(eventBatch, 10*time.Second)
+				// send the batch to the worker
+				eventResponses, submitError, eventErrors := ap.SubmitEventsToWorker(eventBatch,
+					ap.configuration.GetWorkerAllocationTimeout())
 
-			if submitError != nil {
-				errors.Wrap(err, "Failed to submit events to worker")
-				continue
+				// the events weren't processed, so they aren't post processed. pollers produce them again
+				if submitError != nil {
+					ap.Logger.WarnWith("Failed to submit events to worker", "err", submitError)
+				} else {
 
-				// TODO
+					// post process the events
+					ap.poller.PostProcessEvents(eventBatch, eventResponses, eventErrors)
+				}
 			}
 
-			// post process the events
-			ap.poller.PostProcessEvents(eventBatch, eventResponses, eventErrors)
+			// don't submit any more batches if we were stopped
+			if ap.stopped() {
+				return
+			}
 		}
 
-		// wait the interva
-		time.Sleep(time.Duration(ap.configuration.IntervalMs) * time.Millisecond)
+		// wait the interval, or bail if we're stopped
+		select {
+		case <-time.After(time.Duration(ap.configuration.IntervalMs) * time.Millisecond):
+		case <-ap.stopChan:
+			return
+		}
 	}
 }
 
@@ -132,7 +172,7 @@ func (ap *AbstractPoller) waitForEventBatch(eventsChan chan nuclio.Event,
 				events = append(events, receivedEvent)
 
 				// check if we reached max size. if so we're done
-				if len(events) > maxBatchSize {
+				if len(events) >= maxBatchSize {
 					done = true
 				}
 			}
@@ -0,0 +1,233 @@
+package poller
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type testEvent struct {
+	nuclio.AbstractEvent
+	body string
+}
+
+func (te *testEvent) GetBody() []byte {
+	return []byte(te.body)
+}
+
+type nopRuntime struct{}
+
+func (nr *nopRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	return string(event.GetBody()), nil
+}
+
+// fails allocations while failing is set
+type failingAllocator struct {
+	worker.WorkerAllocator
+	lock    sync.Mutex
+	failing bool
+}
+
+func (fa *failingAllocator) Allocate(timeout time.Duration) (*worker.Worker, error) {
+	fa.lock.Lock()
+	failing := fa.failing
+	fa.lock.Unlock()
+
+	if failing {
+		return nil, errors.New("Allocation failed")
+	}
+
+	return fa.WorkerAllocator.Allocate(timeout)
+}
+
+func (fa *failingAllocator) setFailing(failing bool) {
+	fa.lock.Lock()
+	defer fa.lock.Unlock()
+
+	fa.failing = failing
+}
+
+// produces the bodies of the next poll, after a delay, and records the batches it post processes
+type testPoller struct {
+	AbstractPoller
+	lock          sync.Mutex
+	pollBodies    []string
+	pollDelay     time.Duration
+	postProcessed [][]interface{}
+	numPolls      int
+}
+
+func (tp *testPoller) GetNewEvents(eventsChan chan nuclio.Event) error {
+	defer func() {
+		eventsChan <- nil
+	}()
+
+	time.Sleep(tp.pollDelay)
+
+	tp.lock.Lock()
+	bodies := tp.pollBodies
+	tp.pollBodies = nil
+	tp.numPolls++
+	tp.lock.Unlock()
+
+	for _, body := range bodies {
+		eventsChan <- &testEvent{body: body}
+	}
+
+	return nil
+}
+
+func (tp *testPoller) PostProcessEvents(events []nuclio.Event, responses []interface{}, processErrors []error) {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	tp.postProcessed = append(tp.postProcessed, responses)
+}
+
+func (tp *testPoller) setPollBodies(bodies ...string) {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	tp.pollBodies = bodies
+}
+
+func (tp *testPoller) getPostProcessed() [][]interface{} {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	return append([][]interface{}{}, tp.postProcessed...)
+}
+
+func (tp *testPoller) getNumPolls() int {
+	tp.lock.Lock()
+	defer tp.lock.Unlock()
+
+	return tp.numPolls
+}
+
+type EventSourceTestSuite struct {
+	suite.Suite
+	logger    nuclio.Logger
+	allocator *failingAllocator
+	poller    *testPoller
+}
+
+func (suite *EventSourceTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	workerAllocator, err := worker.NewSingletonWorkerAllocator(suite.logger,
+		worker.NewWorker(suite.logger, 0, &nopRuntime{}))
+
+	suite.Require().NoError(err)
+
+	suite.allocator = &failingAllocator{WorkerAllocator: workerAllocator}
+	suite.poller = nil
+}
+
+func (suite *EventSourceTestSuite) TearDownTest() {
+	if suite.poller != nil {
+		suite.poller.Stop(false)
+	}
+}
+
+func (suite *EventSourceTestSuite) TestBatchesCappedAtMaxSize() {
+	suite.startPoller(0)
+	suite.poller.setPollBodies("a", "b", "c", "d", "e")
+
+	suite.waitFor(func() bool { return len(suite.poller.getPostProcessed()) == 3 })
+
+	suite.Equal([][]interface{}{{"a", "b"}, {"c", "d"}, {"e"}}, suite.poller.getPostProcessed())
+}
+
+func (suite *EventSourceTestSuite) TestEmptyBatchesNotSubmitted() {
+
+	// polls outlast the batch wait, which expires with no events
+	suite.startPoller(50 * time.Millisecond)
+
+	suite.waitFor(func() bool { return suite.poller.getNumPolls() >= 3 })
+
+	suite.Empty(suite.poller.getPostProcessed())
+}
+
+func (suite *EventSourceTestSuite) TestSubmitErrorSkipsPostProcessing() {
+	suite.allocator.setFailing(true)
+	suite.startPoller(0)
+	suite.poller.setPollBodies("a")
+
+	suite.waitFor(func() bool { return suite.poller.getNumPolls() >= 3 })
+	suite.Empty(suite.poller.getPostProcessed())
+
+	// the poller produces the events again once they can be submitted
+	suite.allocator.setFailing(false)
+	suite.poller.setPollBodies("a")
+
+	suite.waitFor(func() bool { return len(suite.poller.getPostProcessed()) == 1 })
+	suite.Equal([]interface{}{"a"}, suite.poller.getPostProcessed()[0])
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	configuration := &Configuration{
+		Configuration: eventsource.Configuration{ID: "poller1"},
+	}
+
+	stoppedChan := make(chan struct{})
+
+	go func() {
+		NewAbstractPoller(suite.logger, suite.allocator, configuration).Stop(false)
+		close(stoppedChan)
+	}()
+
+	select {
+	case <-stoppedChan:
+	case <-time.After(5 * time.Second):
+		suite.Fail("Stop blocked")
+	}
+}
+
+func (suite *EventSourceTestSuite) startPoller(pollDelay time.Duration) {
+	configuration := &Configuration{
+		Configuration: eventsource.Configuration{
+			ID:                        "poller1",
+			WorkerAllocationTimeoutMs: 100,
+		},
+		IntervalMs:     10,
+		MaxBatchSize:   2,
+		MaxBatchWaitMs: 20,
+	}
+
+	suite.poller = &testPoller{
+		AbstractPoller: *NewAbstractPoller(suite.logger, suite.allocator, configuration),
+		pollDelay:      pollDelay,
+	}
+
+	suite.poller.SetPoller(suite.poller)
+
+	suite.Require().NoError(suite.poller.Start(nil))
+}
+
+func (suite *EventSourceTestSuite) waitFor(condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !condition() {
+		if time.Now().After(deadline) {
+			suite.FailNow("Timed out waiting for condition")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
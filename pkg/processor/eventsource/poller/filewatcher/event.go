@@ -0,0 +1,83 @@
+package filewatcher
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// the changes an event may describe
+const (
+	changeCreate = "create"
+	changeModify = "modify"
+	changeDelete = "delete"
+)
+
+// describes a change to a file. the body is empty - functions read the file at the path. the following
+// headers are available: path and change (create, modify or delete, both strings), size (int64) and
+// mtime (time.Time). deleted files have the size and modification time they were last seen with
+type Event struct {
+	nuclio.AbstractEvent
+	path    string
+	change  string
+	size    int64
+	modTime time.Time
+}
+
+func (e *Event) GetPath() string {
+	return e.path
+}
+
+func (e *Event) GetURL() string {
+	return "file://" + e.path
+}
+
+func (e *Event) GetSize() int {
+	return int(e.size)
+}
+
+func (e *Event) GetTimestamp() time.Time {
+	return e.modTime
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	switch key {
+	case "path":
+		return e.path
+	case "change":
+		return e.change
+	case "size":
+		return e.size
+	case "mtime":
+		return e.modTime
+	default:
+		return nil
+	}
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return map[string]interface{}{
+		"path":   e.path,
+		"change": e.change,
+		"size":   e.size,
+		"mtime":  e.modTime,
+	}
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	return []byte(e.GetHeaderString(key))
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	switch value := e.GetHeader(key).(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
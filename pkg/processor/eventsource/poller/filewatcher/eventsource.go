@@ -0,0 +1,324 @@
+package filewatcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type fileWatcher struct {
+	poller.AbstractPoller
+	configuration *Configuration
+
+	// the files seen, by path. a poll compares the watched files against these while the events of the
+	// same poll are post processed. they're the checkpoint, saved as events are handled and returned when
+	// stopped
+	seenLock  sync.Mutex
+	seenFiles map[string]fileState
+}
+
+// what we know of a file, which tells whether it changed
+type fileState struct {
+	Size int64 `json:"size"`
+
+	// in nanoseconds since the epoch
+	ModTime int64 `json:"mtime"`
+}
+
+func newEventSource(logger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	newEventSource := fileWatcher{
+		AbstractPoller: *poller.NewAbstractPoller(logger, workerAllocator, &configuration.Configuration),
+		configuration:  configuration,
+	}
+
+	newEventSource.Kind = "file-watcher"
+
+	// register self as the poller (to allow parent to call child functions)
+	newEventSource.SetPoller(&newEventSource)
+
+	return &newEventSource, nil
+}
+
+func (fw *fileWatcher) Start(checkpoint eventsource.Checkpoint) error {
+	fw.Logger.InfoWith("Starting",
+		"paths", fw.configuration.Paths,
+		"recursive", fw.configuration.Recursive,
+		"patterns", fw.configuration.Patterns,
+		"suffixes", fw.configuration.Suffixes)
+
+	if err := fw.loadSeenFiles(checkpoint); err != nil {
+		return errors.Wrap(err, "Failed to load seen files")
+	}
+
+	return fw.AbstractPoller.Start(checkpoint)
+}
+
+func (fw *fileWatcher) Stop(force bool) (eventsource.Checkpoint, error) {
+	if _, err := fw.AbstractPoller.Stop(force); err != nil {
+		return nil, err
+	}
+
+	// don't produce events for the changes already handled when restarted
+	return fw.encodeCheckpoint()
+}
+
+// produces an event for each watched file created, modified or deleted since it was last seen
+func (fw *fileWatcher) GetNewEvents(eventsChan chan nuclio.Event) error {
+
+	// we're done. add a "nil" into the channel to indicate where the cycle completes
+	defer func() {
+		eventsChan <- nil
+	}()
+
+	watchedFiles, err := fw.scan()
+	if err != nil {
+
+		// don't mistake files we failed to list for deleted ones. try again next poll
+		fw.Logger.WarnWith("Failed to scan paths", "err", err)
+
+		return errors.Wrap(err, "Failed to scan paths")
+	}
+
+	fw.seenLock.Lock()
+	events := fw.getChanges(watchedFiles)
+	fw.seenLock.Unlock()
+
+	for _, event := range events {
+		eventsChan <- event
+	}
+
+	return nil
+}
+
+// records the files whose events were handled - processed successfully or dead lettered - as seen, and saves
+// them so that a crash doesn't produce their events again. the others produce events again on the next poll
+func (fw *fileWatcher) PostProcessEvents(events []nuclio.Event, responses []interface{}, processErrors []error) {
+	if !fw.recordSeenFiles(events, processErrors) {
+		return
+	}
+
+	checkpoint, err := fw.encodeCheckpoint()
+	if err == nil {
+		err = fw.SaveCheckpoint(checkpoint)
+	}
+
+	if err != nil {
+		fw.Logger.WarnWith("Failed to save seen files", "err", err)
+	}
+}
+
+// returns whether any file was recorded
+func (fw *fileWatcher) recordSeenFiles(events []nuclio.Event, processErrors []error) bool {
+	fw.seenLock.Lock()
+	defer fw.seenLock.Unlock()
+
+	recorded := false
+
+	for eventIndex, event := range events {
+		if processErrors[eventIndex] != nil && !fw.HasDeadLetterSink() {
+			continue
+		}
+
+		fileEvent := event.(*Event)
+
+		if fileEvent.change == changeDelete {
+			delete(fw.seenFiles, fileEvent.path)
+		} else {
+			fw.seenFiles[fileEvent.path] = fileState{
+				Size:    fileEvent.size,
+				ModTime: fileEvent.modTime.UnixNano(),
+			}
+		}
+
+		recorded = true
+	}
+
+	return recorded
+}
+
+func (fw *fileWatcher) getChanges(watchedFiles map[string]fileState) []nuclio.Event {
+	var events []nuclio.Event
+
+	for path, watchedFile := range watchedFiles {
+		seenFile, seen := fw.seenFiles[path]
+
+		switch {
+		case !seen:
+			events = append(events, fw.createEvent(path, changeCreate, watchedFile))
+		case watchedFile != seenFile:
+			events = append(events, fw.createEvent(path, changeModify, watchedFile))
+		}
+	}
+
+	for path, seenFile := range fw.seenFiles {
+		if _, watched := watchedFiles[path]; !watched {
+			events = append(events, fw.createEvent(path, changeDelete, seenFile))
+		}
+	}
+
+	// produce the events in a predictable order
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].GetPath() < events[j].GetPath()
+	})
+
+	return events
+}
+
+func (fw *fileWatcher) createEvent(path string, change string, state fileState) *Event {
+	return &Event{
+		path:    path,
+		change:  change,
+		size:    state.Size,
+		modTime: time.Unix(0, state.ModTime),
+	}
+}
+
+// lists the watched files in all paths. a path that doesn't exist holds no files
+func (fw *fileWatcher) scan() (map[string]fileState, error) {
+	watchedFiles := map[string]fileState{}
+
+	for _, path := range fw.configuration.Paths {
+		var err error
+
+		if fw.configuration.Recursive {
+			err = filepath.Walk(path, func(filePath string, fileInfo os.FileInfo, err error) error {
+
+				// files and directories deleted while we walk are simply not listed
+				if err != nil && os.IsNotExist(err) && filePath != path {
+					return nil
+				}
+
+				if err != nil {
+					return err
+				}
+
+				fw.addWatchedFile(watchedFiles, filePath, fileInfo)
+
+				return nil
+			})
+		} else {
+			var fileInfos []os.FileInfo
+
+			fileInfos, err = ioutil.ReadDir(path)
+
+			for _, fileInfo := range fileInfos {
+				fw.addWatchedFile(watchedFiles, filepath.Join(path, fileInfo.Name()), fileInfo)
+			}
+		}
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "Failed to list %s", path)
+		}
+	}
+
+	return watchedFiles, nil
+}
+
+func (fw *fileWatcher) addWatchedFile(watchedFiles map[string]fileState, path string, fileInfo os.FileInfo) {
+	if !fileInfo.Mode().IsRegular() || !fw.isWatched(path) {
+		return
+	}
+
+	watchedFiles[path] = fileState{
+		Size:    fileInfo.Size(),
+		ModTime: fileInfo.ModTime().UnixNano(),
+	}
+}
+
+func (fw *fileWatcher) isWatched(path string) bool {
+	name := filepath.Base(path)
+
+	if len(fw.configuration.Patterns) != 0 {
+		matched := false
+
+		for _, pattern := range fw.configuration.Patterns {
+			if patternMatched, _ := filepath.Match(pattern, name); patternMatched {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	if len(fw.configuration.Suffixes) != 0 {
+		for _, suffix := range fw.configuration.Suffixes {
+			if strings.HasSuffix(name, suffix) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// loads the files seen before a restart from the checkpoint. when first started, the files that exist are
+// seen only if we're to ignore them
+func (fw *fileWatcher) loadSeenFiles(checkpoint eventsource.Checkpoint) error {
+	fw.seenLock.Lock()
+	defer fw.seenLock.Unlock()
+
+	fw.seenFiles = map[string]fileState{}
+
+	if checkpoint != nil && *checkpoint != "" {
+		if err := json.Unmarshal([]byte(*checkpoint), &fw.seenFiles); err != nil {
+			return errors.Wrap(err, "Failed to decode checkpoint")
+		}
+
+		fw.Logger.DebugWith("Loaded seen files", "numSeenFiles", len(fw.seenFiles))
+
+		return nil
+	}
+
+	if !fw.configuration.IgnoreExisting {
+		return nil
+	}
+
+	var err error
+
+	if fw.seenFiles, err = fw.scan(); err != nil {
+		return errors.Wrap(err, "Failed to scan paths")
+	}
+
+	fw.Logger.DebugWith("Ignoring existing files", "numSeenFiles", len(fw.seenFiles))
+
+	return nil
+}
+
+func (fw *fileWatcher) encodeCheckpoint() (eventsource.Checkpoint, error) {
+	fw.seenLock.Lock()
+	defer fw.seenLock.Unlock()
+
+	// nothing was seen if we never started
+	if fw.seenFiles == nil {
+		return nil, nil
+	}
+
+	encodedSeenFiles, err := json.Marshal(fw.seenFiles)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode checkpoint")
+	}
+
+	checkpoint := string(encodedSeenFiles)
+
+	return &checkpoint, nil
+}
@@ -0,0 +1,280 @@
+package filewatcher
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type processedEvent struct {
+	path      string
+	change    string
+	size      int
+	timestamp time.Time
+}
+
+// keeps the last checkpoint saved
+type testCheckpointSink struct {
+	lock       sync.Mutex
+	checkpoint eventsource.Checkpoint
+}
+
+func (tcs *testCheckpointSink) Set(eventSourceID string, checkpoint eventsource.Checkpoint) error {
+	tcs.lock.Lock()
+	defer tcs.lock.Unlock()
+
+	tcs.checkpoint = checkpoint
+
+	return nil
+}
+
+func (tcs *testCheckpointSink) getCheckpoint() eventsource.Checkpoint {
+	tcs.lock.Lock()
+	defer tcs.lock.Unlock()
+
+	return tcs.checkpoint
+}
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	tempDir    string
+	stagingDir string
+	runtime    *eventsourcetest.RecordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	var err error
+
+	suite.tempDir, err = ioutil.TempDir("", "file-watcher-test")
+	suite.Require().NoError(err)
+
+	suite.stagingDir, err = ioutil.TempDir("", "file-watcher-test-staging")
+	suite.Require().NoError(err)
+
+	// records the events it processes. fails an event of a file named flaky.csv the first time it's processed
+	suite.runtime = eventsourcetest.NewRecordingRuntime(func(event nuclio.Event) interface{} {
+		return processedEvent{
+			path:      event.GetPath(),
+			change:    event.GetHeaderString("change"),
+			size:      event.GetSize(),
+			timestamp: event.GetTimestamp(),
+		}
+	}, func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+		if filepath.Base(event.GetPath()) == "flaky.csv" && len(previousRecords) == 0 {
+			return nil, errors.New("Processing error")
+		}
+
+		return nil, nil
+	})
+}
+
+func (suite *EventSourceTestSuite) TearDownTest() {
+	suite.StopEventSources()
+
+	os.RemoveAll(suite.tempDir)
+	os.RemoveAll(suite.stagingDir)
+}
+
+func (suite *EventSourceTestSuite) TestChanges() {
+	suite.startEventSource(suite.createConfiguration(), nil)
+
+	csvPath := suite.writeFile("data.csv", "1,2", time.Now())
+	suite.writeFile("notes.txt", "ignored", time.Now())
+
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.Equal(processedEvent{csvPath, changeCreate, 3, suite.getModTime(csvPath)},
+		suite.getProcessedEvents()[0])
+
+	// modified a minute later
+	suite.writeFile("data.csv", "1,2,3", time.Now().Add(time.Minute))
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.Equal(processedEvent{csvPath, changeModify, 5, suite.getModTime(csvPath)},
+		suite.getProcessedEvents()[1])
+
+	// deleted files have the size and modification time they were last seen with
+	suite.Require().NoError(os.Remove(csvPath))
+
+	suite.WaitForNumRecords(suite.runtime, 3)
+	suite.Equal(processedEvent{csvPath, changeDelete, 5, suite.getProcessedEvents()[1].timestamp},
+		suite.getProcessedEvents()[2])
+
+	suite.ExpectNumRecords(suite.runtime, 3)
+}
+
+func (suite *EventSourceTestSuite) TestRecursiveAndPatterns() {
+	configuration := suite.createConfiguration()
+	configuration.Recursive = true
+	configuration.Patterns = []string{"orders-*"}
+	configuration.Suffixes = nil
+	suite.startEventSource(configuration, nil)
+
+	orderPath := suite.writeFile(filepath.Join("2017", "10", "orders-1"), "order", time.Now())
+	suite.writeFile(filepath.Join("2017", "10", "payments-1"), "payment", time.Now())
+	suite.writeFile("orders-2.tmp", "order", time.Now())
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.ExpectNumRecords(suite.runtime, 2)
+
+	suite.Equal(orderPath, suite.getProcessedEvents()[0].path)
+	suite.Equal(filepath.Join(suite.tempDir, "orders-2.tmp"), suite.getProcessedEvents()[1].path)
+}
+
+func (suite *EventSourceTestSuite) TestRestart() {
+	eventSource := suite.startEventSource(suite.createConfiguration(), nil)
+
+	firstPath := suite.writeFile("first.csv", "1", time.Now())
+	suite.WaitForNumRecords(suite.runtime, 1)
+
+	// the files seen are the checkpoint
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(checkpoint)
+	suite.Contains(*checkpoint, firstPath)
+
+	suite.EventSources = nil
+
+	// changed while we're stopped
+	secondPath := suite.writeFile("second.csv", "2", time.Now())
+
+	suite.startEventSource(suite.createConfiguration(), checkpoint)
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.ExpectNumRecords(suite.runtime, 2)
+
+	suite.Equal(processedEvent{secondPath, changeCreate, 1, suite.getModTime(secondPath)},
+		suite.getProcessedEvents()[1])
+}
+
+func (suite *EventSourceTestSuite) TestSeenFilesSavedWhileRunning() {
+	checkpointSink := &testCheckpointSink{}
+
+	eventSource, err := newEventSource(suite.Logger,
+		suite.CreateWorkerAllocator(suite.runtime, 1),
+		suite.createConfiguration())
+
+	suite.Require().NoError(err)
+
+	eventSource.SetCheckpointSink(checkpointSink)
+	suite.StartEventSource(eventSource, nil)
+
+	firstPath := suite.writeFile("first.csv", "1", time.Now())
+	suite.WaitForNumRecords(suite.runtime, 1)
+
+	// saved once handled, without stopping
+	suite.WaitFor(func() bool { return checkpointSink.getCheckpoint() != nil })
+	suite.Contains(*checkpointSink.getCheckpoint(), firstPath)
+
+	// as if the processor crashed and restarted from the saved checkpoint
+	suite.startEventSource(suite.createConfiguration(), checkpointSink.getCheckpoint())
+	suite.ExpectNumRecords(suite.runtime, 1)
+}
+
+func (suite *EventSourceTestSuite) TestIgnoreExisting() {
+	suite.writeFile("existing.csv", "1", time.Now())
+
+	configuration := suite.createConfiguration()
+	configuration.IgnoreExisting = true
+	suite.startEventSource(configuration, nil)
+
+	newPath := suite.writeFile("new.csv", "2", time.Now())
+
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.ExpectNumRecords(suite.runtime, 1)
+
+	suite.Equal(newPath, suite.getProcessedEvents()[0].path)
+}
+
+func (suite *EventSourceTestSuite) TestFailedEventProducedAgain() {
+	suite.startEventSource(suite.createConfiguration(), nil)
+
+	flakyPath := suite.writeFile("flaky.csv", "1", time.Now())
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.ExpectNumRecords(suite.runtime, 2)
+
+	for _, processedEvent := range suite.getProcessedEvents() {
+		suite.Equal(flakyPath, processedEvent.path)
+		suite.Equal(changeCreate, processedEvent.change)
+	}
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 1),
+		suite.createConfiguration())
+
+	suite.Require().NoError(err)
+
+	// nothing was seen, so there's no checkpoint
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.Nil(checkpoint)
+}
+
+func (suite *EventSourceTestSuite) createConfiguration() *Configuration {
+	return &Configuration{
+		Configuration: poller.Configuration{
+			Configuration:  suite.CreateConfiguration("watcher1", 1),
+			IntervalMs:     20,
+			MaxBatchSize:   4,
+			MaxBatchWaitMs: 10,
+		},
+		Paths:    []string{suite.tempDir},
+		Suffixes: []string{".csv", ".tmp"},
+	}
+}
+
+func (suite *EventSourceTestSuite) startEventSource(configuration *Configuration,
+	checkpoint eventsource.Checkpoint) eventsource.EventSource {
+
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 1), configuration)
+	suite.Require().NoError(err)
+
+	return suite.StartEventSource(eventSource, checkpoint)
+}
+
+func (suite *EventSourceTestSuite) getProcessedEvents() []processedEvent {
+	var processedEvents []processedEvent
+
+	for _, record := range suite.runtime.GetRecords() {
+		processedEvents = append(processedEvents, record.(processedEvent))
+	}
+
+	return processedEvents
+}
+
+// writes a file under the temporary directory with the given modification time, returning its path. the
+// file is written elsewhere and moved into place, so that a poll doesn't see it half written
+func (suite *EventSourceTestSuite) writeFile(relativePath string, contents string, modTime time.Time) string {
+	path := filepath.Join(suite.tempDir, relativePath)
+	stagingPath := filepath.Join(suite.stagingDir, "file")
+
+	suite.Require().NoError(ioutil.WriteFile(stagingPath, []byte(contents), 0644))
+	suite.Require().NoError(os.Chtimes(stagingPath, modTime, modTime))
+	suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	suite.Require().NoError(os.Rename(stagingPath, path))
+
+	return path
+}
+
+func (suite *EventSourceTestSuite) getModTime(path string) time.Time {
+	fileInfo, err := os.Stat(path)
+	suite.Require().NoError(err)
+
+	return fileInfo.ModTime()
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
@@ -0,0 +1,93 @@
+package filewatcher
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// defaults
+	eventSourceConfiguration.SetDefault("interval_ms", 1000)
+	eventSourceConfiguration.SetDefault("max_batch_size", 16)
+	eventSourceConfiguration.SetDefault("max_batch_wait_ms", 100)
+
+	// validate and read the poller configuration
+	pollerConfiguration, err := poller.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"paths":           eventsource.ValueTypeStringSlice,
+		"recursive":       eventsource.ValueTypeBool,
+		"patterns":        eventsource.ValueTypeStringSlice,
+		"suffixes":        eventsource.ValueTypeStringSlice,
+		"ignore_existing": eventsource.ValueTypeBool,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	configuration := Configuration{
+		Configuration:  *pollerConfiguration,
+		Recursive:      eventSourceConfiguration.GetBool("recursive"),
+		Patterns:       eventSourceConfiguration.GetStringSlice("patterns"),
+		Suffixes:       eventSourceConfiguration.GetStringSlice("suffixes"),
+		IgnoreExisting: eventSourceConfiguration.GetBool("ignore_existing"),
+	}
+
+	// paths are cleaned so that the paths of events are consistent across restarts
+	for _, path := range eventSourceConfiguration.GetStringSlice("paths") {
+		configuration.Paths = append(configuration.Paths, filepath.Clean(path))
+	}
+
+	if len(configuration.Paths) == 0 {
+		return nil, fmt.Errorf("File watcher %s requires paths", configuration.ID)
+	}
+
+	for _, pattern := range configuration.Patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "Invalid pattern %s", pattern)
+		}
+	}
+
+	if configuration.IntervalMs <= 0 {
+		return nil, errors.New("Interval must be positive")
+	}
+
+	// create logger parent
+	fileWatcherLogger := parentLogger.GetChild("file_watcher").(nuclio.Logger)
+
+	// create worker allocator
+	workerAllocator, err := eventsource.NewWorkerAllocator(fileWatcherLogger,
+		&pollerConfiguration.Configuration,
+		runtimeConfiguration,
+		workerPools)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	fileWatcherEventSource, err := newEventSource(fileWatcherLogger, workerAllocator, &configuration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create file watcher event source")
+	}
+
+	return fileWatcherEventSource, nil
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("file-watcher", &factory{})
+}
@@ -0,0 +1,20 @@
+package filewatcher
+
+import "github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+
+type Configuration struct {
+	poller.Configuration
+
+	// the directories watched, and whether their subdirectories are too
+	Paths     []string
+	Recursive bool
+
+	// only files whose name matches one of the patterns (e.g. *.csv), if any, and ends with one of the
+	// suffixes, if any, are watched
+	Patterns []string
+	Suffixes []string
+
+	// whether files that exist when first started (without a checkpoint) are seen as already handled,
+	// rather than as created
+	IgnoreExisting bool
+}
@@ -0,0 +1,233 @@
+package sqlpoller
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// a database/sql driver over an in-memory jobs table, which understands the statements of the tests: the
+// base queries, the base queries wrapped by the poller and the status updates
+const testDriverName = "sqlpoller-test"
+
+const (
+	testQueryAll     = "SELECT id, body, status, updated FROM jobs"
+	testQueryPending = "SELECT id, body, status, updated FROM jobs WHERE status = 'pending'"
+)
+
+var (
+	wrappedQueryRegexp = regexp.MustCompile(
+		`^SELECT \* FROM \((.*)\) AS nuclio_rows(?: WHERE updated > (?:\?|\$1))? ORDER BY updated$`)
+
+	updateRegexp = regexp.MustCompile(`^UPDATE jobs SET status = (?:\?|\$1) WHERE id = (?:\?|\$2)$`)
+)
+
+type testJob struct {
+	id      int64
+	body    string
+	status  string
+	updated int64
+}
+
+// the databases of the tests, by data source name
+var testDatabases = struct {
+	sync.Mutex
+	databases map[string]*testDatabase
+}{
+	databases: map[string]*testDatabase{},
+}
+
+type testDatabase struct {
+	lock       sync.Mutex
+	jobs       []*testJob
+	statements []string
+}
+
+func newTestDatabase(dataSourceName string) *testDatabase {
+	database := &testDatabase{}
+
+	testDatabases.Lock()
+	testDatabases.databases[dataSourceName] = database
+	testDatabases.Unlock()
+
+	return database
+}
+
+func (td *testDatabase) addJob(id int64, body string, updated int64) {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+
+	td.jobs = append(td.jobs, &testJob{id, body, "pending", updated})
+}
+
+func (td *testDatabase) getStatuses() map[int64]string {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+
+	statuses := map[int64]string{}
+
+	for _, job := range td.jobs {
+		statuses[job.id] = job.status
+	}
+
+	return statuses
+}
+
+func (td *testDatabase) getStatements() []string {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+
+	return append([]string{}, td.statements...)
+}
+
+func (td *testDatabase) query(query string, args []driver.Value) (driver.Rows, error) {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+
+	td.statements = append(td.statements, query)
+
+	baseQuery := query
+	wrapped := false
+
+	if match := wrappedQueryRegexp.FindStringSubmatch(query); match != nil {
+		baseQuery = match[1]
+		wrapped = true
+	}
+
+	if baseQuery != testQueryAll && baseQuery != testQueryPending {
+		return nil, fmt.Errorf("Unexpected query: %s", query)
+	}
+
+	var jobs []*testJob
+
+	for _, job := range td.jobs {
+		if baseQuery == testQueryPending && job.status != "pending" {
+			continue
+		}
+
+		if len(args) == 1 && job.updated <= args[0].(int64) {
+			continue
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	if wrapped {
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return jobs[i].updated < jobs[j].updated
+		})
+	}
+
+	rows := &testRows{}
+
+	for _, job := range jobs {
+		rows.values = append(rows.values, []driver.Value{job.id, []byte(job.body), []byte(job.status), job.updated})
+	}
+
+	return rows, nil
+}
+
+func (td *testDatabase) exec(statement string, args []driver.Value) (driver.Result, error) {
+	td.lock.Lock()
+	defer td.lock.Unlock()
+
+	td.statements = append(td.statements, statement)
+
+	if !updateRegexp.MatchString(statement) {
+		return nil, fmt.Errorf("Unexpected statement: %s", statement)
+	}
+
+	for _, job := range td.jobs {
+		if job.id == args[1].(int64) {
+			job.status = args[0].(string)
+
+			return driver.RowsAffected(1), nil
+		}
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+type testDriver struct{}
+
+func (td *testDriver) Open(dataSourceName string) (driver.Conn, error) {
+	testDatabases.Lock()
+	defer testDatabases.Unlock()
+
+	database, found := testDatabases.databases[dataSourceName]
+	if !found {
+		return nil, fmt.Errorf("Unknown database: %s", dataSourceName)
+	}
+
+	return &testConn{database}, nil
+}
+
+type testConn struct {
+	database *testDatabase
+}
+
+func (tc *testConn) Prepare(query string) (driver.Stmt, error) {
+	return &testStmt{tc.database, query}, nil
+}
+
+func (tc *testConn) Close() error {
+	return nil
+}
+
+func (tc *testConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("Transactions aren't supported")
+}
+
+type testStmt struct {
+	database *testDatabase
+	query    string
+}
+
+func (ts *testStmt) Close() error {
+	return nil
+}
+
+// any number of arguments
+func (ts *testStmt) NumInput() int {
+	return -1
+}
+
+func (ts *testStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return ts.database.exec(ts.query, args)
+}
+
+func (ts *testStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return ts.database.query(ts.query, args)
+}
+
+type testRows struct {
+	values [][]driver.Value
+}
+
+func (tr *testRows) Columns() []string {
+	return []string{"id", "body", "status", "updated"}
+}
+
+func (tr *testRows) Close() error {
+	return nil
+}
+
+func (tr *testRows) Next(dest []driver.Value) error {
+	if len(tr.values) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, tr.values[0])
+	tr.values = tr.values[1:]
+
+	return nil
+}
+
+func init() {
+	sql.Register(testDriverName, &testDriver{})
+}
@@ -0,0 +1,56 @@
+package sqlpoller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// allows accessing a row. the columns are available as headers, with the type the driver returned them as
+// (text and binary columns as strings)
+type Event struct {
+	nuclio.AbstractEvent
+	columns    map[string]interface{}
+	bodyColumn string
+
+	// the high water mark of the handled rows that follow this one in its poll and were skipped
+	skippedHighWaterMark interface{}
+}
+
+func (e *Event) GetBody() []byte {
+	if e.bodyColumn == "" {
+		return nil
+	}
+
+	return e.GetHeaderByteSlice(e.bodyColumn)
+}
+
+func (e *Event) GetSize() int {
+	return len(e.GetBody())
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	return e.columns[key]
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return e.columns
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	return []byte(e.GetHeaderString(key))
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	switch value := e.columns[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
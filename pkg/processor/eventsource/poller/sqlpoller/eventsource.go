@@ -0,0 +1,388 @@
+package sqlpoller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type sqlPoller struct {
+	poller.AbstractPoller
+	configuration *Configuration
+	db            *sql.DB
+
+	// the high water mark column value of the last row handled (nil - none yet). once a row of a poll fails,
+	// the mark stays below it for the rest of the poll, so that the next poll gets it again. the rows handled
+	// after it are remembered (by key) so that they're skipped rather than processed again, though not
+	// across restarts, since checkpoints hold only the mark
+	highWaterMarkLock    sync.Mutex
+	highWaterMark        interface{}
+	highWaterMarkBlocked bool
+	handledRowKeys       map[string]bool
+}
+
+// checkpoints hold the high water mark and its type, so that it's passed to the driver as it was read
+type encodedHighWaterMark struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func newEventSource(logger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	newEventSource := sqlPoller{
+		AbstractPoller: *poller.NewAbstractPoller(logger, workerAllocator, &configuration.Configuration),
+		configuration:  configuration,
+		handledRowKeys: map[string]bool{},
+	}
+
+	newEventSource.Kind = "sql-poller"
+
+	// register self as the poller (to allow parent to call child functions)
+	newEventSource.SetPoller(&newEventSource)
+
+	return &newEventSource, nil
+}
+
+func (sp *sqlPoller) Start(checkpoint eventsource.Checkpoint) error {
+	sp.Logger.InfoWith("Starting",
+		"driver", sp.configuration.Driver,
+		"query", sp.configuration.Query,
+		"highWaterMarkColumn", sp.configuration.HighWaterMarkColumn,
+		"statusColumn", sp.configuration.StatusColumn)
+
+	highWaterMark, err := decodeCheckpoint(checkpoint)
+	if err != nil {
+		return errors.Wrap(err, "Failed to decode checkpoint")
+	}
+
+	sp.highWaterMark = highWaterMark
+
+	// the driver must be linked into the processor
+	sp.db, err = sql.Open(sp.configuration.Driver, sp.configuration.DataSourceName)
+	if err != nil {
+		return errors.Wrap(err, "Failed to open database")
+	}
+
+	// opening doesn't connect, so make sure misconfiguration is reported on start
+	if err := sp.db.Ping(); err != nil {
+		sp.db.Close()
+
+		// so that stopping doesn't close it again
+		sp.db = nil
+
+		return errors.Wrap(err, "Failed to connect to database")
+	}
+
+	return sp.AbstractPoller.Start(checkpoint)
+}
+
+func (sp *sqlPoller) Stop(force bool) (eventsource.Checkpoint, error) {
+	if _, err := sp.AbstractPoller.Stop(force); err != nil {
+		return nil, err
+	}
+
+	// nothing to close if we never started
+	if sp.db != nil {
+		if err := sp.db.Close(); err != nil {
+			sp.Logger.WarnWith("Failed to close database", "err", err)
+		}
+	}
+
+	// resume from the high water mark when restarted
+	return sp.encodeCheckpoint()
+}
+
+// reads the rows the query returns and produces an event for each
+func (sp *sqlPoller) GetNewEvents(eventsChan chan nuclio.Event) error {
+
+	// we're done. add a "nil" into the channel to indicate where the cycle completes
+	defer func() {
+		eventsChan <- nil
+	}()
+
+	events, err := sp.getRows()
+	if err != nil {
+		sp.Logger.WarnWith("Failed to get rows", "err", err)
+
+		return errors.Wrap(err, "Failed to get rows")
+	}
+
+	if sp.configuration.HighWaterMarkColumn != "" {
+		events = sp.skipHandledRows(events)
+	}
+
+	for _, event := range events {
+		eventsChan <- event
+	}
+
+	return nil
+}
+
+// advances the high water mark past the rows handled - processed successfully or dead lettered - and sets
+// their status. rows that failed and will be polled again keep their status
+func (sp *sqlPoller) PostProcessEvents(events []nuclio.Event, responses []interface{}, processErrors []error) {
+	for eventIndex, event := range events {
+		rowEvent := event.(*Event)
+		handled := processErrors[eventIndex] == nil || sp.HasDeadLetterSink()
+
+		if sp.configuration.HighWaterMarkColumn != "" {
+			sp.advanceHighWaterMark(rowEvent, handled)
+		}
+
+		if sp.configuration.StatusColumn != "" && handled {
+			status := sp.configuration.SuccessStatus
+			if processErrors[eventIndex] != nil {
+				status = sp.configuration.FailureStatus
+			}
+
+			if err := sp.updateStatus(rowEvent, status); err != nil {
+				sp.Logger.WarnWith("Failed to update row status",
+					"err", err,
+					"key", rowEvent.GetHeader(sp.configuration.KeyColumn),
+					"status", status)
+			}
+		}
+	}
+}
+
+// rows are read in full before they're handed over, so that updating their status doesn't contend with
+// the read (e.g. on SQLite)
+func (sp *sqlPoller) getRows() ([]*Event, error) {
+	sp.highWaterMarkLock.Lock()
+	sp.highWaterMarkBlocked = false
+	query, args := sp.getQueryToRequest()
+	sp.highWaterMarkLock.Unlock()
+
+	sp.Logger.DebugWith("Querying rows", "query", query, "args", args)
+
+	rows, err := sp.db.Query(query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to query")
+	}
+
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to get columns")
+	}
+
+	var events []*Event
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePointers := make([]interface{}, len(columns))
+
+		for valueIndex := range values {
+			valuePointers[valueIndex] = &values[valueIndex]
+		}
+
+		if err := rows.Scan(valuePointers...); err != nil {
+			return nil, errors.Wrap(err, "Failed to scan row")
+		}
+
+		event := &Event{
+			columns:    map[string]interface{}{},
+			bodyColumn: sp.configuration.BodyColumn,
+		}
+
+		for columnIndex, column := range columns {
+			value := values[columnIndex]
+
+			// drivers return text as bytes
+			if bytesValue, isBytes := value.([]byte); isBytes {
+				value = string(bytesValue)
+			}
+
+			event.columns[column] = value
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "Failed to read rows")
+	}
+
+	return events, nil
+}
+
+// wraps the query so that it returns only the rows above the high water mark, in order. like the v3io item
+// poller, the first poll doesn't filter by the mark since there is none yet
+func (sp *sqlPoller) getQueryToRequest() (string, []interface{}) {
+	column := sp.configuration.HighWaterMarkColumn
+
+	if column == "" {
+		return sp.configuration.Query, nil
+	}
+
+	if sp.highWaterMark == nil {
+		return fmt.Sprintf("SELECT * FROM (%s) AS nuclio_rows ORDER BY %s",
+			sp.configuration.Query,
+			column), nil
+	}
+
+	return fmt.Sprintf("SELECT * FROM (%s) AS nuclio_rows WHERE %s > %s ORDER BY %s",
+		sp.configuration.Query,
+		column,
+		sp.getPlaceholder(1),
+		column), []interface{}{sp.highWaterMark}
+}
+
+func (sp *sqlPoller) updateStatus(rowEvent *Event, status string) error {
+	statement := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s",
+		sp.configuration.Table,
+		sp.configuration.StatusColumn,
+		sp.getPlaceholder(1),
+		sp.configuration.KeyColumn,
+		sp.getPlaceholder(2))
+
+	_, err := sp.db.Exec(statement, status, rowEvent.GetHeader(sp.configuration.KeyColumn))
+
+	return err
+}
+
+// rows are produced in high water mark order, so a handled row's value (or that of the handled rows skipped
+// after it) is the highest handled so far
+func (sp *sqlPoller) advanceHighWaterMark(rowEvent *Event, handled bool) {
+	sp.highWaterMarkLock.Lock()
+	defer sp.highWaterMarkLock.Unlock()
+
+	if sp.highWaterMarkBlocked {
+		if handled {
+			sp.handledRowKeys[sp.getRowKey(rowEvent)] = true
+		}
+
+		return
+	}
+
+	if !handled {
+		sp.highWaterMarkBlocked = true
+		return
+	}
+
+	sp.highWaterMark = rowEvent.GetHeader(sp.configuration.HighWaterMarkColumn)
+
+	if rowEvent.skippedHighWaterMark != nil {
+		sp.highWaterMark = rowEvent.skippedHighWaterMark
+	}
+}
+
+// removes the rows handled in earlier polls, which are above the mark since a row before them failed. the mark
+// advances past them along with the row before them, or right away if they lead the poll
+func (sp *sqlPoller) skipHandledRows(events []*Event) []*Event {
+	sp.highWaterMarkLock.Lock()
+	defer sp.highWaterMarkLock.Unlock()
+
+	var eventsToProcess []*Event
+
+	// rows that weren't polled again are below the mark now, or gone
+	handledRowKeys := map[string]bool{}
+
+	for _, event := range events {
+		rowKey := sp.getRowKey(event)
+
+		if !sp.handledRowKeys[rowKey] {
+			eventsToProcess = append(eventsToProcess, event)
+			continue
+		}
+
+		if len(eventsToProcess) == 0 {
+			sp.highWaterMark = event.GetHeader(sp.configuration.HighWaterMarkColumn)
+			continue
+		}
+
+		eventsToProcess[len(eventsToProcess)-1].skippedHighWaterMark =
+			event.GetHeader(sp.configuration.HighWaterMarkColumn)
+
+		handledRowKeys[rowKey] = true
+	}
+
+	sp.handledRowKeys = handledRowKeys
+
+	return eventsToProcess
+}
+
+// identifies a row by its key column if there is one, or by all of its columns
+func (sp *sqlPoller) getRowKey(rowEvent *Event) string {
+	if sp.configuration.KeyColumn != "" {
+		return rowEvent.GetHeaderString(sp.configuration.KeyColumn)
+	}
+
+	return fmt.Sprint(rowEvent.columns)
+}
+
+func (sp *sqlPoller) getPlaceholder(index int) string {
+	if sp.configuration.PlaceholderStyle == placeholderStyleDollar {
+		return "$" + strconv.Itoa(index)
+	}
+
+	return "?"
+}
+
+func (sp *sqlPoller) encodeCheckpoint() (eventsource.Checkpoint, error) {
+	sp.highWaterMarkLock.Lock()
+	defer sp.highWaterMarkLock.Unlock()
+
+	if sp.highWaterMark == nil {
+		return nil, nil
+	}
+
+	var encodedMark encodedHighWaterMark
+
+	switch value := sp.highWaterMark.(type) {
+	case int64:
+		encodedMark = encodedHighWaterMark{"int", strconv.FormatInt(value, 10)}
+	case float64:
+		encodedMark = encodedHighWaterMark{"float", strconv.FormatFloat(value, 'g', -1, 64)}
+	case time.Time:
+		encodedMark = encodedHighWaterMark{"time", value.Format(time.RFC3339Nano)}
+	default:
+		encodedMark = encodedHighWaterMark{"string", fmt.Sprint(value)}
+	}
+
+	encodedCheckpoint, err := json.Marshal(encodedMark)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode checkpoint")
+	}
+
+	checkpoint := string(encodedCheckpoint)
+
+	return &checkpoint, nil
+}
+
+func decodeCheckpoint(checkpoint eventsource.Checkpoint) (interface{}, error) {
+	if checkpoint == nil || *checkpoint == "" {
+		return nil, nil
+	}
+
+	var encodedMark encodedHighWaterMark
+	if err := json.Unmarshal([]byte(*checkpoint), &encodedMark); err != nil {
+		return nil, err
+	}
+
+	switch encodedMark.Type {
+	case "int":
+		return strconv.ParseInt(encodedMark.Value, 10, 64)
+	case "float":
+		return strconv.ParseFloat(encodedMark.Value, 64)
+	case "time":
+		return time.Parse(time.RFC3339Nano, encodedMark.Value)
+	case "string":
+		return encodedMark.Value, nil
+	}
+
+	return nil, errors.Errorf("Unknown high water mark type %s", encodedMark.Type)
+}
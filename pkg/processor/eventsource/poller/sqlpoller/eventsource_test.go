@@ -0,0 +1,301 @@
+package sqlpoller
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type processedRow struct {
+	body    string
+	headers map[string]interface{}
+}
+
+// accepts dead letters
+type testDeadLetterSink struct{}
+
+func (tdls *testDeadLetterSink) Write(deadLetter *eventsource.DeadLetter) error {
+	return nil
+}
+
+func (tdls *testDeadLetterSink) Close() error {
+	return nil
+}
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	database *testDatabase
+	runtime  *eventsourcetest.RecordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	suite.database = newTestDatabase(suite.T().Name())
+
+	// records the rows it processes. fails rows whose body is "fail", and rows whose body is "fail-once" the
+	// first time they're processed
+	suite.runtime = eventsourcetest.NewRecordingRuntime(func(event nuclio.Event) interface{} {
+		return processedRow{
+			body:    string(event.GetBody()),
+			headers: event.GetHeaders(),
+		}
+	}, func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+		switch string(event.GetBody()) {
+		case "fail":
+			return nil, errors.New("Processing error")
+		case "fail-once":
+			for _, record := range previousRecords {
+				if record.(processedRow).headers["id"] == event.GetHeader("id") {
+					return nil, nil
+				}
+			}
+
+			return nil, errors.New("Processing error")
+		}
+
+		return nil, nil
+	})
+}
+
+func (suite *EventSourceTestSuite) TestRowsAsEvents() {
+	configuration := suite.createConfiguration(testQueryPending)
+	configuration.PlaceholderStyle = placeholderStyleDollar
+	configuration.Table = "jobs"
+	configuration.KeyColumn = "id"
+	configuration.StatusColumn = "status"
+	configuration.SuccessStatus = "done"
+	configuration.FailureStatus = "failed"
+	suite.startEventSource(configuration, nil)
+
+	suite.database.addJob(1, "first", 10)
+	suite.database.addJob(2, "fail-once", 20)
+
+	suite.WaitFor(func() bool {
+		statuses := suite.database.getStatuses()
+
+		return statuses[1] == "done" && statuses[2] == "done"
+	})
+
+	// the failed row stayed pending, so it was polled again. rows that aren't pending anymore aren't
+	suite.ExpectNumRecords(suite.runtime, 3)
+	suite.Equal(2, suite.getNumStatusUpdates())
+
+	processedRow := suite.getProcessedRows()[0]
+	suite.Equal("first", processedRow.body)
+	suite.Equal(map[string]interface{}{
+		"id":      int64(1),
+		"body":    "first",
+		"status":  "pending",
+		"updated": int64(10),
+	}, processedRow.headers)
+
+	suite.Contains(suite.database.getStatements(), "UPDATE jobs SET status = $1 WHERE id = $2")
+}
+
+func (suite *EventSourceTestSuite) TestDeadLetteredRowStatus() {
+	configuration := suite.createConfiguration(testQueryPending)
+	configuration.Table = "jobs"
+	configuration.KeyColumn = "id"
+	configuration.StatusColumn = "status"
+	configuration.SuccessStatus = "done"
+	configuration.FailureStatus = "failed"
+
+	eventSource := suite.createEventSource(configuration)
+	eventSource.SetDeadLetterSink(&testDeadLetterSink{})
+	suite.StartEventSource(eventSource, nil)
+
+	suite.database.addJob(1, "fail", 10)
+
+	// dead lettered rows won't be processed again, so they're marked as failed
+	suite.WaitFor(func() bool { return suite.database.getStatuses()[1] == "failed" })
+	suite.ExpectNumRecords(suite.runtime, 1)
+}
+
+func (suite *EventSourceTestSuite) TestHighWaterMark() {
+	configuration := suite.createConfiguration(testQueryAll)
+	configuration.HighWaterMarkColumn = "updated"
+	suite.startEventSource(configuration, nil)
+
+	suite.database.addJob(2, "second", 20)
+	suite.database.addJob(1, "first", 10)
+
+	// ordered by the high water mark column
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.Equal("first", suite.getProcessedRows()[0].body)
+	suite.Equal("second", suite.getProcessedRows()[1].body)
+
+	// only rows above the mark are polled
+	suite.database.addJob(3, "below", 5)
+	suite.database.addJob(4, "above", 30)
+
+	suite.WaitForNumRecords(suite.runtime, 3)
+	suite.ExpectNumRecords(suite.runtime, 3)
+	suite.Equal("above", suite.getProcessedRows()[2].body)
+
+	suite.Contains(suite.database.getStatements(),
+		"SELECT * FROM ("+testQueryAll+") AS nuclio_rows WHERE updated > ? ORDER BY updated")
+}
+
+func (suite *EventSourceTestSuite) TestFailedRowPolledAgain() {
+	configuration := suite.createConfiguration(testQueryAll)
+	configuration.HighWaterMarkColumn = "updated"
+
+	suite.database.addJob(1, "fail-once", 10)
+	suite.database.addJob(2, "second", 20)
+
+	eventSource := suite.startEventSource(configuration, nil)
+
+	// the mark doesn't advance past the failed row, so the next poll gets both rows again. the row handled
+	// after it is skipped, and the mark advances past both once the failed row is handled
+	suite.WaitForNumRecords(suite.runtime, 3)
+	suite.ExpectNumRecords(suite.runtime, 3)
+
+	suite.database.addJob(3, "third", 30)
+	suite.WaitForNumRecords(suite.runtime, 4)
+	suite.ExpectNumRecords(suite.runtime, 4)
+
+	var bodies []string
+	for _, processedRow := range suite.getProcessedRows() {
+		bodies = append(bodies, processedRow.body)
+	}
+
+	suite.Equal([]string{"fail-once", "second", "fail-once", "third"}, bodies)
+
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.Equal(`{"type":"int","value":"30"}`, *checkpoint)
+
+	suite.EventSources = nil
+}
+
+func (suite *EventSourceTestSuite) TestRowsAfterFailedRowProcessedOnce() {
+	configuration := suite.createConfiguration(testQueryAll)
+	configuration.HighWaterMarkColumn = "updated"
+	configuration.Table = "jobs"
+	configuration.KeyColumn = "id"
+	configuration.StatusColumn = "status"
+	configuration.SuccessStatus = "done"
+	configuration.FailureStatus = "failed"
+
+	suite.database.addJob(1, "first", 10)
+	suite.database.addJob(2, "fail", 20)
+	suite.database.addJob(3, "third", 30)
+	suite.database.addJob(4, "fourth", 40)
+
+	suite.startEventSource(configuration, nil)
+
+	// the row that keeps failing is polled again and again, but the rows after it aren't processed again
+	suite.WaitForNumRecords(suite.runtime, 7)
+
+	numProcessed := map[string]int{}
+	for _, processedRow := range suite.getProcessedRows() {
+		numProcessed[processedRow.body]++
+	}
+
+	suite.Equal(1, numProcessed["first"])
+	suite.Equal(1, numProcessed["third"])
+	suite.Equal(1, numProcessed["fourth"])
+
+	// and it's left pending, to be retried
+	suite.Equal("pending", suite.database.getStatuses()[2])
+}
+
+func (suite *EventSourceTestSuite) TestCheckpoint() {
+	configuration := suite.createConfiguration(testQueryAll)
+	configuration.HighWaterMarkColumn = "updated"
+	eventSource := suite.startEventSource(configuration, nil)
+
+	suite.database.addJob(1, "first", 10)
+	suite.WaitForNumRecords(suite.runtime, 1)
+
+	checkpoint, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(checkpoint)
+	suite.Equal(`{"type":"int","value":"10"}`, *checkpoint)
+
+	suite.EventSources = nil
+
+	// resumes from the mark
+	suite.database.addJob(2, "second", 20)
+	suite.startEventSource(configuration, checkpoint)
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.ExpectNumRecords(suite.runtime, 2)
+	suite.Equal("second", suite.getProcessedRows()[1].body)
+}
+
+func (suite *EventSourceTestSuite) TestUnreachableDatabase() {
+	configuration := suite.createConfiguration(testQueryAll)
+	configuration.DataSourceName = "unknown"
+
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 1), configuration)
+	suite.Require().NoError(err)
+
+	suite.Error(eventSource.Start(nil))
+
+	// the database closed when the start failed isn't closed again
+	suite.Nil(eventSource.(*sqlPoller).db)
+
+	_, err = eventSource.Stop(false)
+	suite.NoError(err)
+}
+
+func (suite *EventSourceTestSuite) createConfiguration(query string) *Configuration {
+	return &Configuration{
+		Configuration: poller.Configuration{
+			Configuration:  suite.CreateConfiguration("sql1", 1),
+			IntervalMs:     20,
+			MaxBatchSize:   4,
+			MaxBatchWaitMs: 10,
+		},
+		Driver:           testDriverName,
+		DataSourceName:   suite.T().Name(),
+		Query:            query,
+		PlaceholderStyle: placeholderStyleQuestion,
+		BodyColumn:       "body",
+	}
+}
+
+func (suite *EventSourceTestSuite) startEventSource(configuration *Configuration,
+	checkpoint eventsource.Checkpoint) eventsource.EventSource {
+
+	return suite.StartEventSource(suite.createEventSource(configuration), checkpoint)
+}
+
+func (suite *EventSourceTestSuite) createEventSource(configuration *Configuration) eventsource.EventSource {
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 1), configuration)
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+func (suite *EventSourceTestSuite) getNumStatusUpdates() int {
+	numStatusUpdates := 0
+
+	for _, statement := range suite.database.getStatements() {
+		if updateRegexp.MatchString(statement) {
+			numStatusUpdates++
+		}
+	}
+
+	return numStatusUpdates
+}
+
+func (suite *EventSourceTestSuite) getProcessedRows() []processedRow {
+	var processedRows []processedRow
+
+	for _, record := range suite.runtime.GetRecords() {
+		processedRows = append(processedRows, record.(processedRow))
+	}
+
+	return processedRows
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
@@ -0,0 +1,112 @@
+package sqlpoller
+
+import (
+	"fmt"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// defaults
+	eventSourceConfiguration.SetDefault("interval_ms", 5000)
+	eventSourceConfiguration.SetDefault("max_batch_size", 16)
+	eventSourceConfiguration.SetDefault("max_batch_wait_ms", 100)
+	eventSourceConfiguration.SetDefault("placeholder_style", placeholderStyleQuestion)
+	eventSourceConfiguration.SetDefault("success_status", "done")
+	eventSourceConfiguration.SetDefault("failure_status", "failed")
+
+	// validate and read the poller configuration
+	pollerConfiguration, err := poller.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"driver":                 eventsource.ValueTypeString,
+		"data_source_name":       eventsource.ValueTypeString,
+		"query":                  eventsource.ValueTypeString,
+		"placeholder_style":      eventsource.ValueTypeString,
+		"body_column":            eventsource.ValueTypeString,
+		"high_water_mark_column": eventsource.ValueTypeString,
+		"table":                  eventsource.ValueTypeString,
+		"key_column":             eventsource.ValueTypeString,
+		"status_column":          eventsource.ValueTypeString,
+		"success_status":         eventsource.ValueTypeString,
+		"failure_status":         eventsource.ValueTypeString,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	configuration := Configuration{
+		Configuration:       *pollerConfiguration,
+		Driver:              eventSourceConfiguration.GetString("driver"),
+		DataSourceName:      eventSourceConfiguration.GetString("data_source_name"),
+		Query:               eventSourceConfiguration.GetString("query"),
+		PlaceholderStyle:    eventSourceConfiguration.GetString("placeholder_style"),
+		BodyColumn:          eventSourceConfiguration.GetString("body_column"),
+		HighWaterMarkColumn: eventSourceConfiguration.GetString("high_water_mark_column"),
+		Table:               eventSourceConfiguration.GetString("table"),
+		KeyColumn:           eventSourceConfiguration.GetString("key_column"),
+		StatusColumn:        eventSourceConfiguration.GetString("status_column"),
+		SuccessStatus:       eventSourceConfiguration.GetString("success_status"),
+		FailureStatus:       eventSourceConfiguration.GetString("failure_status"),
+	}
+
+	if configuration.Driver == "" || configuration.Query == "" {
+		return nil, fmt.Errorf("SQL poller %s requires a driver and a query", configuration.ID)
+	}
+
+	if configuration.PlaceholderStyle != placeholderStyleQuestion &&
+		configuration.PlaceholderStyle != placeholderStyleDollar {
+		return nil, fmt.Errorf("Invalid placeholder style: %s", configuration.PlaceholderStyle)
+	}
+
+	// otherwise every poll would produce all the rows again
+	if configuration.HighWaterMarkColumn == "" && configuration.StatusColumn == "" {
+		return nil, fmt.Errorf("SQL poller %s requires a high water mark column or a status column",
+			configuration.ID)
+	}
+
+	if configuration.StatusColumn != "" && (configuration.Table == "" || configuration.KeyColumn == "") {
+		return nil, errors.New("Updating the status column requires a table and a key column")
+	}
+
+	if configuration.IntervalMs <= 0 {
+		return nil, errors.New("Interval must be positive")
+	}
+
+	// create logger parent
+	sqlPollerLogger := parentLogger.GetChild("sql_poller").(nuclio.Logger)
+
+	// create worker allocator
+	workerAllocator, err := eventsource.NewWorkerAllocator(sqlPollerLogger,
+		&pollerConfiguration.Configuration,
+		runtimeConfiguration,
+		workerPools)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	sqlPollerEventSource, err := newEventSource(sqlPollerLogger, workerAllocator, &configuration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create SQL poller event source")
+	}
+
+	return sqlPollerEventSource, nil
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("sql-poller", &factory{})
+}
@@ -0,0 +1,38 @@
+package sqlpoller
+
+import "github.com/nuclio/nuclio/pkg/processor/eventsource/poller"
+
+// the styles of query placeholders drivers expect
+const (
+	placeholderStyleQuestion = "question"
+	placeholderStyleDollar   = "dollar"
+)
+
+type Configuration struct {
+	poller.Configuration
+
+	// the name a database/sql driver registered with, which must be linked into the processor (postgres
+	// is), and the data source name passed to it
+	Driver         string
+	DataSourceName string
+
+	// the query whose rows are polled, and the placeholders the driver expects: ? (question) or $1 (dollar)
+	Query            string
+	PlaceholderStyle string
+
+	// the column holding the event body, if any. all columns are available as headers
+	BodyColumn string
+
+	// if set, only rows whose value in this column is greater than that of the rows already handled are
+	// polled (e.g. an auto incrementing ID or an update time). this or the status column must be set
+	HighWaterMarkColumn string
+
+	// if set, the status column of a row in the table (identified by the key column) is set to the
+	// success status once its event was processed, or to the failure status once it was dead lettered.
+	// the query should return only the rows whose status is neither, so that failed rows are polled again
+	Table         string
+	KeyColumn     string
+	StatusColumn  string
+	SuccessStatus string
+	FailureStatus string
+}
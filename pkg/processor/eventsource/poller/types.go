@@ -4,6 +4,7 @@ import (
 	"github.com/nuclio/nuclio-sdk"
 	"github.com/nuclio/nuclio/pkg/processor/eventsource"
 
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
@@ -14,13 +15,26 @@ type Configuration struct {
 	MaxBatchWaitMs int
 }
 
-func NewConfiguration(configuration *viper.Viper) *Configuration {
+// keys common to all pollers
+var pollerSchema = eventsource.Schema{
+	"interval_ms":       eventsource.ValueTypeInt,
+	"max_batch_size":    eventsource.ValueTypeInt,
+	"max_batch_wait_ms": eventsource.ValueTypeInt,
+}
+
+// validates the configuration against the poller schema augmented by the keys of a specific poller
+func NewConfiguration(configuration *viper.Viper, kindSchema eventsource.Schema) (*Configuration, error) {
+	eventSourceConfiguration, err := eventsource.NewConfiguration(configuration, kindSchema.Merge(pollerSchema))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read event source configuration")
+	}
+
 	return &Configuration{
-		Configuration:  *eventsource.NewConfiguration(configuration),
+		Configuration:  *eventSourceConfiguration,
 		IntervalMs:     configuration.GetInt("interval_ms"),
 		MaxBatchSize:   configuration.GetInt("max_batch_size"),
 		MaxBatchWaitMs: configuration.GetInt("max_batch_wait_ms"),
-	}
+	}, nil
 }
 
 type Poller interface {
@@ -14,21 +14,35 @@ type factory struct{}
 
 func (f *factory) Create(parentLogger nuclio.Logger,
 	eventSourceConfiguration *viper.Viper,
-	runtimeConfiguration *viper.Viper) (eventsource.EventSource, error) {
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
 
-	// defaults
-	eventSourceConfiguration.SetDefault("num_workers", 1)
+	// validate and read the poller configuration
+	pollerConfiguration, err := poller.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"url":             eventsource.ValueTypeString,
+		"container_id":    eventsource.ValueTypeInt,
+		"container_alias": eventsource.ValueTypeString,
+		"paths":           eventsource.ValueTypeStringSlice,
+		"attributes":      eventsource.ValueTypeStringSlice,
+		"queries":         eventsource.ValueTypeStringSlice,
+		"suffixes":        eventsource.ValueTypeStringSlice,
+		"incremental":     eventsource.ValueTypeBool,
+		"shard_id":        eventsource.ValueTypeInt,
+		"total_shards":    eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
 
 	// create logger parent
 	v3ioItemPollerLogger := parentLogger.GetChild("v3io_item_poller").(nuclio.Logger)
 
-	// get how many workers are required
-	numWorkers := eventSourceConfiguration.GetInt("num_workers")
-
 	// create worker allocator
-	workerAllocator, err := worker.WorkerFactorySingleton.CreateFixedPoolWorkerAllocator(v3ioItemPollerLogger,
-		numWorkers,
-		runtimeConfiguration)
+	workerAllocator, err := eventsource.NewWorkerAllocator(v3ioItemPollerLogger,
+		&pollerConfiguration.Configuration,
+		runtimeConfiguration,
+		workerPools)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create worker allocator")
@@ -36,7 +50,7 @@ func (f *factory) Create(parentLogger nuclio.Logger,
 
 	// create a configuration structure
 	configuration := Configuration{
-		Configuration:  *poller.NewConfiguration(eventSourceConfiguration),
+		Configuration:  *pollerConfiguration,
 		Restart:        false,
 		URL:            eventSourceConfiguration.GetString("url"),
 		ContainerID:    eventSourceConfiguration.GetInt("container_id"),
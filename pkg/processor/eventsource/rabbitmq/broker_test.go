@@ -0,0 +1,302 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/streadway/amqp"
+)
+
+// a broker holding the single queue its clients consume, keeping a log of what the clients acked, nacked and
+// published, in order
+type testBroker struct {
+	lock sync.Mutex
+
+	// the messages waiting to be delivered
+	queue   []amqp.Delivery
+	clients []*testClient
+	nextTag uint64
+	log     []string
+
+	// the number of connection attempts, the number of the next ones to refuse and when the last succeeded
+	numConnects       int
+	numRefusals       int
+	lastConnectedTime time.Time
+}
+
+// test brokers are looked up by the URL of the event source configuration
+var (
+	testBrokersLock sync.Mutex
+	testBrokers     = map[string]*testBroker{}
+)
+
+func newTestBroker(url string) *testBroker {
+	newTestBroker := &testBroker{}
+
+	testBrokersLock.Lock()
+	testBrokers[url] = newTestBroker
+	testBrokersLock.Unlock()
+
+	return newTestBroker
+}
+
+// queues a message, delivering it to a connected consumer
+func (tb *testBroker) publish(message amqp.Delivery) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	tb.queue = append(tb.queue, message)
+	tb.deliver()
+}
+
+// closes the connections of all clients, as if the broker restarted
+func (tb *testBroker) dropConnections() {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	for _, client := range tb.clients {
+		client.close()
+	}
+}
+
+func (tb *testBroker) refuseConnects(numRefusals int) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	tb.numRefusals = numRefusals
+}
+
+func (tb *testBroker) getLog() []string {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	return append([]string{}, tb.log...)
+}
+
+func (tb *testBroker) getConnects() (int, time.Time) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	return tb.numConnects, tb.lastConnectedTime
+}
+
+func (tb *testBroker) getNumConsumers() int {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	numConsumers := 0
+
+	for _, client := range tb.clients {
+		if !client.closed && !client.cancelled {
+			numConsumers++
+		}
+	}
+
+	return numConsumers
+}
+
+func (tb *testBroker) connect() (*testClient, error) {
+	tb.lock.Lock()
+	defer tb.lock.Unlock()
+
+	tb.numConnects++
+
+	if tb.numRefusals > 0 {
+		tb.numRefusals--
+		return nil, errors.New("Connection refused")
+	}
+
+	newTestClient := &testClient{
+		broker:     tb,
+		deliveries: make(chan amqp.Delivery, 100),
+		unacked:    map[uint64]amqp.Delivery{},
+	}
+
+	tb.clients = append(tb.clients, newTestClient)
+	tb.lastConnectedTime = time.Now()
+	tb.deliver()
+
+	return newTestClient, nil
+}
+
+// delivers the queued messages to the first consuming client, if any. called under the lock
+func (tb *testBroker) deliver() {
+	for _, client := range tb.clients {
+		if client.closed || client.cancelled {
+			continue
+		}
+
+		for _, message := range tb.queue {
+			tb.nextTag++
+
+			message.DeliveryTag = tb.nextTag
+			message.Acknowledger = client
+
+			client.unacked[message.DeliveryTag] = message
+			client.deliveries <- message
+		}
+
+		tb.queue = nil
+
+		return
+	}
+}
+
+// a client of a test broker, acking and nacking the messages it delivers
+type testClient struct {
+	broker     *testBroker
+	deliveries chan amqp.Delivery
+	unacked    map[uint64]amqp.Delivery
+	cancelled  bool
+	closed     bool
+}
+
+func (tc *testClient) Deliveries() <-chan amqp.Delivery {
+	return tc.deliveries
+}
+
+func (tc *testClient) Publish(exchangeName string, routingKey string, publishing *amqp.Publishing) error {
+	tc.broker.lock.Lock()
+	defer tc.broker.lock.Unlock()
+
+	if tc.closed {
+		return amqp.ErrClosed
+	}
+
+	tc.broker.log = append(tc.broker.log, fmt.Sprintf("publish %s/%s %s %s",
+		exchangeName,
+		routingKey,
+		publishing.CorrelationId,
+		publishing.Body))
+
+	return nil
+}
+
+func (tc *testClient) Cancel() error {
+	tc.broker.lock.Lock()
+	defer tc.broker.lock.Unlock()
+
+	if tc.closed {
+		return amqp.ErrClosed
+	}
+
+	if !tc.cancelled {
+		tc.cancelled = true
+		close(tc.deliveries)
+	}
+
+	return nil
+}
+
+func (tc *testClient) Close() error {
+	tc.broker.lock.Lock()
+	defer tc.broker.lock.Unlock()
+
+	tc.close()
+
+	return nil
+}
+
+func (tc *testClient) Ack(tag uint64, multiple bool) error {
+	tc.broker.lock.Lock()
+	defer tc.broker.lock.Unlock()
+
+	message, err := tc.settle(tag)
+	if err != nil {
+		return err
+	}
+
+	tc.broker.log = append(tc.broker.log, fmt.Sprintf("ack %s", message.Body))
+
+	return nil
+}
+
+func (tc *testClient) Nack(tag uint64, multiple bool, requeue bool) error {
+	tc.broker.lock.Lock()
+	defer tc.broker.lock.Unlock()
+
+	message, err := tc.settle(tag)
+	if err != nil {
+		return err
+	}
+
+	tc.broker.log = append(tc.broker.log, fmt.Sprintf("nack %s requeue=%t", message.Body, requeue))
+
+	if requeue {
+		tc.requeue(message)
+	}
+
+	return nil
+}
+
+func (tc *testClient) Reject(tag uint64, requeue bool) error {
+	return tc.Nack(tag, false, requeue)
+}
+
+// returns the unacked message with the tag, which is no longer unacked. called under the broker's lock
+func (tc *testClient) settle(tag uint64) (*amqp.Delivery, error) {
+	if tc.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	message, found := tc.unacked[tag]
+	if !found {
+		return nil, fmt.Errorf("Unknown delivery tag %d", tag)
+	}
+
+	delete(tc.unacked, tag)
+
+	return &message, nil
+}
+
+// returns the unacked messages to the queue. called under the broker's lock
+func (tc *testClient) close() {
+	if tc.closed {
+		return
+	}
+
+	tc.closed = true
+
+	if !tc.cancelled {
+		close(tc.deliveries)
+	}
+
+	for tag := uint64(0); tag <= tc.broker.nextTag; tag++ {
+		if message, found := tc.unacked[tag]; found {
+			tc.requeue(&message)
+		}
+	}
+
+	tc.unacked = nil
+}
+
+// called under the broker's lock
+func (tc *testClient) requeue(message *amqp.Delivery) {
+	message.Redelivered = true
+
+	tc.broker.queue = append(tc.broker.queue, *message)
+	tc.broker.deliver()
+}
+
+type testClientCreator struct{}
+
+func (tcc *testClientCreator) Create(logger nuclio.Logger, configuration *Configuration) (Client, error) {
+	testBrokersLock.Lock()
+	broker := testBrokers[configuration.BrokerUrl]
+	testBrokersLock.Unlock()
+
+	client, err := broker.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func init() {
+	ClientRegistrySingleton.Register("test", &testClientCreator{})
+}
@@ -0,0 +1,53 @@
+package rabbitmq
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+
+	"github.com/streadway/amqp"
+)
+
+// a connection to a RabbitMQ broker, consuming the queue of the event source. the rabbit-mq event source is
+// written against this so that the AMQP implementation can be swapped
+type Client interface {
+
+	// the messages delivered from the queue, which are acked and nacked through their own methods. closed
+	// once the consumer is cancelled, or the connection is lost or closed
+	Deliveries() <-chan amqp.Delivery
+
+	// publishes a message to an exchange (empty - the default exchange, which routes by queue name)
+	Publish(exchangeName string, routingKey string, publishing *amqp.Publishing) error
+
+	// stops the broker from delivering more messages. those delivered already may still be acked
+	Cancel() error
+
+	// closes the connection, returning the unacked messages to the queue
+	Close() error
+}
+
+//
+// Client registry
+// Clients are keyed by the client kind in the event source configuration
+//
+
+type ClientCreator interface {
+	Create(logger nuclio.Logger, configuration *Configuration) (Client, error)
+}
+
+type ClientRegistry struct {
+	registry.Registry
+}
+
+// global singleton
+var ClientRegistrySingleton = ClientRegistry{
+	Registry: *registry.NewRegistry("rabbit_mq_client"),
+}
+
+func (r *ClientRegistry) NewClient(logger nuclio.Logger, kind string, configuration *Configuration) (Client, error) {
+	registree, err := r.Get(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(ClientCreator).Create(logger, configuration)
+}
@@ -0,0 +1,164 @@
+package rabbitmq
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+// a client over the streadway/amqp implementation of AMQP 0-9-1. declares the topology of the event source
+// and consumes its queue on a single channel
+type conn struct {
+	logger        nuclio.Logger
+	consumerTag   string
+	brokerConn    *amqp.Connection
+	brokerChannel *amqp.Channel
+	deliveries    <-chan amqp.Delivery
+}
+
+func newConn(logger nuclio.Logger, configuration *Configuration) (*conn, error) {
+	var err error
+
+	newConn := &conn{
+		logger:      logger,
+		consumerTag: configuration.ConsumerTag,
+	}
+
+	newConn.brokerConn, err = amqp.Dial(configuration.BrokerUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create connection to broker")
+	}
+
+	if err := newConn.consume(configuration); err != nil {
+
+		// don't leak a connection whose resources failed to be created
+		newConn.brokerConn.Close()
+
+		return nil, err
+	}
+
+	go newConn.logClose()
+
+	return newConn, nil
+}
+
+func (c *conn) Deliveries() <-chan amqp.Delivery {
+	return c.deliveries
+}
+
+func (c *conn) Publish(exchangeName string, routingKey string, publishing *amqp.Publishing) error {
+	return c.brokerChannel.Publish(exchangeName, routingKey, false, false, *publishing)
+}
+
+func (c *conn) Cancel() error {
+	return c.brokerChannel.Cancel(c.consumerTag, false)
+}
+
+func (c *conn) Close() error {
+	if err := c.brokerConn.Close(); err != nil && err != amqp.ErrClosed {
+		return err
+	}
+
+	return nil
+}
+
+func (c *conn) consume(configuration *Configuration) error {
+	var err error
+
+	c.brokerChannel, err = c.brokerConn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "Failed to create channel")
+	}
+
+	// limit the number of unacked messages delivered to us. zero means no limit
+	if err = c.brokerChannel.Qos(configuration.PrefetchCount, 0, false); err != nil {
+		return errors.Wrap(err, "Failed to set prefetch count")
+	}
+
+	if configuration.ExchangeDeclare {
+		err = c.brokerChannel.ExchangeDeclare(
+			configuration.BrokerExchangeName, // name
+			configuration.ExchangeType,       // type
+			configuration.ExchangeDurable,    // durable
+			false,                            // auto-delete
+			false,                            // internal
+			false,                            // no-wait
+			nil,                              // arguments
+		)
+		if err != nil {
+			return errors.Wrap(err, "Failed to declare exchange")
+		}
+	}
+
+	brokerQueue, err := c.brokerChannel.QueueDeclare(
+		configuration.QueueName,       // queue name
+		configuration.QueueDurable,    // durable
+		configuration.QueueAutoDelete, // delete when unused
+		configuration.QueueExclusive,  // exclusive
+		false,                         // no-wait
+		nil,                           // arguments
+	)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create queue")
+	}
+
+	// the default exchange routes by queue name and can't be bound to
+	if configuration.BrokerExchangeName != "" {
+		for _, routingKey := range configuration.RoutingKeys {
+			err = c.brokerChannel.QueueBind(
+				brokerQueue.Name,                 // queue name
+				routingKey,                       // routing key
+				configuration.BrokerExchangeName, // exchange
+				false,
+				nil)
+			if err != nil {
+				return errors.Wrapf(err, "Failed to bind to queue with routing key %s", routingKey)
+			}
+		}
+	}
+
+	c.deliveries, err = c.brokerChannel.Consume(
+		brokerQueue.Name,          // queue
+		configuration.ConsumerTag, // consumer
+		false,                     // auto-ack
+		false,                     // exclusive
+		false,                     // no-local
+		false,                     // no-wait
+		nil,                       // args
+	)
+	if err != nil {
+		return errors.Wrap(err, "Failed to start consuming messages")
+	}
+
+	return nil
+}
+
+// logs why the connection or channel closed. closing either closes the deliveries channel
+func (c *conn) logClose() {
+	connectionCloseChan := c.brokerConn.NotifyClose(make(chan *amqp.Error, 1))
+	channelCloseChan := c.brokerChannel.NotifyClose(make(chan *amqp.Error, 1))
+
+	// the notification channels are closed without an error when we close the connection
+	select {
+	case closeError := <-connectionCloseChan:
+		if closeError != nil {
+			c.logger.WarnWith("Connection closed", "err", closeError)
+		}
+	case closeError := <-channelCloseChan:
+		if closeError != nil {
+			c.logger.WarnWith("Channel closed", "err", closeError)
+		}
+	}
+}
+
+type connCreator struct{}
+
+func (cc *connCreator) Create(logger nuclio.Logger, configuration *Configuration) (Client, error) {
+	return newConn(logger, configuration)
+}
+
+// register the streadway/amqp implementation as the default client
+func init() {
+	ClientRegistrySingleton.Register("amqp", &connCreator{})
+}
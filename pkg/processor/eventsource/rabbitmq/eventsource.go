@@ -1,6 +1,7 @@
 package rabbitmq
 
 import (
+	"sync"
 	"time"
 
 	"github.com/nuclio/nuclio-sdk"
@@ -13,130 +14,227 @@ import (
 
 type rabbitMq struct {
 	eventsource.AbstractEventSource
-	event                      Event
-	configuration              *Configuration
-	brokerConn                 *amqp.Connection
-	brokerChannel              *amqp.Channel
-	brokerQueue                amqp.Queue
-	brokerInputMessagesChannel <-chan amqp.Delivery
-	worker                     *worker.Worker
+	configuration *Configuration
+
+	// the client is replaced when reconnecting, and is accessed under the connection's lock
+	connection *eventsource.Connection
+	client     Client
 }
 
 func newEventSource(parentLogger nuclio.Logger,
 	workerAllocator worker.WorkerAllocator,
 	configuration *Configuration) (eventsource.EventSource, error) {
 
-	newEventSource := rabbitMq{
+	// messages are handled concurrently, so the allocator must be shareable
+	if !workerAllocator.Shareable() {
+		return nil, errors.New("Rabbit-mq event source requires a shareable worker allocator")
+	}
+
+	newEventSource := &rabbitMq{
 		AbstractEventSource: eventsource.AbstractEventSource{
 			Logger:          parentLogger.GetChild("rabbitMq").(nuclio.Logger),
 			WorkerAllocator: workerAllocator,
 			Class:           "async",
 			Kind:            "rabbitMq",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
 		},
 		configuration: configuration,
 	}
 
-	return &newEventSource, nil
+	newEventSource.connection = eventsource.NewConnection(newEventSource.Logger,
+		time.Duration(configuration.ReconnectBackoffMs)*time.Millisecond,
+		time.Duration(configuration.ReconnectMaxBackoffMs)*time.Millisecond,
+		newEventSource.connect,
+		newEventSource.disconnect)
+
+	return newEventSource, nil
 }
 
 func (rmq *rabbitMq) Start(checkpoint eventsource.Checkpoint) error {
-	var err error
-
-	rmq.Logger.InfoWith("Starting", "brokerUrl", rmq.configuration.BrokerUrl)
-
-	// get a worker, we'll be using this one always
-	rmq.worker, err = rmq.WorkerAllocator.Allocate(10 * time.Second)
-	if err != nil {
-		return errors.Wrap(err, "Failed to allocate worker")
+	rmq.Logger.InfoWith("Starting",
+		"brokerUrl", rmq.configuration.BrokerUrl,
+		"queue", rmq.configuration.QueueName,
+		"numWorkers", rmq.configuration.NumWorkers)
+
+	// the first connection must succeed, so that misconfiguration is reported on start
+	if err := rmq.connection.Start(rmq.consume); err != nil {
+		return errors.Wrap(err, "Failed to connect to broker")
 	}
 
-	if err := rmq.createBrokerResources(); err != nil {
-		return errors.Wrap(err, "Failed to create broker resources")
-	}
-
-	// start listening for published messages
-	go rmq.handleBrokerMessages()
-
 	return nil
 }
 
 func (rmq *rabbitMq) Stop(force bool) (eventsource.Checkpoint, error) {
+	rmq.Logger.InfoWith("Stopping", "force", force)
+
+	// stop receiving deliveries. this closes the deliveries channel and lets the message handlers exit once
+	// the messages being processed are acked - unless we're asked not to wait. closing the connection then
+	// returns any unacked messages to the queue, so that they'll be redelivered
+	err := rmq.connection.Stop(force, func() {
+		if rmq.client == nil {
+			return
+		}
 
-	// TODO
+		if err := rmq.client.Cancel(); err != nil {
+			rmq.Logger.WarnWith("Failed to cancel consumer", "err", err)
+		}
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to close connection to broker")
+	}
+
+	// the broker tracks our position in the queue
 	return nil, nil
 }
 
-func (rmq *rabbitMq) createBrokerResources() error {
-	var err error
+func (rmq *rabbitMq) GetConnectionState() eventsource.ConnectionState {
+	return rmq.connection.GetConnectionState()
+}
 
-	rmq.brokerConn, err = amqp.Dial(rmq.configuration.BrokerUrl)
-	if err != nil {
-		return errors.Wrap(err, "Failed to create connection to broker")
+// publishes a message to the exchange we consume from with the publish routing key, allowing other event
+// sources to use us as their dead letter sink
+func (rmq *rabbitMq) Publish(body []byte, contentType string) error {
+	rmq.connection.Lock()
+	defer rmq.connection.Unlock()
+
+	if rmq.configuration.PublishRoutingKey == "" {
+		return errors.Errorf("Event source %s has no publish_routing_key to publish with", rmq.GetID())
 	}
 
-	rmq.brokerChannel, err = rmq.brokerConn.Channel()
-	if err != nil {
-		return errors.Wrap(err, "Failed to create channel")
+	if rmq.client == nil {
+		return errors.New("Can't publish while not connected to the broker")
 	}
 
-	rmq.brokerQueue, err = rmq.brokerChannel.QueueDeclare(
-		"foo", // queue name (account  + function name)
-		false, // durable  TBD: change to true if/when we bind to persistent storage
-		false, // delete when unused
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		return errors.Wrap(err, "Failed to create queue")
+	return rmq.client.Publish(rmq.configuration.BrokerExchangeName,
+		rmq.configuration.PublishRoutingKey,
+		&amqp.Publishing{
+			ContentType: contentType,
+			Body:        body,
+		})
+}
+
+// handles the deliveries of the current connection until it's lost, the broker cancels our consumer (e.g.
+// the queue was deleted) or we're stopped
+func (rmq *rabbitMq) consume() {
+	rmq.connection.Lock()
+	client := rmq.client
+	rmq.connection.Unlock()
+
+	// a forced stop may have disconnected already
+	if client == nil {
+		return
 	}
 
-	err = rmq.brokerChannel.QueueBind(
-		rmq.brokerQueue.Name, // queue name
-		"foo",                // routing key
-		rmq.configuration.BrokerExchangeName, // exchange
-		false,
-		nil)
-	if err != nil {
-		return errors.Wrap(err, "Failed to bind to queue")
+	deliveries := client.Deliveries()
+
+	// handle as many messages concurrently as we have workers. all handlers consume the same deliveries,
+	// until the deliveries channel is closed
+	handlersWaitGroup := sync.WaitGroup{}
+
+	for handlerIndex := 0; handlerIndex < rmq.configuration.NumWorkers; handlerIndex++ {
+		handlersWaitGroup.Add(1)
+
+		go func() {
+			defer handlersWaitGroup.Done()
+
+			rmq.handleBrokerMessages(client, deliveries)
+		}()
 	}
 
-	rmq.brokerInputMessagesChannel, err = rmq.brokerChannel.Consume(
-		rmq.brokerQueue.Name, // queue
-		"",                   // consumer
-		false,                // auto-ack
-		false,                // exclusive
-		false,                // no-local
-		false,                // no-wait
-		nil,                  // args
-	)
+	handlersWaitGroup.Wait()
+}
+
+// connects and declares the topology. called under the connection's lock
+func (rmq *rabbitMq) connect() error {
+	client, err := ClientRegistrySingleton.NewClient(rmq.Logger, rmq.configuration.ClientKind, rmq.configuration)
 	if err != nil {
-		return errors.Wrap(err, "Failed to start consuming messages")
+		return errors.Wrap(err, "Failed to create client")
 	}
 
+	rmq.client = client
+
 	return nil
 }
 
-func (rmq *rabbitMq) handleBrokerMessages() {
-	for {
-		select {
-		case message := <-rmq.brokerInputMessagesChannel:
+// called under the connection's lock
+func (rmq *rabbitMq) disconnect() error {
+
+	// nothing to close if we never connected, or already disconnected
+	if rmq.client == nil {
+		return nil
+	}
+
+	client := rmq.client
+	rmq.client = nil
+
+	return client.Close()
+}
+
+// handles the deliveries received on a connection. replies are published on the same connection
+func (rmq *rabbitMq) handleBrokerMessages(client Client, deliveries <-chan amqp.Delivery) {
+	var event Event
+
+	// the channel is closed when the consumer is cancelled or the connection is closed
+	for message := range deliveries {
+
+		// bind to delivery
+		event.message = &message
 
-			// bind to delivery
-			rmq.event.message = &message
+		// submit to worker. this retries and dead letters the message according to configuration
+		response, submitError, processError := rmq.SubmitEventToWorker(&event, rmq.configuration.GetWorkerAllocationTimeout())
 
-			// submit to worker
-			_, submitError, processError := rmq.SubmitEventToWorker(&rmq.event, 10*time.Second)
+		// if we couldn't get the message to a worker, return it to the queue so that it's redelivered.
+		// otherwise, it was either processed or failed all retries (and was dead lettered, if configured)
+		if submitError != nil {
+			rmq.Logger.WarnWith("Failed to submit message to worker, requeueing", "err", submitError)
 
-			// TODO: do something with response and process error?
-			rmq.Logger.DebugWith("Processed message", "processError", processError)
+			message.Nack(false, true)
+		} else if rmq.shouldRequeue(processError) {
+			rmq.Logger.WarnWith("Timed out processing message, requeueing", "err", processError)
 
-			// ack the message if we didn't fail to submit
-			if submitError == nil {
-				message.Ack(false)
-			} else {
-				errors.Wrap(submitError, "Failed to submit to worker")
+			message.Nack(false, true)
+		} else {
+			if processError != nil {
+				rmq.Logger.WarnWith("Failed to process message", "err", processError)
 			}
+
+			// reply before acking, so that the reply isn't lost if we stop in between
+			if message.ReplyTo != "" {
+				rmq.reply(client, &message, response, processError)
+			}
+
+			message.Ack(false)
 		}
 	}
+
+	rmq.Logger.Debug("Stopped handling broker messages")
+}
+
+// messages that timed out are returned to the queue to be processed again, unless they were dead lettered
+func (rmq *rabbitMq) shouldRequeue(processError error) bool {
+	return errors.Cause(processError) == worker.ErrEventTimeout && !rmq.HasDeadLetterSink()
+}
+
+// publishes the response (or error) to the queue the caller asked us to reply to, through the default
+// exchange. a failure to reply doesn't fail the message, since the handler already processed it
+func (rmq *rabbitMq) reply(client Client,
+	message *amqp.Delivery,
+	response interface{},
+	processError error) {
+
+	reply, err := newReply(message, response, processError)
+	if err != nil {
+		rmq.Logger.WarnWith("Failed to create reply", "err", err, "replyTo", message.ReplyTo)
+		return
+	}
+
+	if err := client.Publish("", message.ReplyTo, reply); err != nil {
+		rmq.Logger.WarnWith("Failed to publish reply",
+			"err", err,
+			"replyTo", message.ReplyTo,
+			"correlationId", message.CorrelationId)
+	}
 }
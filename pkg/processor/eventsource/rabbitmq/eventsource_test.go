@@ -0,0 +1,248 @@
+package rabbitmq
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/suite"
+)
+
+const testBrokerURL = "test://broker"
+
+// counts the dead letters written to it
+type testDeadLetterSink struct {
+	lock           sync.Mutex
+	numDeadLetters int
+}
+
+func (tdls *testDeadLetterSink) Write(deadLetter *eventsource.DeadLetter) error {
+	tdls.lock.Lock()
+	defer tdls.lock.Unlock()
+
+	tdls.numDeadLetters++
+
+	return nil
+}
+
+func (tdls *testDeadLetterSink) getNumDeadLetters() int {
+	tdls.lock.Lock()
+	defer tdls.lock.Unlock()
+
+	return tdls.numDeadLetters
+}
+
+func (tdls *testDeadLetterSink) Close() error {
+	return nil
+}
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	broker  *testBroker
+	runtime *eventsourcetest.RecordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	suite.broker = newTestBroker(testBrokerURL)
+
+	// records the bodies of the messages it processes, and responds with them. fails a message whose body is
+	// "fail", takes a while to process one whose body is "slow" and fails one whose body is "timeout" once its
+	// deadline passed the first time it's processed
+	suite.runtime = eventsourcetest.NewRecordingRuntime(func(event nuclio.Event) interface{} {
+		return string(event.GetBody())
+	}, func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+		body := string(event.GetBody())
+
+		switch body {
+		case "fail":
+			return nil, errors.New("Processing error")
+		case "slow":
+			time.Sleep(200 * time.Millisecond)
+		case "timeout":
+			for _, previousRecord := range previousRecords {
+				if previousRecord == body {
+					return "processed " + body, nil
+				}
+			}
+
+			time.Sleep(200 * time.Millisecond)
+			return nil, errors.New("Processing error")
+		}
+
+		return "processed " + body, nil
+	})
+}
+
+func (suite *EventSourceTestSuite) TestAckAfterProcessing() {
+	suite.startEventSource(suite.createConfiguration())
+
+	suite.broker.publish(amqp.Delivery{Body: []byte("first")})
+	suite.broker.publish(amqp.Delivery{Body: []byte("fail")})
+
+	suite.waitForLogLength(2)
+
+	// failed messages are acked too, having failed all retries
+	log := suite.broker.getLog()
+	suite.Contains(log, "ack first")
+	suite.Contains(log, "ack fail")
+}
+
+func (suite *EventSourceTestSuite) TestReplyBeforeAck() {
+	suite.startEventSource(suite.createConfiguration())
+
+	for testCaseIndex, testCase := range []struct {
+		body          string
+		expectedReply string
+	}{
+		{"question", "publish /replies 1 processed question"},
+		{"fail", `publish /replies 2 {"error":"Failed to process event: Processing error"}`},
+	} {
+		suite.broker.publish(amqp.Delivery{
+			Body:          []byte(testCase.body),
+			ReplyTo:       "replies",
+			CorrelationId: strconv.Itoa(testCaseIndex + 1),
+		})
+
+		suite.waitForLogLength(2 * (testCaseIndex + 1))
+
+		suite.Equal([]string{testCase.expectedReply, "ack " + testCase.body},
+			suite.broker.getLog()[2*testCaseIndex:],
+			testCase.body)
+	}
+}
+
+func (suite *EventSourceTestSuite) TestTimeoutRequeued() {
+	configuration := suite.createConfiguration()
+	configuration.EventTimeoutMs = 50
+	suite.startEventSource(configuration)
+
+	suite.broker.publish(amqp.Delivery{Body: []byte("timeout")})
+
+	// processed again once requeued
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.waitForLogLength(2)
+	suite.Equal([]string{"nack timeout requeue=true", "ack timeout"}, suite.broker.getLog())
+}
+
+func (suite *EventSourceTestSuite) TestTimeoutDeadLettered() {
+	configuration := suite.createConfiguration()
+	configuration.EventTimeoutMs = 50
+
+	deadLetterSink := &testDeadLetterSink{}
+
+	eventSource := suite.createEventSource(configuration)
+	eventSource.SetDeadLetterSink(deadLetterSink)
+	suite.StartEventSource(eventSource, nil)
+
+	suite.broker.publish(amqp.Delivery{Body: []byte("timeout")})
+
+	// dead lettered rather than requeued
+	suite.waitForLogLength(1)
+	suite.Equal([]string{"ack timeout"}, suite.broker.getLog())
+	suite.Equal(1, deadLetterSink.getNumDeadLetters())
+	suite.ExpectNumRecords(suite.runtime, 1)
+}
+
+func (suite *EventSourceTestSuite) TestReconnectsWithBackoff() {
+	eventSource := suite.startEventSource(suite.createConfiguration())
+
+	suite.broker.publish(amqp.Delivery{Body: []byte("slow")})
+
+	// the broker restarts while the message is processed, and refuses the first reconnection attempts. the
+	// runtime is busy while processing, so this can't wait for it to record the message
+	time.Sleep(50 * time.Millisecond)
+	suite.broker.refuseConnects(2)
+	disconnectTime := time.Now()
+	suite.broker.dropConnections()
+
+	// the message couldn't be acked, so it's redelivered once reconnected
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.waitForLogLength(1)
+	suite.Equal([]string{"ack slow"}, suite.broker.getLog())
+
+	// 10 + 20 + 40 ms
+	numConnects, lastConnectedTime := suite.broker.getConnects()
+	suite.Equal(4, numConnects)
+	suite.True(lastConnectedTime.Sub(disconnectTime) >= 70*time.Millisecond)
+
+	suite.Equal(eventsource.ConnectionStateConnected,
+		eventSource.(eventsource.ConnectionStateProvider).GetConnectionState())
+}
+
+func (suite *EventSourceTestSuite) TestStopAcksMessagesBeingProcessed() {
+	eventSource := suite.startEventSource(suite.createConfiguration())
+
+	suite.broker.publish(amqp.Delivery{Body: []byte("slow")})
+	suite.WaitForNumRecords(suite.runtime, 1)
+
+	_, err := eventSource.Stop(false)
+	suite.Require().NoError(err)
+
+	// the consumer was cancelled, and the message acked before the connection was closed
+	suite.Equal([]string{"ack slow"}, suite.broker.getLog())
+	suite.Equal(0, suite.broker.getNumConsumers())
+	suite.Equal(eventsource.ConnectionStateDisconnected,
+		eventSource.(eventsource.ConnectionStateProvider).GetConnectionState())
+}
+
+func (suite *EventSourceTestSuite) TestPublish() {
+	configuration := suite.createConfiguration()
+	configuration.BrokerExchangeName = "functions"
+	configuration.PublishRoutingKey = "orders.dead"
+
+	publisher := suite.createEventSource(configuration).(eventsource.Publisher)
+
+	// not connected yet
+	suite.Error(publisher.Publish([]byte("letter"), "application/json"))
+
+	suite.StartEventSource(publisher.(eventsource.EventSource), nil)
+
+	suite.Require().NoError(publisher.Publish([]byte("letter"), "application/json"))
+	suite.Equal([]string{"publish functions/orders.dead  letter"}, suite.broker.getLog())
+
+	// nothing to publish with
+	configuration.PublishRoutingKey = ""
+	suite.Error(publisher.Publish([]byte("letter"), "application/json"))
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	suite.ExpectStopReturns(suite.createEventSource(suite.createConfiguration()))
+}
+
+func (suite *EventSourceTestSuite) createConfiguration() *Configuration {
+	return &Configuration{
+		Configuration:         suite.CreateConfiguration("rmq1", 2),
+		ClientKind:            "test",
+		BrokerUrl:             testBrokerURL,
+		QueueName:             "orders",
+		ConsumerTag:           "nuclio-rmq1",
+		ReconnectBackoffMs:    10,
+		ReconnectMaxBackoffMs: 40,
+	}
+}
+
+func (suite *EventSourceTestSuite) createEventSource(configuration *Configuration) eventsource.EventSource {
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 2), configuration)
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+func (suite *EventSourceTestSuite) startEventSource(configuration *Configuration) eventsource.EventSource {
+	return suite.StartEventSource(suite.createEventSource(configuration), nil)
+}
+
+func (suite *EventSourceTestSuite) waitForLogLength(logLength int) {
+	suite.WaitFor(func() bool { return len(suite.broker.getLog()) >= logLength })
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
@@ -13,33 +13,35 @@ type factory struct{}
 
 func (f *factory) Create(parentLogger nuclio.Logger,
 	eventSourceConfiguration *viper.Viper,
-	runtimeConfiguration *viper.Viper) (eventsource.EventSource, error) {
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	// validate and read the configuration
+	configuration, err := newConfiguration(eventSourceConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
 
 	// create logger parent
 	rabbitMqLogger := parentLogger.GetChild("rabbit_mq").(nuclio.Logger)
 
-	// create worker allocator
-	workerAllocator, err := worker.WorkerFactorySingleton.CreateSingletonPoolWorkerAllocator(rabbitMqLogger,
-		runtimeConfiguration)
+	// messages are processed concurrently, one per worker
+	workerAllocator, err := eventsource.NewWorkerAllocator(rabbitMqLogger,
+		&configuration.Configuration,
+		runtimeConfiguration,
+		workerPools)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create worker allocator")
 	}
 
 	// finally, create the event source
-	generatorEventSource, err := newEventSource(rabbitMqLogger,
-		workerAllocator,
-		&Configuration{
-			*eventsource.NewConfiguration(eventSourceConfiguration),
-			eventSourceConfiguration.GetString("url"),
-			eventSourceConfiguration.GetString("exchange"),
-		},
-	)
+	rabbitMqEventSource, err := newEventSource(rabbitMqLogger, workerAllocator, configuration)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create rabbit-mq event source")
 	}
 
-	return generatorEventSource, nil
+	return rabbitMqEventSource, nil
 }
 
 // register factory
@@ -0,0 +1,67 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+
+	// set on replies to messages whose processing failed
+	replyErrorHeader = "x-nuclio-error"
+
+	// set on replies to the status code of the handler's response, if it set one
+	replyStatusCodeHeader = "x-nuclio-status-code"
+)
+
+// the body of replies to messages whose processing failed
+type replyErrorEnvelope struct {
+	Error string `json:"error"`
+}
+
+// creates the reply to a message, correlated with it, from the handler's response or processing error
+func newReply(message *amqp.Delivery, response interface{}, processError error) (*amqp.Publishing, error) {
+	reply := amqp.Publishing{
+		CorrelationId: message.CorrelationId,
+		Headers:       amqp.Table{},
+	}
+
+	if processError != nil {
+		body, err := json.Marshal(&replyErrorEnvelope{Error: processError.Error()})
+		if err != nil {
+			return nil, err
+		}
+
+		reply.ContentType = "application/json"
+		reply.Body = body
+		reply.Headers[replyErrorHeader] = true
+
+		return &reply, nil
+	}
+
+	// format the reply based on the response type
+	switch typedResponse := response.(type) {
+	case nuclio.Response:
+		reply.ContentType = typedResponse.ContentType
+		reply.Body = typedResponse.Body
+
+		for headerKey, headerValue := range typedResponse.Headers {
+			reply.Headers[headerKey] = headerValue
+		}
+
+		if typedResponse.StatusCode != 0 {
+			reply.Headers[replyStatusCodeHeader] = int32(typedResponse.StatusCode)
+		}
+
+	case []byte:
+		reply.Body = typedResponse
+
+	case string:
+		reply.Body = []byte(typedResponse)
+	}
+
+	return &reply, nil
+}
@@ -0,0 +1,72 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReplyTestSuite struct {
+	suite.Suite
+	message *amqp.Delivery
+}
+
+func (suite *ReplyTestSuite) SetupTest() {
+	suite.message = &amqp.Delivery{
+		ReplyTo:       "amq.rabbitmq.reply-to",
+		CorrelationId: "request-1",
+	}
+}
+
+func (suite *ReplyTestSuite) TestResponse() {
+	reply, err := newReply(suite.message, nuclio.Response{
+		StatusCode:  201,
+		ContentType: "application/json",
+		Headers:     map[string]string{"x-request-id": "abc"},
+		Body:        []byte(`{"id": 1}`),
+	}, nil)
+
+	suite.Require().NoError(err)
+	suite.Equal("request-1", reply.CorrelationId)
+	suite.Equal("application/json", reply.ContentType)
+	suite.Equal([]byte(`{"id": 1}`), reply.Body)
+	suite.Equal("abc", reply.Headers["x-request-id"])
+	suite.Equal(int32(201), reply.Headers[replyStatusCodeHeader])
+	suite.NotContains(reply.Headers, replyErrorHeader)
+
+	// the headers must be encodable in an amqp frame
+	suite.NoError(reply.Headers.Validate())
+}
+
+func (suite *ReplyTestSuite) TestRawResponse() {
+	reply, err := newReply(suite.message, []byte("raw"), nil)
+	suite.Require().NoError(err)
+	suite.Equal("request-1", reply.CorrelationId)
+	suite.Equal([]byte("raw"), reply.Body)
+
+	reply, err = newReply(suite.message, "text", nil)
+	suite.Require().NoError(err)
+	suite.Equal([]byte("text"), reply.Body)
+}
+
+func (suite *ReplyTestSuite) TestErrorEnvelope() {
+	reply, err := newReply(suite.message, nil, errors.New("Processing error"))
+	suite.Require().NoError(err)
+
+	suite.Equal("request-1", reply.CorrelationId)
+	suite.Equal("application/json", reply.ContentType)
+	suite.Equal(true, reply.Headers[replyErrorHeader])
+
+	envelope := replyErrorEnvelope{}
+	suite.Require().NoError(json.Unmarshal(reply.Body, &envelope))
+	suite.Equal("Processing error", envelope.Error)
+}
+
+func TestReplyTestSuite(t *testing.T) {
+	suite.Run(t, new(ReplyTestSuite))
+}
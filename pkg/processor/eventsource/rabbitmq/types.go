@@ -1,9 +1,183 @@
 package rabbitmq
 
-import "github.com/nuclio/nuclio/pkg/processor/eventsource"
+import (
+	"strings"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
 
 type Configuration struct {
 	eventsource.Configuration
+	ClientKind         string
 	BrokerUrl          string
 	BrokerExchangeName string
+
+	// the exchange is declared only if asked to, since it's usually shared with publishers
+	ExchangeDeclare bool
+	ExchangeType    string
+	ExchangeDurable bool
+
+	QueueName       string
+	QueueDurable    bool
+	QueueExclusive  bool
+	QueueAutoDelete bool
+
+	// the queue is bound to the exchange with each of these. without any, the queue is expected to be bound
+	// by whoever declared it
+	RoutingKeys []string
+
+	// the routing key of messages published through the event source (e.g. dead letters). publishing is
+	// disabled unless set, and it mustn't route to the queue we consume from - or failed events would loop
+	PublishRoutingKey string
+
+	ConsumerTag string
+
+	// the number of unacked messages the broker delivers to us
+	PrefetchCount int
+
+	// the wait before the first reconnection attempt. doubles with every attempt, up to the max
+	ReconnectBackoffMs    int
+	ReconnectMaxBackoffMs int
+}
+
+func newConfiguration(eventSourceConfiguration *viper.Viper) (*Configuration, error) {
+	id := eventSourceConfiguration.GetString("id")
+
+	// defaults
+	eventSourceConfiguration.SetDefault("client", "amqp")
+	eventSourceConfiguration.SetDefault("exchange_declare", false)
+	eventSourceConfiguration.SetDefault("exchange_type", "topic")
+	eventSourceConfiguration.SetDefault("exchange_durable", true)
+
+	// the queue is named after the event source, so that the replicas of a function share it (each message
+	// is processed by one of them). set queue_durable to not lose messages across broker restarts
+	eventSourceConfiguration.SetDefault("queue_name", "nuclio-"+id)
+	eventSourceConfiguration.SetDefault("queue_durable", false)
+	eventSourceConfiguration.SetDefault("consumer_tag", "nuclio-"+id)
+	eventSourceConfiguration.SetDefault("reconnect_backoff_ms", 500)
+	eventSourceConfiguration.SetDefault("reconnect_max_backoff_ms", 30000)
+
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"client":                   eventsource.ValueTypeString,
+		"url":                      eventsource.ValueTypeString,
+		"exchange":                 eventsource.ValueTypeString,
+		"exchange_declare":         eventsource.ValueTypeBool,
+		"exchange_type":            eventsource.ValueTypeString,
+		"exchange_durable":         eventsource.ValueTypeBool,
+		"queue_name":               eventsource.ValueTypeString,
+		"queue_durable":            eventsource.ValueTypeBool,
+		"queue_exclusive":          eventsource.ValueTypeBool,
+		"queue_auto_delete":        eventsource.ValueTypeBool,
+		"routing_keys":             eventsource.ValueTypeStringSlice,
+		"publish_routing_key":      eventsource.ValueTypeString,
+		"consumer_tag":             eventsource.ValueTypeString,
+		"prefetch_count":           eventsource.ValueTypeInt,
+		"reconnect_backoff_ms":     eventsource.ValueTypeInt,
+		"reconnect_max_backoff_ms": eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// by default, as many messages as we have workers to process them are delivered at a time
+	eventSourceConfiguration.SetDefault("prefetch_count", configuration.NumWorkers)
+
+	rabbitMqConfiguration := Configuration{
+		Configuration:         *configuration,
+		ClientKind:            eventSourceConfiguration.GetString("client"),
+		BrokerUrl:             eventSourceConfiguration.GetString("url"),
+		BrokerExchangeName:    eventSourceConfiguration.GetString("exchange"),
+		ExchangeDeclare:       eventSourceConfiguration.GetBool("exchange_declare"),
+		ExchangeType:          eventSourceConfiguration.GetString("exchange_type"),
+		ExchangeDurable:       eventSourceConfiguration.GetBool("exchange_durable"),
+		QueueName:             eventSourceConfiguration.GetString("queue_name"),
+		QueueDurable:          eventSourceConfiguration.GetBool("queue_durable"),
+		QueueExclusive:        eventSourceConfiguration.GetBool("queue_exclusive"),
+		QueueAutoDelete:       eventSourceConfiguration.GetBool("queue_auto_delete"),
+		RoutingKeys:           eventSourceConfiguration.GetStringSlice("routing_keys"),
+		PublishRoutingKey:     eventSourceConfiguration.GetString("publish_routing_key"),
+		ConsumerTag:           eventSourceConfiguration.GetString("consumer_tag"),
+		PrefetchCount:         eventSourceConfiguration.GetInt("prefetch_count"),
+		ReconnectBackoffMs:    eventSourceConfiguration.GetInt("reconnect_backoff_ms"),
+		ReconnectMaxBackoffMs: eventSourceConfiguration.GetInt("reconnect_max_backoff_ms"),
+	}
+
+	if rabbitMqConfiguration.routesToQueue(rabbitMqConfiguration.PublishRoutingKey) {
+		return nil, errors.Errorf("Publish routing key %s of event source %s routes to the queue it consumes from",
+			rabbitMqConfiguration.PublishRoutingKey,
+			id)
+	}
+
+	if rabbitMqConfiguration.PrefetchCount < 0 {
+		return nil, errors.New("Prefetch count can't be negative")
+	}
+
+	if rabbitMqConfiguration.ReconnectBackoffMs <= 0 {
+		return nil, errors.New("Reconnect backoff must be positive")
+	}
+
+	return &rabbitMqConfiguration, nil
+}
+
+// returns whether a message published with the routing key is delivered to the queue we consume from
+func (c *Configuration) routesToQueue(routingKey string) bool {
+	if routingKey == "" {
+		return false
+	}
+
+	// the default exchange routes by queue name
+	if c.BrokerExchangeName == "" {
+		return routingKey == c.QueueName
+	}
+
+	switch c.ExchangeType {
+	case "fanout":
+		return true
+	case "headers":
+
+		// routes by headers, which we don't publish
+		return false
+	}
+
+	for _, bindingKey := range c.RoutingKeys {
+		if bindingKey == routingKey {
+			return true
+		}
+
+		if c.ExchangeType == "topic" && topicMatches(strings.Split(bindingKey, "."), strings.Split(routingKey, ".")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns whether the words of a topic binding key match those of a routing key, where * matches exactly one
+// word and # matches zero or more
+func topicMatches(bindingWords []string, routingWords []string) bool {
+	if len(bindingWords) == 0 {
+		return len(routingWords) == 0
+	}
+
+	switch bindingWords[0] {
+	case "#":
+		for numSkipped := 0; numSkipped <= len(routingWords); numSkipped++ {
+			if topicMatches(bindingWords[1:], routingWords[numSkipped:]) {
+				return true
+			}
+		}
+
+		return false
+	case "*":
+		return len(routingWords) != 0 && topicMatches(bindingWords[1:], routingWords[1:])
+	default:
+		return len(routingWords) != 0 &&
+			bindingWords[0] == routingWords[0] &&
+			topicMatches(bindingWords[1:], routingWords[1:])
+	}
 }
@@ -0,0 +1,78 @@
+package redisstreams
+
+import (
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+)
+
+// an entry of a stream
+type Entry struct {
+	Stream string
+
+	// <milliseconds>-<sequence number>, assigned by the server when the entry was added
+	ID string
+
+	// nil for entries deleted from the stream after they were delivered
+	Fields map[string]string
+}
+
+// a connection to a Redis server. the redis-streams event source is written against this so that the
+// protocol implementation can be swapped (e.g. for one with TLS or cluster support). commands are sent
+// one at a time - a blocking read holds the connection until it returns
+type Client interface {
+
+	// creates a consumer group reading a stream from startID ($ - new entries only, 0 - all entries),
+	// creating the stream if it doesn't exist. a group that already exists is left as is
+	CreateGroup(stream string, group string, startID string) error
+
+	// reads up to count entries of the streams that weren't delivered to the group yet, as one of its
+	// consumers, waiting up to block for entries to arrive. returns no entries if none did
+	ReadGroup(group string, consumer string, streams []string, count int, block time.Duration) ([]*Entry, error)
+
+	// removes entries from the group's pending entries
+	Ack(stream string, group string, ids ...string) error
+
+	// transfers up to count entries of the group that are pending (delivered and not acknowledged) for
+	// longer than minIdle to a consumer, scanning the pending entries from start. returns the ID to
+	// continue scanning from (0-0 once all were scanned) and the claimed entries
+	AutoClaim(stream string,
+		group string,
+		consumer string,
+		minIdle time.Duration,
+		start string,
+		count int) (string, []*Entry, error)
+
+	// closed once the connection is lost or closed
+	Done() <-chan struct{}
+
+	Close() error
+}
+
+//
+// Client registry
+// Clients are keyed by the client kind in the event source configuration
+//
+
+type ClientCreator interface {
+	Create(logger nuclio.Logger, url string) (Client, error)
+}
+
+type ClientRegistry struct {
+	registry.Registry
+}
+
+// global singleton
+var ClientRegistrySingleton = ClientRegistry{
+	Registry: *registry.NewRegistry("redis_streams_client"),
+}
+
+func (r *ClientRegistry) NewClient(logger nuclio.Logger, kind string, url string) (Client, error) {
+	registree, err := r.Get(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(ClientCreator).Create(logger, url)
+}
@@ -0,0 +1,425 @@
+package redisstreams
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultPort = "6379"
+
+	// how long connecting, including authentication, may take
+	connectTimeout = 5 * time.Second
+
+	// how long the server may take to answer a command, beyond the time the command blocks for
+	commandTimeout = 10 * time.Second
+)
+
+// an error reply to a command. the connection remains usable
+type serverError string
+
+func (se serverError) Error() string {
+	return string(se)
+}
+
+//
+// A client speaking RESP (https://redis.io/topics/protocol) over TCP
+//
+
+type conn struct {
+	logger  nuclio.Logger
+	netConn net.Conn
+	reader  *bufio.Reader
+
+	// a command and its reply must not interleave with those of other go routines
+	commandLock sync.Mutex
+
+	closeOnce sync.Once
+	doneChan  chan struct{}
+}
+
+// connects, authenticates and selects the database given in the URL - redis://[[user]:password@]host[:port][/db]
+func newConn(parentLogger nuclio.Logger, serverURL string) (*conn, error) {
+	parsedURL, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to parse URL")
+	}
+
+	if parsedURL.Scheme != "redis" {
+		return nil, errors.Errorf("Unsupported scheme %s", parsedURL.Scheme)
+	}
+
+	address := parsedURL.Host
+	if parsedURL.Port() == "" {
+		address = net.JoinHostPort(parsedURL.Hostname(), defaultPort)
+	}
+
+	netConn, err := net.DialTimeout("tcp", address, connectTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to dial server")
+	}
+
+	newConn := &conn{
+		logger:   parentLogger,
+		netConn:  netConn,
+		reader:   bufio.NewReader(netConn),
+		doneChan: make(chan struct{}),
+	}
+
+	if err := newConn.handshake(parsedURL); err != nil {
+		newConn.Close()
+		return nil, errors.Wrap(err, "Failed to complete handshake")
+	}
+
+	return newConn, nil
+}
+
+func (c *conn) CreateGroup(stream string, group string, startID string) error {
+	_, err := c.do(0, "XGROUP", "CREATE", stream, group, startID, "MKSTREAM")
+
+	// the group was created by another replica, or by us before reconnecting
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+}
+
+func (c *conn) ReadGroup(group string,
+	consumer string,
+	streams []string,
+	count int,
+	block time.Duration) ([]*Entry, error) {
+
+	args := []string{
+		"XREADGROUP", "GROUP", group, consumer,
+		"COUNT", strconv.Itoa(count),
+		"BLOCK", strconv.FormatInt(int64(block/time.Millisecond), 10),
+		"STREAMS",
+	}
+
+	args = append(args, streams...)
+
+	// > - entries never delivered to the group
+	for range streams {
+		args = append(args, ">")
+	}
+
+	reply, err := c.do(block, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// nil if no entries arrived in time. otherwise, the entries of each stream that has any
+	if reply == nil {
+		return nil, nil
+	}
+
+	streamReplies, ok := reply.([]interface{})
+	if !ok {
+		return nil, errors.New("Malformed read reply")
+	}
+
+	var entries []*Entry
+
+	for _, streamReply := range streamReplies {
+		streamFields, ok := streamReply.([]interface{})
+		if !ok || len(streamFields) != 2 {
+			return nil, errors.New("Malformed stream in read reply")
+		}
+
+		stream, ok := streamFields[0].([]byte)
+		if !ok {
+			return nil, errors.New("Malformed stream name in read reply")
+		}
+
+		streamEntries, err := parseEntries(string(stream), streamFields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to parse entries of %s", stream)
+		}
+
+		entries = append(entries, streamEntries...)
+	}
+
+	return entries, nil
+}
+
+func (c *conn) Ack(stream string, group string, ids ...string) error {
+	_, err := c.do(0, append([]string{"XACK", stream, group}, ids...)...)
+
+	return err
+}
+
+func (c *conn) AutoClaim(stream string,
+	group string,
+	consumer string,
+	minIdle time.Duration,
+	start string,
+	count int) (string, []*Entry, error) {
+
+	reply, err := c.do(0,
+		"XAUTOCLAIM", stream, group, consumer,
+		strconv.FormatInt(int64(minIdle/time.Millisecond), 10),
+		start,
+		"COUNT", strconv.Itoa(count))
+
+	if err != nil {
+		return "", nil, err
+	}
+
+	// the next start and the claimed entries, followed by the IDs of deleted entries on Redis 7 (which are
+	// no longer pending). Redis 6.2 claims deleted entries with nil fields instead
+	replyFields, ok := reply.([]interface{})
+	if !ok || len(replyFields) < 2 {
+		return "", nil, errors.New("Malformed claim reply")
+	}
+
+	nextStart, ok := replyFields[0].([]byte)
+	if !ok {
+		return "", nil, errors.New("Malformed next start in claim reply")
+	}
+
+	entries, err := parseEntries(stream, replyFields[1])
+	if err != nil {
+		return "", nil, errors.Wrap(err, "Failed to parse claimed entries")
+	}
+
+	return string(nextStart), entries, nil
+}
+
+func (c *conn) Done() <-chan struct{} {
+	return c.doneChan
+}
+
+// may be called while a command blocks, which then fails
+func (c *conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.doneChan)
+		err = c.netConn.Close()
+	})
+
+	return err
+}
+
+func (c *conn) handshake(parsedURL *url.URL) error {
+	if parsedURL.User != nil {
+		if password, passwordSet := parsedURL.User.Password(); passwordSet {
+			args := []string{"AUTH", password}
+
+			// ACL users are supported from Redis 6. redis://:password@host authenticates as the default user
+			if username := parsedURL.User.Username(); username != "" {
+				args = []string{"AUTH", username, password}
+			}
+
+			if _, err := c.do(0, args...); err != nil {
+				return errors.Wrap(err, "Failed to authenticate")
+			}
+		}
+	}
+
+	if database := strings.Trim(parsedURL.Path, "/"); database != "" {
+		if _, err := c.do(0, "SELECT", database); err != nil {
+			return errors.Wrapf(err, "Failed to select database %s", database)
+		}
+	}
+
+	return nil
+}
+
+// sends a command and reads its reply, giving the server block (the time the command may block for) and
+// the command timeout to answer. the connection is closed on failure, unless the server replied with an error
+func (c *conn) do(block time.Duration, args ...string) (interface{}, error) {
+	c.commandLock.Lock()
+	defer c.commandLock.Unlock()
+
+	if c.closed() {
+		return nil, errors.New("Connection closed")
+	}
+
+	c.netConn.SetDeadline(time.Now().Add(block + commandTimeout))
+
+	// commands are sent as arrays of bulk strings
+	command := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+
+	for _, arg := range args {
+		command = append(command, fmt.Sprintf("$%d\r\n", len(arg))...)
+		command = append(command, arg...)
+		command = append(command, "\r\n"...)
+	}
+
+	if _, err := c.netConn.Write(command); err != nil {
+		return nil, c.fail(errors.Wrap(err, "Failed to send command"))
+	}
+
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, c.fail(errors.Wrap(err, "Failed to read reply"))
+	}
+
+	if replyError, isError := reply.(serverError); isError {
+		return nil, replyError
+	}
+
+	return reply, nil
+}
+
+// reads a reply: a simple string (string), an error (serverError), an integer (int64), a bulk string
+// ([]byte) or an array ([]interface{}). nil bulk strings and arrays are nil
+func (c *conn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errors.Errorf("Malformed reply: %q", line)
+	}
+
+	replyType, value := line[0], line[1:len(line)-2]
+
+	switch replyType {
+	case '+':
+		return value, nil
+
+	case '-':
+		return serverError(value), nil
+
+	case ':':
+		return strconv.ParseInt(value, 10, 64)
+
+	case '$':
+		size, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Malformed bulk string size: %s", value)
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		bulkString := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, bulkString); err != nil {
+			return nil, err
+		}
+
+		return bulkString[:size], nil
+
+	case '*':
+		numElements, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Malformed array size: %s", value)
+		}
+
+		if numElements < 0 {
+			return nil, nil
+		}
+
+		elements := make([]interface{}, numElements)
+
+		for elementIndex := range elements {
+			if elements[elementIndex], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+
+		return elements, nil
+	}
+
+	return nil, errors.Errorf("Unknown reply type: %c", replyType)
+}
+
+// the connection can't be used once a command failed midway, since replies would no longer match commands
+func (c *conn) fail(err error) error {
+	if !c.closed() {
+		c.logger.WarnWith("Connection lost", "err", err)
+	}
+
+	c.Close()
+
+	return err
+}
+
+func (c *conn) closed() bool {
+	select {
+	case <-c.doneChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// parses an array of entries, each an array of the ID and the fields (an array of alternating names and
+// values, nil for deleted entries)
+func parseEntries(stream string, reply interface{}) ([]*Entry, error) {
+	entryReplies, ok := reply.([]interface{})
+	if !ok {
+		return nil, errors.New("Malformed entries")
+	}
+
+	var entries []*Entry
+
+	for _, entryReply := range entryReplies {
+		entryFields, ok := entryReply.([]interface{})
+		if !ok || len(entryFields) != 2 {
+			return nil, errors.New("Malformed entry")
+		}
+
+		id, ok := entryFields[0].([]byte)
+		if !ok {
+			return nil, errors.New("Malformed entry ID")
+		}
+
+		entry := &Entry{
+			Stream: stream,
+			ID:     string(id),
+		}
+
+		if entryFields[1] != nil {
+			fields, ok := entryFields[1].([]interface{})
+			if !ok || len(fields)%2 != 0 {
+				return nil, errors.Errorf("Malformed fields of entry %s", id)
+			}
+
+			entry.Fields = map[string]string{}
+
+			for fieldIndex := 0; fieldIndex < len(fields); fieldIndex += 2 {
+				name, nameOk := fields[fieldIndex].([]byte)
+				value, valueOk := fields[fieldIndex+1].([]byte)
+
+				if !nameOk || !valueOk {
+					return nil, errors.Errorf("Malformed field of entry %s", id)
+				}
+
+				entry.Fields[string(name)] = string(value)
+			}
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+type connCreator struct{}
+
+func (cc *connCreator) Create(logger nuclio.Logger, url string) (Client, error) {
+	return newConn(logger, url)
+}
+
+// register the protocol implementation as the default client
+func init() {
+	ClientRegistrySingleton.Register("redis", &connCreator{})
+}
@@ -0,0 +1,276 @@
+package redisstreams
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// the server side of a single connection, driven command by command by the test
+type ConnTestSuite struct {
+	suite.Suite
+	logger       nuclio.Logger
+	listener     net.Listener
+	serverConn   net.Conn
+	serverReader *bufio.Reader
+	conn         *conn
+}
+
+func (suite *ConnTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *ConnTestSuite) SetupTest() {
+	var err error
+
+	suite.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+}
+
+func (suite *ConnTestSuite) TearDownTest() {
+	suite.listener.Close()
+
+	if suite.conn != nil {
+		suite.conn.Close()
+	}
+
+	if suite.serverConn != nil {
+		suite.serverConn.Close()
+	}
+}
+
+func (suite *ConnTestSuite) TestHandshake() {
+	connErrChan := suite.connectAsync(fmt.Sprintf("redis://user:secret@%s/3", suite.listener.Addr()))
+
+	suite.expectCommand("AUTH", "user", "secret")
+	suite.reply("+OK\r\n")
+	suite.expectCommand("SELECT", "3")
+	suite.reply("+OK\r\n")
+
+	suite.Require().NoError(<-connErrChan)
+}
+
+func (suite *ConnTestSuite) TestHandshakeRefused() {
+	connErrChan := suite.connectAsync(fmt.Sprintf("redis://:wrong@%s", suite.listener.Addr()))
+
+	suite.expectCommand("AUTH", "wrong")
+	suite.reply("-WRONGPASS invalid username-password pair\r\n")
+
+	err := <-connErrChan
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "WRONGPASS")
+}
+
+func (suite *ConnTestSuite) TestUnsupportedScheme() {
+	_, err := newConn(suite.logger, "rediss://"+suite.listener.Addr().String())
+	suite.Error(err)
+}
+
+func (suite *ConnTestSuite) TestReadGroup() {
+	suite.connect()
+
+	entriesChan, errChan := suite.readGroupAsync(time.Second)
+
+	suite.expectCommand("XREADGROUP", "GROUP", "group", "consumer", "COUNT", "2", "BLOCK", "1000",
+		"STREAMS", "orders", "payments", ">", ">")
+
+	// values are sized, so they may hold line breaks. entries deleted since delivered have nil fields
+	suite.reply("*2\r\n" +
+		"*2\r\n$6\r\norders\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*4\r\n$4\r\nbody\r\n$6\r\na\r\nb\r\n\r\n$1\r\nk\r\n$0\r\n\r\n" +
+		"*2\r\n$8\r\npayments\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*-1\r\n")
+
+	suite.Require().NoError(<-errChan)
+	suite.Equal([]*Entry{
+		{Stream: "orders", ID: "1-0", Fields: map[string]string{"body": "a\r\nb\r\n", "k": ""}},
+		{Stream: "payments", ID: "2-0"},
+	}, <-entriesChan)
+
+	// nothing arrived in time
+	entriesChan, errChan = suite.readGroupAsync(time.Second)
+	suite.expectCommand("XREADGROUP", "GROUP", "group", "consumer", "COUNT", "2", "BLOCK", "1000",
+		"STREAMS", "orders", "payments", ">", ">")
+	suite.reply("*-1\r\n")
+
+	suite.Require().NoError(<-errChan)
+	suite.Empty(<-entriesChan)
+}
+
+func (suite *ConnTestSuite) TestAutoClaim() {
+	suite.connect()
+
+	for _, testCase := range []struct {
+		name  string
+		reply string
+	}{
+
+		// Redis 6.2 claims deleted entries with nil fields
+		{"6.2", "*2\r\n$3\r\n5-0\r\n*2\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$4\r\nbody\r\n$1\r\nx\r\n*2\r\n$3\r\n4-0\r\n*-1\r\n"},
+
+		// Redis 7 lists the IDs of deleted entries, which are no longer pending
+		{"7", "*3\r\n$3\r\n5-0\r\n*2\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$4\r\nbody\r\n$1\r\nx\r\n*2\r\n$3\r\n4-0\r\n*-1\r\n*0\r\n"},
+	} {
+		type claimResult struct {
+			nextStart string
+			entries   []*Entry
+			err       error
+		}
+
+		resultChan := make(chan claimResult, 1)
+
+		go func() {
+			nextStart, entries, err := suite.conn.AutoClaim("orders", "group", "consumer", 1500*time.Millisecond, "0-0", 2)
+			resultChan <- claimResult{nextStart, entries, err}
+		}()
+
+		suite.expectCommand("XAUTOCLAIM", "orders", "group", "consumer", "1500", "0-0", "COUNT", "2")
+		suite.reply(testCase.reply)
+
+		result := <-resultChan
+		suite.Require().NoError(result.err, testCase.name)
+		suite.Equal("5-0", result.nextStart, testCase.name)
+		suite.Equal([]*Entry{
+			{Stream: "orders", ID: "3-0", Fields: map[string]string{"body": "x"}},
+			{Stream: "orders", ID: "4-0"},
+		}, result.entries, testCase.name)
+	}
+}
+
+func (suite *ConnTestSuite) TestServerErrorKeepsConnection() {
+	suite.connect()
+
+	errChan := make(chan error, 1)
+
+	// a group that exists already isn't an error
+	go func() { errChan <- suite.conn.CreateGroup("orders", "group", "$") }()
+	suite.expectCommand("XGROUP", "CREATE", "orders", "group", "$", "MKSTREAM")
+	suite.reply("-BUSYGROUP Consumer Group name already exists\r\n")
+	suite.NoError(<-errChan)
+
+	go func() { errChan <- suite.conn.Ack("orders", "group", "1-0", "2-0") }()
+	suite.expectCommand("XACK", "orders", "group", "1-0", "2-0")
+	suite.reply("-ERR something went wrong\r\n")
+	suite.Error(<-errChan)
+
+	// the connection remains usable
+	go func() { errChan <- suite.conn.Ack("orders", "group", "1-0") }()
+	suite.expectCommand("XACK", "orders", "group", "1-0")
+	suite.reply(":1\r\n")
+	suite.NoError(<-errChan)
+
+	suite.expectOpen()
+}
+
+func (suite *ConnTestSuite) TestMalformedReplyClosesConnection() {
+	for _, reply := range []string{"?what\r\n", "$abc\r\n", "*2\r\n:1\r\n", "+OK\n"} {
+		suite.connect()
+
+		errChan := make(chan error, 1)
+
+		go func() { errChan <- suite.conn.Ack("orders", "group", "1-0") }()
+		suite.expectCommand("XACK", "orders", "group", "1-0")
+		suite.reply(reply)
+
+		// the reply of an array cut short is never completed, so the server hangs up
+		if reply == "*2\r\n:1\r\n" {
+			suite.serverConn.Close()
+		}
+
+		suite.Error(<-errChan, reply)
+
+		select {
+		case <-suite.conn.Done():
+		case <-time.After(5 * time.Second):
+			suite.Fail("Connection not closed on a malformed reply", reply)
+		}
+
+		suite.serverConn.Close()
+	}
+}
+
+func (suite *ConnTestSuite) TestCloseInterruptsBlockingRead() {
+	suite.connect()
+
+	_, errChan := suite.readGroupAsync(time.Minute)
+	suite.expectCommand("XREADGROUP", "GROUP", "group", "consumer", "COUNT", "2", "BLOCK", "60000",
+		"STREAMS", "orders", "payments", ">", ">")
+
+	// never answered
+	suite.conn.Close()
+
+	select {
+	case err := <-errChan:
+		suite.Error(err)
+	case <-time.After(5 * time.Second):
+		suite.Fail("Close didn't interrupt the blocking read")
+	}
+}
+
+// connects to a URL, with the server side of the connection accepted by the test
+func (suite *ConnTestSuite) connectAsync(serverURL string) chan error {
+	connErrChan := make(chan error, 1)
+
+	go func() {
+		var err error
+
+		suite.conn, err = newConn(suite.logger, serverURL)
+		connErrChan <- err
+	}()
+
+	var err error
+
+	suite.serverConn, err = suite.listener.Accept()
+	suite.Require().NoError(err)
+
+	suite.serverConn.SetDeadline(time.Now().Add(10 * time.Second))
+	suite.serverReader = bufio.NewReader(suite.serverConn)
+
+	return connErrChan
+}
+
+// connects without authenticating
+func (suite *ConnTestSuite) connect() {
+	suite.Require().NoError(<-suite.connectAsync("redis://" + suite.listener.Addr().String()))
+}
+
+func (suite *ConnTestSuite) readGroupAsync(block time.Duration) (chan []*Entry, chan error) {
+	entriesChan := make(chan []*Entry, 1)
+	errChan := make(chan error, 1)
+
+	go func() {
+		entries, err := suite.conn.ReadGroup("group", "consumer", []string{"orders", "payments"}, 2, block)
+		entriesChan <- entries
+		errChan <- err
+	}()
+
+	return entriesChan, errChan
+}
+
+func (suite *ConnTestSuite) expectCommand(args ...string) {
+	receivedArgs, err := readCommand(suite.serverReader)
+	suite.Require().NoError(err)
+	suite.Require().Equal(args, receivedArgs)
+}
+
+func (suite *ConnTestSuite) reply(reply string) {
+	_, err := suite.serverConn.Write([]byte(reply))
+	suite.Require().NoError(err)
+}
+
+func (suite *ConnTestSuite) expectOpen() {
+	select {
+	case <-suite.conn.Done():
+		suite.Fail("Connection closed")
+	default:
+	}
+}
+
+func TestConnTestSuite(t *testing.T) {
+	suite.Run(t, new(ConnTestSuite))
+}
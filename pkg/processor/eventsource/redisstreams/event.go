@@ -0,0 +1,66 @@
+package redisstreams
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// allows accessing an Entry. besides the entry's fields (strings), the following headers are available:
+// stream and id (both strings)
+type Event struct {
+	nuclio.AbstractSync
+	entry     *Entry
+	bodyField string
+	headers   map[string]interface{}
+}
+
+func (e *Event) setEntry(entry *Entry) {
+	e.entry = entry
+	e.headers = map[string]interface{}{}
+
+	for fieldName, fieldValue := range entry.Fields {
+		e.headers[fieldName] = fieldValue
+	}
+
+	e.headers["stream"] = entry.Stream
+	e.headers["id"] = entry.ID
+}
+
+func (e *Event) GetBody() []byte {
+	return []byte(e.entry.Fields[e.bodyField])
+}
+
+func (e *Event) GetSize() int {
+	return len(e.entry.Fields[e.bodyField])
+}
+
+// the time the entry was added, which the first part of its ID holds (in milliseconds)
+func (e *Event) GetTimestamp() time.Time {
+	milliseconds, err := strconv.ParseInt(strings.SplitN(e.entry.ID, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, milliseconds*int64(time.Millisecond))
+}
+
+func (e *Event) GetHeader(key string) interface{} {
+	return e.headers[key]
+}
+
+func (e *Event) GetHeaders() map[string]interface{} {
+	return e.headers
+}
+
+func (e *Event) GetHeaderByteSlice(key string) []byte {
+	return []byte(e.GetHeaderString(key))
+}
+
+func (e *Event) GetHeaderString(key string) string {
+	value, _ := e.headers[key].(string)
+
+	return value
+}
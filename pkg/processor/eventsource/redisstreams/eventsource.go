@@ -0,0 +1,385 @@
+package redisstreams
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+)
+
+type redisStreams struct {
+	eventsource.AbstractEventSource
+	configuration *Configuration
+
+	// the clients are replaced when reconnecting, and are accessed under the connection's lock. reads block
+	// their client, so entries are acknowledged and claimed through another
+	connection *eventsource.Connection
+	readClient Client
+	client     Client
+
+	// the entries handed over to the handlers and not handled yet, by stream and ID. these are pending, and
+	// may idle long enough to be claimed - but mustn't be handled again while they're being handled
+	inflightLock    sync.Mutex
+	inflightEntries map[string]bool
+}
+
+func newEventSource(parentLogger nuclio.Logger,
+	workerAllocator worker.WorkerAllocator,
+	configuration *Configuration) (eventsource.EventSource, error) {
+
+	// entries are handled concurrently, so the allocator must be shareable
+	if !workerAllocator.Shareable() {
+		return nil, errors.New("Redis streams event source requires a shareable worker allocator")
+	}
+
+	newEventSource := &redisStreams{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Logger:          parentLogger,
+			WorkerAllocator: workerAllocator,
+			Class:           "async",
+			Kind:            "redis-streams",
+			ID:              configuration.ID,
+			RetryPolicy:     eventsource.NewRetryPolicy(&configuration.Configuration),
+			EventTimeout:    configuration.GetEventTimeout(),
+		},
+		configuration:   configuration,
+		inflightEntries: map[string]bool{},
+	}
+
+	newEventSource.connection = eventsource.NewConnection(parentLogger,
+		time.Duration(configuration.ReconnectBackoffMs)*time.Millisecond,
+		time.Duration(configuration.ReconnectMaxBackoffMs)*time.Millisecond,
+		newEventSource.connect,
+		newEventSource.disconnect)
+
+	return newEventSource, nil
+}
+
+func (rs *redisStreams) Start(checkpoint eventsource.Checkpoint) error {
+	rs.Logger.InfoWith("Starting",
+		"url", rs.configuration.URL,
+		"streams", rs.configuration.Streams,
+		"group", rs.configuration.Group,
+		"consumerName", rs.configuration.ConsumerName,
+		"numWorkers", rs.configuration.NumWorkers)
+
+	// the first connection must succeed, so that misconfiguration is reported on start
+	if err := rs.connection.Start(rs.consume); err != nil {
+		return errors.Wrap(err, "Failed to connect to server")
+	}
+
+	return nil
+}
+
+func (rs *redisStreams) Stop(force bool) (eventsource.Checkpoint, error) {
+	rs.Logger.InfoWith("Stopping", "force", force)
+
+	// interrupt the blocking read and let the entries being processed be acknowledged, unless we're asked not
+	// to wait. entries read and not handled yet remain pending, and are claimed once idle
+	err := rs.connection.Stop(force, func() {
+		if rs.readClient != nil {
+			rs.readClient.Close()
+		}
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to close connection to server")
+	}
+
+	// the group tracks what was delivered and acknowledged
+	return nil, nil
+}
+
+func (rs *redisStreams) GetConnectionState() eventsource.ConnectionState {
+	return rs.connection.GetConnectionState()
+}
+
+// reads and handles the entries of the current connection, until it's lost or we're stopped
+func (rs *redisStreams) consume() {
+	rs.connection.Lock()
+	readClient := rs.readClient
+	client := rs.client
+	rs.connection.Unlock()
+
+	// entries read and claimed are handed over to as many handlers as we have workers
+	entries := make(chan *Entry)
+	readDoneChan := make(chan struct{})
+	handlersWaitGroup := sync.WaitGroup{}
+
+	for handlerIndex := 0; handlerIndex < rs.configuration.NumWorkers; handlerIndex++ {
+		handlersWaitGroup.Add(1)
+
+		go func() {
+			defer handlersWaitGroup.Done()
+
+			rs.handleEntries(client, entries, readDoneChan)
+		}()
+	}
+
+	handlersWaitGroup.Add(1)
+
+	go func() {
+		defer handlersWaitGroup.Done()
+
+		rs.claimEntries(client, entries, readDoneChan)
+	}()
+
+	// entries can't be acknowledged once the other connection is lost, so stop reading
+	go func() {
+		select {
+		case <-client.Done():
+			readClient.Close()
+		case <-readDoneChan:
+		}
+	}()
+
+	// read until the connection is lost or we're stopped, then let the handlers finish with the entries being
+	// processed
+	rs.readEntries(readClient, entries)
+
+	close(readDoneChan)
+	handlersWaitGroup.Wait()
+}
+
+// creates the clients, and the group on all streams. called under the connection's lock
+func (rs *redisStreams) connect() error {
+	readClient, client, err := rs.createClients()
+	if err != nil {
+		return err
+	}
+
+	rs.readClient = readClient
+	rs.client = client
+
+	return nil
+}
+
+func (rs *redisStreams) createClients() (Client, Client, error) {
+	readClient, err := ClientRegistrySingleton.NewClient(rs.Logger,
+		rs.configuration.ClientKind,
+		rs.configuration.URL)
+
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "Failed to create read client")
+	}
+
+	client, err := ClientRegistrySingleton.NewClient(rs.Logger, rs.configuration.ClientKind, rs.configuration.URL)
+	if err != nil {
+		readClient.Close()
+
+		return nil, nil, errors.Wrap(err, "Failed to create client")
+	}
+
+	for _, stream := range rs.configuration.Streams {
+		if err := client.CreateGroup(stream, rs.configuration.Group, rs.configuration.StartID); err != nil {
+
+			// don't leak connections we won't use
+			readClient.Close()
+			client.Close()
+
+			return nil, nil, errors.Wrapf(err, "Failed to create group on %s", stream)
+		}
+	}
+
+	return readClient, client, nil
+}
+
+// called under the connection's lock
+func (rs *redisStreams) disconnect() error {
+
+	// nothing to close if we never connected, or already disconnected
+	if rs.client == nil {
+		return nil
+	}
+
+	readClient := rs.readClient
+	client := rs.client
+	rs.readClient = nil
+	rs.client = nil
+
+	readClient.Close()
+
+	return client.Close()
+}
+
+// reads the entries of all streams, a handful at a time, until the connection is lost or we're stopped
+func (rs *redisStreams) readEntries(readClient Client, entries chan<- *Entry) {
+	block := time.Duration(rs.configuration.BlockMs) * time.Millisecond
+
+	for !rs.connection.Stopped() {
+		readEntries, err := readClient.ReadGroup(rs.configuration.Group,
+			rs.configuration.ConsumerName,
+			rs.configuration.Streams,
+			rs.configuration.NumWorkers,
+			block)
+
+		if err != nil {
+			if !rs.connection.Stopped() {
+				rs.Logger.WarnWith("Failed to read entries", "err", err)
+			}
+
+			return
+		}
+
+		for _, entry := range readEntries {
+			if !rs.handOver(entry, entries, rs.connection.StopChan()) {
+				return
+			}
+		}
+	}
+}
+
+// claims the entries that are pending for too long every claim interval, from all consumers (including
+// us, for entries we failed to handle), and hands those not being handled over to the handlers
+func (rs *redisStreams) claimEntries(client Client, entries chan<- *Entry, readDoneChan <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(rs.configuration.ClaimIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		for _, stream := range rs.configuration.Streams {
+			if !rs.claimStreamEntries(client, stream, entries, readDoneChan) {
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-readDoneChan:
+			return
+		}
+	}
+}
+
+// returns false if the handlers are done
+func (rs *redisStreams) claimStreamEntries(client Client,
+	stream string,
+	entries chan<- *Entry,
+	readDoneChan <-chan struct{}) bool {
+
+	minIdle := time.Duration(rs.configuration.ClaimMinIdleMs) * time.Millisecond
+
+	for start := "0-0"; ; {
+		nextStart, claimedEntries, err := client.AutoClaim(stream,
+			rs.configuration.Group,
+			rs.configuration.ConsumerName,
+			minIdle,
+			start,
+			rs.configuration.NumWorkers)
+
+		if err != nil {
+			rs.Logger.WarnWith("Failed to claim pending entries", "err", err, "stream", stream)
+
+			// try again next interval
+			return true
+		}
+
+		for _, entry := range claimedEntries {
+
+			// deleted from the stream, so there's nothing left to handle
+			if entry.Fields == nil {
+				rs.ack(client, entry)
+				continue
+			}
+
+			// still being handled, e.g. by a handler waiting to retry it
+			if rs.isInflight(entry) {
+				continue
+			}
+
+			rs.Logger.DebugWith("Claimed pending entry", "stream", stream, "id", entry.ID)
+
+			if !rs.handOver(entry, entries, readDoneChan) {
+				return false
+			}
+		}
+
+		if nextStart == "0-0" || nextStart == "" {
+			return true
+		}
+
+		start = nextStart
+	}
+}
+
+// handles entries until reading is done. entries are acknowledged once handled - processed successfully or
+// dead lettered. others remain pending, and are claimed again once idle
+func (rs *redisStreams) handleEntries(client Client, entries <-chan *Entry, readDoneChan <-chan struct{}) {
+	event := Event{
+		bodyField: rs.configuration.BodyField,
+	}
+
+	for {
+		var entry *Entry
+
+		select {
+		case entry = <-entries:
+		case <-readDoneChan:
+			return
+		}
+
+		rs.handleEntry(client, &event, entry)
+	}
+}
+
+func (rs *redisStreams) handleEntry(client Client, event *Event, entry *Entry) {
+	defer rs.setInflight(entry, false)
+
+	// bind to entry
+	event.setEntry(entry)
+
+	// submit to worker. this retries and dead letters the entry according to configuration
+	_, submitError, processError := rs.SubmitEventToWorker(event, rs.configuration.GetWorkerAllocationTimeout())
+
+	if submitError != nil || (processError != nil && !rs.HasDeadLetterSink()) {
+		rs.Logger.WarnWith("Failed to handle entry, leaving it pending",
+			"stream", entry.Stream,
+			"id", entry.ID,
+			"submitError", submitError,
+			"processError", processError)
+
+		return
+	}
+
+	rs.ack(client, entry)
+}
+
+// hands an entry over to the handlers, marking it as in flight until handled. returns false if done first
+func (rs *redisStreams) handOver(entry *Entry, entries chan<- *Entry, doneChan <-chan struct{}) bool {
+	rs.setInflight(entry, true)
+
+	select {
+	case entries <- entry:
+		return true
+	case <-doneChan:
+		rs.setInflight(entry, false)
+		return false
+	}
+}
+
+func (rs *redisStreams) setInflight(entry *Entry, inflight bool) {
+	rs.inflightLock.Lock()
+	defer rs.inflightLock.Unlock()
+
+	if inflight {
+		rs.inflightEntries[entry.Stream+"/"+entry.ID] = true
+	} else {
+		delete(rs.inflightEntries, entry.Stream+"/"+entry.ID)
+	}
+}
+
+func (rs *redisStreams) isInflight(entry *Entry) bool {
+	rs.inflightLock.Lock()
+	defer rs.inflightLock.Unlock()
+
+	return rs.inflightEntries[entry.Stream+"/"+entry.ID]
+}
+
+func (rs *redisStreams) ack(client Client, entry *Entry) {
+	if err := client.Ack(entry.Stream, rs.configuration.Group, entry.ID); err != nil {
+		rs.Logger.WarnWith("Failed to acknowledge entry", "err", err, "stream", entry.Stream, "id", entry.ID)
+	}
+}
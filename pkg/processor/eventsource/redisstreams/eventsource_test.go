@@ -0,0 +1,237 @@
+package redisstreams
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource/eventsourcetest"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+const testGroupName = "nuclio-group"
+
+type processedEntry struct {
+	stream    string
+	id        string
+	body      string
+	headers   map[string]interface{}
+	timestamp time.Time
+}
+
+type EventSourceTestSuite struct {
+	eventsourcetest.AbstractEventSourceTestSuite
+	server  *testServer
+	runtime *eventsourcetest.RecordingRuntime
+}
+
+func (suite *EventSourceTestSuite) SetupTest() {
+	var err error
+
+	suite.server, err = newTestServer("secret")
+	suite.Require().NoError(err)
+
+	// records the entries it processes. fails an entry whose body is "flaky" the first time it's processed,
+	// and takes longer than the claim min idle time to process one whose body is "slow"
+	suite.runtime = eventsourcetest.NewRecordingRuntime(func(event nuclio.Event) interface{} {
+		return processedEntry{
+			stream:    event.GetHeaderString("stream"),
+			id:        event.GetHeaderString("id"),
+			body:      string(event.GetBody()),
+			headers:   event.GetHeaders(),
+			timestamp: event.GetTimestamp(),
+		}
+	}, func(event nuclio.Event, previousRecords []interface{}) (interface{}, error) {
+		if string(event.GetBody()) == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+
+		if string(event.GetBody()) != "flaky" {
+			return nil, nil
+		}
+
+		for _, record := range previousRecords {
+			if record.(processedEntry).id == event.GetHeaderString("id") {
+				return nil, nil
+			}
+		}
+
+		return nil, errors.New("Processing error")
+	})
+}
+
+func (suite *EventSourceTestSuite) TearDownTest() {
+	suite.StopEventSources()
+	suite.server.close()
+}
+
+func (suite *EventSourceTestSuite) TestFieldsAsHeaders() {
+	configuration := suite.createConfiguration("consumer1")
+	configuration.Streams = []string{"orders", "payments"}
+	suite.startEventSource(configuration)
+
+	orderID := suite.server.add("orders", "body", "order", "customer", "alice")
+	suite.server.add("payments", "body", "payment")
+
+	suite.WaitForNumRecords(suite.runtime, 2)
+
+	// the entries of both streams are read
+	processedEntries := suite.getProcessedEntries()
+	if processedEntries[0].stream != "orders" {
+		processedEntries[0], processedEntries[1] = processedEntries[1], processedEntries[0]
+	}
+
+	suite.Equal(orderID, processedEntries[0].id)
+	suite.Equal("order", processedEntries[0].body)
+	suite.Equal("alice", processedEntries[0].headers["customer"])
+	suite.WithinDuration(time.Now(), processedEntries[0].timestamp, time.Minute)
+	suite.Equal("payments", processedEntries[1].stream)
+	suite.Equal("payment", processedEntries[1].body)
+
+	suite.waitForNumPending("orders", 0)
+	suite.waitForNumPending("payments", 0)
+}
+
+func (suite *EventSourceTestSuite) TestFailedEntryClaimed() {
+	suite.startEventSource(suite.createConfiguration("consumer1"))
+
+	id := suite.server.add("orders", "body", "flaky")
+
+	// the entry remains pending until it's claimed and processed again
+	suite.WaitForNumRecords(suite.runtime, 2)
+	suite.waitForNumPending("orders", 0)
+
+	processedEntries := suite.getProcessedEntries()
+	suite.Equal(id, processedEntries[0].id)
+	suite.Equal(id, processedEntries[1].id)
+}
+
+func (suite *EventSourceTestSuite) TestEntryBeingHandledNotClaimed() {
+	suite.startEventSource(suite.createConfiguration("consumer1"))
+
+	suite.server.add("orders", "body", "slow")
+
+	// the entry idles long enough to be claimed while it's handled, but isn't handled again
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.waitForNumPending("orders", 0)
+	suite.ExpectNumRecords(suite.runtime, 1)
+}
+
+func (suite *EventSourceTestSuite) TestEntryOfDeadConsumerClaimed() {
+	suite.server.createGroup("orders", testGroupName)
+	id := suite.server.add("orders", "body", "orphan")
+
+	// delivered to a consumer that died before acknowledging it
+	suite.Len(suite.server.deliver("orders", testGroupName, "dead"), 1)
+
+	suite.startEventSource(suite.createConfiguration("consumer1"))
+
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.waitForNumPending("orders", 0)
+
+	suite.Equal(id, suite.getProcessedEntries()[0].id)
+}
+
+func (suite *EventSourceTestSuite) TestConsumersShareGroup() {
+	suite.startEventSource(suite.createConfiguration("consumer1"))
+	suite.startEventSource(suite.createConfiguration("consumer2"))
+
+	for entryIndex := 0; entryIndex < 10; entryIndex++ {
+		suite.server.add("orders", "body", "order")
+	}
+
+	suite.WaitForNumRecords(suite.runtime, 10)
+	suite.waitForNumPending("orders", 0)
+
+	// each entry is processed by a single consumer
+	processedIDs := map[string]bool{}
+
+	for _, processedEntry := range suite.getProcessedEntries() {
+		processedIDs[processedEntry.id] = true
+	}
+
+	suite.Len(processedIDs, 10)
+}
+
+func (suite *EventSourceTestSuite) TestReconnect() {
+	eventSource := suite.startEventSource(suite.createConfiguration("consumer1"))
+
+	suite.server.disconnectClients()
+
+	suite.server.add("orders", "body", "order")
+
+	suite.WaitForNumRecords(suite.runtime, 1)
+	suite.waitForNumPending("orders", 0)
+
+	suite.Equal(eventsource.ConnectionStateConnected,
+		eventSource.(eventsource.ConnectionStateProvider).GetConnectionState())
+}
+
+func (suite *EventSourceTestSuite) TestAuthentication() {
+	configuration := suite.createConfiguration("consumer1")
+	configuration.URL = suite.server.url("wrong")
+
+	eventSource := suite.createEventSource(configuration)
+
+	err := eventSource.Start(nil)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "WRONGPASS")
+
+	// the connections are closed
+	suite.WaitFor(func() bool { return suite.server.getNumConns() == 0 })
+}
+
+func (suite *EventSourceTestSuite) TestStopWithoutStart() {
+	suite.ExpectStopReturns(suite.createEventSource(suite.createConfiguration("consumer1")))
+}
+
+func (suite *EventSourceTestSuite) createConfiguration(consumerName string) *Configuration {
+	return &Configuration{
+		Configuration:         suite.CreateConfiguration("redis1", 2),
+		ClientKind:            "redis",
+		URL:                   suite.server.url("secret"),
+		Streams:               []string{"orders"},
+		Group:                 testGroupName,
+		ConsumerName:          consumerName,
+		StartID:               "$",
+		BodyField:             "body",
+		BlockMs:               100,
+		ClaimIntervalMs:       20,
+		ClaimMinIdleMs:        50,
+		ReconnectBackoffMs:    10,
+		ReconnectMaxBackoffMs: 100,
+	}
+}
+
+func (suite *EventSourceTestSuite) createEventSource(configuration *Configuration) eventsource.EventSource {
+	eventSource, err := newEventSource(suite.Logger, suite.CreateWorkerAllocator(suite.runtime, 2), configuration)
+	suite.Require().NoError(err)
+
+	return eventSource
+}
+
+// returns once the group was created
+func (suite *EventSourceTestSuite) startEventSource(configuration *Configuration) eventsource.EventSource {
+	return suite.StartEventSource(suite.createEventSource(configuration), nil)
+}
+
+func (suite *EventSourceTestSuite) getProcessedEntries() []processedEntry {
+	var processedEntries []processedEntry
+
+	for _, record := range suite.runtime.GetRecords() {
+		processedEntries = append(processedEntries, record.(processedEntry))
+	}
+
+	return processedEntries
+}
+
+func (suite *EventSourceTestSuite) waitForNumPending(stream string, numPending int) {
+	suite.WaitFor(func() bool { return suite.server.getNumPending(stream, testGroupName) == numPending })
+}
+
+func TestEventSourceTestSuite(t *testing.T) {
+	suite.Run(t, new(EventSourceTestSuite))
+}
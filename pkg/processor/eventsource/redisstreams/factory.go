@@ -0,0 +1,49 @@
+package redisstreams
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	eventSourceConfiguration *viper.Viper,
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (eventsource.EventSource, error) {
+
+	redisStreamsConfiguration, err := newConfiguration(eventSourceConfiguration)
+	if err != nil {
+		return nil, err
+	}
+
+	// create logger parent
+	redisStreamsLogger := parentLogger.GetChild("redis-streams").(nuclio.Logger)
+
+	// entries are processed concurrently, one per worker
+	workerAllocator, err := eventsource.NewWorkerAllocator(redisStreamsLogger,
+		&redisStreamsConfiguration.Configuration,
+		runtimeConfiguration,
+		workerPools)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	// finally, create the event source
+	redisStreamsEventSource, err := newEventSource(redisStreamsLogger, workerAllocator, redisStreamsConfiguration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create Redis streams event source")
+	}
+
+	return redisStreamsEventSource, nil
+}
+
+// register factory
+func init() {
+	eventsource.RegistrySingleton.Register("redis-streams", &factory{})
+}
@@ -0,0 +1,521 @@
+package redisstreams
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// an in-process stand-in for Redis, speaking enough of RESP and of the stream commands for the event source:
+// AUTH, SELECT, XGROUP CREATE, XREADGROUP (of new entries), XACK and XAUTOCLAIM
+type testServer struct {
+	listener net.Listener
+
+	// required of clients, if set
+	password string
+
+	lock    sync.Mutex
+	streams map[string]*testStream
+	conns   map[net.Conn]bool
+
+	// closed and replaced whenever an entry is added, waking blocked reads
+	addedChan chan struct{}
+
+	// the last ID assigned
+	lastMs  int64
+	lastSeq int64
+}
+
+type testStream struct {
+	entries []*Entry
+	groups  map[string]*testGroup
+}
+
+type testGroup struct {
+
+	// the entries up to this index were delivered to the group
+	numDelivered int
+
+	// delivered and not acknowledged, by ID
+	pendingEntries map[string]*testPendingEntry
+}
+
+type testPendingEntry struct {
+	entryIndex  int
+	consumer    string
+	deliveredAt time.Time
+}
+
+// a simple string reply, as opposed to a bulk string
+type testStatus string
+
+func newTestServer(password string) (*testServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &testServer{
+		listener:  listener,
+		password:  password,
+		streams:   map[string]*testStream{},
+		conns:     map[net.Conn]bool{},
+		addedChan: make(chan struct{}),
+	}
+
+	go server.accept()
+
+	return server, nil
+}
+
+func (ts *testServer) url(password string) string {
+	return fmt.Sprintf("redis://:%s@%s/0", password, ts.listener.Addr().String())
+}
+
+func (ts *testServer) close() {
+	ts.listener.Close()
+	ts.disconnectClients()
+}
+
+func (ts *testServer) disconnectClients() {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	for conn := range ts.conns {
+		conn.Close()
+	}
+}
+
+// adds an entry of alternating field names and values, returning its ID
+func (ts *testServer) add(streamName string, fields ...string) string {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	nowMs := time.Now().UnixNano() / int64(time.Millisecond)
+
+	if nowMs > ts.lastMs {
+		ts.lastMs = nowMs
+		ts.lastSeq = 0
+	} else {
+		ts.lastSeq++
+	}
+
+	entry := &Entry{
+		Stream: streamName,
+		ID:     fmt.Sprintf("%d-%d", ts.lastMs, ts.lastSeq),
+		Fields: map[string]string{},
+	}
+
+	for fieldIndex := 0; fieldIndex < len(fields); fieldIndex += 2 {
+		entry.Fields[fields[fieldIndex]] = fields[fieldIndex+1]
+	}
+
+	stream := ts.getStream(streamName)
+	stream.entries = append(stream.entries, entry)
+
+	close(ts.addedChan)
+	ts.addedChan = make(chan struct{})
+
+	return entry.ID
+}
+
+// creates a group reading the stream from its start
+func (ts *testServer) createGroup(streamName string, groupName string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.getStream(streamName).groups[groupName] = &testGroup{
+		pendingEntries: map[string]*testPendingEntry{},
+	}
+}
+
+// delivers the new entries of a stream to a consumer, as a read of the consumer would
+func (ts *testServer) deliver(streamName string, groupName string, consumer string) []*Entry {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	return ts.deliverEntries(streamName, groupName, consumer, 1000)
+}
+
+func (ts *testServer) getNumPending(streamName string, groupName string) int {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	return len(ts.getStream(streamName).groups[groupName].pendingEntries)
+}
+
+func (ts *testServer) getNumConns() int {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	return len(ts.conns)
+}
+
+func (ts *testServer) accept() {
+	for {
+		conn, err := ts.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		ts.lock.Lock()
+		ts.conns[conn] = true
+		ts.lock.Unlock()
+
+		go ts.serve(conn)
+	}
+}
+
+func (ts *testServer) serve(conn net.Conn) {
+	defer func() {
+		ts.lock.Lock()
+		delete(ts.conns, conn)
+		ts.lock.Unlock()
+
+		conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	authenticated := ts.password == ""
+
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		var reply interface{}
+
+		switch {
+		case strings.ToUpper(args[0]) == "AUTH":
+			authenticated = args[len(args)-1] == ts.password
+
+			reply = testStatus("OK")
+			if !authenticated {
+				reply = serverError("WRONGPASS invalid username-password pair or user is disabled.")
+			}
+
+		case !authenticated:
+			reply = serverError("NOAUTH Authentication required.")
+
+		default:
+			reply = ts.execute(args)
+		}
+
+		if _, err := conn.Write(encodeReply(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (ts *testServer) execute(args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "SELECT":
+		return testStatus("OK")
+
+	case "XGROUP":
+		return ts.executeGroupCreate(args)
+
+	case "XREADGROUP":
+		return ts.executeReadGroup(args)
+
+	case "XACK":
+		return ts.executeAck(args)
+
+	case "XAUTOCLAIM":
+		return ts.executeAutoClaim(args)
+	}
+
+	return serverError("ERR unknown command " + args[0])
+}
+
+// XGROUP CREATE <stream> <group> <$ | 0> [MKSTREAM]
+func (ts *testServer) executeGroupCreate(args []string) interface{} {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	streamName, groupName := args[2], args[3]
+
+	if _, found := ts.streams[streamName]; !found && len(args) < 6 {
+		return serverError("ERR The XGROUP subcommand requires the key to exist")
+	}
+
+	stream := ts.getStream(streamName)
+
+	if _, found := stream.groups[groupName]; found {
+		return serverError("BUSYGROUP Consumer Group name already exists")
+	}
+
+	group := &testGroup{
+		pendingEntries: map[string]*testPendingEntry{},
+	}
+
+	if args[4] == "$" {
+		group.numDelivered = len(stream.entries)
+	}
+
+	stream.groups[groupName] = group
+
+	return testStatus("OK")
+}
+
+// XREADGROUP GROUP <group> <consumer> COUNT <count> BLOCK <ms> STREAMS <stream>... >...
+func (ts *testServer) executeReadGroup(args []string) interface{} {
+	groupName, consumer := args[2], args[3]
+	count, _ := strconv.Atoi(args[5])
+	blockMs, _ := strconv.Atoi(args[7])
+	streamNames := args[9 : 9+(len(args)-9)/2]
+
+	deadline := time.Now().Add(time.Duration(blockMs) * time.Millisecond)
+
+	for {
+		ts.lock.Lock()
+
+		var reply []interface{}
+
+		for _, streamName := range streamNames {
+			if _, found := ts.getStream(streamName).groups[groupName]; !found {
+				ts.lock.Unlock()
+
+				return serverError("NOGROUP No such consumer group")
+			}
+
+			if entries := ts.deliverEntries(streamName, groupName, consumer, count); len(entries) != 0 {
+				reply = append(reply, []interface{}{streamName, encodeEntries(entries)})
+			}
+		}
+
+		addedChan := ts.addedChan
+		ts.lock.Unlock()
+
+		if len(reply) != 0 {
+			return reply
+		}
+
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return nil
+		}
+
+		select {
+		case <-addedChan:
+		case <-time.After(remaining):
+		}
+	}
+}
+
+// XACK <stream> <group> <id>...
+func (ts *testServer) executeAck(args []string) interface{} {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	group := ts.getStream(args[1]).groups[args[2]]
+	numAcked := 0
+
+	for _, id := range args[3:] {
+		if _, found := group.pendingEntries[id]; found {
+			delete(group.pendingEntries, id)
+			numAcked++
+		}
+	}
+
+	return numAcked
+}
+
+// XAUTOCLAIM <stream> <group> <consumer> <min idle ms> <start> COUNT <count>
+func (ts *testServer) executeAutoClaim(args []string) interface{} {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	stream := ts.getStream(args[1])
+	group := stream.groups[args[2]]
+	consumer := args[3]
+	minIdleMs, _ := strconv.Atoi(args[4])
+	start := args[5]
+	count, _ := strconv.Atoi(args[7])
+
+	// scan the pending entries in order, from the start
+	var pendingEntries []*testPendingEntry
+
+	for id, pendingEntry := range group.pendingEntries {
+		if compareIDs(id, start) >= 0 {
+			pendingEntries = append(pendingEntries, pendingEntry)
+		}
+	}
+
+	sort.Slice(pendingEntries, func(i, j int) bool {
+		return pendingEntries[i].entryIndex < pendingEntries[j].entryIndex
+	})
+
+	var claimedEntries []*Entry
+
+	nextStart := "0-0"
+
+	for pendingEntryIndex, pendingEntry := range pendingEntries {
+		if pendingEntryIndex == count {
+			nextStart = stream.entries[pendingEntry.entryIndex].ID
+			break
+		}
+
+		if time.Since(pendingEntry.deliveredAt) < time.Duration(minIdleMs)*time.Millisecond {
+			continue
+		}
+
+		pendingEntry.consumer = consumer
+		pendingEntry.deliveredAt = time.Now()
+
+		claimedEntries = append(claimedEntries, stream.entries[pendingEntry.entryIndex])
+	}
+
+	// as of Redis 7, followed by the IDs of deleted entries
+	return []interface{}{nextStart, encodeEntries(claimedEntries), []interface{}{}}
+}
+
+func (ts *testServer) getStream(streamName string) *testStream {
+	stream, found := ts.streams[streamName]
+	if !found {
+		stream = &testStream{
+			groups: map[string]*testGroup{},
+		}
+
+		ts.streams[streamName] = stream
+	}
+
+	return stream
+}
+
+func (ts *testServer) deliverEntries(streamName string, groupName string, consumer string, count int) []*Entry {
+	stream := ts.getStream(streamName)
+	group := stream.groups[groupName]
+
+	var entries []*Entry
+
+	for len(entries) < count && group.numDelivered < len(stream.entries) {
+		entry := stream.entries[group.numDelivered]
+
+		group.pendingEntries[entry.ID] = &testPendingEntry{
+			entryIndex:  group.numDelivered,
+			consumer:    consumer,
+			deliveredAt: time.Now(),
+		}
+
+		entries = append(entries, entry)
+		group.numDelivered++
+	}
+
+	return entries
+}
+
+// reads an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	numArgs, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, numArgs)
+
+	for argIndex := range args {
+		if line, err = reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil, err
+		}
+
+		args[argIndex] = string(arg[:size])
+	}
+
+	return args, nil
+}
+
+func encodeReply(reply interface{}) []byte {
+	switch typedReply := reply.(type) {
+	case nil:
+		return []byte("*-1\r\n")
+
+	case testStatus:
+		return []byte("+" + string(typedReply) + "\r\n")
+
+	case serverError:
+		return []byte("-" + string(typedReply) + "\r\n")
+
+	case int:
+		return []byte(fmt.Sprintf(":%d\r\n", typedReply))
+
+	case string:
+		return []byte(fmt.Sprintf("$%d\r\n%s\r\n", len(typedReply), typedReply))
+
+	case []interface{}:
+		encodedReply := []byte(fmt.Sprintf("*%d\r\n", len(typedReply)))
+
+		for _, element := range typedReply {
+			encodedReply = append(encodedReply, encodeReply(element)...)
+		}
+
+		return encodedReply
+	}
+
+	panic(fmt.Sprintf("Can't encode %T", reply))
+}
+
+// entries are encoded as their ID and their alternating field names and values
+func encodeEntries(entries []*Entry) []interface{} {
+	encodedEntries := []interface{}{}
+
+	for _, entry := range entries {
+		var fields []interface{}
+
+		for fieldName, fieldValue := range entry.Fields {
+			fields = append(fields, fieldName, fieldValue)
+		}
+
+		encodedEntries = append(encodedEntries, []interface{}{entry.ID, fields})
+	}
+
+	return encodedEntries
+}
+
+func compareIDs(id string, otherID string) int {
+	parseID := func(id string) (int64, int64) {
+		parts := strings.SplitN(id, "-", 2)
+		ms, _ := strconv.ParseInt(parts[0], 10, 64)
+
+		var seq int64
+		if len(parts) == 2 {
+			seq, _ = strconv.ParseInt(parts[1], 10, 64)
+		}
+
+		return ms, seq
+	}
+
+	ms, seq := parseID(id)
+	otherMs, otherSeq := parseID(otherID)
+
+	switch {
+	case ms < otherMs || ms == otherMs && seq < otherSeq:
+		return -1
+	case ms == otherMs && seq == otherSeq:
+		return 0
+	}
+
+	return 1
+}
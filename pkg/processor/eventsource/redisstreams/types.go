@@ -0,0 +1,138 @@
+package redisstreams
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type Configuration struct {
+	eventsource.Configuration
+	ClientKind string
+
+	// redis://[[user]:password@]host[:port][/db]
+	URL string
+
+	// the streams read, by all consumers of the group. replicas of a function share the group, and each
+	// consumes as a differently named consumer
+	Streams      []string
+	Group        string
+	ConsumerName string
+
+	// where a group created by us starts reading the streams: $ - new entries only, 0 - all entries
+	StartID string
+
+	// the field holding the event body. all fields are available as headers
+	BodyField string
+
+	// how long a read waits for entries to arrive before reading again
+	BlockMs int
+
+	// entries pending (delivered and not acknowledged) for longer than the min idle time - since they
+	// failed, or since their consumer died - are claimed every claim interval and handled again. the min idle
+	// time must be longer than handling an entry may take (all attempts timing out, and the backoffs between
+	// them) so that entries being handled aren't claimed by other consumers. without an event timeout, this
+	// is up to the handler
+	ClaimIntervalMs int
+	ClaimMinIdleMs  int
+
+	// the wait before the first reconnection attempt. doubles with every attempt, up to the max
+	ReconnectBackoffMs    int
+	ReconnectMaxBackoffMs int
+}
+
+func newConfiguration(eventSourceConfiguration *viper.Viper) (*Configuration, error) {
+	// defaults. replicas of a function share the event source ID, and so the group - but each must
+	// consume under its own name
+	hostname, _ := os.Hostname()
+
+	eventSourceConfiguration.SetDefault("client", "redis")
+	eventSourceConfiguration.SetDefault("url", "redis://127.0.0.1:6379")
+	eventSourceConfiguration.SetDefault("group", "nuclio-"+eventSourceConfiguration.GetString("id"))
+	eventSourceConfiguration.SetDefault("consumer_name", fmt.Sprintf("nuclio-%s-%s",
+		eventSourceConfiguration.GetString("id"),
+		hostname))
+	eventSourceConfiguration.SetDefault("start_id", "$")
+	eventSourceConfiguration.SetDefault("body_field", "body")
+	eventSourceConfiguration.SetDefault("block_ms", 5000)
+	eventSourceConfiguration.SetDefault("claim_interval_ms", 30000)
+	eventSourceConfiguration.SetDefault("claim_min_idle_ms", 60000)
+	eventSourceConfiguration.SetDefault("reconnect_backoff_ms", 500)
+	eventSourceConfiguration.SetDefault("reconnect_max_backoff_ms", 30000)
+
+	// validate and read the configuration
+	configuration, err := eventsource.NewConfiguration(eventSourceConfiguration, eventsource.Schema{
+		"client":                   eventsource.ValueTypeString,
+		"url":                      eventsource.ValueTypeString,
+		"streams":                  eventsource.ValueTypeStringSlice,
+		"topic":                    eventsource.ValueTypeString,
+		"group":                    eventsource.ValueTypeString,
+		"consumer_name":            eventsource.ValueTypeString,
+		"start_id":                 eventsource.ValueTypeString,
+		"body_field":               eventsource.ValueTypeString,
+		"block_ms":                 eventsource.ValueTypeInt,
+		"claim_interval_ms":        eventsource.ValueTypeInt,
+		"claim_min_idle_ms":        eventsource.ValueTypeInt,
+		"reconnect_backoff_ms":     eventsource.ValueTypeInt,
+		"reconnect_max_backoff_ms": eventsource.ValueTypeInt,
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration")
+	}
+
+	redisStreamsConfiguration := &Configuration{
+		Configuration:         *configuration,
+		ClientKind:            eventSourceConfiguration.GetString("client"),
+		URL:                   eventSourceConfiguration.GetString("url"),
+		Streams:               eventSourceConfiguration.GetStringSlice("streams"),
+		Group:                 eventSourceConfiguration.GetString("group"),
+		ConsumerName:          eventSourceConfiguration.GetString("consumer_name"),
+		StartID:               eventSourceConfiguration.GetString("start_id"),
+		BodyField:             eventSourceConfiguration.GetString("body_field"),
+		BlockMs:               eventSourceConfiguration.GetInt("block_ms"),
+		ClaimIntervalMs:       eventSourceConfiguration.GetInt("claim_interval_ms"),
+		ClaimMinIdleMs:        eventSourceConfiguration.GetInt("claim_min_idle_ms"),
+		ReconnectBackoffMs:    eventSourceConfiguration.GetInt("reconnect_backoff_ms"),
+		ReconnectMaxBackoffMs: eventSourceConfiguration.GetInt("reconnect_max_backoff_ms"),
+	}
+
+	// the topic key may be used for a single stream
+	if len(redisStreamsConfiguration.Streams) == 0 && eventSourceConfiguration.GetString("topic") != "" {
+		redisStreamsConfiguration.Streams = []string{eventSourceConfiguration.GetString("topic")}
+	}
+
+	if len(redisStreamsConfiguration.Streams) == 0 {
+		return nil, fmt.Errorf("Redis streams event source %s requires streams", configuration.ID)
+	}
+
+	if redisStreamsConfiguration.BlockMs <= 0 {
+		return nil, errors.New("Block must be positive")
+	}
+
+	if redisStreamsConfiguration.ClaimIntervalMs <= 0 {
+		return nil, errors.New("Claim interval must be positive")
+	}
+
+	// an entry must not be claimed (by another consumer) while it's still being handled
+	claimMinIdle := time.Duration(redisStreamsConfiguration.ClaimMinIdleMs) * time.Millisecond
+	maxHandlingTime := eventsource.NewRetryPolicy(configuration).GetMaxHandlingTime(configuration.GetEventTimeout())
+
+	if claimMinIdle <= maxHandlingTime {
+		return nil, fmt.Errorf("Redis streams event source %s requires a claim_min_idle_ms greater than "+
+			"event_timeout_ms * (retries + 1) plus the retry backoffs (%s)",
+			configuration.ID,
+			maxHandlingTime)
+	}
+
+	if redisStreamsConfiguration.ReconnectBackoffMs <= 0 {
+		return nil, errors.New("Reconnect backoff must be positive")
+	}
+
+	return redisStreamsConfiguration, nil
+}
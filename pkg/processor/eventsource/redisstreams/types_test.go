@@ -0,0 +1,74 @@
+package redisstreams
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigurationTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ConfigurationTestSuite) TestDefaults() {
+	configuration, err := newConfiguration(suite.readConfiguration(`
+id: redis1
+topic: orders
+`))
+
+	suite.Require().NoError(err)
+	suite.Equal([]string{"orders"}, configuration.Streams)
+	suite.Equal("nuclio-redis1", configuration.Group)
+	suite.Contains(configuration.ConsumerName, "nuclio-redis1-")
+	suite.Equal("$", configuration.StartID)
+	suite.Equal(60000, configuration.ClaimMinIdleMs)
+}
+
+func (suite *ConfigurationTestSuite) TestClaimMinIdleExceedsHandling() {
+	for _, testCase := range []struct {
+		configuration string
+		valid         bool
+	}{
+
+		// 3 attempts of 10 seconds, and 1 + 2 seconds between them
+		{"event_timeout_ms: 10000\nretries: 2\nretry_backoff_ms: 1000\nclaim_min_idle_ms: 33001", true},
+		{"event_timeout_ms: 10000\nretries: 2\nretry_backoff_ms: 1000\nclaim_min_idle_ms: 33000", false},
+		{"event_timeout_ms: 60000\nclaim_min_idle_ms: 60000", false},
+
+		// without an event timeout, only the backoffs are known
+		{"retries: 1\nretry_backoff_ms: 1000\nclaim_min_idle_ms: 1001", true},
+	} {
+		_, err := newConfiguration(suite.readConfiguration("id: redis1\nstreams: [orders]\n" + testCase.configuration))
+
+		if testCase.valid {
+			suite.NoError(err, testCase.configuration)
+		} else {
+			suite.Require().Error(err, testCase.configuration)
+			suite.Contains(err.Error(), "redis1", testCase.configuration)
+			suite.Contains(err.Error(), "claim_min_idle_ms", testCase.configuration)
+		}
+	}
+}
+
+func (suite *ConfigurationTestSuite) TestRequiresStreams() {
+	_, err := newConfiguration(suite.readConfiguration(`
+id: redis1
+`))
+
+	suite.Error(err)
+}
+
+func (suite *ConfigurationTestSuite) readConfiguration(contents string) *viper.Viper {
+	configuration := viper.New()
+	configuration.SetConfigType("yaml")
+
+	suite.Require().NoError(configuration.ReadConfig(bytes.NewBufferString(contents)))
+
+	return configuration
+}
+
+func TestConfigurationTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigurationTestSuite))
+}
@@ -2,15 +2,18 @@ package eventsource
 
 import (
 	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
 	"github.com/nuclio/nuclio/pkg/util/registry"
 
 	"github.com/spf13/viper"
 )
 
+// creators are given the worker pools the processor created, by name, which event sources may share
 type Creator interface {
 	Create(logger nuclio.Logger,
 		eventSourceConfiguration *viper.Viper,
-		runtimeConfiguration *viper.Viper) (EventSource, error)
+		runtimeConfiguration *viper.Viper,
+		workerPools map[string]*worker.WorkerPool) (EventSource, error)
 }
 
 type Registry struct {
@@ -25,14 +28,19 @@ var RegistrySingleton = Registry{
 func (r *Registry) NewEventSource(logger nuclio.Logger,
 	kind string,
 	eventSourceConfiguration *viper.Viper,
-	runtimeConfiguration *viper.Viper) (EventSource, error) {
+	runtimeConfiguration *viper.Viper,
+	workerPools map[string]*worker.WorkerPool) (EventSource, error) {
 
 	registree, err := r.Get(kind)
 	if err != nil {
 		return nil, err
 	}
 
+	// events are given the function's deadline, unless the event source overrides it
+	eventSourceConfiguration.SetDefault("event_timeout_ms", runtimeConfiguration.GetInt("event_timeout_ms"))
+
 	return registree.(Creator).Create(logger,
 		eventSourceConfiguration,
-		runtimeConfiguration)
+		runtimeConfiguration,
+		workerPools)
 }
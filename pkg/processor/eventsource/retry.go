@@ -0,0 +1,49 @@
+package eventsource
+
+import (
+	"time"
+)
+
+// how an event source retries events whose processing failed
+type RetryPolicy struct {
+	MaxRetries int
+
+	// the wait before the first retry. doubles with every subsequent retry, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func NewRetryPolicy(configuration *Configuration) *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries: configuration.Retries,
+		Backoff:    time.Duration(configuration.RetryBackoffMs) * time.Millisecond,
+		MaxBackoff: time.Duration(configuration.RetryMaxBackoffMs) * time.Millisecond,
+	}
+}
+
+// returns how long to wait before a given retry (the first retry is 1)
+func (rp *RetryPolicy) GetBackoff(retry int) time.Duration {
+	backoff := rp.Backoff
+
+	for retryIndex := 1; retryIndex < retry && backoff < rp.MaxBackoff; retryIndex++ {
+		backoff *= 2
+	}
+
+	if rp.MaxBackoff != 0 && backoff > rp.MaxBackoff {
+		return rp.MaxBackoff
+	}
+
+	return backoff
+}
+
+// returns the longest handling an event may take - all attempts timing out, and the backoffs between them. an
+// attemptTimeout of zero (no timeout) only counts the backoffs
+func (rp *RetryPolicy) GetMaxHandlingTime(attemptTimeout time.Duration) time.Duration {
+	maxHandlingTime := time.Duration(rp.MaxRetries+1) * attemptTimeout
+
+	for retry := 1; retry <= rp.MaxRetries; retry++ {
+		maxHandlingTime += rp.GetBackoff(retry)
+	}
+
+	return maxHandlingTime
+}
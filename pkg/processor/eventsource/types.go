@@ -1,13 +1,239 @@
 package eventsource
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+)
+
+// the type of value a configuration key holds
+type ValueType int
+
+const (
+	ValueTypeString ValueType = iota
+	ValueTypeInt
+	ValueTypeBool
+	ValueTypeStringSlice
+	ValueTypeMap
+)
+
+// maps configuration keys to the type of value they hold. every event source kind declares the keys it
+// accepts on top of the ones common to all event sources
+type Schema map[string]ValueType
+
+// keys common to all event sources. keys only some kinds honor (e.g. topic) are declared by those kinds, so
+// that setting them for other kinds is an error rather than silently ignored
+var commonSchema = Schema{
+	"id":                           ValueTypeString,
+	"kind":                         ValueTypeString,
+	"class":                        ValueTypeString,
+	"enabled":                      ValueTypeBool,
+	"num_workers":                  ValueTypeInt,
+	"worker_allocator":             ValueTypeString,
+	"min_workers":                  ValueTypeInt,
+	"max_workers":                  ValueTypeInt,
+	"worker_idle_timeout_ms":       ValueTypeInt,
+	"worker_pool":                  ValueTypeString,
+	"worker_pool_weight":           ValueTypeInt,
+	"worker_allocation_timeout_ms": ValueTypeInt,
+	"event_timeout_ms":             ValueTypeInt,
+	"retries":                      ValueTypeInt,
+	"retry_backoff_ms":             ValueTypeInt,
+	"retry_max_backoff_ms":         ValueTypeInt,
+	"dlq":                          ValueTypeString,
+}
+
+const (
+	WorkerAllocatorFixedPool = "fixed_pool"
+	WorkerAllocatorElastic   = "elastic"
+)
 
 type Configuration struct {
-	ID string
+	ID         string
+	Kind       string
+	Class      string
+	Enabled    bool
+	NumWorkers int
+
+	// fixed_pool (num_workers workers) or elastic (between min_workers and max_workers workers, torn down
+	// once idle for worker_idle_timeout_ms)
+	WorkerAllocator     string
+	MinWorkers          int
+	WorkerIdleTimeoutMs int
+
+	// the name of a worker pool, declared in the processor's worker_pools, shared with other event sources.
+	// the worker allocator keys are ignored, and num_workers is the number of events handled concurrently
+	WorkerPool       string
+	WorkerPoolWeight int
+
+	// how long an event waits for a worker
+	WorkerAllocationTimeoutMs int
+
+	// how long a worker may take to process an event before the event is abandoned (0 - no deadline).
+	// defaults to the function's event_timeout_ms
+	EventTimeoutMs int
+
+	Retries           int
+	RetryBackoffMs    int
+	RetryMaxBackoffMs int
+
+	// where events that failed processing after all retries are written to. a URL whose scheme selects
+	// the sink (e.g. file:///var/log/nuclio/dlq, amqp://host/?exchange=dlq) or the ID of another event
+	// source, through which dead letters are published
+	DLQ string
 }
 
-func NewConfiguration(configuration *viper.Viper) *Configuration {
+// validates the configuration against the common schema augmented by the keys of a specific kind and
+// returns the populated common configuration
+func NewConfiguration(configuration *viper.Viper, kindSchema Schema) (*Configuration, error) {
+
+	// defaults
+	configuration.SetDefault("enabled", true)
+	configuration.SetDefault("num_workers", 1)
+	configuration.SetDefault("retry_backoff_ms", 100)
+	configuration.SetDefault("retry_max_backoff_ms", 10000)
+	configuration.SetDefault("worker_allocator", WorkerAllocatorFixedPool)
+	configuration.SetDefault("min_workers", 1)
+	configuration.SetDefault("worker_idle_timeout_ms", 60000)
+	configuration.SetDefault("worker_pool_weight", 1)
+	configuration.SetDefault("worker_allocation_timeout_ms", 10000)
+
+	if err := kindSchema.Merge(commonSchema).Validate(configuration); err != nil {
+		return nil, err
+	}
+
+	switch configuration.GetString("worker_allocator") {
+	case WorkerAllocatorFixedPool:
+	case WorkerAllocatorElastic:
+
+		// event sources size their concurrency by the number of workers, which for an elastic pool is the
+		// most it grows to
+		configuration.SetDefault("max_workers", configuration.GetInt("num_workers"))
+		configuration.Set("num_workers", configuration.GetInt("max_workers"))
+
+	default:
+		return nil, fmt.Errorf("Unknown worker allocator %s in event source %s",
+			configuration.GetString("worker_allocator"),
+			configuration.GetString("id"))
+	}
+
 	return &Configuration{
-		ID: configuration.GetString("ID"),
+		ID:                        configuration.GetString("id"),
+		Kind:                      configuration.GetString("kind"),
+		Class:                     configuration.GetString("class"),
+		Enabled:                   configuration.GetBool("enabled"),
+		NumWorkers:                configuration.GetInt("num_workers"),
+		WorkerAllocator:           configuration.GetString("worker_allocator"),
+		MinWorkers:                configuration.GetInt("min_workers"),
+		WorkerIdleTimeoutMs:       configuration.GetInt("worker_idle_timeout_ms"),
+		WorkerPool:                configuration.GetString("worker_pool"),
+		WorkerPoolWeight:          configuration.GetInt("worker_pool_weight"),
+		WorkerAllocationTimeoutMs: configuration.GetInt("worker_allocation_timeout_ms"),
+		EventTimeoutMs:            configuration.GetInt("event_timeout_ms"),
+		Retries:                   configuration.GetInt("retries"),
+		RetryBackoffMs:            configuration.GetInt("retry_backoff_ms"),
+		RetryMaxBackoffMs:         configuration.GetInt("retry_max_backoff_ms"),
+		DLQ:                       configuration.GetString("dlq"),
+	}, nil
+}
+
+func (c *Configuration) GetWorkerAllocationTimeout() time.Duration {
+	return time.Duration(c.WorkerAllocationTimeoutMs) * time.Millisecond
+}
+
+func (c *Configuration) GetEventTimeout() time.Duration {
+	return time.Duration(c.EventTimeoutMs) * time.Millisecond
+}
+
+// returns whether an event source is enabled. event sources are enabled unless explicitly disabled
+func IsEnabled(configuration *viper.Viper) (bool, error) {
+	if !configuration.IsSet("enabled") {
+		return true, nil
 	}
+
+	enabled, err := cast.ToBoolE(configuration.Get("enabled"))
+	if err != nil {
+		return false, errors.Wrapf(err,
+			"Invalid value for key enabled in event source %s",
+			configuration.GetString("id"))
+	}
+
+	return enabled, nil
+}
+
+// returns a schema holding the keys of both schemas
+func (s Schema) Merge(other Schema) Schema {
+	mergedSchema := Schema{}
+
+	for _, schema := range []Schema{s, other} {
+		for key, valueType := range schema {
+			mergedSchema[key] = valueType
+		}
+	}
+
+	return mergedSchema
+}
+
+// returns an error naming the event source and the key if the configuration holds a key not in the schema
+// or a value that can't be converted to the type of its key
+func (s Schema) Validate(configuration *viper.Viper) error {
+	eventSourceID := configuration.GetString("id")
+
+	// sort so that the first offending key is reported consistently
+	keys := configuration.AllKeys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+
+		// nested keys (e.g. options.foo) are validated by their root key, which must be a map
+		rootKey := strings.SplitN(key, ".", 2)[0]
+
+		valueType, found := s[rootKey]
+		if !found {
+			return fmt.Errorf("Unknown key %s in event source %s", rootKey, eventSourceID)
+		}
+
+		if rootKey != key {
+			if valueType != ValueTypeMap {
+				return fmt.Errorf("Invalid value for key %s in event source %s: not a map", rootKey, eventSourceID)
+			}
+
+			continue
+		}
+
+		if err := s.validateValue(configuration.Get(key), valueType); err != nil {
+			return errors.Wrapf(err, "Invalid value for key %s in event source %s", key, eventSourceID)
+		}
+	}
+
+	return nil
+}
+
+func (s Schema) validateValue(value interface{}, valueType ValueType) error {
+	var err error
+
+	// keys explicitly set to null are treated as unset
+	if value == nil {
+		return nil
+	}
+
+	switch valueType {
+	case ValueTypeString:
+		_, err = cast.ToStringE(value)
+	case ValueTypeInt:
+		_, err = cast.ToIntE(value)
+	case ValueTypeBool:
+		_, err = cast.ToBoolE(value)
+	case ValueTypeStringSlice:
+		_, err = cast.ToStringSliceE(value)
+	case ValueTypeMap:
+		_, err = cast.ToStringMapE(value)
+	}
+
+	return err
 }
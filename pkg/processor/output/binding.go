@@ -0,0 +1,281 @@
+package output
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/util/common"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// fields are updated atomically and must be read with atomic.LoadUint64
+type Statistics struct {
+	MessagesDelivered uint64
+	MessagesFailed    uint64
+	MessagesRetried   uint64
+
+	// messages that were never written, since the queue was full
+	MessagesDropped uint64
+}
+
+// an output, as declared in the function's output bindings, along with how writes to it are retried.
+// messages are queued and written by a go routine of the binding, so that a slow or failing output (e.g.
+// while retrying) doesn't hold up the processing of events
+type Binding struct {
+	Name        string
+	Kind        string
+	logger      nuclio.Logger
+	output      Output
+	retryPolicy *eventsource.RetryPolicy
+	statistics  Statistics
+	queue       chan *Message
+
+	// writes are rejected once closed, since the queue is closed
+	closedLock sync.RWMutex
+	closed     bool
+
+	// closed once the binding is closing, to stop retrying, and once the queue is drained
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+func NewBinding(parentLogger nuclio.Logger,
+	name string,
+	kind string,
+	output Output,
+	retryPolicy *eventsource.RetryPolicy,
+	queueSize int) *Binding {
+
+	newBinding := &Binding{
+		Name:        name,
+		Kind:        kind,
+		logger:      parentLogger.GetChild(name).(nuclio.Logger),
+		output:      output,
+		retryPolicy: retryPolicy,
+		queue:       make(chan *Message, queueSize),
+		stopChan:    make(chan struct{}),
+		doneChan:    make(chan struct{}),
+	}
+
+	go newBinding.deliver()
+
+	return newBinding
+}
+
+// queues a message to be written to the output. the message is dropped if the queue is full
+func (b *Binding) Write(message *Message) error {
+	b.closedLock.RLock()
+	defer b.closedLock.RUnlock()
+
+	if b.closed {
+		return fmt.Errorf("Output %s is closed", b.Name)
+	}
+
+	select {
+	case b.queue <- message:
+		return nil
+	default:
+		atomic.AddUint64(&b.statistics.MessagesDropped, 1)
+		return fmt.Errorf("Queue of output %s is full, dropping message", b.Name)
+	}
+}
+
+// stops accepting messages and closes the output once the queued messages are written, or the timeout
+// passes. queued messages are written once, without retrying, so that a failing output doesn't hold up
+// stopping
+func (b *Binding) Close(timeout time.Duration) error {
+	b.closedLock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.queue)
+		close(b.stopChan)
+	}
+	b.closedLock.Unlock()
+
+	select {
+	case <-b.doneChan:
+	case <-time.After(timeout):
+		b.logger.WarnWith("Timed out writing queued messages", "numQueued", len(b.queue))
+	}
+
+	return b.output.Close()
+}
+
+func (b *Binding) GetStatistics() *Statistics {
+	return &b.statistics
+}
+
+// returns the number of messages waiting to be written
+func (b *Binding) GetNumQueuedMessages() int {
+	return len(b.queue)
+}
+
+func (b *Binding) deliver() {
+	defer close(b.doneChan)
+
+	for message := range b.queue {
+		if err := b.write(message); err != nil {
+			b.logger.WarnWith("Failed to write message", "eventID", message.EventID, "err", err)
+		}
+	}
+}
+
+// writes a message to the output, retrying according to the retry policy until closed
+func (b *Binding) write(message *Message) error {
+	for attempt := 1; ; attempt++ {
+		err := b.output.Write(message)
+		if err == nil {
+			atomic.AddUint64(&b.statistics.MessagesDelivered, 1)
+			return nil
+		}
+
+		if attempt > b.retryPolicy.MaxRetries || b.stopping() {
+			atomic.AddUint64(&b.statistics.MessagesFailed, 1)
+			return errors.Wrapf(err, "Failed to write to output %s after %d attempts", b.Name, attempt)
+		}
+
+		atomic.AddUint64(&b.statistics.MessagesRetried, 1)
+
+		b.logger.DebugWith("Retrying write", "attempt", attempt, "err", err)
+
+		select {
+		case <-time.After(b.retryPolicy.GetBackoff(attempt)):
+		case <-b.stopChan:
+		}
+	}
+}
+
+func (b *Binding) stopping() bool {
+	select {
+	case <-b.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// writes the responses of processed events to all of the function's outputs
+type Bindings struct {
+	logger   nuclio.Logger
+	bindings []*Binding
+}
+
+// creates the outputs declared in the function's output_bindings. each binding has a unique name, a kind
+// and the configuration of that kind, e.g.:
+//
+//	output_bindings:
+//	- name: results
+//	  kind: file
+//	  path: /var/log/nuclio/results.json
+//	  retries: 3
+//	  queue_size: 1000
+func NewBindings(parentLogger nuclio.Logger, runtimeConfiguration *viper.Viper) (*Bindings, error) {
+	newBindings := Bindings{
+		logger: parentLogger.GetChild("outputs").(nuclio.Logger),
+	}
+
+	bindingNames := map[string]bool{}
+
+	for bindingIndex, bindingFields := range common.GetObjectSlice(runtimeConfiguration, "output_bindings") {
+		bindingConfiguration := viper.New()
+
+		for fieldName, fieldValue := range bindingFields {
+			bindingConfiguration.Set(fieldName, fieldValue)
+		}
+
+		// defaults
+		bindingConfiguration.SetDefault("name", fmt.Sprintf("output%d", bindingIndex))
+		bindingConfiguration.SetDefault("retries", 0)
+		bindingConfiguration.SetDefault("retry_backoff_ms", 100)
+		bindingConfiguration.SetDefault("retry_max_backoff_ms", 10000)
+		bindingConfiguration.SetDefault("queue_size", 1000)
+
+		name := bindingConfiguration.GetString("name")
+		kind := bindingConfiguration.GetString("kind")
+
+		if bindingNames[name] {
+			return nil, fmt.Errorf("Output binding name %s is used more than once", name)
+		}
+
+		bindingNames[name] = true
+
+		if kind == "" {
+			return nil, fmt.Errorf("Output binding %s has no kind", name)
+		}
+
+		if bindingConfiguration.GetInt("queue_size") < 1 {
+			return nil, fmt.Errorf("Output binding %s must have a positive queue size", name)
+		}
+
+		output, err := RegistrySingleton.NewOutput(newBindings.logger, kind, bindingConfiguration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create output %s", name)
+		}
+
+		newBindings.bindings = append(newBindings.bindings, NewBinding(newBindings.logger,
+			name,
+			kind,
+			output,
+			&eventsource.RetryPolicy{
+				MaxRetries: bindingConfiguration.GetInt("retries"),
+				Backoff:    time.Duration(bindingConfiguration.GetInt("retry_backoff_ms")) * time.Millisecond,
+				MaxBackoff: time.Duration(bindingConfiguration.GetInt("retry_max_backoff_ms")) * time.Millisecond,
+			},
+			bindingConfiguration.GetInt("queue_size")))
+	}
+
+	return &newBindings, nil
+}
+
+// queues the response to all outputs, even if queueing to some fails. returns the first error
+func (b *Bindings) Write(eventSourceID string, event nuclio.Event, response interface{}) error {
+	var firstError error
+
+	message, err := NewMessage(eventSourceID, event, response)
+	if err != nil {
+		return err
+	}
+
+	for _, binding := range b.bindings {
+		if err := binding.Write(message); err != nil && firstError == nil {
+			firstError = err
+		}
+	}
+
+	return firstError
+}
+
+// closes all outputs in parallel, each once its queued messages are written or the timeout passes
+func (b *Bindings) Close(timeout time.Duration) error {
+	var closeWaitGroup sync.WaitGroup
+
+	closeErrors := make(chan error, len(b.bindings))
+
+	for _, binding := range b.bindings {
+		closeWaitGroup.Add(1)
+
+		go func(binding *Binding) {
+			defer closeWaitGroup.Done()
+
+			if err := binding.Close(timeout); err != nil {
+				closeErrors <- errors.Wrapf(err, "Failed to close output %s", binding.Name)
+			}
+		}(binding)
+	}
+
+	closeWaitGroup.Wait()
+	close(closeErrors)
+
+	// return the first error
+	return <-closeErrors
+}
+
+func (b *Bindings) GetBindings() []*Binding {
+	return b.bindings
+}
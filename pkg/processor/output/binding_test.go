@@ -0,0 +1,281 @@
+package output
+
+import (
+	"bytes"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockOutput struct {
+	mock.Mock
+}
+
+func (mo *MockOutput) Write(message *Message) error {
+	args := mo.Called(message)
+	return args.Error(0)
+}
+
+func (mo *MockOutput) Close() error {
+	args := mo.Called()
+	return args.Error(0)
+}
+
+// always returns the output of the current test
+type mockOutputFactory struct {
+	output *MockOutput
+}
+
+func (mof *mockOutputFactory) Create(logger nuclio.Logger, configuration *viper.Viper) (Output, error) {
+	return mof.output, nil
+}
+
+var mockOutputFactorySingleton = mockOutputFactory{}
+
+type BindingTestSuite struct {
+	suite.Suite
+	logger      nuclio.Logger
+	mockOutput  *MockOutput
+	outputError error
+}
+
+func (suite *BindingTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.outputError = errors.New("Output error")
+}
+
+func (suite *BindingTestSuite) SetupTest() {
+	suite.mockOutput = &MockOutput{}
+	mockOutputFactorySingleton.output = suite.mockOutput
+}
+
+func (suite *BindingTestSuite) TestRetrySucceeds() {
+	binding := suite.createBinding(2, 10)
+	message := &Message{}
+
+	// fail once, then succeed
+	suite.mockOutput.On("Write", message).Return(suite.outputError).Once()
+	suite.mockOutput.On("Write", message).Return(nil).Once()
+	suite.mockOutput.On("Close").Return(nil).Once()
+
+	suite.NoError(binding.Write(message))
+	suite.waitForWrittenMessages(binding, 1)
+	suite.NoError(binding.Close(time.Second))
+
+	suite.Equal(uint64(1), binding.GetStatistics().MessagesDelivered)
+	suite.Equal(uint64(1), binding.GetStatistics().MessagesRetried)
+	suite.Equal(uint64(0), binding.GetStatistics().MessagesFailed)
+
+	suite.mockOutput.AssertExpectations(suite.T())
+}
+
+func (suite *BindingTestSuite) TestRetryExhausted() {
+	binding := suite.createBinding(2, 10)
+	message := &Message{}
+
+	// fail on all 3 attempts (1 + 2 retries)
+	suite.mockOutput.On("Write", message).Return(suite.outputError).Times(3)
+	suite.mockOutput.On("Close").Return(nil).Once()
+
+	suite.NoError(binding.Write(message))
+	suite.waitForWrittenMessages(binding, 1)
+	suite.NoError(binding.Close(time.Second))
+
+	suite.Equal(uint64(0), binding.GetStatistics().MessagesDelivered)
+	suite.Equal(uint64(2), binding.GetStatistics().MessagesRetried)
+	suite.Equal(uint64(1), binding.GetStatistics().MessagesFailed)
+
+	suite.mockOutput.AssertExpectations(suite.T())
+}
+
+func (suite *BindingTestSuite) TestFullQueueDropsMessages() {
+	binding := suite.createBinding(0, 1)
+	releaseChan := make(chan time.Time)
+
+	// the first message is written once released, holding the second in the queue
+	suite.mockOutput.On("Write", mock.Anything).Return(nil).WaitUntil(releaseChan)
+	suite.mockOutput.On("Close").Return(nil).Once()
+
+	suite.NoError(binding.Write(&Message{}))
+
+	for binding.GetNumQueuedMessages() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	suite.NoError(binding.Write(&Message{}))
+	suite.Error(binding.Write(&Message{}))
+	suite.Equal(1, binding.GetNumQueuedMessages())
+
+	// writing doesn't wait for the output
+	close(releaseChan)
+	suite.NoError(binding.Close(time.Second))
+
+	suite.Equal(uint64(2), binding.GetStatistics().MessagesDelivered)
+	suite.Equal(uint64(1), binding.GetStatistics().MessagesDropped)
+
+	// nothing is queued once closed
+	suite.Error(binding.Write(&Message{}))
+}
+
+func (suite *BindingTestSuite) TestCloseStopsRetrying() {
+	binding := NewBinding(suite.logger, "test", "mock", suite.mockOutput, &eventsource.RetryPolicy{
+		MaxRetries: 10,
+		Backoff:    time.Hour,
+		MaxBackoff: time.Hour,
+	}, 10)
+
+	message := &Message{}
+
+	suite.mockOutput.On("Write", message).Return(suite.outputError)
+	suite.mockOutput.On("Close").Return(nil).Once()
+
+	suite.NoError(binding.Write(message))
+
+	for atomic.LoadUint64(&binding.GetStatistics().MessagesRetried) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the backoff is cut short, and the message is failed after one more attempt
+	closeStartTime := time.Now()
+	suite.NoError(binding.Close(5 * time.Second))
+	suite.True(time.Since(closeStartTime) < time.Second)
+
+	suite.Equal(uint64(1), binding.GetStatistics().MessagesFailed)
+	suite.mockOutput.AssertNumberOfCalls(suite.T(), "Write", 2)
+	suite.mockOutput.AssertCalled(suite.T(), "Close")
+}
+
+func (suite *BindingTestSuite) TestBindings() {
+	bindings, err := NewBindings(suite.logger, suite.readConfiguration(`
+output_bindings:
+- name: first
+  kind: mock
+- kind: mock
+  retries: 3
+`))
+
+	suite.Require().NoError(err)
+	suite.Require().Len(bindings.GetBindings(), 2)
+	suite.Equal("first", bindings.GetBindings()[0].Name)
+	suite.Equal("mock", bindings.GetBindings()[0].Kind)
+	suite.Equal("output1", bindings.GetBindings()[1].Name)
+	suite.Equal(3, bindings.GetBindings()[1].retryPolicy.MaxRetries)
+
+	event := &nuclio.AbstractSync{}
+	event.SetID(nuclio.NewID())
+
+	// each output gets the response
+	suite.mockOutput.On("Write", mock.MatchedBy(func(message *Message) bool {
+		return message.EventSourceID == "http1" &&
+			message.EventID != "" &&
+			message.ContentType == "text/plain" &&
+			string(message.Body) == "response"
+	})).Return(nil).Twice()
+
+	suite.mockOutput.On("Close").Return(nil).Twice()
+
+	suite.NoError(bindings.Write("http1", event, nuclio.Response{
+		ContentType: "text/plain",
+		Body:        []byte("response"),
+	}))
+
+	// the outputs are closed once the queued messages are written
+	suite.NoError(bindings.Close(time.Second))
+
+	suite.mockOutput.AssertExpectations(suite.T())
+}
+
+func (suite *BindingTestSuite) TestInvalidBindings() {
+	_, err := NewBindings(suite.logger, suite.readConfiguration(`
+output_bindings:
+- name: first
+  kind: mock
+- name: first
+  kind: mock
+`))
+
+	suite.Error(err)
+
+	_, err = NewBindings(suite.logger, suite.readConfiguration(`
+output_bindings:
+- name: first
+`))
+
+	suite.Error(err)
+
+	_, err = NewBindings(suite.logger, suite.readConfiguration(`
+output_bindings:
+- name: first
+  kind: unknown
+`))
+
+	suite.Error(err)
+}
+
+func (suite *BindingTestSuite) TestNewMessage() {
+	event := &nuclio.AbstractSync{}
+
+	message, err := NewMessage("http1", event, []byte("raw"))
+	suite.Require().NoError(err)
+	suite.Equal([]byte("raw"), message.Body)
+	suite.Equal("", message.EventID)
+
+	message, err = NewMessage("http1", event, "text")
+	suite.Require().NoError(err)
+	suite.Equal([]byte("text"), message.Body)
+
+	// other types are encoded as JSON
+	message, err = NewMessage("http1", event, map[string]int{"a": 1})
+	suite.Require().NoError(err)
+	suite.Equal("application/json", message.ContentType)
+	suite.Equal(`{"a":1}`, string(message.Body))
+}
+
+func (suite *BindingTestSuite) createBinding(retries int, queueSize int) *Binding {
+	return NewBinding(suite.logger, "test", "mock", suite.mockOutput, &eventsource.RetryPolicy{
+		MaxRetries: retries,
+		Backoff:    time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	}, queueSize)
+}
+
+// waits for the given number of messages to be delivered or failed
+func (suite *BindingTestSuite) waitForWrittenMessages(binding *Binding, numMessages uint64) {
+	deadline := time.Now().Add(5 * time.Second)
+
+	for atomic.LoadUint64(&binding.GetStatistics().MessagesDelivered)+
+		atomic.LoadUint64(&binding.GetStatistics().MessagesFailed) < numMessages {
+
+		if time.Now().After(deadline) {
+			suite.FailNow("Timed out waiting for messages to be written")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (suite *BindingTestSuite) readConfiguration(contents string) *viper.Viper {
+	configuration := viper.New()
+	configuration.SetConfigType("yaml")
+
+	suite.Require().NoError(configuration.ReadConfig(bytes.NewBufferString(contents)))
+
+	return configuration
+}
+
+func init() {
+	RegistrySingleton.Register("mock", &mockOutputFactorySingleton)
+}
+
+func TestBindingTestSuite(t *testing.T) {
+	suite.Run(t, new(BindingTestSuite))
+}
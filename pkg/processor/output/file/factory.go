@@ -0,0 +1,21 @@
+package file
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	configuration *viper.Viper) (output.Output, error) {
+
+	return NewOutput(parentLogger, configuration.GetString("path"))
+}
+
+// register factory
+func init() {
+	output.RegistrySingleton.Register("file", &factory{})
+}
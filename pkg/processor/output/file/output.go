@@ -0,0 +1,61 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+
+	"github.com/pkg/errors"
+)
+
+// appends messages to a local file, one JSON document per line
+type fileOutput struct {
+	logger nuclio.Logger
+	lock   sync.Mutex
+	file   *os.File
+}
+
+func NewOutput(parentLogger nuclio.Logger, path string) (output.Output, error) {
+	if path == "" {
+		return nil, errors.New("File output requires a path")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "Failed to create output directory")
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open %s", path)
+	}
+
+	return &fileOutput{
+		logger: parentLogger.GetChild("file").(nuclio.Logger),
+		file:   file,
+	}, nil
+}
+
+func (fo *fileOutput) Write(message *output.Message) error {
+	encodedMessage, err := json.Marshal(message)
+	if err != nil {
+		return errors.Wrap(err, "Failed to encode message")
+	}
+
+	fo.lock.Lock()
+	defer fo.lock.Unlock()
+
+	_, err = fo.file.Write(append(encodedMessage, '\n'))
+
+	return err
+}
+
+func (fo *fileOutput) Close() error {
+	fo.lock.Lock()
+	defer fo.lock.Unlock()
+
+	return fo.file.Close()
+}
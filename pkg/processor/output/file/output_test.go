@@ -0,0 +1,65 @@
+package file
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type OutputTestSuite struct {
+	suite.Suite
+	logger  nuclio.Logger
+	tempDir string
+}
+
+func (suite *OutputTestSuite) SetupTest() {
+	var err error
+
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.tempDir, err = ioutil.TempDir("", "output-test")
+	suite.Require().NoError(err)
+}
+
+func (suite *OutputTestSuite) TearDownTest() {
+	os.RemoveAll(suite.tempDir)
+}
+
+func (suite *OutputTestSuite) TestWrite() {
+	path := filepath.Join(suite.tempDir, "outputs", "results.json")
+
+	fileOutput, err := NewOutput(suite.logger, path)
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(fileOutput.Write(&output.Message{EventSourceID: "http1", Body: []byte("first")}))
+	suite.Require().NoError(fileOutput.Write(&output.Message{EventSourceID: "http1", Body: []byte("second")}))
+
+	contents, err := ioutil.ReadFile(path)
+	suite.Require().NoError(err)
+
+	// one message per line
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	suite.Require().Len(lines, 2)
+
+	message := output.Message{}
+	suite.Require().NoError(json.Unmarshal([]byte(lines[1]), &message))
+	suite.Equal("http1", message.EventSourceID)
+	suite.Equal([]byte("second"), message.Body)
+}
+
+func (suite *OutputTestSuite) TestNoPath() {
+	_, err := NewOutput(suite.logger, "")
+	suite.Error(err)
+}
+
+func TestOutputTestSuite(t *testing.T) {
+	suite.Run(t, new(OutputTestSuite))
+}
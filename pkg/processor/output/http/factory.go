@@ -0,0 +1,32 @@
+package http
+
+import (
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	configuration *viper.Viper) (output.Output, error) {
+
+	// defaults
+	configuration.SetDefault("method", "POST")
+	configuration.SetDefault("timeout_ms", 10000)
+
+	return NewOutput(parentLogger, &Configuration{
+		URL:     configuration.GetString("url"),
+		Method:  configuration.GetString("method"),
+		Headers: configuration.GetStringMapString("headers"),
+		Timeout: time.Duration(configuration.GetInt("timeout_ms")) * time.Millisecond,
+	})
+}
+
+// register factory
+func init() {
+	output.RegistrySingleton.Register("http", &factory{})
+}
@@ -0,0 +1,102 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	net_http "net/http"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// identify the event whose response is delivered
+	eventSourceIDHeader = "X-Nuclio-Event-Source-Id"
+	eventIDHeader       = "X-Nuclio-Event-Id"
+)
+
+type Configuration struct {
+	URL    string
+	Method string
+
+	// sent with every request, overriding the headers of the response
+	Headers map[string]string
+
+	Timeout time.Duration
+}
+
+// sends messages to a webhook. any status other than 2xx is a failure
+type httpOutput struct {
+	logger        nuclio.Logger
+	configuration *Configuration
+	client        *net_http.Client
+}
+
+func NewOutput(parentLogger nuclio.Logger, configuration *Configuration) (output.Output, error) {
+	if configuration.URL == "" {
+		return nil, errors.New("HTTP output requires a URL")
+	}
+
+	return &httpOutput{
+		logger:        parentLogger.GetChild("http").(nuclio.Logger),
+		configuration: configuration,
+		client: &net_http.Client{
+			Timeout: configuration.Timeout,
+		},
+	}, nil
+}
+
+func (ho *httpOutput) Write(message *output.Message) error {
+	request, err := net_http.NewRequest(ho.configuration.Method,
+		ho.configuration.URL,
+		bytes.NewReader(message.Body))
+
+	if err != nil {
+		return errors.Wrap(err, "Failed to create request")
+	}
+
+	for headerKey, headerValue := range message.Headers {
+		request.Header.Set(headerKey, headerValue)
+	}
+
+	if message.ContentType != "" {
+		request.Header.Set("Content-Type", message.ContentType)
+	}
+
+	request.Header.Set(eventSourceIDHeader, message.EventSourceID)
+
+	if message.EventID != "" {
+		request.Header.Set(eventIDHeader, message.EventID)
+	}
+
+	for headerKey, headerValue := range ho.configuration.Headers {
+		request.Header.Set(headerKey, headerValue)
+	}
+
+	response, err := ho.client.Do(request)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to send request to %s", ho.configuration.URL)
+	}
+
+	// drain the body so that the connection can be reused
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("Got unexpected status %d from %s", response.StatusCode, ho.configuration.URL)
+	}
+
+	return nil
+}
+
+func (ho *httpOutput) Close() error {
+	ho.client.CloseIdleConnections()
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package http
+
+import (
+	"io/ioutil"
+	net_http "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type OutputTestSuite struct {
+	suite.Suite
+	logger         nuclio.Logger
+	server         *httptest.Server
+	responseStatus int
+	lastRequest    *net_http.Request
+	lastBody       []byte
+}
+
+func (suite *OutputTestSuite) SetupTest() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.responseStatus = net_http.StatusOK
+
+	suite.server = httptest.NewServer(net_http.HandlerFunc(func(responseWriter net_http.ResponseWriter,
+		request *net_http.Request) {
+
+		suite.lastRequest = request
+		suite.lastBody, _ = ioutil.ReadAll(request.Body)
+
+		responseWriter.WriteHeader(suite.responseStatus)
+	}))
+}
+
+func (suite *OutputTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *OutputTestSuite) TestWrite() {
+	httpOutput := suite.createOutput()
+
+	err := httpOutput.Write(&output.Message{
+		EventSourceID: "rmq1",
+		EventID:       "event-1",
+		ContentType:   "application/json",
+		Headers:       map[string]string{"X-Response": "response", "Authorization": "from-response"},
+		Body:          []byte(`{"a": 1}`),
+	})
+
+	suite.Require().NoError(err)
+	suite.Equal("POST", suite.lastRequest.Method)
+	suite.Equal(`{"a": 1}`, string(suite.lastBody))
+	suite.Equal("application/json", suite.lastRequest.Header.Get("Content-Type"))
+	suite.Equal("response", suite.lastRequest.Header.Get("X-Response"))
+	suite.Equal("rmq1", suite.lastRequest.Header.Get("X-Nuclio-Event-Source-Id"))
+	suite.Equal("event-1", suite.lastRequest.Header.Get("X-Nuclio-Event-Id"))
+
+	// configured headers override those of the response
+	suite.Equal("Bearer token", suite.lastRequest.Header.Get("Authorization"))
+}
+
+func (suite *OutputTestSuite) TestUnexpectedStatus() {
+	httpOutput := suite.createOutput()
+	suite.responseStatus = net_http.StatusBadGateway
+
+	suite.Error(httpOutput.Write(&output.Message{Body: []byte("body")}))
+}
+
+func (suite *OutputTestSuite) createOutput() output.Output {
+	httpOutput, err := NewOutput(suite.logger, &Configuration{
+		URL:     suite.server.URL,
+		Method:  "POST",
+		Headers: map[string]string{"Authorization": "Bearer token"},
+		Timeout: time.Second,
+	})
+
+	suite.Require().NoError(err)
+
+	return httpOutput
+}
+
+func TestOutputTestSuite(t *testing.T) {
+	suite.Run(t, new(OutputTestSuite))
+}
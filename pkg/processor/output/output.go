@@ -0,0 +1,95 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/util/registry"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// delivers handler responses to a downstream target (e.g. a message broker, a file, a webhook)
+type Output interface {
+	Write(message *Message) error
+
+	// release the resources held by the output (e.g. a connection). called once nothing writes to it
+	Close() error
+}
+
+// a handler response, normalized for delivery
+type Message struct {
+	EventSourceID string            `json:"event_source_id"`
+	EventID       string            `json:"event_id,omitempty"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          []byte            `json:"body"`
+}
+
+// creates a message from the response to an event. responses that aren't a nuclio.Response, a byte slice
+// or a string are encoded as JSON
+func NewMessage(eventSourceID string, event nuclio.Event, response interface{}) (*Message, error) {
+	message := Message{
+		EventSourceID: eventSourceID,
+	}
+
+	if event.GetID() != nil {
+		message.EventID = fmt.Sprintf("%s", *event.GetID())
+	}
+
+	switch typedResponse := response.(type) {
+	case nuclio.Response:
+		message.ContentType = typedResponse.ContentType
+		message.Headers = typedResponse.Headers
+		message.Body = typedResponse.Body
+
+	case []byte:
+		message.Body = typedResponse
+
+	case string:
+		message.Body = []byte(typedResponse)
+
+	default:
+		body, err := json.Marshal(typedResponse)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to encode response")
+		}
+
+		message.ContentType = "application/json"
+		message.Body = body
+	}
+
+	return &message, nil
+}
+
+//
+// Output registry
+// Outputs are keyed by the kind declared in their binding (e.g. file)
+//
+
+type Creator interface {
+	Create(logger nuclio.Logger, configuration *viper.Viper) (Output, error)
+}
+
+type Registry struct {
+	registry.Registry
+}
+
+// global singleton
+var RegistrySingleton = Registry{
+	Registry: *registry.NewRegistry("output"),
+}
+
+func (r *Registry) NewOutput(logger nuclio.Logger,
+	kind string,
+	configuration *viper.Viper) (Output, error) {
+
+	registree, err := r.Get(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	return registree.(Creator).Create(logger, configuration)
+}
@@ -0,0 +1,25 @@
+package rabbitmq
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	configuration *viper.Viper) (output.Output, error) {
+
+	return NewOutput(parentLogger, &Configuration{
+		BrokerUrl:          configuration.GetString("url"),
+		BrokerExchangeName: configuration.GetString("exchange"),
+		RoutingKey:         configuration.GetString("routing_key"),
+	})
+}
+
+// register factory
+func init() {
+	output.RegistrySingleton.Register("rabbit-mq", &factory{})
+}
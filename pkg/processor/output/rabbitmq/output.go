@@ -0,0 +1,118 @@
+package rabbitmq
+
+import (
+	"sync"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+type Configuration struct {
+	BrokerUrl string
+
+	// the default exchange (empty) routes by queue name, so the routing key is the name of a queue
+	BrokerExchangeName string
+	RoutingKey         string
+}
+
+// publishes messages to an exchange. the connection is created on first write, and recreated on the
+// write following a failure
+type rabbitMqOutput struct {
+	logger        nuclio.Logger
+	configuration *Configuration
+	lock          sync.Mutex
+	brokerConn    *amqp.Connection
+	brokerChannel *amqp.Channel
+}
+
+func NewOutput(parentLogger nuclio.Logger, configuration *Configuration) (output.Output, error) {
+	if configuration.BrokerUrl == "" {
+		return nil, errors.New("Rabbit-mq output requires a URL")
+	}
+
+	if configuration.BrokerExchangeName == "" && configuration.RoutingKey == "" {
+		return nil, errors.New("Rabbit-mq output requires an exchange or a routing key")
+	}
+
+	return &rabbitMqOutput{
+		logger:        parentLogger.GetChild("rabbitMq").(nuclio.Logger),
+		configuration: configuration,
+	}, nil
+}
+
+func (rmqo *rabbitMqOutput) Write(message *output.Message) error {
+	rmqo.lock.Lock()
+	defer rmqo.lock.Unlock()
+
+	if rmqo.brokerChannel == nil {
+		if err := rmqo.connect(); err != nil {
+			return err
+		}
+	}
+
+	headers := amqp.Table{}
+	for headerKey, headerValue := range message.Headers {
+		headers[headerKey] = headerValue
+	}
+
+	err := rmqo.brokerChannel.Publish(rmqo.configuration.BrokerExchangeName,
+		rmqo.configuration.RoutingKey,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType: message.ContentType,
+			Headers:     headers,
+			Body:        message.Body,
+			MessageId:   message.EventID,
+		})
+
+	// the connection or channel may have closed, so reconnect on the next write
+	if err != nil {
+		rmqo.disconnect()
+
+		return errors.Wrap(err, "Failed to publish message")
+	}
+
+	return nil
+}
+
+func (rmqo *rabbitMqOutput) Close() error {
+	rmqo.lock.Lock()
+	defer rmqo.lock.Unlock()
+
+	rmqo.disconnect()
+
+	return nil
+}
+
+func (rmqo *rabbitMqOutput) connect() error {
+	var err error
+
+	rmqo.logger.DebugWith("Connecting", "brokerUrl", rmqo.configuration.BrokerUrl)
+
+	rmqo.brokerConn, err = amqp.Dial(rmqo.configuration.BrokerUrl)
+	if err != nil {
+		return errors.Wrap(err, "Failed to create connection to broker")
+	}
+
+	rmqo.brokerChannel, err = rmqo.brokerConn.Channel()
+	if err != nil {
+		rmqo.disconnect()
+
+		return errors.Wrap(err, "Failed to create channel")
+	}
+
+	return nil
+}
+
+func (rmqo *rabbitMqOutput) disconnect() {
+	if rmqo.brokerConn != nil {
+		rmqo.brokerConn.Close()
+	}
+
+	rmqo.brokerConn = nil
+	rmqo.brokerChannel = nil
+}
@@ -0,0 +1,391 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/suite"
+)
+
+// AMQP frame types, and the octet ending each frame
+const (
+	frameMethod = 1
+	frameHeader = 2
+	frameBody   = 3
+	frameEnd    = 0xce
+)
+
+// a message published to the fake broker
+type publishedMessage struct {
+	exchange    string
+	routingKey  string
+	contentType string
+	headers     map[string]string
+	messageID   string
+	body        []byte
+}
+
+// speaks just enough AMQP 0-9-1 to accept connections, channels and publishes
+type fakeBroker struct {
+	listener      net.Listener
+	publishedChan chan *publishedMessage
+	connsLock     sync.Mutex
+	conns         []net.Conn
+}
+
+func newFakeBroker() (*fakeBroker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	broker := &fakeBroker{
+		listener:      listener,
+		publishedChan: make(chan *publishedMessage, 16),
+	}
+
+	go broker.accept()
+
+	return broker, nil
+}
+
+func (fb *fakeBroker) url() string {
+	return "amqp://guest:guest@" + fb.listener.Addr().String()
+}
+
+func (fb *fakeBroker) close() {
+	fb.listener.Close()
+	fb.closeConnections()
+}
+
+// drops all connections, as a restarting broker would
+func (fb *fakeBroker) closeConnections() {
+	fb.connsLock.Lock()
+	defer fb.connsLock.Unlock()
+
+	for _, conn := range fb.conns {
+		conn.Close()
+	}
+
+	fb.conns = nil
+}
+
+func (fb *fakeBroker) accept() {
+	for {
+		conn, err := fb.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		fb.connsLock.Lock()
+		fb.conns = append(fb.conns, conn)
+		fb.connsLock.Unlock()
+
+		go fb.serve(conn)
+	}
+}
+
+func (fb *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	// protocol header
+	if _, err := io.ReadFull(reader, make([]byte, 8)); err != nil {
+		return
+	}
+
+	start := fakeBrokerEncoder{}
+	start.putUint8(0)
+	start.putUint8(9)
+	start.putUint32(0) // server properties
+	start.putLongString("PLAIN")
+	start.putLongString("en_US")
+
+	fb.writeMethod(conn, 0, 10, 10, start.Bytes())
+
+	var message *publishedMessage
+
+	for {
+		frameType, channel, payload, err := fb.readFrame(reader)
+		if err != nil {
+			return
+		}
+
+		payloadReader := bytes.NewReader(payload)
+
+		switch frameType {
+		case frameMethod:
+			var classID, methodID uint16
+			binary.Read(payloadReader, binary.BigEndian, &classID)
+			binary.Read(payloadReader, binary.BigEndian, &methodID)
+
+			switch {
+
+			// connection.start-ok, replied with connection.tune
+			case classID == 10 && methodID == 11:
+				tune := fakeBrokerEncoder{}
+				tune.putUint16(0)
+				tune.putUint32(131072)
+				tune.putUint16(0)
+
+				fb.writeMethod(conn, 0, 10, 30, tune.Bytes())
+
+			// connection.open
+			case classID == 10 && methodID == 40:
+				fb.writeMethod(conn, 0, 10, 41, []byte{0})
+
+			// connection.close
+			case classID == 10 && methodID == 50:
+				fb.writeMethod(conn, 0, 10, 51, nil)
+				return
+
+			// channel.open
+			case classID == 20 && methodID == 10:
+				fb.writeMethod(conn, channel, 20, 11, []byte{0, 0, 0, 0})
+
+			// channel.close
+			case classID == 20 && methodID == 40:
+				fb.writeMethod(conn, channel, 20, 41, nil)
+
+			// basic.publish, followed by a content header and body frames
+			case classID == 60 && methodID == 40:
+				payloadReader.Seek(2, io.SeekCurrent)
+
+				message = &publishedMessage{headers: map[string]string{}}
+				message.exchange = readShortString(payloadReader)
+				message.routingKey = readShortString(payloadReader)
+			}
+
+		case frameHeader:
+			var bodySize uint64
+			var propertyFlags uint16
+
+			payloadReader.Seek(4, io.SeekCurrent)
+			binary.Read(payloadReader, binary.BigEndian, &bodySize)
+			binary.Read(payloadReader, binary.BigEndian, &propertyFlags)
+
+			// only the properties set by the output are expected
+			if propertyFlags&0x8000 != 0 {
+				message.contentType = readShortString(payloadReader)
+			}
+
+			if propertyFlags&0x2000 != 0 {
+				var tableSize uint32
+				binary.Read(payloadReader, binary.BigEndian, &tableSize)
+
+				for tableReader := io.LimitReader(payloadReader, int64(tableSize)); ; {
+					key := readShortString(tableReader)
+					if key == "" {
+						break
+					}
+
+					// the value type, always a long string
+					tableReader.Read(make([]byte, 1))
+					message.headers[key] = readLongString(tableReader)
+				}
+			}
+
+			if propertyFlags&0x0080 != 0 {
+				message.messageID = readShortString(payloadReader)
+			}
+
+			if bodySize == 0 {
+				fb.publishedChan <- message
+			}
+
+		case frameBody:
+			message.body = append(message.body, payload...)
+
+			fb.publishedChan <- message
+		}
+	}
+}
+
+func (fb *fakeBroker) readFrame(reader io.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	// the payload and the frame end octet
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1], nil
+}
+
+func (fb *fakeBroker) writeMethod(writer io.Writer, channel uint16, classID uint16, methodID uint16, args []byte) {
+	frame := fakeBrokerEncoder{}
+	frame.putUint8(frameMethod)
+	frame.putUint16(channel)
+	frame.putUint32(uint32(4 + len(args)))
+	frame.putUint16(classID)
+	frame.putUint16(methodID)
+	frame.Write(args)
+	frame.putUint8(frameEnd)
+
+	writer.Write(frame.Bytes())
+}
+
+type fakeBrokerEncoder struct {
+	bytes.Buffer
+}
+
+func (fbe *fakeBrokerEncoder) putUint8(value uint8) {
+	fbe.WriteByte(value)
+}
+
+func (fbe *fakeBrokerEncoder) putUint16(value uint16) {
+	binary.Write(fbe, binary.BigEndian, value)
+}
+
+func (fbe *fakeBrokerEncoder) putUint32(value uint32) {
+	binary.Write(fbe, binary.BigEndian, value)
+}
+
+func (fbe *fakeBrokerEncoder) putLongString(value string) {
+	fbe.putUint32(uint32(len(value)))
+	fbe.WriteString(value)
+}
+
+func readShortString(reader io.Reader) string {
+	length := make([]byte, 1)
+	if _, err := io.ReadFull(reader, length); err != nil {
+		return ""
+	}
+
+	value := make([]byte, length[0])
+	io.ReadFull(reader, value)
+
+	return string(value)
+}
+
+func readLongString(reader io.Reader) string {
+	var length uint32
+	binary.Read(reader, binary.BigEndian, &length)
+
+	value := make([]byte, length)
+	io.ReadFull(reader, value)
+
+	return string(value)
+}
+
+type OutputTestSuite struct {
+	suite.Suite
+	logger nuclio.Logger
+	broker *fakeBroker
+}
+
+func (suite *OutputTestSuite) SetupTest() {
+	var err error
+
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	suite.broker, err = newFakeBroker()
+	suite.Require().NoError(err)
+}
+
+func (suite *OutputTestSuite) TearDownTest() {
+	suite.broker.close()
+}
+
+func (suite *OutputTestSuite) TestWrite() {
+	rmqOutput := suite.createOutput(suite.broker.url())
+	defer rmqOutput.Close()
+
+	err := rmqOutput.Write(&output.Message{
+		EventID:     "event-1",
+		ContentType: "application/json",
+		Headers:     map[string]string{"X-Response": "response"},
+		Body:        []byte(`{"a": 1}`),
+	})
+
+	suite.Require().NoError(err)
+
+	message := suite.waitForPublishedMessage()
+	suite.Equal("responses", message.exchange)
+	suite.Equal("results", message.routingKey)
+	suite.Equal("application/json", message.contentType)
+	suite.Equal(map[string]string{"X-Response": "response"}, message.headers)
+	suite.Equal("event-1", message.messageID)
+	suite.Equal(`{"a": 1}`, string(message.body))
+}
+
+func (suite *OutputTestSuite) TestReconnectAfterFailure() {
+	rmqOutput := suite.createOutput(suite.broker.url())
+	defer rmqOutput.Close()
+
+	suite.Require().NoError(rmqOutput.Write(&output.Message{Body: []byte("first")}))
+	suite.Equal("first", string(suite.waitForPublishedMessage().body))
+
+	// wait for the client to notice the broker dropped the connection
+	closeChan := rmqOutput.(*rabbitMqOutput).brokerConn.NotifyClose(make(chan *amqp.Error, 1))
+	suite.broker.closeConnections()
+	<-closeChan
+
+	// the write on the dropped connection fails, and the next one reconnects
+	suite.Error(rmqOutput.Write(&output.Message{Body: []byte("lost")}))
+	suite.Require().NoError(rmqOutput.Write(&output.Message{Body: []byte("second")}))
+	suite.Equal("second", string(suite.waitForPublishedMessage().body))
+}
+
+func (suite *OutputTestSuite) TestWriteUnreachableBroker() {
+	url := suite.broker.url()
+	suite.broker.close()
+
+	rmqOutput := suite.createOutput(url)
+
+	suite.Error(rmqOutput.Write(&output.Message{Body: []byte("body")}))
+
+	// closing without a connection is harmless
+	suite.NoError(rmqOutput.Close())
+}
+
+func (suite *OutputTestSuite) TestInvalidConfiguration() {
+	_, err := NewOutput(suite.logger, &Configuration{RoutingKey: "results"})
+	suite.Error(err)
+
+	_, err = NewOutput(suite.logger, &Configuration{BrokerUrl: suite.broker.url()})
+	suite.Error(err)
+}
+
+func (suite *OutputTestSuite) createOutput(url string) output.Output {
+	rmqOutput, err := NewOutput(suite.logger, &Configuration{
+		BrokerUrl:          url,
+		BrokerExchangeName: "responses",
+		RoutingKey:         "results",
+	})
+
+	suite.Require().NoError(err)
+
+	return rmqOutput
+}
+
+func (suite *OutputTestSuite) waitForPublishedMessage() *publishedMessage {
+	select {
+	case message := <-suite.broker.publishedChan:
+		return message
+	case <-time.After(5 * time.Second):
+		suite.FailNow("Timed out waiting for a published message")
+	}
+
+	return nil
+}
+
+func TestOutputTestSuite(t *testing.T) {
+	suite.Run(t, new(OutputTestSuite))
+}
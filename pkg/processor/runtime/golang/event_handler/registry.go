@@ -15,3 +15,7 @@ var EventHandlers = EventHandlerRegistry{
 func (ehr *EventHandlerRegistry) Add(name string, eventHandler EventHandler) {
 	ehr.Register(name, eventHandler)
 }
+
+func (ehr *EventHandlerRegistry) AddWithContext(name string, eventHandler ContextEventHandler) {
+	ehr.Register(name, eventHandler)
+}
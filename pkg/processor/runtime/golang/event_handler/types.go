@@ -1,7 +1,15 @@
 package golangruntimeeventhandler
 
 import (
+	"context"
+
 	"github.com/nuclio/nuclio-sdk"
 )
 
 type EventHandler func(context *nuclio.Context, event nuclio.Event) (interface{}, error)
+
+// a handler that's also given the event's context, which is done once the event's deadline expires. it
+// should return when the context is done, since the runtime can't interrupt it
+type ContextEventHandler func(ctx context.Context,
+	context *nuclio.Context,
+	event nuclio.Event) (interface{}, error)
@@ -1,6 +1,7 @@
 package golang
 
 import (
+	"context"
 	"fmt"
 
 	nuclio "github.com/nuclio/nuclio-sdk"
@@ -13,7 +14,7 @@ import (
 type golang struct {
 	runtime.AbstractRuntime
 	configuration *Configuration
-	eventHandler  golangruntimeeventhandler.EventHandler
+	eventHandler  golangruntimeeventhandler.ContextEventHandler
 }
 
 func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runtime.Runtime, error) {
@@ -38,17 +39,32 @@ func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runti
 		return nil, err
 	}
 
-	// create the command string
 	newGoRuntime := &golang{
 		AbstractRuntime: *runtime.NewAbstractRuntime(runtimeLogger, &configuration.Configuration),
 		configuration:   configuration,
-		eventHandler:    eventHandler.(golangruntimeeventhandler.EventHandler),
+	}
+
+	switch typedEventHandler := eventHandler.(type) {
+	case golangruntimeeventhandler.ContextEventHandler:
+		newGoRuntime.eventHandler = typedEventHandler
+
+	// handlers unaware of the context simply aren't given it
+	case golangruntimeeventhandler.EventHandler:
+		newGoRuntime.eventHandler = func(ctx context.Context,
+			nuclioContext *nuclio.Context,
+			event nuclio.Event) (interface{}, error) {
+
+			return typedEventHandler(nuclioContext, event)
+		}
+
+	default:
+		return nil, errors.Errorf("Handler %s is not an event handler", handlerName)
 	}
 
 	return newGoRuntime, nil
 }
 
-func (g *golang) ProcessEvent(event nuclio.Event) (response interface{}, err error) {
+func (g *golang) ProcessEvent(ctx context.Context, event nuclio.Event) (response interface{}, err error) {
 	defer func() {
 		if perr := recover(); perr != nil {
 			response = nil
@@ -57,8 +73,13 @@ func (g *golang) ProcessEvent(event nuclio.Event) (response interface{}, err err
 		}
 	}()
 
+	// don't bother with events abandoned before they got to us
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	// call the registered event handler
-	response, err = g.eventHandler(g.Context, event)
+	response, err = g.eventHandler(ctx, g.Context, event)
 	if err != nil {
 		return nil, errors.Wrap(err, "Event handler returned error")
 	}
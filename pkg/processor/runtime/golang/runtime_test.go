@@ -1,37 +1,71 @@
 package golang
 
 import (
+	"context"
 	"log"
 	"testing"
+	"time"
 
-	"github.com/nuclio/nuclio-sdk/event"
 	"github.com/nuclio/nuclio/pkg/processor/runtime"
 	golangruntimeeventhandler "github.com/nuclio/nuclio/pkg/processor/runtime/golang/event_handler"
 	nucliozap "github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/pkg/errors"
 )
 
-func panicHandler(ctx *runtime.Context, event event.Event) (interface{}, error) {
+func panicHandler(context *nuclio.Context, event nuclio.Event) (interface{}, error) {
 	panic("where are my keys?")
 }
 
-func TestHandlerPanic(t *testing.T) {
-	logger, err := nucliozap.NewNuclioZap("test")
+// waits for the event's deadline
+func deadlineHandler(ctx context.Context, context *nuclio.Context, event nuclio.Event) (interface{}, error) {
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func init() {
+	golangruntimeeventhandler.EventHandlers.Add("panicTestHandler", panicHandler)
+	golangruntimeeventhandler.EventHandlers.AddWithContext("deadlineTestHandler", deadlineHandler)
+}
+
+func createRuntime(t *testing.T, handlerName string) runtime.Runtime {
+	logger, err := nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
 	if err != nil {
 		log.Fatalf("can't create logger - %s", err)
 	}
-	name := "panicTestHandler"
-	golangruntimeeventhandler.EventHandlers.Add(name, panicHandler)
 
 	cfg := &Configuration{
-		EventHandlerName: name,
+		EventHandlerName: handlerName,
 	}
 	rt, err := NewRuntime(logger, cfg)
 	if err != nil {
-		log.Fatalf("can't create runtime - %s", err)
+		t.Fatalf("can't create runtime - %s", err)
 	}
-	evt := &event.AbstractSync{}
-	_, err = rt.ProcessEvent(evt)
+
+	return rt
+}
+
+func TestHandlerPanic(t *testing.T) {
+	rt := createRuntime(t, "panicTestHandler")
+
+	evt := &nuclio.AbstractSync{}
+	_, err := rt.ProcessEvent(context.Background(), evt)
 	if err == nil {
 		t.Fatalf("no nil error in panic")
 	}
 }
+
+func TestHandlerDeadline(t *testing.T) {
+	rt := createRuntime(t, "deadlineTestHandler")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	evt := &nuclio.AbstractSync{}
+	_, err := rt.ProcessEvent(ctx, evt)
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,60 @@
+package nodejs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/processor/runtime/wrapper"
+)
+
+type nodejs struct {
+	*wrapper.Runtime
+	configuration *Configuration
+}
+
+func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runtime.Runtime, error) {
+	var err error
+
+	newNodeJSRuntime := &nodejs{
+		configuration: configuration,
+	}
+
+	newNodeJSRuntime.Runtime, err = wrapper.NewRuntime(parentLogger.GetChild("nodejs").(nuclio.Logger),
+		&configuration.Configuration,
+		&wrapper.Configuration{
+			StartTimeout: time.Duration(configuration.StartTimeoutMs) * time.Millisecond,
+		},
+		newNodeJSRuntime.createCommand)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newNodeJSRuntime, nil
+}
+
+func (n *nodejs) createCommand(socketPath string) *exec.Cmd {
+	args := []string{
+		n.configuration.WrapperPath,
+		"--socket-path", socketPath,
+		"--handler", n.configuration.Handler,
+		"--handler-path", n.configuration.HandlerPath,
+	}
+
+	if n.configuration.InitHandler != "" {
+		args = append(args, "--init-handler", n.configuration.InitHandler)
+	}
+
+	cmd := exec.Command(n.configuration.NodePath, args...)
+
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("NUCLIO_FUNCTION_NAME=%s", n.configuration.Name),
+		fmt.Sprintf("NUCLIO_FUNCTION_DESCRIPTION=%s", n.configuration.Description),
+		fmt.Sprintf("NUCLIO_FUNCTION_VERSION=%s", n.configuration.Version))
+
+	return cmd
+}
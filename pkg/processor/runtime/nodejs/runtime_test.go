@@ -0,0 +1,153 @@
+package nodejs
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// the behavior shared with other wrapper runtimes is tested in the wrapper package. this module has an
+// async init handler and a synchronous handler returning the javascript values the wrapper converts to
+// responses
+const handlerModule = `
+'use strict';
+
+exports.initContext = async function(context) {
+    await new Promise((resolve) => setTimeout(resolve, 10));
+
+    context.userData = 'initialized';
+};
+
+exports.handler = function(context, event) {
+    const body = event.body.toString();
+
+    switch (body) {
+    case 'string':
+        return 'text';
+    case 'buffer':
+        return Buffer.from([0, 1, 2]);
+    case 'object':
+        return {a: 1};
+    case 'undefined':
+        return undefined;
+    case 'userData':
+        return context.userData;
+    case 'env':
+        return process.env.NUCLIO_FUNCTION_NAME + ':' + process.env.NUCLIO_FUNCTION_VERSION;
+    }
+
+    throw new TypeError(body);
+};
+`
+
+type testEvent struct {
+	nuclio.AbstractSync
+	body []byte
+}
+
+func (te *testEvent) GetBody() []byte {
+	return te.body
+}
+
+type RuntimeTestSuite struct {
+	suite.Suite
+	logger     nuclio.Logger
+	handlerDir string
+}
+
+func (suite *RuntimeTestSuite) SetupSuite() {
+	var err error
+
+	if _, err := exec.LookPath("node"); err != nil {
+		suite.T().Skip("node not found")
+	}
+
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	suite.handlerDir, err = ioutil.TempDir("", "nodejs-runtime-test")
+	suite.Require().NoError(err)
+
+	err = ioutil.WriteFile(filepath.Join(suite.handlerDir, "handler.js"), []byte(handlerModule), 0644)
+	suite.Require().NoError(err)
+}
+
+func (suite *RuntimeTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.handlerDir)
+}
+
+func (suite *RuntimeTestSuite) TestReturnValues() {
+	nodejsRuntime := suite.createRuntime()
+	defer nodejsRuntime.(runtime.Stopper).Stop()
+
+	for _, testCase := range []struct {
+		body                string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"string", "text/plain", "text"},
+		{"buffer", "text/plain", "\x00\x01\x02"},
+		{"object", "application/json", `{"a":1}`},
+		{"undefined", "text/plain", ""},
+		{"env", "text/plain", "echo:1"},
+
+		// the async init handler was awaited before the first event
+		{"userData", "text/plain", "initialized"},
+	} {
+		response, err := nodejsRuntime.ProcessEvent(context.Background(), suite.createEvent(testCase.body))
+		suite.Require().NoError(err, testCase.body)
+
+		typedResponse := response.(nuclio.Response)
+		suite.Equal(200, typedResponse.StatusCode, testCase.body)
+		suite.Equal(testCase.expectedContentType, typedResponse.ContentType, testCase.body)
+		suite.Equal(testCase.expectedBody, string(typedResponse.Body), testCase.body)
+	}
+}
+
+func (suite *RuntimeTestSuite) TestSynchronousThrow() {
+	nodejsRuntime := suite.createRuntime()
+	defer nodejsRuntime.(runtime.Stopper).Stop()
+
+	// a synchronous handler's exception is reported like an async handler's rejection
+	_, err := nodejsRuntime.ProcessEvent(context.Background(), suite.createEvent("unknown"))
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "unknown")
+}
+
+func (suite *RuntimeTestSuite) createRuntime() runtime.Runtime {
+	nodejsRuntime, err := NewRuntime(suite.logger, &Configuration{
+		Configuration: runtime.Configuration{
+			Name:    "echo",
+			Version: "1",
+		},
+		Handler:        "handler:handler",
+		HandlerPath:    suite.handlerDir,
+		InitHandler:    "handler:initContext",
+		NodePath:       "node",
+		WrapperPath:    "wrapper.js",
+		StartTimeoutMs: 10000,
+	})
+
+	suite.Require().NoError(err)
+
+	return nodejsRuntime
+}
+
+func (suite *RuntimeTestSuite) createEvent(body string) nuclio.Event {
+	event := &testEvent{body: []byte(body)}
+	event.SetID(nuclio.NewID())
+
+	return event
+}
+
+func TestRuntimeTestSuite(t *testing.T) {
+	suite.Run(t, new(RuntimeTestSuite))
+}
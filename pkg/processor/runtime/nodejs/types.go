@@ -0,0 +1,24 @@
+package nodejs
+
+import (
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+)
+
+type Configuration struct {
+	runtime.Configuration
+
+	// the handler, as module:function, and the directory holding its module
+	Handler     string
+	HandlerPath string
+
+	// an optional function (module:function) called once per wrapper process, before it handles events.
+	// it receives the context, on which it may set userData for the handler, and may be async
+	InitHandler string
+
+	// the node binary running the wrapper, and the wrapper script itself
+	NodePath    string
+	WrapperPath string
+
+	// how long the wrapper may take to start, including the init handler
+	StartTimeoutMs int
+}
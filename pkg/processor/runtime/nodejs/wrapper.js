@@ -0,0 +1,193 @@
+// Hosts a nuclio JavaScript handler in a process of its own.
+//
+// The processor starts this wrapper once per worker, telling it which handler to load and the unix socket
+// to connect to. Messages in both directions are JSON objects, each on a line of its own:
+//
+// - once the handler is loaded (and the init handler, if any, ran) the wrapper sends {"type": "ready"}
+// - the processor sends an event, which the wrapper answers with any number of "log" messages followed by
+//   either a "response" or an "error" message
+//
+// Bodies are base64 encoded. The handler is called as handler(context, event) and may return (or resolve
+// to, if async) a context.Response, a Buffer, a string or anything else that can be encoded as JSON.
+
+'use strict';
+
+const net = require('net');
+const path = require('path');
+const readline = require('readline');
+const util = require('util');
+
+class Response {
+    constructor(body, statusCode = 200, contentType = 'text/plain', headers = {}) {
+        this.body = body;
+        this.statusCode = statusCode;
+        this.contentType = contentType;
+        this.headers = headers;
+    }
+}
+
+class Logger {
+    constructor(send) {
+        this._send = send;
+    }
+
+    error(message, ...args) { this._log('error', message, args, {}); }
+    warn(message, ...args) { this._log('warn', message, args, {}); }
+    info(message, ...args) { this._log('info', message, args, {}); }
+    debug(message, ...args) { this._log('debug', message, args, {}); }
+
+    // fields are given as an object, e.g. context.logger.infoWith('Got event', {size: 10})
+    errorWith(message, fields) { this._log('error', message, [], fields); }
+    warnWith(message, fields) { this._log('warn', message, [], fields); }
+    infoWith(message, fields) { this._log('info', message, [], fields); }
+    debugWith(message, fields) { this._log('debug', message, [], fields); }
+
+    _log(level, message, args, fields) {
+        this._send({
+            type: 'log',
+            level: level,
+            message: args.length ? util.format(message, ...args) : String(message),
+            with: fields || {},
+        });
+    }
+}
+
+function parseArgs(argv) {
+    const args = {};
+
+    for (let argIndex = 0; argIndex < argv.length; argIndex += 2) {
+        args[argv[argIndex].replace(/^--/, '')] = argv[argIndex + 1];
+    }
+
+    return args;
+}
+
+// loads a function given as module:function, the module relative to the handler path
+function loadFunction(handlerPath, name) {
+    const [moduleName, functionName] = name.split(':');
+    if (!functionName) {
+        throw new Error(`Expected module:function, got ${name}`);
+    }
+
+    const handler = require(path.resolve(handlerPath, moduleName))[functionName];
+    if (typeof handler !== 'function') {
+        throw new Error(`${name} is not a function`);
+    }
+
+    return handler;
+}
+
+function createEvent(message) {
+    return {
+        id: message.id,
+        sourceClass: message.source.class,
+        sourceKind: message.source.kind,
+        contentType: message.content_type,
+        body: Buffer.from(message.body || '', 'base64'),
+        size: message.size,
+        headers: message.headers || {},
+        timestamp: message.timestamp,
+        path: message.path,
+        url: message.url,
+    };
+}
+
+function encodeBody(body) {
+    if (body === undefined || body === null) {
+        body = Buffer.alloc(0);
+    } else if (!Buffer.isBuffer(body)) {
+        body = Buffer.from(String(body));
+    }
+
+    return body.toString('base64');
+}
+
+function createResponseMessage(response) {
+    if (!(response instanceof Response)) {
+        if (response === undefined || response === null || Buffer.isBuffer(response)) {
+            response = new Response(response);
+        } else if (typeof response === 'string') {
+            response = new Response(response);
+        } else {
+            response = new Response(JSON.stringify(response), 200, 'application/json');
+        }
+    }
+
+    const headers = {};
+    for (const [key, value] of Object.entries(response.headers || {})) {
+        headers[key] = String(value);
+    }
+
+    return {
+        type: 'response',
+        status_code: response.statusCode,
+        content_type: response.contentType,
+        headers: headers,
+        body: encodeBody(response.body),
+    };
+}
+
+function createErrorMessage(error) {
+    return {
+        type: 'error',
+        message: error instanceof Error ? `${error.name}: ${error.message}` : String(error),
+    };
+}
+
+async function main() {
+    const args = parseArgs(process.argv.slice(2));
+    const socket = net.createConnection(args['socket-path']);
+
+    const send = (message) => socket.write(JSON.stringify(message) + '\n');
+
+    const context = {
+        logger: new Logger(send),
+        Response: Response,
+
+        // set by the init handler for the handler's use (e.g. a connection to a database)
+        userData: null,
+    };
+
+    await new Promise((resolve, reject) => {
+        socket.once('connect', resolve);
+        socket.once('error', reject);
+    });
+
+    let handler;
+
+    try {
+        handler = loadFunction(args['handler-path'], args['handler']);
+
+        if (args['init-handler']) {
+            await loadFunction(args['handler-path'], args['init-handler'])(context);
+        }
+    } catch (error) {
+        context.logger.errorWith('Failed to initialize', {stack: error && error.stack});
+        send(createErrorMessage(error));
+        socket.end();
+        return;
+    }
+
+    send({type: 'ready'});
+
+    // the processor sends an event only once the previous one was responded to
+    const lines = readline.createInterface({input: socket});
+
+    for await (const line of lines) {
+        try {
+            const response = await handler(context, createEvent(JSON.parse(line)));
+            send(createResponseMessage(response));
+        } catch (error) {
+            context.logger.errorWith('Handler raised an exception', {stack: error && error.stack});
+            send(createErrorMessage(error));
+        }
+    }
+
+    // the processor closed the connection
+    process.exit(0);
+}
+
+main().catch((error) => {
+    console.error(error);
+    process.exit(1);
+});
@@ -0,0 +1,33 @@
+package runtime
+
+import (
+	"bytes"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+// logs what a process writes (e.g. to its stderr) line by line. set as the process' output stream
+type OutputLogger struct {
+	Logger nuclio.Logger
+
+	// the name of the stream, logged with each line
+	Stream string
+
+	buffer []byte
+}
+
+func (ol *OutputLogger) Write(data []byte) (int, error) {
+	ol.buffer = append(ol.buffer, data...)
+
+	for {
+		lineLength := bytes.IndexByte(ol.buffer, '\n')
+		if lineLength == -1 {
+			break
+		}
+
+		ol.Logger.InfoWith("Process output", "stream", ol.Stream, "line", string(ol.buffer[:lineLength]))
+		ol.buffer = ol.buffer[lineLength+1:]
+	}
+
+	return len(data), nil
+}
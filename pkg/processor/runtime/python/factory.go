@@ -0,0 +1,43 @@
+package python
+
+import (
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type factory struct{}
+
+func (f *factory) Create(parentLogger nuclio.Logger,
+	configuration *viper.Viper) (runtime.Runtime, error) {
+
+	// defaults, matching where the build tool places the wrapper and the function
+	configuration.SetDefault("handler", "handler:handler")
+	configuration.SetDefault("path", "/opt/nuclio/handler")
+	configuration.SetDefault("interpreter", "python3")
+	configuration.SetDefault("wrapper_path", "/opt/nuclio/wrapper.py")
+	configuration.SetDefault("start_timeout_ms", 30000)
+
+	newConfiguration, err := runtime.NewConfiguration(configuration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create configuration")
+	}
+
+	return NewRuntime(parentLogger.GetChild("python").(nuclio.Logger),
+		&Configuration{
+			Configuration:   *newConfiguration,
+			Handler:         configuration.GetString("handler"),
+			HandlerPath:     configuration.GetString("path"),
+			InitHandler:     configuration.GetString("init_handler"),
+			InterpreterPath: configuration.GetString("interpreter"),
+			WrapperPath:     configuration.GetString("wrapper_path"),
+			StartTimeoutMs:  configuration.GetInt("start_timeout_ms"),
+		})
+}
+
+// register factory
+func init() {
+	runtime.RegistrySingleton.Register("python", &factory{})
+}
@@ -0,0 +1,62 @@
+package python
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/processor/runtime/wrapper"
+)
+
+type python struct {
+	*wrapper.Runtime
+	configuration *Configuration
+}
+
+func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runtime.Runtime, error) {
+	var err error
+
+	newPythonRuntime := &python{
+		configuration: configuration,
+	}
+
+	newPythonRuntime.Runtime, err = wrapper.NewRuntime(parentLogger.GetChild("python").(nuclio.Logger),
+		&configuration.Configuration,
+		&wrapper.Configuration{
+			StartTimeout: time.Duration(configuration.StartTimeoutMs) * time.Millisecond,
+		},
+		newPythonRuntime.createCommand)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return newPythonRuntime, nil
+}
+
+func (p *python) createCommand(socketPath string) *exec.Cmd {
+	args := []string{
+		// unbuffered, so that the handler's output is logged as it's written
+		"-u",
+		p.configuration.WrapperPath,
+		"--socket-path", socketPath,
+		"--handler", p.configuration.Handler,
+		"--handler-path", p.configuration.HandlerPath,
+	}
+
+	if p.configuration.InitHandler != "" {
+		args = append(args, "--init-handler", p.configuration.InitHandler)
+	}
+
+	cmd := exec.Command(p.configuration.InterpreterPath, args...)
+
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("NUCLIO_FUNCTION_NAME=%s", p.configuration.Name),
+		fmt.Sprintf("NUCLIO_FUNCTION_DESCRIPTION=%s", p.configuration.Description),
+		fmt.Sprintf("NUCLIO_FUNCTION_VERSION=%s", p.configuration.Version))
+
+	return cmd
+}
@@ -0,0 +1,142 @@
+package python
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// the behavior shared with other wrapper runtimes is tested in the wrapper package. this handler returns
+// the python values the wrapper converts to responses
+const handlerModule = `
+import os
+
+
+def handler(context, event):
+    body = event.body.decode('utf-8')
+
+    if body == 'str':
+        return 'text'
+
+    if body == 'bytes':
+        return b'\x00binary'
+
+    if body == 'dict':
+        return {'a': 1}
+
+    if body == 'none':
+        return None
+
+    if body == 'env':
+        return os.environ['NUCLIO_FUNCTION_NAME'] + ':' + os.environ['NUCLIO_FUNCTION_VERSION']
+
+    raise KeyError(body)
+`
+
+type testEvent struct {
+	nuclio.AbstractSync
+	body []byte
+}
+
+func (te *testEvent) GetBody() []byte {
+	return te.body
+}
+
+type RuntimeTestSuite struct {
+	suite.Suite
+	logger     nuclio.Logger
+	handlerDir string
+}
+
+func (suite *RuntimeTestSuite) SetupSuite() {
+	var err error
+
+	if _, err := exec.LookPath("python3"); err != nil {
+		suite.T().Skip("python3 not found")
+	}
+
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	suite.handlerDir, err = ioutil.TempDir("", "python-runtime-test")
+	suite.Require().NoError(err)
+
+	err = ioutil.WriteFile(filepath.Join(suite.handlerDir, "handler.py"), []byte(handlerModule), 0644)
+	suite.Require().NoError(err)
+}
+
+func (suite *RuntimeTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.handlerDir)
+}
+
+func (suite *RuntimeTestSuite) TestReturnValues() {
+	pythonRuntime := suite.createRuntime()
+	defer pythonRuntime.(runtime.Stopper).Stop()
+
+	for _, testCase := range []struct {
+		body                string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{"str", "text/plain", "text"},
+		{"bytes", "text/plain", "\x00binary"},
+		{"dict", "application/json", `{"a": 1}`},
+		{"none", "text/plain", ""},
+		{"env", "text/plain", "echo:1"},
+	} {
+		response, err := pythonRuntime.ProcessEvent(context.Background(), suite.createEvent(testCase.body))
+		suite.Require().NoError(err, testCase.body)
+
+		typedResponse := response.(nuclio.Response)
+		suite.Equal(200, typedResponse.StatusCode, testCase.body)
+		suite.Equal(testCase.expectedContentType, typedResponse.ContentType, testCase.body)
+		suite.Equal(testCase.expectedBody, string(typedResponse.Body), testCase.body)
+	}
+}
+
+func (suite *RuntimeTestSuite) TestExceptionType() {
+	pythonRuntime := suite.createRuntime()
+	defer pythonRuntime.(runtime.Stopper).Stop()
+
+	// the error names the exception's class
+	_, err := pythonRuntime.ProcessEvent(context.Background(), suite.createEvent("unknown"))
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "KeyError: 'unknown'")
+}
+
+func (suite *RuntimeTestSuite) createRuntime() runtime.Runtime {
+	pythonRuntime, err := NewRuntime(suite.logger, &Configuration{
+		Configuration: runtime.Configuration{
+			Name:    "echo",
+			Version: "1",
+		},
+		Handler:         "handler:handler",
+		HandlerPath:     suite.handlerDir,
+		InterpreterPath: "python3",
+		WrapperPath:     "wrapper.py",
+		StartTimeoutMs:  10000,
+	})
+
+	suite.Require().NoError(err)
+
+	return pythonRuntime
+}
+
+func (suite *RuntimeTestSuite) createEvent(body string) nuclio.Event {
+	event := &testEvent{body: []byte(body)}
+	event.SetID(nuclio.NewID())
+
+	return event
+}
+
+func TestRuntimeTestSuite(t *testing.T) {
+	suite.Run(t, new(RuntimeTestSuite))
+}
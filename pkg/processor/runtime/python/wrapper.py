@@ -0,0 +1,220 @@
+"""Hosts a nuclio python handler in a process of its own.
+
+The processor starts this wrapper once per worker, telling it which handler to load and the unix socket
+to connect to. Messages in both directions are JSON objects, each on a line of its own:
+
+- once the handler is loaded (and the init handler, if any, ran) the wrapper sends {"type": "ready"}
+- the processor sends an event, which the wrapper answers with any number of "log" messages followed by
+  either a "response" or an "error" message
+
+Bodies are base64 encoded. The handler is called as handler(context, event) and may return a Response,
+bytes, a string or anything else that can be encoded as JSON. Handlers get Response by importing nuclio.
+"""
+
+import argparse
+import base64
+import importlib
+import json
+import socket
+import sys
+import traceback
+
+
+class Event(object):
+
+    def __init__(self, message):
+        self.id = message['id']
+        self.source_class = message['source']['class']
+        self.source_kind = message['source']['kind']
+        self.content_type = message['content_type']
+        self.body = base64.b64decode(message['body'] or '')
+        self.size = message['size']
+        self.headers = message['headers'] or {}
+        self.timestamp = message['timestamp']
+        self.path = message['path']
+        self.url = message['url']
+
+
+class Response(object):
+
+    def __init__(self, body=None, status_code=200, content_type='text/plain', headers=None):
+        self.body = body
+        self.status_code = status_code
+        self.content_type = content_type
+        self.headers = headers or {}
+
+
+class Logger(object):
+    """Forwards log records to the processor's logger.
+
+    Fields are passed as keyword arguments, e.g. context.logger.info_with('Got event', size=10)
+    """
+
+    def __init__(self, connection):
+        self._connection = connection
+
+    def error(self, message, *args):
+        self._log('error', message, args, {})
+
+    def warn(self, message, *args):
+        self._log('warn', message, args, {})
+
+    def info(self, message, *args):
+        self._log('info', message, args, {})
+
+    def debug(self, message, *args):
+        self._log('debug', message, args, {})
+
+    def error_with(self, message, **fields):
+        self._log('error', message, (), fields)
+
+    def warn_with(self, message, **fields):
+        self._log('warn', message, (), fields)
+
+    def info_with(self, message, **fields):
+        self._log('info', message, (), fields)
+
+    def debug_with(self, message, **fields):
+        self._log('debug', message, (), fields)
+
+    def _log(self, level, message, args, fields):
+        if args:
+            message = message % args
+
+        self._connection.send({
+            'type': 'log',
+            'level': level,
+            'message': message,
+            'with': {key: _to_loggable(value) for key, value in fields.items()},
+        })
+
+
+class Context(object):
+
+    def __init__(self, logger):
+        self.logger = logger
+
+        # set by the init handler for the handler's use (e.g. a connection to a database)
+        self.user_data = None
+
+
+class Connection(object):
+
+    def __init__(self, socket_path):
+        self._socket = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+        self._socket.connect(socket_path)
+        self._reader = self._socket.makefile('rb')
+
+    def send(self, message):
+        self._socket.sendall(json.dumps(message).encode('utf-8') + b'\n')
+
+    def receive(self):
+        line = self._reader.readline()
+        if not line:
+            return None
+
+        return json.loads(line.decode('utf-8'))
+
+
+def _to_loggable(value):
+    try:
+        json.dumps(value)
+        return value
+    except (TypeError, ValueError):
+        return repr(value)
+
+
+def _encode_body(body):
+    if body is None:
+        body = b''
+    elif not isinstance(body, bytes):
+        body = str(body).encode('utf-8')
+
+    return base64.b64encode(body).decode('ascii')
+
+
+def _create_response_message(response):
+    if not isinstance(response, Response):
+        if response is None or isinstance(response, bytes):
+            response = Response(body=response)
+        elif isinstance(response, str):
+            response = Response(body=response.encode('utf-8'))
+        else:
+            response = Response(body=json.dumps(response).encode('utf-8'), content_type='application/json')
+
+    return {
+        'type': 'response',
+        'status_code': response.status_code,
+        'content_type': response.content_type,
+        'headers': {str(key): str(value) for key, value in response.headers.items()},
+        'body': _encode_body(response.body),
+    }
+
+
+def _load_function(name):
+    """Loads a function given as module:function"""
+    module_name, _, function_name = name.partition(':')
+    if not function_name:
+        raise ValueError('Expected module:function, got {0}'.format(name))
+
+    return getattr(importlib.import_module(module_name), function_name)
+
+
+def _error_message(error):
+    return {
+        'type': 'error',
+        'message': '{0}: {1}'.format(type(error).__name__, error),
+    }
+
+
+def serve(connection, handler, context):
+    while True:
+        message = connection.receive()
+
+        # the processor closed the connection
+        if message is None:
+            return
+
+        try:
+            response = handler(context, Event(message))
+            connection.send(_create_response_message(response))
+        except Exception as error:
+            context.logger.error_with('Handler raised an exception', traceback=traceback.format_exc())
+            connection.send(_error_message(error))
+
+
+def main():
+    parser = argparse.ArgumentParser()
+    parser.add_argument('--socket-path', required=True)
+    parser.add_argument('--handler', required=True)
+    parser.add_argument('--handler-path', required=True)
+    parser.add_argument('--init-handler')
+    args = parser.parse_args()
+
+    # let handlers import this module as nuclio, rather than load it again (with classes of its own)
+    sys.modules['nuclio'] = sys.modules[__name__]
+
+    connection = Connection(args.socket_path)
+    context = Context(Logger(connection))
+
+    try:
+        sys.path.insert(0, args.handler_path)
+
+        handler = _load_function(args.handler)
+
+        if args.init_handler:
+            _load_function(args.init_handler)(context)
+    except Exception as error:
+        context.logger.error_with('Failed to initialize', traceback=traceback.format_exc())
+        connection.send(_error_message(error))
+        return 1
+
+    connection.send({'type': 'ready'})
+
+    serve(connection, handler, context)
+
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
@@ -1,11 +1,22 @@
 package runtime
 
 import (
+	"context"
+
 	"github.com/nuclio/nuclio-sdk"
 )
 
 type Runtime interface {
-	ProcessEvent(event nuclio.Event) (interface{}, error)
+
+	// processes an event. runtimes abandon the event and return ctx.Err() once the context is done
+	// (e.g. its deadline expires), as far as the handler allows them to
+	ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error)
+}
+
+// implemented by runtimes that hold resources (e.g. a process) which must be released when their worker
+// is torn down
+type Stopper interface {
+	Stop() error
 }
 
 type AbstractRuntime struct {
@@ -13,6 +13,9 @@ type factory struct{}
 func (f *factory) Create(parentLogger nuclio.Logger,
 	configuration *viper.Viper) (runtime.Runtime, error) {
 
+	configuration.SetDefault("mode", ModeFork)
+	configuration.SetDefault("framing", FramingNewline)
+
 	newConfiguration, err := runtime.NewConfiguration(configuration)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create configuration")
@@ -23,6 +26,8 @@ func (f *factory) Create(parentLogger nuclio.Logger,
 			Configuration: *newConfiguration,
 			ScriptPath:    configuration.GetString("path"),
 			ScriptArgs:    configuration.GetStringSlice("args"),
+			Mode:          configuration.GetString("mode"),
+			Framing:       configuration.GetString("framing"),
 		})
 }
 
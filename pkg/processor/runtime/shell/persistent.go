@@ -0,0 +1,218 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+
+	"github.com/pkg/errors"
+)
+
+//
+// Persistent mode
+// The script is started once and fed events on its stdin, responding to each on its stdout before it
+// is sent the next. Whatever it writes to its stderr is logged. A script that exits, breaks framing
+// or is abandoned once an event's deadline expires is killed and started again
+//
+
+func (s *shell) sendToProcess(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	body := event.GetBody()
+
+	// rejected before it's written, so it doesn't throw the script out of sync
+	if s.configuration.Framing == FramingNewline && bytes.IndexByte(body, '\n') != -1 {
+		return nil, errors.New("Event body holds a newline, which newline framing can't carry")
+	}
+
+	// the script may have failed to start again after it last exited
+	if s.cmd == nil {
+		if err := s.startProcess(); err != nil {
+			return nil, errors.Wrap(err, "Failed to start script")
+		}
+	}
+
+	response, err := s.exchange(ctx, body)
+	if err == nil {
+		s.Logger.DebugWith("Script responded", "eventID", *event.GetID())
+
+		return response, nil
+	}
+
+	// the script can't be trusted to be in sync with us, start it again for the next event
+	s.restartProcess()
+
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "Script abandoned")
+	}
+
+	return nil, errors.Wrap(err, "Failed to communicate with script")
+}
+
+// writes an event to the script and reads its response
+func (s *shell) exchange(ctx context.Context, body []byte) ([]byte, error) {
+	doneChan := make(chan struct{})
+	watcherDoneChan := make(chan struct{})
+
+	// killing the script unblocks reading and writing once the context is done
+	go func(pid int) {
+		defer close(watcherDoneChan)
+
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-pid, syscall.SIGKILL)
+		case <-doneChan:
+		}
+	}(s.cmd.Process.Pid)
+
+	defer func() {
+		close(doneChan)
+		<-watcherDoneChan
+	}()
+
+	if err := s.writeEvent(body); err != nil {
+		return nil, errors.Wrap(err, "Failed to write event")
+	}
+
+	response, err := s.readResponse()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read response")
+	}
+
+	return response, nil
+}
+
+func (s *shell) writeEvent(body []byte) error {
+	var frame bytes.Buffer
+
+	switch s.configuration.Framing {
+	case FramingLength:
+		fmt.Fprintf(&frame, "%d\n", len(body))
+		frame.Write(body)
+	default:
+		frame.Write(body)
+		frame.WriteByte('\n')
+	}
+
+	_, err := s.stdin.Write(frame.Bytes())
+
+	return err
+}
+
+func (s *shell) readResponse() ([]byte, error) {
+	line, err := s.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+
+	if s.configuration.Framing != FramingLength {
+		return line, nil
+	}
+
+	length, err := strconv.Atoi(string(bytes.TrimSpace(line)))
+	if err != nil || length < 0 {
+		return nil, errors.Errorf("Expected response length, got %q", line)
+	}
+
+	response := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (s *shell) startProcess() error {
+	cmd := exec.Command("/bin/bash", "-c", s.command)
+	cmd.Env = s.env
+
+	// in a process group of its own, so that whatever the script spawns is killed along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stderr = &runtime.OutputLogger{Logger: s.Logger, Stream: "stderr"}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return errors.Wrap(err, "Failed to create stdin pipe")
+	}
+
+	// a pipe of our own rather than StdoutPipe(), which may not be read from once the script exited
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return errors.Wrap(err, "Failed to create stdout pipe")
+	}
+
+	cmd.Stdout = stdoutWriter
+
+	s.Logger.DebugWith("Starting script", "command", s.command, "framing", s.configuration.Framing)
+
+	err = cmd.Start()
+
+	// the script holds the write end now, so that reading ends once it exits
+	stdoutWriter.Close()
+
+	if err != nil {
+		stdin.Close()
+		stdoutReader.Close()
+		return errors.Wrap(err, "Failed to start script process")
+	}
+
+	s.cmd = cmd
+	s.stdin = stdin
+	s.stdout = stdoutReader
+	s.reader = bufio.NewReader(stdoutReader)
+	s.waitChan = make(chan error, 1)
+
+	go func(waitChan chan error) {
+		waitChan <- cmd.Wait()
+	}(s.waitChan)
+
+	s.Logger.DebugWith("Script started", "pid", cmd.Process.Pid)
+
+	return nil
+}
+
+func (s *shell) restartProcess() {
+	s.Logger.WarnWith("Restarting script")
+
+	s.stopProcess()
+
+	// if this fails, the next event will try again
+	if err := s.startProcess(); err != nil {
+		s.Logger.WarnWith("Failed to restart script", "err", err)
+	}
+}
+
+func (s *shell) stopProcess() {
+	if s.cmd == nil {
+		return
+	}
+
+	// a negative pid signals the entire process group
+	syscall.Kill(-s.cmd.Process.Pid, syscall.SIGKILL)
+
+	if err := <-s.waitChan; err != nil {
+		s.Logger.DebugWith("Script exited", "err", err)
+	}
+
+	s.stdin.Close()
+	s.stdout.Close()
+
+	s.cmd = nil
+	s.stdin = nil
+	s.stdout = nil
+	s.reader = nil
+}
@@ -1,11 +1,15 @@
 package shell
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
 	"strings"
-	"time"
+	"syscall"
 
 	"github.com/nuclio/nuclio-sdk"
 	"github.com/nuclio/nuclio/pkg/processor/runtime"
@@ -18,7 +22,13 @@ type shell struct {
 	configuration *Configuration
 	command       string
 	env           []string
-	ctx           context.Context
+
+	// the running script, in persistent mode. nil if not running
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   *os.File
+	reader   *bufio.Reader
+	waitChan chan error
 }
 
 func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runtime.Runtime, error) {
@@ -26,7 +36,6 @@ func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runti
 	// create the command string
 	newShellRuntime := &shell{
 		AbstractRuntime: *runtime.NewAbstractRuntime(parentLogger.GetChild("shell").(nuclio.Logger), &configuration.Configuration),
-		ctx:             context.Background(),
 		configuration:   configuration,
 	}
 
@@ -34,21 +43,49 @@ func NewRuntime(parentLogger nuclio.Logger, configuration *Configuration) (runti
 	newShellRuntime.command = newShellRuntime.getCommandString()
 	newShellRuntime.env = newShellRuntime.getEnvFromConfiguration()
 
+	switch configuration.Mode {
+	case "", ModeFork:
+	case ModePersistent:
+		if configuration.Framing != FramingNewline && configuration.Framing != FramingLength {
+			return nil, errors.Errorf("Unknown framing: %s", configuration.Framing)
+		}
+
+		// start right away, so that a script that can't be started fails the processor
+		if err := newShellRuntime.startProcess(); err != nil {
+			return nil, errors.Wrap(err, "Failed to start script")
+		}
+	default:
+		return nil, errors.Errorf("Unknown mode: %s", configuration.Mode)
+	}
+
 	return newShellRuntime, nil
 }
 
-func (s *shell) ProcessEvent(event nuclio.Event) (interface{}, error) {
+func (s *shell) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
 	s.Logger.DebugWith("Executing shell",
 		"name", s.configuration.Name,
 		"version", s.configuration.Version,
 		"eventID", *event.GetID())
 
-	// create a timeout context
-	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
-	defer cancel()
+	if s.configuration.Mode == ModePersistent {
+		return s.sendToProcess(ctx, event)
+	}
+
+	return s.runCommand(ctx, event)
+}
+
+// kills the persistent script, if any. the runtime must not be used afterwards
+func (s *shell) Stop() error {
+	s.stopProcess()
+
+	return nil
+}
+
+// runs the command for a single event
+func (s *shell) runCommand(ctx context.Context, event nuclio.Event) (interface{}, error) {
 
 	// create a command
-	cmd := exec.CommandContext(ctx, "/bin/bash", "-c", s.command+" "+event.GetContentType())
+	cmd := exec.Command("/bin/bash", "-c", s.command+" "+event.GetContentType())
 	cmd.Stdin = strings.NewReader(string(event.GetBody()))
 
 	// set the command env
@@ -57,17 +94,44 @@ func (s *shell) ProcessEvent(event nuclio.Event) (interface{}, error) {
 	// add event stuff to env
 	cmd.Env = append(cmd.Env, s.getEnvFromEvent(event)...)
 
+	// run the command in a process group of its own, so that whatever it spawns can be killed along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
 	// run the command
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return nil, errors.Wrap(err, "Failed to run shell command")
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrap(err, "Failed to start shell command")
+	}
+
+	waitChan := make(chan error, 1)
+	go func() {
+		waitChan <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-waitChan:
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to run shell command")
+		}
+
+	case <-ctx.Done():
+		s.Logger.WarnWith("Killing shell command", "err", ctx.Err(), "eventID", *event.GetID())
+
+		// a negative pid signals the entire process group
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-waitChan
+
+		return nil, errors.Wrap(ctx.Err(), "Shell command killed")
 	}
 
 	s.Logger.DebugWith("Shell executed",
-		"out", string(out),
+		"out", out.String(),
 		"eventID", *event.GetID())
 
-	return out, nil
+	return out.Bytes(), nil
 }
 
 func (s *shell) getCommandString() string {
@@ -0,0 +1,251 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// echoes a single event, as run per event in fork mode
+const forkScript = `#!/bin/bash
+read -r body
+echo "got:$body"
+`
+
+// echoes events forever, one per line. "pid" is answered with the script's pid
+const newlineScript = `#!/bin/bash
+while read -r body; do
+	case "$body" in
+	crash) exit 1 ;;
+	sleep) sleep 30 ;;
+	pid) echo "$$" ;;
+	log) echo "logged" >&2; echo "logged" ;;
+	*) echo "got:$body" ;;
+	esac
+done
+`
+
+// echoes events forever, each preceded by its length
+const lengthScript = `#!/bin/bash
+export LC_ALL=C
+while read -r length; do
+	read -r -N "$length" body
+	response="got:$body"
+	echo "${#response}"
+	printf '%s' "$response"
+done
+`
+
+type testSource struct{}
+
+func (ts *testSource) GetClass() string {
+	return "sync"
+}
+
+func (ts *testSource) GetKind() string {
+	return "test"
+}
+
+type testEvent struct {
+	nuclio.AbstractSync
+	body []byte
+}
+
+func (te *testEvent) GetBody() []byte {
+	return te.body
+}
+
+type RuntimeTestSuite struct {
+	suite.Suite
+	logger    nuclio.Logger
+	scriptDir string
+}
+
+func (suite *RuntimeTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.scriptDir = createScripts(suite.T())
+}
+
+func (suite *RuntimeTestSuite) TearDownSuite() {
+	os.RemoveAll(suite.scriptDir)
+}
+
+func (suite *RuntimeTestSuite) TestFork() {
+	shellRuntime := suite.createRuntime("fork.sh", ModeFork, "")
+
+	response, err := shellRuntime.ProcessEvent(context.Background(), createEvent("hello"))
+	suite.Require().NoError(err)
+	suite.Equal("got:hello\n", string(response.([]byte)))
+}
+
+func (suite *RuntimeTestSuite) TestPersistentNewline() {
+	shellRuntime := suite.createRuntime("newline.sh", ModePersistent, FramingNewline)
+	defer shellRuntime.(runtime.Stopper).Stop()
+
+	firstPid := suite.getPid(shellRuntime)
+
+	for _, body := range []string{"first", "log", "second"} {
+		response, err := shellRuntime.ProcessEvent(context.Background(), createEvent(body))
+		suite.Require().NoError(err)
+		suite.Contains(string(response.([]byte)), body)
+	}
+
+	// a body the framing can't carry is rejected without disturbing the script
+	_, err := shellRuntime.ProcessEvent(context.Background(), createEvent("two\nlines"))
+	suite.Error(err)
+
+	// all events were handled by the same script
+	suite.Equal(firstPid, suite.getPid(shellRuntime))
+}
+
+func (suite *RuntimeTestSuite) TestPersistentLength() {
+	shellRuntime := suite.createRuntime("length.sh", ModePersistent, FramingLength)
+	defer shellRuntime.(runtime.Stopper).Stop()
+
+	for _, body := range []string{"first", "two\nlines", ""} {
+		response, err := shellRuntime.ProcessEvent(context.Background(), createEvent(body))
+		suite.Require().NoError(err)
+		suite.Equal("got:"+body, string(response.([]byte)))
+	}
+}
+
+func (suite *RuntimeTestSuite) TestPersistentRestartOnCrash() {
+	shellRuntime := suite.createRuntime("newline.sh", ModePersistent, FramingNewline)
+	defer shellRuntime.(runtime.Stopper).Stop()
+
+	firstPid := suite.getPid(shellRuntime)
+
+	_, err := shellRuntime.ProcessEvent(context.Background(), createEvent("crash"))
+	suite.Error(err)
+
+	// the script was started again
+	suite.NotEqual(firstPid, suite.getPid(shellRuntime))
+
+	response, err := shellRuntime.ProcessEvent(context.Background(), createEvent("hello"))
+	suite.Require().NoError(err)
+	suite.Equal("got:hello", string(response.([]byte)))
+}
+
+func (suite *RuntimeTestSuite) TestPersistentDeadline() {
+	shellRuntime := suite.createRuntime("newline.sh", ModePersistent, FramingNewline)
+	defer shellRuntime.(runtime.Stopper).Stop()
+
+	firstPid := suite.getPid(shellRuntime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+
+	_, err := shellRuntime.ProcessEvent(ctx, createEvent("sleep"))
+	suite.Error(err)
+	suite.Equal(context.DeadlineExceeded, ctx.Err())
+	suite.True(time.Since(startTime) < 10*time.Second)
+
+	// the abandoned script was replaced
+	suite.NotEqual(firstPid, suite.getPid(shellRuntime))
+}
+
+func (suite *RuntimeTestSuite) TestInvalidConfiguration() {
+	_, err := NewRuntime(suite.logger, createConfiguration(suite.scriptDir, "newline.sh", "daemon", ""))
+	suite.Error(err)
+
+	_, err = NewRuntime(suite.logger, createConfiguration(suite.scriptDir, "newline.sh", ModePersistent, "xml"))
+	suite.Error(err)
+}
+
+func (suite *RuntimeTestSuite) createRuntime(script string, mode string, framing string) runtime.Runtime {
+	shellRuntime, err := NewRuntime(suite.logger, createConfiguration(suite.scriptDir, script, mode, framing))
+	suite.Require().NoError(err)
+
+	return shellRuntime
+}
+
+func (suite *RuntimeTestSuite) getPid(shellRuntime runtime.Runtime) string {
+	response, err := shellRuntime.ProcessEvent(context.Background(), createEvent("pid"))
+	suite.Require().NoError(err)
+
+	return string(response.([]byte))
+}
+
+func TestRuntimeTestSuite(t *testing.T) {
+	suite.Run(t, new(RuntimeTestSuite))
+}
+
+func BenchmarkFork(b *testing.B) {
+	benchmarkMode(b, "fork.sh", ModeFork)
+}
+
+func BenchmarkPersistent(b *testing.B) {
+	benchmarkMode(b, "newline.sh", ModePersistent)
+}
+
+func benchmarkMode(b *testing.B, script string, mode string) {
+	scriptDir := createScripts(b)
+	defer os.RemoveAll(scriptDir)
+
+	logger, _ := nucliozap.NewNuclioZap("test", nucliozap.InfoLevel)
+
+	shellRuntime, err := NewRuntime(logger, createConfiguration(scriptDir, script, mode, FramingNewline))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer shellRuntime.(runtime.Stopper).Stop()
+
+	event := createEvent("hello")
+
+	b.ResetTimer()
+
+	for eventIndex := 0; eventIndex < b.N; eventIndex++ {
+		if _, err := shellRuntime.ProcessEvent(context.Background(), event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func createScripts(tb testing.TB) string {
+	scriptDir, err := ioutil.TempDir("", "shell-runtime-test")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	scripts := map[string]string{
+		"fork.sh":    forkScript,
+		"newline.sh": newlineScript,
+		"length.sh":  lengthScript,
+	}
+
+	for name, contents := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(scriptDir, name), []byte(contents), 0755); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return scriptDir
+}
+
+func createConfiguration(scriptDir string, script string, mode string, framing string) *Configuration {
+	return &Configuration{
+		ScriptPath: filepath.Join(scriptDir, script),
+		Mode:       mode,
+		Framing:    framing,
+	}
+}
+
+func createEvent(body string) nuclio.Event {
+	event := &testEvent{body: []byte(body)}
+	event.SetID(nuclio.NewID())
+	event.SetSourceProvider(&testSource{})
+
+	return event
+}
@@ -2,6 +2,25 @@ package shell
 
 import "github.com/nuclio/nuclio/pkg/processor/runtime"
 
+const (
+
+	// the script is run once per event, receiving the event body on its stdin and responding with its output
+	ModeFork = "fork"
+
+	// the script is started once per worker and fed events on its stdin, responding to each on its stdout
+	ModePersistent = "persistent"
+)
+
+// how events and responses are delimited on a persistent script's stdin and stdout
+const (
+
+	// each event and response is a single line. events whose body holds a newline can't be sent
+	FramingNewline = "newline"
+
+	// each event and response is preceded by a line holding its length in bytes
+	FramingLength = "length"
+)
+
 type Configuration struct {
 	runtime.Configuration
 
@@ -12,4 +31,8 @@ type Configuration struct {
 	// a map of environment variables that need to be injected into the shell process. a nil value
 	// indicates to take it from the running process' environment map
 	Env map[string]*string
+
+	// fork (the default) or persistent and, in persistent mode, how events are framed
+	Mode    string
+	Framing string
 }
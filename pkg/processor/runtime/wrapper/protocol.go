@@ -0,0 +1,116 @@
+package wrapper
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+)
+
+//
+// The wrapper protocol
+// The processor and a wrapper process exchange JSON objects, each on a line of its own, over a unix
+// socket the wrapper connects to. Once it's ready to handle events (e.g. its init hook ran) the wrapper
+// sends a "ready" message. For each event it's sent, it replies with any number of "log" messages
+// followed by either a "response" or an "error" message. Bodies are base64 encoded
+//
+
+const (
+	messageTypeReady    = "ready"
+	messageTypeLog      = "log"
+	messageTypeResponse = "response"
+	messageTypeError    = "error"
+)
+
+type eventSource struct {
+	Class string `json:"class"`
+	Kind  string `json:"kind"`
+}
+
+// an event, as sent to the wrapper
+type eventMessage struct {
+	ID          string                 `json:"id"`
+	Source      eventSource            `json:"source"`
+	ContentType string                 `json:"content_type"`
+	Body        []byte                 `json:"body"`
+	Size        int                    `json:"size"`
+	Headers     map[string]interface{} `json:"headers"`
+	Timestamp   time.Time              `json:"timestamp"`
+	Path        string                 `json:"path"`
+	URL         string                 `json:"url"`
+}
+
+func newEventMessage(event nuclio.Event) *eventMessage {
+	message := eventMessage{
+		ContentType: event.GetContentType(),
+		Body:        event.GetBody(),
+		Size:        event.GetSize(),
+		Headers:     map[string]interface{}{},
+		Timestamp:   event.GetTimestamp(),
+		Path:        event.GetPath(),
+		URL:         event.GetURL(),
+	}
+
+	if event.GetID() != nil {
+		message.ID = fmt.Sprintf("%s", *event.GetID())
+	}
+
+	if event.GetSource() != nil {
+		message.Source.Class = event.GetSource().GetClass()
+		message.Source.Kind = event.GetSource().GetKind()
+	}
+
+	// header values may be byte slices, which would otherwise be base64 encoded
+	for headerKey, headerValue := range event.GetHeaders() {
+		if byteSliceValue, ok := headerValue.([]byte); ok {
+			headerValue = string(byteSliceValue)
+		}
+
+		message.Headers[headerKey] = headerValue
+	}
+
+	return &message
+}
+
+// a message sent by the wrapper. the fields populated depend on its type
+type wrapperMessage struct {
+	Type string `json:"type"`
+
+	// log and error
+	Level   string                 `json:"level"`
+	Message string                 `json:"message"`
+	With    map[string]interface{} `json:"with"`
+
+	// response
+	StatusCode  int               `json:"status_code"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	Body        []byte            `json:"body"`
+}
+
+func (wm *wrapperMessage) getResponse() nuclio.Response {
+	return nuclio.Response{
+		StatusCode:  wm.StatusCode,
+		ContentType: wm.ContentType,
+		Headers:     wm.Headers,
+		Body:        wm.Body,
+	}
+}
+
+// returns the structured fields of a log message as alternating keys and values, ordered by key
+func (wm *wrapperMessage) getVars() []interface{} {
+	var keys []string
+	for key := range wm.With {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	vars := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		vars = append(vars, key, wm.With[key])
+	}
+
+	return vars
+}
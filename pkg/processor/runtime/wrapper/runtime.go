@@ -0,0 +1,346 @@
+package wrapper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+
+	"github.com/pkg/errors"
+)
+
+// creates the command running a wrapper process, which is to connect to the given unix socket
+type CommandCreator func(socketPath string) *exec.Cmd
+
+type Configuration struct {
+
+	// how long a wrapper process may take to connect and become ready (e.g. run its init hook)
+	StartTimeout time.Duration
+}
+
+//
+// Wrapper runtime
+// Hosts a handler written in another language in a long-lived wrapper process, one per worker, speaking
+// the wrapper protocol. A wrapper that crashes, misbehaves or is abandoned once an event's deadline
+// expires is killed and restarted
+//
+
+type Runtime struct {
+	runtime.AbstractRuntime
+	configuration *Configuration
+	createCommand CommandCreator
+
+	// holds the sockets wrapper processes connect to, one per process started
+	socketDir       string
+	numStartedTimes int
+
+	// the running process and its connection. nil if not running
+	cmd      *exec.Cmd
+	conn     net.Conn
+	reader   *bufio.Reader
+	waitChan chan error
+}
+
+func NewRuntime(logger nuclio.Logger,
+	runtimeConfiguration *runtime.Configuration,
+	configuration *Configuration,
+	createCommand CommandCreator) (*Runtime, error) {
+
+	var err error
+
+	newRuntime := &Runtime{
+		AbstractRuntime: *runtime.NewAbstractRuntime(logger, runtimeConfiguration),
+		configuration:   configuration,
+		createCommand:   createCommand,
+	}
+
+	newRuntime.socketDir, err = ioutil.TempDir("", "nuclio-wrapper-")
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create socket directory")
+	}
+
+	// start right away, so that a handler that fails to load fails the processor
+	if err := newRuntime.start(); err != nil {
+		os.RemoveAll(newRuntime.socketDir)
+
+		return nil, errors.Wrap(err, "Failed to start wrapper")
+	}
+
+	return newRuntime, nil
+}
+
+func (r *Runtime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	// the wrapper may have failed to restart after it last exited
+	if r.cmd == nil {
+		if err := r.start(); err != nil {
+			return nil, errors.Wrap(err, "Failed to start wrapper")
+		}
+	}
+
+	response, err := r.handleEvent(ctx, event)
+	if err == nil {
+		return response, nil
+	}
+
+	// the wrapper is fine, the handler failed
+	if _, ok := err.(*handlerError); ok {
+		return nil, err
+	}
+
+	// the wrapper can't be trusted to be in sync with us, restart it for the next event
+	r.restart()
+
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "Wrapper abandoned")
+	}
+
+	return nil, errors.Wrap(err, "Failed to communicate with wrapper")
+}
+
+// kills the wrapper process. the runtime must not be used afterwards
+func (r *Runtime) Stop() error {
+	r.stopProcess()
+
+	return os.RemoveAll(r.socketDir)
+}
+
+func (r *Runtime) start() error {
+	r.numStartedTimes++
+
+	// each process gets a socket of its own, so that one that failed to start can't connect to its successor's
+	socketPath := filepath.Join(r.socketDir, fmt.Sprintf("wrapper-%d.sock", r.numStartedTimes))
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return errors.Wrap(err, "Failed to listen on socket")
+	}
+
+	// only a single connection is accepted
+	defer listener.Close()
+
+	cmd := r.createCommand(socketPath)
+
+	// in a process group of its own, so that whatever the handler spawns is killed along with it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Stdout = &runtime.OutputLogger{Logger: r.Logger, Stream: "stdout"}
+	cmd.Stderr = &runtime.OutputLogger{Logger: r.Logger, Stream: "stderr"}
+
+	r.Logger.DebugWith("Starting wrapper", "path", cmd.Path, "args", cmd.Args)
+
+	if err := cmd.Start(); err != nil {
+		return errors.Wrap(err, "Failed to start wrapper process")
+	}
+
+	r.cmd = cmd
+	r.waitChan = make(chan error, 1)
+
+	go func(waitChan chan error) {
+		waitChan <- cmd.Wait()
+	}(r.waitChan)
+
+	if err := r.waitReady(listener); err != nil {
+		r.stopProcess()
+		return err
+	}
+
+	r.Logger.DebugWith("Wrapper ready", "pid", cmd.Process.Pid)
+
+	return nil
+}
+
+// waits for the wrapper to connect and report that it's ready
+func (r *Runtime) waitReady(listener net.Listener) error {
+	deadline := time.Now().Add(r.configuration.StartTimeout)
+
+	type acceptResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	acceptChan := make(chan acceptResult, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		acceptChan <- acceptResult{conn, err}
+	}()
+
+	select {
+	case result := <-acceptChan:
+		if result.err != nil {
+			return errors.Wrap(result.err, "Failed to accept wrapper connection")
+		}
+
+		r.conn = result.conn
+		r.reader = bufio.NewReader(r.conn)
+
+	case err := <-r.waitChan:
+		r.waitChan <- err
+		return errors.Errorf("Wrapper exited before connecting: %v", err)
+
+	case <-time.After(time.Until(deadline)):
+		return errors.New("Timed out waiting for wrapper to connect")
+	}
+
+	r.conn.SetReadDeadline(deadline)
+
+	// the wrapper may log before it's ready (e.g. from its init hook)
+	for {
+		message, err := r.readMessage()
+		if err != nil {
+			return errors.Wrap(err, "Failed to wait for wrapper to be ready")
+		}
+
+		switch message.Type {
+		case messageTypeReady:
+			r.conn.SetReadDeadline(time.Time{})
+			return nil
+
+		case messageTypeLog:
+			r.log(message)
+
+		case messageTypeError:
+			return errors.Errorf("Wrapper failed to initialize: %s", message.Message)
+
+		default:
+			return errors.Errorf("Unexpected message type %s while initializing", message.Type)
+		}
+	}
+}
+
+func (r *Runtime) handleEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	doneChan := make(chan struct{})
+	watcherDoneChan := make(chan struct{})
+
+	// unblock reading and writing once the context is done
+	go func() {
+		defer close(watcherDoneChan)
+
+		select {
+		case <-ctx.Done():
+			r.conn.SetDeadline(time.Now())
+		case <-doneChan:
+		}
+	}()
+
+	// the watcher must not touch the connection after we're done with this event
+	defer func() {
+		close(doneChan)
+		<-watcherDoneChan
+	}()
+
+	encodedEvent, err := json.Marshal(newEventMessage(event))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode event")
+	}
+
+	if _, err := r.conn.Write(append(encodedEvent, '\n')); err != nil {
+		return nil, errors.Wrap(err, "Failed to send event")
+	}
+
+	// the handler may log any number of times before it responds
+	for {
+		message, err := r.readMessage()
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read response")
+		}
+
+		switch message.Type {
+		case messageTypeLog:
+			r.log(message)
+
+		case messageTypeResponse:
+			return message.getResponse(), nil
+
+		case messageTypeError:
+			return nil, &handlerError{message: message.Message}
+
+		default:
+			return nil, errors.Errorf("Unexpected message type %s", message.Type)
+		}
+	}
+}
+
+func (r *Runtime) readMessage() (*wrapperMessage, error) {
+	line, err := r.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	message := wrapperMessage{}
+	if err := json.Unmarshal(line, &message); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode message")
+	}
+
+	return &message, nil
+}
+
+// forwards a log record of the handler to our logger
+func (r *Runtime) log(message *wrapperMessage) {
+	vars := message.getVars()
+
+	switch message.Level {
+	case "error":
+		r.Logger.ErrorWith(message.Message, vars...)
+	case "warn", "warning":
+		r.Logger.WarnWith(message.Message, vars...)
+	case "debug":
+		r.Logger.DebugWith(message.Message, vars...)
+	default:
+		r.Logger.InfoWith(message.Message, vars...)
+	}
+}
+
+func (r *Runtime) restart() {
+	r.Logger.WarnWith("Restarting wrapper")
+
+	r.stopProcess()
+
+	// if this fails, the next event will try again
+	if err := r.start(); err != nil {
+		r.Logger.WarnWith("Failed to restart wrapper", "err", err)
+	}
+}
+
+func (r *Runtime) stopProcess() {
+	if r.cmd == nil {
+		return
+	}
+
+	// a negative pid signals the entire process group
+	syscall.Kill(-r.cmd.Process.Pid, syscall.SIGKILL)
+
+	if err := <-r.waitChan; err != nil {
+		r.Logger.DebugWith("Wrapper exited", "err", err)
+	}
+
+	if r.conn != nil {
+		r.conn.Close()
+	}
+
+	r.cmd = nil
+	r.conn = nil
+	r.reader = nil
+}
+
+// an error raised by the handler, as opposed to one communicating with the wrapper
+type handlerError struct {
+	message string
+}
+
+func (he *handlerError) Error() string {
+	return fmt.Sprintf("Handler failed: %s", he.message)
+}
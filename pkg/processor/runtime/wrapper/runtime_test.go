@@ -0,0 +1,331 @@
+package wrapper_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/runtime"
+	"github.com/nuclio/nuclio/pkg/processor/runtime/nodejs"
+	"github.com/nuclio/nuclio/pkg/processor/runtime/python"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+// each handler echoes the body of the event, prefixed by what its init hook stored, unless the body is
+// one of the commands below
+const pythonHandlerModule = `
+import os
+import time
+
+import nuclio
+
+
+def init_context(context):
+    context.user_data = 'initialized'
+    context.logger.info_with('Initializing', pid=os.getpid())
+
+
+def handler(context, event):
+    body = event.body.decode('utf-8')
+
+    context.logger.debug_with('Got event', body=body)
+
+    if body == 'crash':
+        os._exit(1)
+
+    if body == 'raise':
+        raise ValueError('raised')
+
+    if body == 'sleep':
+        time.sleep(30)
+
+    if body == 'pid':
+        return str(os.getpid())
+
+    return nuclio.Response(body=((context.user_data or 'uninitialized') + ':' + body).encode('utf-8'),
+                           status_code=201,
+                           content_type='text/plain',
+                           headers={'X-Header': event.headers.get('X-Header', '')})
+
+
+def failing_init_context(context):
+    raise RuntimeError('init failed')
+`
+
+const nodejsHandlerModule = `
+'use strict';
+
+exports.initContext = function(context) {
+    context.userData = 'initialized';
+    context.logger.infoWith('Initializing', {pid: process.pid});
+};
+
+exports.handler = async function(context, event) {
+    const body = event.body.toString();
+
+    context.logger.debugWith('Got event', {body: body});
+
+    if (body === 'crash') {
+        process.exit(1);
+    }
+
+    if (body === 'raise') {
+        throw new Error('raised');
+    }
+
+    if (body === 'sleep') {
+        await new Promise((resolve) => setTimeout(resolve, 30000));
+    }
+
+    if (body === 'pid') {
+        return String(process.pid);
+    }
+
+    return new context.Response((context.userData || 'uninitialized') + ':' + body,
+                                201,
+                                'text/plain',
+                                {'X-Header': event.headers['X-Header'] || ''});
+};
+
+exports.failingInitContext = function(context) {
+    throw new Error('init failed');
+};
+`
+
+// a runtime hosting its handlers in a wrapper process
+type wrapperRuntime struct {
+	name               string
+	interpreter        string
+	handlerFileName    string
+	handlerModule      string
+	initHandler        string
+	failingInitHandler string
+	create             func(logger nuclio.Logger, handlerDir string, initHandler string) (runtime.Runtime, error)
+
+	// set once the handler is written
+	handlerDir string
+}
+
+type testEvent struct {
+	nuclio.AbstractSync
+	body []byte
+}
+
+func (te *testEvent) GetBody() []byte {
+	return te.body
+}
+
+func (te *testEvent) GetHeaders() map[string]interface{} {
+	return map[string]interface{}{"X-Header": []byte("value")}
+}
+
+// the behavior every wrapper runtime shares, whatever the language of its handlers
+type RuntimeTestSuite struct {
+	suite.Suite
+	logger   nuclio.Logger
+	runtimes []*wrapperRuntime
+}
+
+func (suite *RuntimeTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	for _, wrapperRuntimeInstance := range []*wrapperRuntime{
+		{
+			name:               "python",
+			interpreter:        "python3",
+			handlerFileName:    "handler.py",
+			handlerModule:      pythonHandlerModule,
+			initHandler:        "handler:init_context",
+			failingInitHandler: "handler:failing_init_context",
+			create: func(logger nuclio.Logger, handlerDir string, initHandler string) (runtime.Runtime, error) {
+				return python.NewRuntime(logger, &python.Configuration{
+					Handler:         "handler:handler",
+					HandlerPath:     handlerDir,
+					InitHandler:     initHandler,
+					InterpreterPath: "python3",
+					WrapperPath:     "../python/wrapper.py",
+					StartTimeoutMs:  10000,
+				})
+			},
+		},
+		{
+			name:               "nodejs",
+			interpreter:        "node",
+			handlerFileName:    "handler.js",
+			handlerModule:      nodejsHandlerModule,
+			initHandler:        "handler:initContext",
+			failingInitHandler: "handler:failingInitContext",
+			create: func(logger nuclio.Logger, handlerDir string, initHandler string) (runtime.Runtime, error) {
+				return nodejs.NewRuntime(logger, &nodejs.Configuration{
+					Handler:        "handler:handler",
+					HandlerPath:    handlerDir,
+					InitHandler:    initHandler,
+					NodePath:       "node",
+					WrapperPath:    "../nodejs/wrapper.js",
+					StartTimeoutMs: 10000,
+				})
+			},
+		},
+	} {
+
+		// runtimes whose interpreter isn't installed aren't tested
+		if _, err := exec.LookPath(wrapperRuntimeInstance.interpreter); err != nil {
+			suite.logger.WarnWith("Skipping runtime", "name", wrapperRuntimeInstance.name, "err", err)
+			continue
+		}
+
+		handlerDir, err := ioutil.TempDir("", wrapperRuntimeInstance.name+"-wrapper-runtime-test")
+		suite.Require().NoError(err)
+
+		err = ioutil.WriteFile(filepath.Join(handlerDir, wrapperRuntimeInstance.handlerFileName),
+			[]byte(wrapperRuntimeInstance.handlerModule),
+			0644)
+
+		suite.Require().NoError(err)
+
+		wrapperRuntimeInstance.handlerDir = handlerDir
+		suite.runtimes = append(suite.runtimes, wrapperRuntimeInstance)
+	}
+
+	if len(suite.runtimes) == 0 {
+		suite.T().Skip("No interpreters found")
+	}
+}
+
+func (suite *RuntimeTestSuite) TearDownSuite() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		os.RemoveAll(wrapperRuntimeInstance.handlerDir)
+	}
+}
+
+func (suite *RuntimeTestSuite) TestProcessEvent() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		runtimeInstance := suite.createRuntime(wrapperRuntimeInstance, wrapperRuntimeInstance.initHandler)
+
+		response, err := runtimeInstance.ProcessEvent(context.Background(), suite.createEvent("hello"))
+		suite.Require().NoError(err, wrapperRuntimeInstance.name)
+
+		typedResponse := response.(nuclio.Response)
+		suite.Equal(201, typedResponse.StatusCode, wrapperRuntimeInstance.name)
+		suite.Equal("text/plain", typedResponse.ContentType, wrapperRuntimeInstance.name)
+		suite.Equal("value", typedResponse.Headers["X-Header"], wrapperRuntimeInstance.name)
+		suite.Equal("initialized:hello", string(typedResponse.Body), wrapperRuntimeInstance.name)
+
+		runtimeInstance.(runtime.Stopper).Stop()
+	}
+}
+
+func (suite *RuntimeTestSuite) TestWithoutInitHandler() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		runtimeInstance := suite.createRuntime(wrapperRuntimeInstance, "")
+
+		response, err := runtimeInstance.ProcessEvent(context.Background(), suite.createEvent("hello"))
+		suite.Require().NoError(err, wrapperRuntimeInstance.name)
+		suite.Equal("uninitialized:hello", string(response.(nuclio.Response).Body), wrapperRuntimeInstance.name)
+
+		runtimeInstance.(runtime.Stopper).Stop()
+	}
+}
+
+func (suite *RuntimeTestSuite) TestHandlerError() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		runtimeInstance := suite.createRuntime(wrapperRuntimeInstance, wrapperRuntimeInstance.initHandler)
+
+		firstPid := suite.getPid(runtimeInstance)
+
+		_, err := runtimeInstance.ProcessEvent(context.Background(), suite.createEvent("raise"))
+		suite.Require().Error(err, wrapperRuntimeInstance.name)
+		suite.Contains(err.Error(), "raised", wrapperRuntimeInstance.name)
+
+		// an exception doesn't restart the wrapper
+		suite.Equal(firstPid, suite.getPid(runtimeInstance), wrapperRuntimeInstance.name)
+
+		runtimeInstance.(runtime.Stopper).Stop()
+	}
+}
+
+func (suite *RuntimeTestSuite) TestRestartOnCrash() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		runtimeInstance := suite.createRuntime(wrapperRuntimeInstance, wrapperRuntimeInstance.initHandler)
+
+		firstPid := suite.getPid(runtimeInstance)
+
+		_, err := runtimeInstance.ProcessEvent(context.Background(), suite.createEvent("crash"))
+		suite.Error(err, wrapperRuntimeInstance.name)
+
+		// the wrapper was restarted, and initialized again
+		suite.NotEqual(firstPid, suite.getPid(runtimeInstance), wrapperRuntimeInstance.name)
+
+		response, err := runtimeInstance.ProcessEvent(context.Background(), suite.createEvent("hello"))
+		suite.Require().NoError(err, wrapperRuntimeInstance.name)
+		suite.Equal("initialized:hello", string(response.(nuclio.Response).Body), wrapperRuntimeInstance.name)
+
+		runtimeInstance.(runtime.Stopper).Stop()
+	}
+}
+
+func (suite *RuntimeTestSuite) TestDeadline() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		runtimeInstance := suite.createRuntime(wrapperRuntimeInstance, "")
+
+		firstPid := suite.getPid(runtimeInstance)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		startTime := time.Now()
+
+		_, err := runtimeInstance.ProcessEvent(ctx, suite.createEvent("sleep"))
+		suite.Error(err, wrapperRuntimeInstance.name)
+		suite.Equal(context.DeadlineExceeded, ctx.Err(), wrapperRuntimeInstance.name)
+		suite.True(time.Since(startTime) < 10*time.Second, wrapperRuntimeInstance.name)
+
+		cancel()
+
+		// the abandoned wrapper was replaced
+		suite.NotEqual(firstPid, suite.getPid(runtimeInstance), wrapperRuntimeInstance.name)
+
+		runtimeInstance.(runtime.Stopper).Stop()
+	}
+}
+
+func (suite *RuntimeTestSuite) TestInitFailure() {
+	for _, wrapperRuntimeInstance := range suite.runtimes {
+		_, err := wrapperRuntimeInstance.create(suite.logger,
+			wrapperRuntimeInstance.handlerDir,
+			wrapperRuntimeInstance.failingInitHandler)
+
+		suite.Require().Error(err, wrapperRuntimeInstance.name)
+		suite.Contains(err.Error(), "init failed", wrapperRuntimeInstance.name)
+	}
+}
+
+func (suite *RuntimeTestSuite) createRuntime(wrapperRuntimeInstance *wrapperRuntime, initHandler string) runtime.Runtime {
+	runtimeInstance, err := wrapperRuntimeInstance.create(suite.logger, wrapperRuntimeInstance.handlerDir, initHandler)
+	suite.Require().NoError(err, wrapperRuntimeInstance.name)
+
+	return runtimeInstance
+}
+
+func (suite *RuntimeTestSuite) createEvent(body string) nuclio.Event {
+	event := &testEvent{body: []byte(body)}
+	event.SetID(nuclio.NewID())
+
+	return event
+}
+
+func (suite *RuntimeTestSuite) getPid(runtimeInstance runtime.Runtime) string {
+	response, err := runtimeInstance.ProcessEvent(context.Background(), suite.createEvent("pid"))
+	suite.Require().NoError(err)
+
+	return string(response.(nuclio.Response).Body)
+}
+
+func TestRuntimeTestSuite(t *testing.T) {
+	suite.Run(t, new(RuntimeTestSuite))
+}
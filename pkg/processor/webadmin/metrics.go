@@ -0,0 +1,366 @@
+package webadmin
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+)
+
+type metricSample struct {
+	labels map[string]string
+	value  float64
+}
+
+// a metric and all its samples, rendered in the Prometheus text exposition format
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []metricSample
+}
+
+type metricFamilies struct {
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func newMetricFamilies() *metricFamilies {
+	return &metricFamilies{
+		byName: map[string]*metricFamily{},
+	}
+}
+
+// adds a sample to a metric, creating the metric on first use
+func (mf *metricFamilies) add(name string, help string, kind string, labels map[string]string, value float64) {
+	family, found := mf.byName[name]
+	if !found {
+		family = &metricFamily{
+			name: name,
+			help: help,
+			kind: kind,
+		}
+
+		mf.byName[name] = family
+		mf.families = append(mf.families, family)
+	}
+
+	family.samples = append(family.samples, metricSample{labels, value})
+}
+
+func (mf *metricFamilies) render() []byte {
+	var buffer bytes.Buffer
+
+	for _, family := range mf.families {
+		fmt.Fprintf(&buffer, "# HELP %s %s\n", family.name, family.help)
+		fmt.Fprintf(&buffer, "# TYPE %s %s\n", family.name, family.kind)
+
+		for _, sample := range family.samples {
+			buffer.WriteString(family.name)
+			buffer.WriteString(mf.renderLabels(sample.labels))
+			buffer.WriteByte(' ')
+			buffer.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+			buffer.WriteByte('\n')
+		}
+	}
+
+	return buffer.Bytes()
+}
+
+func (mf *metricFamilies) renderLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	// sort for stable output
+	labelNames := make([]string, 0, len(labels))
+	for labelName := range labels {
+		labelNames = append(labelNames, labelName)
+	}
+
+	sort.Strings(labelNames)
+
+	renderedLabels := make([]string, 0, len(labels))
+	for _, labelName := range labelNames {
+		renderedLabels = append(renderedLabels, fmt.Sprintf(`%s="%s"`, labelName, mf.escapeLabelValue(labels[labelName])))
+	}
+
+	return "{" + strings.Join(renderedLabels, ",") + "}"
+}
+
+func (mf *metricFamilies) escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func (s *Server) handleMetrics(responseWriter http.ResponseWriter, request *http.Request) {
+	families := newMetricFamilies()
+
+	for _, eventSource := range s.eventSources {
+		s.addEventSourceMetrics(families, eventSource)
+	}
+
+	for _, workerPool := range s.workerPools {
+		s.addWorkerPoolMetrics(families, workerPool)
+	}
+
+	if s.outputBindings != nil {
+		for _, binding := range s.outputBindings.GetBindings() {
+			s.addOutputMetrics(families, binding)
+		}
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	responseWriter.Write(families.render())
+}
+
+func (s *Server) addEventSourceMetrics(families *metricFamilies, eventSource eventsource.EventSource) {
+	statistics := eventSource.GetStatistics()
+
+	families.add("nuclio_event_source_events_handled_total",
+		"Number of events handled by the event source, after retries",
+		"counter",
+		s.getEventSourceLabels(eventSource, "result", "success"),
+		float64(atomic.LoadUint64(&statistics.EventsHandledSuccess)))
+
+	families.add("nuclio_event_source_events_handled_total",
+		"Number of events handled by the event source, after retries",
+		"counter",
+		s.getEventSourceLabels(eventSource, "result", "failure"),
+		float64(atomic.LoadUint64(&statistics.EventsHandledFailure)))
+
+	families.add("nuclio_event_source_events_retried_total",
+		"Number of event processing retries",
+		"counter",
+		s.getEventSourceLabels(eventSource),
+		float64(atomic.LoadUint64(&statistics.EventsRetried)))
+
+	families.add("nuclio_event_source_events_dead_lettered_total",
+		"Number of events written to the dead letter sink",
+		"counter",
+		s.getEventSourceLabels(eventSource),
+		float64(atomic.LoadUint64(&statistics.EventsDeadLettered)))
+
+	if connectionStateProvider, ok := eventSource.(eventsource.ConnectionStateProvider); ok {
+		connected := 0.0
+		if connectionStateProvider.GetConnectionState() == eventsource.ConnectionStateConnected {
+			connected = 1
+		}
+
+		families.add("nuclio_event_source_connected",
+			"Whether the event source is connected (1) or not (0)",
+			"gauge",
+			s.getEventSourceLabels(eventSource),
+			connected)
+	}
+
+	workerAllocator := eventSource.GetWorkerAllocator()
+	if workerAllocator == nil {
+		return
+	}
+
+	labels := s.getEventSourceLabels(eventSource)
+
+	// the workers of a shared pool are reported once, with the pool
+	if poolMemberAllocator, ok := workerAllocator.(worker.PoolMemberAllocator); ok {
+		labels["worker_pool"] = poolMemberAllocator.GetWorkerPool().Name
+
+		s.addAllocationMetrics(families, labels, workerAllocator)
+		return
+	}
+
+	s.addAllocationMetrics(families, labels, workerAllocator)
+	s.addWorkerMetrics(families, labels, workerAllocator)
+}
+
+func (s *Server) addWorkerPoolMetrics(families *metricFamilies, workerPool *worker.WorkerPool) {
+	labels := map[string]string{
+		"function":    s.functionName,
+		"version":     s.functionVersion,
+		"worker_pool": workerPool.Name,
+	}
+
+	workerAllocator := workerPool.GetAllocator()
+
+	families.add("nuclio_workers_allocated",
+		"Number of workers currently allocated",
+		"gauge",
+		labels,
+		float64(workerAllocator.GetNumWorkersAllocated()))
+
+	s.addWorkerMetrics(families, labels, workerAllocator)
+}
+
+func (s *Server) addAllocationMetrics(families *metricFamilies,
+	labels map[string]string,
+	workerAllocator worker.WorkerAllocator) {
+
+	statistics := workerAllocator.GetStatistics()
+
+	families.add("nuclio_worker_allocations_total",
+		"Number of successful worker allocations",
+		"counter",
+		labels,
+		float64(atomic.LoadUint64(&statistics.Allocations)))
+
+	families.add("nuclio_worker_allocation_timeouts_total",
+		"Number of worker allocations that timed out waiting for a worker",
+		"counter",
+		labels,
+		float64(atomic.LoadUint64(&statistics.AllocationTimeouts)))
+
+	families.add("nuclio_worker_allocation_wait_seconds_total",
+		"Total time spent waiting for a worker to become available",
+		"counter",
+		labels,
+		time.Duration(atomic.LoadUint64(&statistics.AllocationWaitDuration)).Seconds())
+
+	families.add("nuclio_workers_allocated",
+		"Number of workers currently allocated",
+		"gauge",
+		labels,
+		float64(workerAllocator.GetNumWorkersAllocated()))
+}
+
+// adds the metrics of the allocator's workers, labeled by the event source or pool owning them
+func (s *Server) addWorkerMetrics(families *metricFamilies,
+	labels map[string]string,
+	workerAllocator worker.WorkerAllocator) {
+
+	statistics := workerAllocator.GetStatistics()
+	workers := workerAllocator.GetWorkers()
+
+	families.add("nuclio_workers_created_total",
+		"Number of workers created by the allocator, when its pool grows",
+		"counter",
+		labels,
+		float64(atomic.LoadUint64(&statistics.WorkersCreated)))
+
+	families.add("nuclio_workers_stopped_total",
+		"Number of idle workers stopped by the allocator, when its pool shrinks",
+		"counter",
+		labels,
+		float64(atomic.LoadUint64(&statistics.WorkersStopped)))
+
+	families.add("nuclio_workers",
+		"Number of workers in the pool",
+		"gauge",
+		labels,
+		float64(len(workers)))
+
+	for _, workerInstance := range workers {
+		workerStatistics := workerInstance.GetStatistics()
+		workerIndex := strconv.Itoa(workerInstance.GetIndex())
+
+		families.add("nuclio_worker_events_total",
+			"Number of events processed by the worker",
+			"counter",
+			augmentLabels(labels, "worker", workerIndex, "result", "success"),
+			float64(atomic.LoadUint64(&workerStatistics.Succeeded)))
+
+		families.add("nuclio_worker_events_total",
+			"Number of events processed by the worker",
+			"counter",
+			augmentLabels(labels, "worker", workerIndex, "result", "failure"),
+			float64(atomic.LoadUint64(&workerStatistics.Failed)))
+
+		families.add("nuclio_worker_retries_total",
+			"Number of events the worker processed again, since an earlier attempt failed",
+			"counter",
+			augmentLabels(labels, "worker", workerIndex),
+			float64(atomic.LoadUint64(&workerStatistics.Retry)))
+
+		families.add("nuclio_worker_queued_total",
+			"Number of allocations of the worker that waited for a worker to become available",
+			"counter",
+			augmentLabels(labels, "worker", workerIndex),
+			float64(atomic.LoadUint64(&workerStatistics.Queued)))
+
+		families.add("nuclio_worker_processing_seconds_total",
+			"Total time the worker spent processing events",
+			"counter",
+			augmentLabels(labels, "worker", workerIndex),
+			time.Duration(atomic.LoadUint64(&workerStatistics.Duration)).Seconds())
+	}
+}
+
+func (s *Server) addOutputMetrics(families *metricFamilies, binding *output.Binding) {
+	statistics := binding.GetStatistics()
+
+	families.add("nuclio_output_messages_total",
+		"Number of responses written to the output, after retries",
+		"counter",
+		s.getOutputLabels(binding, "result", "success"),
+		float64(atomic.LoadUint64(&statistics.MessagesDelivered)))
+
+	families.add("nuclio_output_messages_total",
+		"Number of responses written to the output, after retries",
+		"counter",
+		s.getOutputLabels(binding, "result", "failure"),
+		float64(atomic.LoadUint64(&statistics.MessagesFailed)))
+
+	families.add("nuclio_output_messages_total",
+		"Number of responses written to the output, after retries",
+		"counter",
+		s.getOutputLabels(binding, "result", "dropped"),
+		float64(atomic.LoadUint64(&statistics.MessagesDropped)))
+
+	families.add("nuclio_output_retries_total",
+		"Number of output write retries",
+		"counter",
+		s.getOutputLabels(binding),
+		float64(atomic.LoadUint64(&statistics.MessagesRetried)))
+
+	families.add("nuclio_output_queued_messages",
+		"Number of responses waiting to be written to the output",
+		"gauge",
+		s.getOutputLabels(binding),
+		float64(binding.GetNumQueuedMessages()))
+}
+
+// returns the labels identifying the function and output, augmented by the given name/value pairs
+func (s *Server) getOutputLabels(binding *output.Binding, labelsAndValues ...string) map[string]string {
+	labels := map[string]string{
+		"function":    s.functionName,
+		"version":     s.functionVersion,
+		"output":      binding.Name,
+		"output_kind": binding.Kind,
+	}
+
+	return augmentLabels(labels, labelsAndValues...)
+}
+
+// returns the labels identifying the function and event source, augmented by the given name/value pairs
+func (s *Server) getEventSourceLabels(eventSource eventsource.EventSource, labelsAndValues ...string) map[string]string {
+	labels := map[string]string{
+		"function":           s.functionName,
+		"version":            s.functionVersion,
+		"event_source_id":    eventSource.GetID(),
+		"event_source_kind":  eventSource.GetKind(),
+		"event_source_class": eventSource.GetClass(),
+	}
+
+	return augmentLabels(labels, labelsAndValues...)
+}
+
+// returns a copy of the labels with the given name/value pairs added
+func augmentLabels(labels map[string]string, labelsAndValues ...string) map[string]string {
+	augmentedLabels := make(map[string]string, len(labels)+len(labelsAndValues)/2)
+
+	for labelName, labelValue := range labels {
+		augmentedLabels[labelName] = labelValue
+	}
+
+	for labelIndex := 0; labelIndex+1 < len(labelsAndValues); labelIndex += 2 {
+		augmentedLabels[labelsAndValues[labelIndex]] = labelsAndValues[labelIndex+1]
+	}
+
+	return augmentedLabels
+}
@@ -0,0 +1,182 @@
+package webadmin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	_ "github.com/nuclio/nuclio/pkg/processor/output/file"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsTestSuite struct {
+	serverTestSuite
+	tempDir string
+}
+
+func (suite *MetricsTestSuite) SetupTest() {
+	var err error
+
+	suite.tempDir, err = ioutil.TempDir("", "metrics-test")
+	suite.Require().NoError(err)
+
+	logger, _ := nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+
+	runtimeConfiguration := viper.New()
+	runtimeConfiguration.SetConfigType("yaml")
+	suite.Require().NoError(runtimeConfiguration.ReadConfig(bytes.NewBufferString(`
+output_bindings:
+- name: results
+  kind: file
+  path: ` + filepath.Join(suite.tempDir, "results.json"))))
+
+	suite.outputBindings, err = output.NewBindings(logger, runtimeConfiguration)
+	suite.Require().NoError(err)
+
+	suite.serverTestSuite.SetupTest()
+	suite.eventSource.SetOutputSink(suite.outputBindings)
+}
+
+func (suite *MetricsTestSuite) TearDownTest() {
+	os.RemoveAll(suite.tempDir)
+}
+
+func (suite *MetricsTestSuite) TestMetrics() {
+	event := &nuclio.AbstractSync{}
+
+	// one success, one failure
+	suite.mockRuntime.On("ProcessEvent", event).Return("response", nil).Once()
+	suite.mockRuntime.On("ProcessEvent", event).Return(nil, errors.New("Processing error")).Once()
+
+	suite.eventSource.SubmitEventToWorker(event, 0)
+	suite.eventSource.SubmitEventToWorker(event, 0)
+
+	// responses are written asynchronously, and all are written once closed
+	suite.Require().NoError(suite.outputBindings.Close(time.Second))
+
+	responseRecorder := suite.get("/metrics")
+
+	suite.Require().Equal(http.StatusOK, responseRecorder.Code)
+
+	body := responseRecorder.Body.String()
+	labels := `event_source_class="sync",event_source_id="test1",event_source_kind="test",function="echo"`
+
+	suite.Contains(body, "# TYPE nuclio_event_source_events_handled_total counter\n")
+	suite.Contains(body, "nuclio_event_source_events_handled_total{"+labels+`,result="success",version="1"} 1`+"\n")
+	suite.Contains(body, "nuclio_event_source_events_handled_total{"+labels+`,result="failure",version="1"} 1`+"\n")
+	suite.Contains(body, "nuclio_worker_allocations_total{"+labels+`,version="1"} 2`+"\n")
+	suite.Contains(body, "nuclio_event_source_connected{"+labels+`,version="1"} 1`+"\n")
+	suite.Contains(body, "# TYPE nuclio_workers gauge\n")
+	suite.Contains(body, "nuclio_workers{"+labels+`,version="1"} 2`+"\n")
+	suite.Contains(body, "nuclio_workers_allocated{"+labels+`,version="1"} 0`+"\n")
+	suite.Contains(body, "nuclio_worker_events_total{"+labels+`,result="success",version="1",worker="0"} 1`+"\n")
+	suite.Contains(body, "nuclio_worker_processing_seconds_total{"+labels+`,version="1",worker="1"}`)
+	suite.Contains(body, "nuclio_worker_retries_total{"+labels+`,version="1",worker="0"} 0`+"\n")
+	suite.Contains(body, "nuclio_worker_queued_total{"+labels+`,version="1",worker="0"} 0`+"\n")
+
+	// the response of the successful event was written to the output
+	outputLabels := `function="echo",output="results",output_kind="file"`
+	suite.Contains(body, "nuclio_output_messages_total{"+outputLabels+`,result="success",version="1"} 1`+"\n")
+	suite.Contains(body, "nuclio_output_messages_total{"+outputLabels+`,result="failure",version="1"} 0`+"\n")
+	suite.Contains(body, "nuclio_output_messages_total{"+outputLabels+`,result="dropped",version="1"} 0`+"\n")
+	suite.Contains(body, "nuclio_output_retries_total{"+outputLabels+`,version="1"} 0`+"\n")
+	suite.Contains(body, "nuclio_output_queued_messages{"+outputLabels+`,version="1"} 0`+"\n")
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+}
+
+func (suite *MetricsTestSuite) TestWorkerPoolMetrics() {
+	workerAllocator, err := worker.NewFixedPoolWorkerAllocator(suite.logger, []*worker.Worker{
+		worker.NewWorker(suite.logger, 0, suite.mockRuntime),
+		worker.NewWorker(suite.logger, 1, suite.mockRuntime),
+	})
+
+	suite.Require().NoError(err)
+
+	workerPool, err := worker.NewWorkerPool(suite.logger,
+		"shared",
+		workerAllocator,
+		2,
+		worker.AllocationPolicyFairShare)
+
+	suite.Require().NoError(err)
+
+	var eventSources []eventsource.EventSource
+
+	for _, eventSourceID := range []string{"first", "second"} {
+		memberAllocator, err := workerPool.NewMemberAllocator(eventSourceID, 1)
+		suite.Require().NoError(err)
+
+		eventSources = append(eventSources, &testEventSource{
+			AbstractEventSource: eventsource.AbstractEventSource{
+				Logger:          suite.logger,
+				WorkerAllocator: memberAllocator,
+				Class:           "sync",
+				Kind:            "test",
+				ID:              eventSourceID,
+				RetryPolicy:     &eventsource.RetryPolicy{},
+			},
+			connectionState: eventsource.ConnectionStateConnected,
+		})
+	}
+
+	runtimeConfiguration := viper.New()
+	runtimeConfiguration.Set("name", "echo")
+	runtimeConfiguration.Set("version", "1")
+
+	suite.server, err = NewServer(suite.logger,
+		NewConfiguration(viper.New()),
+		nil,
+		eventSources,
+		[]*worker.WorkerPool{workerPool},
+		nil,
+		runtimeConfiguration)
+
+	suite.Require().NoError(err)
+
+	event := &nuclio.AbstractSync{}
+	suite.mockRuntime.On("ProcessEvent", event).Return("response", nil).Once()
+
+	eventSources[0].(*testEventSource).SubmitEventToWorker(event, 0)
+
+	body := suite.get("/metrics").Body.String()
+
+	// the pool's workers are reported once, rather than by each member
+	poolLabels := `function="echo",version="1",worker_pool="shared"`
+	suite.Contains(body, "nuclio_workers{"+poolLabels+"} 2\n")
+	suite.Contains(body, "nuclio_workers_allocated{"+poolLabels+"} 0\n")
+	suite.Contains(body, `nuclio_worker_events_total{function="echo",result="success",version="1",worker="0",worker_pool="shared"} 1`+"\n")
+	suite.Equal(4, strings.Count(body, "nuclio_worker_events_total{"))
+	suite.Equal(1, strings.Count(body, "nuclio_workers{"))
+
+	// each member reports its own allocations
+	memberLabels := `event_source_class="sync",event_source_id="%s",event_source_kind="test",function="echo",version="1",worker_pool="shared"`
+	suite.Contains(body, "nuclio_worker_allocations_total{"+fmt.Sprintf(memberLabels, "first")+"} 1\n")
+	suite.Contains(body, "nuclio_worker_allocations_total{"+fmt.Sprintf(memberLabels, "second")+"} 0\n")
+
+	suite.mockRuntime.AssertExpectations(suite.T())
+}
+
+func (suite *MetricsTestSuite) TestEscapeLabelValue() {
+	families := newMetricFamilies()
+
+	suite.Equal(`a\\b\"c\nd`, families.escapeLabelValue("a\\b\"c\nd"))
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
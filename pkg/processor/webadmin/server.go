@@ -0,0 +1,120 @@
+package webadmin
+
+import (
+	"net"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+type Configuration struct {
+	ListenAddress string
+}
+
+func NewConfiguration(configuration *viper.Viper) *Configuration {
+
+	// defaults
+	configuration.SetDefault("listen_address", ":8081")
+
+	return &Configuration{
+		ListenAddress: configuration.GetString("listen_address"),
+	}
+}
+
+// serves the processor's administrative interface
+type Server struct {
+	logger                 nuclio.Logger
+	configuration          *Configuration
+	processorConfiguration map[string]*viper.Viper
+	eventSources           []eventsource.EventSource
+	workerPools            []*worker.WorkerPool
+	outputBindings         *output.Bindings
+	functionName           string
+	functionVersion        string
+	mux                    *http.ServeMux
+	listener               net.Listener
+
+	// non zero once the processor is ready to handle events. accessed atomically
+	ready int32
+}
+
+func NewServer(parentLogger nuclio.Logger,
+	configuration *Configuration,
+	processorConfiguration map[string]*viper.Viper,
+	eventSources []eventsource.EventSource,
+	workerPools []*worker.WorkerPool,
+	outputBindings *output.Bindings,
+	runtimeConfiguration *viper.Viper) (*Server, error) {
+
+	newServer := Server{
+		logger:                 parentLogger.GetChild("webadmin").(nuclio.Logger),
+		configuration:          configuration,
+		processorConfiguration: processorConfiguration,
+		eventSources:           eventSources,
+		workerPools:            workerPools,
+		outputBindings:         outputBindings,
+		functionName:           runtimeConfiguration.GetString("name"),
+		functionVersion:        runtimeConfiguration.GetString("version"),
+		mux:                    http.NewServeMux(),
+	}
+
+	newServer.mux.HandleFunc("/live", newServer.handleLive)
+	newServer.mux.HandleFunc("/ready", newServer.handleReady)
+	newServer.mux.HandleFunc("/configuration", newServer.handleConfiguration)
+	newServer.mux.HandleFunc("/event_sources", newServer.handleEventSources)
+	newServer.mux.HandleFunc("/event_sources/", newServer.handleEventSource)
+	newServer.mux.HandleFunc("/statistics", newServer.handleStatistics)
+	newServer.mux.HandleFunc("/metrics", newServer.handleMetrics)
+
+	return &newServer, nil
+}
+
+func (s *Server) Start() error {
+	var err error
+
+	s.logger.InfoWith("Starting", "listenAddress", s.configuration.ListenAddress)
+
+	s.listener, err = net.Listen("tcp", s.configuration.ListenAddress)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to listen on %s", s.configuration.ListenAddress)
+	}
+
+	go http.Serve(s.listener, s.mux)
+
+	return nil
+}
+
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+
+	return s.listener.Close()
+}
+
+// called by the processor once all event sources started, and before they're stopped
+func (s *Server) SetReady(ready bool) {
+	var readyValue int32
+
+	if ready {
+		readyValue = 1
+	}
+
+	atomic.StoreInt32(&s.ready, readyValue)
+}
+
+func (s *Server) IsReady() bool {
+	return atomic.LoadInt32(&s.ready) != 0
+}
+
+// allows serving the administrative interface from elsewhere (e.g. tests)
+func (s *Server) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	s.mux.ServeHTTP(responseWriter, request)
+}
@@ -0,0 +1,105 @@
+package webadmin
+
+import (
+	"context"
+	"net/http/httptest"
+
+	"github.com/nuclio/nuclio/pkg/processor/eventsource"
+	"github.com/nuclio/nuclio/pkg/processor/output"
+	"github.com/nuclio/nuclio/pkg/processor/worker"
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type MockRuntime struct {
+	mock.Mock
+}
+
+func (mr *MockRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	args := mr.Called(event)
+	return args.Get(0), args.Error(1)
+}
+
+type testEventSource struct {
+	eventsource.AbstractEventSource
+	connectionState eventsource.ConnectionState
+}
+
+func (tes *testEventSource) Start(checkpoint eventsource.Checkpoint) error {
+	return nil
+}
+
+func (tes *testEventSource) Stop(force bool) (eventsource.Checkpoint, error) {
+	return nil, nil
+}
+
+func (tes *testEventSource) GetConnectionState() eventsource.ConnectionState {
+	return tes.connectionState
+}
+
+type serverTestSuite struct {
+	suite.Suite
+	logger      nuclio.Logger
+	mockRuntime *MockRuntime
+	eventSource *testEventSource
+	server      *Server
+
+	// the configuration the server reports and the worker pools and outputs it reports on, set by suites
+	// before SetupTest
+	processorConfiguration map[string]*viper.Viper
+	workerPools            []*worker.WorkerPool
+	outputBindings         *output.Bindings
+}
+
+func (suite *serverTestSuite) SetupTest() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+	suite.mockRuntime = &MockRuntime{}
+
+	workerAllocator, err := worker.NewFixedPoolWorkerAllocator(suite.logger, []*worker.Worker{
+		worker.NewWorker(suite.logger, 0, suite.mockRuntime),
+		worker.NewWorker(suite.logger, 1, suite.mockRuntime),
+	})
+
+	suite.Require().NoError(err)
+
+	suite.eventSource = &testEventSource{
+		AbstractEventSource: eventsource.AbstractEventSource{
+			Logger:          suite.logger,
+			WorkerAllocator: workerAllocator,
+			Class:           "sync",
+			Kind:            "test",
+			ID:              "test1",
+			RetryPolicy:     &eventsource.RetryPolicy{},
+		},
+		connectionState: eventsource.ConnectionStateConnected,
+	}
+
+	runtimeConfiguration := viper.New()
+	runtimeConfiguration.Set("name", "echo")
+	runtimeConfiguration.Set("version", "1")
+
+	suite.server, err = NewServer(suite.logger,
+		NewConfiguration(viper.New()),
+		suite.processorConfiguration,
+		[]eventsource.EventSource{suite.eventSource},
+		suite.workerPools,
+		suite.outputBindings,
+		runtimeConfiguration)
+
+	suite.Require().NoError(err)
+}
+
+func (suite *serverTestSuite) get(path string) *httptest.ResponseRecorder {
+	return suite.request("GET", path)
+}
+
+func (suite *serverTestSuite) request(method string, path string) *httptest.ResponseRecorder {
+	responseRecorder := httptest.NewRecorder()
+	suite.server.ServeHTTP(responseRecorder, httptest.NewRequest(method, path, nil))
+
+	return responseRecorder
+}
@@ -1,13 +1,21 @@
 package worker
 
 import (
-	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
 )
 
+// returned by Allocate when no worker became available within the timeout
+var ErrAllocationTimeout = errors.New("Timed out waiting for available worker")
+
+// returned by Allocate once the allocator is stopped
+var ErrAllocatorStopped = errors.New("Worker allocator is stopped")
+
 type WorkerAllocator interface {
 
 	// allocate a worker
@@ -18,6 +26,19 @@ type WorkerAllocator interface {
 
 	// true if the several go routines can share this allocator
 	Shareable() bool
+
+	// get the workers managed by the allocator
+	GetWorkers() []*Worker
+
+	// get the number of workers currently allocated
+	GetNumWorkersAllocated() int
+
+	// get allocation statistics
+	GetStatistics() *AllocatorStatistics
+
+	// stop the workers managed by the allocator, releasing their runtimes. workers must not be allocated
+	// afterwards
+	Stop() error
 }
 
 //
@@ -26,8 +47,12 @@ type WorkerAllocator interface {
 //
 
 type singleton struct {
-	logger nuclio.Logger
-	worker *Worker
+	logger     nuclio.Logger
+	worker     *Worker
+	statistics AllocatorStatistics
+
+	// 1 while the worker is allocated to its user. accessed atomically
+	allocated int32
 }
 
 func NewSingletonWorkerAllocator(parentLogger nuclio.Logger, worker *Worker) (WorkerAllocator, error) {
@@ -39,10 +64,14 @@ func NewSingletonWorkerAllocator(parentLogger nuclio.Logger, worker *Worker) (Wo
 }
 
 func (s *singleton) Allocate(timeout time.Duration) (*Worker, error) {
+	atomic.AddUint64(&s.statistics.Allocations, 1)
+	atomic.StoreInt32(&s.allocated, 1)
+
 	return s.worker, nil
 }
 
 func (s *singleton) Release(worker *Worker) {
+	atomic.StoreInt32(&s.allocated, 0)
 }
 
 // true if the several go routines can share this allocator
@@ -50,6 +79,22 @@ func (s *singleton) Shareable() bool {
 	return false
 }
 
+func (s *singleton) GetWorkers() []*Worker {
+	return []*Worker{s.worker}
+}
+
+func (s *singleton) GetNumWorkersAllocated() int {
+	return int(atomic.LoadInt32(&s.allocated))
+}
+
+func (s *singleton) GetStatistics() *AllocatorStatistics {
+	return &s.statistics
+}
+
+func (s *singleton) Stop() error {
+	return stopWorkers(s.logger, []*Worker{s.worker})
+}
+
 //
 // Fixed pool of workers
 // Holds a fixed number of workers. When a worker is unavailable, caller is blocked
@@ -57,14 +102,17 @@ func (s *singleton) Shareable() bool {
 
 type fixedPool struct {
 	logger     nuclio.Logger
+	workers    []*Worker
 	workerChan chan *Worker
 	timerPool  sync.Pool
+	statistics AllocatorStatistics
 }
 
 func NewFixedPoolWorkerAllocator(parentLogger nuclio.Logger, workers []*Worker) (WorkerAllocator, error) {
 
 	newFixedPool := fixedPool{
 		logger:     parentLogger.GetChild("fixed_pool_allocator").(nuclio.Logger),
+		workers:    workers,
 		workerChan: make(chan *Worker, len(workers)),
 		timerPool: sync.Pool{
 			New: func() interface{} {
@@ -82,15 +130,32 @@ func NewFixedPoolWorkerAllocator(parentLogger nuclio.Logger, workers []*Worker)
 }
 
 func (fp *fixedPool) Allocate(timeout time.Duration) (*Worker, error) {
+
+	// try to allocate without waiting first, so that the common case doesn't need a timer
+	select {
+	case workerInstance := <-fp.workerChan:
+		atomic.AddUint64(&fp.statistics.Allocations, 1)
+		return workerInstance, nil
+	default:
+	}
+
 	timer := fp.timerPool.Get().(*time.Timer)
 	defer fp.timerPool.Put(timer)
 
+	startTime := time.Now()
+	defer func() {
+		atomic.AddUint64(&fp.statistics.AllocationWaitDuration, uint64(time.Since(startTime)))
+	}()
+
 	timer.Reset(timeout)
 	select {
 	case workerInstance := <-fp.workerChan:
+		atomic.AddUint64(&fp.statistics.Allocations, 1)
+		workerInstance.countQueued()
 		return workerInstance, nil
 	case <-timer.C:
-		return nil, errors.New("Timed out waiting for available worker")
+		atomic.AddUint64(&fp.statistics.AllocationTimeouts, 1)
+		return nil, ErrAllocationTimeout
 	}
 }
 
@@ -102,3 +167,367 @@ func (fp *fixedPool) Release(worker *Worker) {
 func (fp *fixedPool) Shareable() bool {
 	return true
 }
+
+func (fp *fixedPool) GetWorkers() []*Worker {
+	return fp.workers
+}
+
+func (fp *fixedPool) GetNumWorkersAllocated() int {
+	return len(fp.workers) - len(fp.workerChan)
+}
+
+func (fp *fixedPool) GetStatistics() *AllocatorStatistics {
+	return &fp.statistics
+}
+
+func (fp *fixedPool) Stop() error {
+	return stopWorkers(fp.logger, fp.workers)
+}
+
+//
+// Elastic pool of workers
+// Holds between a minimum and maximum number of workers. Workers are created when all are allocated and
+// torn down once idle for a while. When the maximum are allocated, caller is blocked
+//
+
+// creates the worker with a given index
+type WorkerCreator func(workerIndex int) (*Worker, error)
+
+type ElasticPoolConfiguration struct {
+	MinWorkers  int
+	MaxWorkers  int
+	IdleTimeout time.Duration
+}
+
+type idleWorker struct {
+	worker    *Worker
+	idleSince time.Time
+}
+
+type elasticPool struct {
+	logger        nuclio.Logger
+	configuration *ElasticPoolConfiguration
+	createWorker  WorkerCreator
+	statistics    AllocatorStatistics
+	stopChan      chan struct{}
+	stoppedChan   chan struct{}
+
+	// the fields below are accessed under this lock
+	lock                sync.Mutex
+	stopped             bool
+	workers             []*Worker
+	numWorkersCreating  int
+	numWorkersAllocated int
+	nextWorkerIndex     int
+
+	// the most recently released worker is last, so that busy workers are reused and the rest go idle
+	idleWorkers []idleWorker
+
+	// closed (and replaced) whenever a worker is released while callers wait for one
+	numWaiters      int
+	workerAvailable chan struct{}
+}
+
+func NewElasticPoolWorkerAllocator(parentLogger nuclio.Logger,
+	configuration *ElasticPoolConfiguration,
+	createWorker WorkerCreator) (WorkerAllocator, error) {
+
+	if configuration.MaxWorkers < 1 {
+		return nil, errors.New("Elastic pool requires at least one worker")
+	}
+
+	if configuration.MinWorkers < 0 || configuration.MinWorkers > configuration.MaxWorkers {
+		return nil, errors.New("Elastic pool minimum workers must be between zero and the maximum")
+	}
+
+	if configuration.IdleTimeout <= 0 {
+		return nil, errors.New("Elastic pool idle timeout must be positive")
+	}
+
+	newElasticPool := elasticPool{
+		logger:          parentLogger.GetChild("elastic_pool_allocator").(nuclio.Logger),
+		configuration:   configuration,
+		createWorker:    createWorker,
+		stopChan:        make(chan struct{}),
+		stoppedChan:     make(chan struct{}),
+		workerAvailable: make(chan struct{}),
+	}
+
+	// the minimum are created up front, so that they're ready to process events
+	for workerIndex := 0; workerIndex < configuration.MinWorkers; workerIndex++ {
+		workerInstance, err := newElasticPool.createNextWorker()
+		if err != nil {
+			return nil, err
+		}
+
+		newElasticPool.workers = append(newElasticPool.workers, workerInstance)
+		newElasticPool.idleWorkers = append(newElasticPool.idleWorkers, idleWorker{workerInstance, time.Now()})
+	}
+
+	// idle workers are torn down until the pool is stopped
+	go newElasticPool.stopIdleWorkers()
+
+	return &newElasticPool, nil
+}
+
+func (ep *elasticPool) Allocate(timeout time.Duration) (*Worker, error) {
+	var timer *time.Timer
+	var startTime time.Time
+
+	ep.lock.Lock()
+
+	for {
+		if ep.stopped {
+			ep.lock.Unlock()
+			return nil, ErrAllocatorStopped
+		}
+
+		// prefer an idle worker
+		if numIdleWorkers := len(ep.idleWorkers); numIdleWorkers != 0 {
+			workerInstance := ep.idleWorkers[numIdleWorkers-1].worker
+			ep.idleWorkers = ep.idleWorkers[:numIdleWorkers-1]
+			ep.numWorkersAllocated++
+			ep.lock.Unlock()
+
+			ep.allocated(workerInstance, startTime)
+			return workerInstance, nil
+		}
+
+		// grow the pool. the worker is created outside the lock since creating a runtime may take a while
+		if len(ep.workers)+ep.numWorkersCreating < ep.configuration.MaxWorkers {
+			ep.numWorkersCreating++
+			ep.lock.Unlock()
+
+			workerInstance, err := ep.createNextWorker()
+
+			ep.lock.Lock()
+			ep.numWorkersCreating--
+
+			// the slot is free again, so callers waiting for a worker may try to create one
+			if err != nil {
+				ep.signalWorkerAvailable()
+				ep.lock.Unlock()
+
+				return nil, errors.Wrap(err, "Failed to create worker")
+			}
+
+			// the pool may have been stopped while the worker was created
+			if ep.stopped {
+				ep.lock.Unlock()
+				stopWorkers(ep.logger, []*Worker{workerInstance})
+
+				return nil, ErrAllocatorStopped
+			}
+
+			ep.workers = append(ep.workers, workerInstance)
+			ep.numWorkersAllocated++
+			ep.lock.Unlock()
+
+			ep.logger.DebugWith("Created worker", "index", workerInstance.GetIndex(), "numWorkers", ep.getNumWorkers())
+
+			ep.allocated(workerInstance, startTime)
+			return workerInstance, nil
+		}
+
+		// all workers are allocated, wait for one to be released
+		if timer == nil {
+			timer = time.NewTimer(timeout)
+			defer timer.Stop()
+
+			startTime = time.Now()
+		}
+
+		workerAvailable := ep.workerAvailable
+		ep.numWaiters++
+		ep.lock.Unlock()
+
+		select {
+		case <-workerAvailable:
+			ep.lock.Lock()
+			ep.numWaiters--
+		case <-timer.C:
+			ep.lock.Lock()
+			ep.numWaiters--
+			ep.lock.Unlock()
+
+			atomic.AddUint64(&ep.statistics.AllocationTimeouts, 1)
+			atomic.AddUint64(&ep.statistics.AllocationWaitDuration, uint64(time.Since(startTime)))
+
+			return nil, ErrAllocationTimeout
+		}
+	}
+}
+
+func (ep *elasticPool) Release(worker *Worker) {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	ep.idleWorkers = append(ep.idleWorkers, idleWorker{worker, time.Now()})
+	ep.numWorkersAllocated--
+
+	ep.signalWorkerAvailable()
+}
+
+// true if the several go routines can share this allocator
+func (ep *elasticPool) Shareable() bool {
+	return true
+}
+
+// returns the workers currently in the pool
+func (ep *elasticPool) GetWorkers() []*Worker {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	workers := make([]*Worker, len(ep.workers))
+	copy(workers, ep.workers)
+
+	return workers
+}
+
+func (ep *elasticPool) GetNumWorkersAllocated() int {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	return ep.numWorkersAllocated
+}
+
+func (ep *elasticPool) GetStatistics() *AllocatorStatistics {
+	return &ep.statistics
+}
+
+// stops tearing down idle workers and stops all workers, including those still allocated
+func (ep *elasticPool) Stop() error {
+	ep.lock.Lock()
+
+	if ep.stopped {
+		ep.lock.Unlock()
+		return nil
+	}
+
+	ep.stopped = true
+	workers := ep.workers
+	ep.workers = nil
+	ep.idleWorkers = nil
+
+	// waiting callers fail rather than wait for a worker that won't be released
+	ep.signalWorkerAvailable()
+	ep.lock.Unlock()
+
+	close(ep.stopChan)
+	<-ep.stoppedChan
+
+	return stopWorkers(ep.logger, workers)
+}
+
+// wakes up callers waiting for a worker. they compete for it, and those who lose wait again. called under
+// lock
+func (ep *elasticPool) signalWorkerAvailable() {
+	if ep.numWaiters != 0 {
+		close(ep.workerAvailable)
+		ep.workerAvailable = make(chan struct{})
+	}
+}
+
+func (ep *elasticPool) getNumWorkers() int {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	return len(ep.workers)
+}
+
+func (ep *elasticPool) allocated(workerInstance *Worker, waitStartTime time.Time) {
+	atomic.AddUint64(&ep.statistics.Allocations, 1)
+
+	if !waitStartTime.IsZero() {
+		atomic.AddUint64(&ep.statistics.AllocationWaitDuration, uint64(time.Since(waitStartTime)))
+		workerInstance.countQueued()
+	}
+}
+
+func (ep *elasticPool) createNextWorker() (*Worker, error) {
+	ep.lock.Lock()
+	workerIndex := ep.nextWorkerIndex
+	ep.nextWorkerIndex++
+	ep.lock.Unlock()
+
+	workerInstance, err := ep.createWorker(workerIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddUint64(&ep.statistics.WorkersCreated, 1)
+
+	return workerInstance, nil
+}
+
+// periodically tears down the workers that were idle for longer than the idle timeout, leaving at least
+// the minimum
+func (ep *elasticPool) stopIdleWorkers() {
+	defer close(ep.stoppedChan)
+
+	ticker := time.NewTicker(ep.configuration.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, workerInstance := range ep.removeIdleWorkers() {
+				if err := workerInstance.Stop(); err != nil {
+					ep.logger.WarnWith("Failed to stop idle worker", "index", workerInstance.GetIndex(), "err", err)
+				}
+
+				atomic.AddUint64(&ep.statistics.WorkersStopped, 1)
+
+				ep.logger.DebugWith("Stopped idle worker", "index", workerInstance.GetIndex())
+			}
+
+		case <-ep.stopChan:
+			return
+		}
+	}
+}
+
+// removes the workers that were idle for longer than the idle timeout from the pool and returns them
+func (ep *elasticPool) removeIdleWorkers() []*Worker {
+	var removedWorkers []*Worker
+
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+
+	// the workers that were idle the longest are first
+	for len(ep.idleWorkers) != 0 &&
+		len(ep.workers) > ep.configuration.MinWorkers &&
+		time.Since(ep.idleWorkers[0].idleSince) > ep.configuration.IdleTimeout {
+
+		removedWorker := ep.idleWorkers[0].worker
+		ep.idleWorkers = ep.idleWorkers[1:]
+
+		for workerIndex, workerInstance := range ep.workers {
+			if workerInstance == removedWorker {
+				ep.workers = append(ep.workers[:workerIndex], ep.workers[workerIndex+1:]...)
+				break
+			}
+		}
+
+		removedWorkers = append(removedWorkers, removedWorker)
+	}
+
+	return removedWorkers
+}
+
+// stops the given workers, returning the first error
+func stopWorkers(logger nuclio.Logger, workers []*Worker) error {
+	var firstErr error
+
+	for _, workerInstance := range workers {
+		if err := workerInstance.Stop(); err != nil {
+			logger.WarnWith("Failed to stop worker", "index", workerInstance.GetIndex(), "err", err)
+
+			if firstErr == nil {
+				firstErr = errors.Wrapf(err, "Failed to stop worker %d", workerInstance.GetIndex())
+			}
+		}
+	}
+
+	return firstErr
+}
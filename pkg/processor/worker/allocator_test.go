@@ -1,6 +1,8 @@
 package worker
 
 import (
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -10,6 +12,17 @@ import (
 	"github.com/stretchr/testify/suite"
 )
 
+// counts the times it was stopped
+type stoppableRuntime struct {
+	MockRuntime
+	numStops *int32
+}
+
+func (sr *stoppableRuntime) Stop() error {
+	atomic.AddInt32(sr.numStops, 1)
+	return nil
+}
+
 type AllocatorTestSuite struct {
 	suite.Suite
 	logger nuclio.Logger
@@ -26,18 +39,22 @@ func (suite *AllocatorTestSuite) TestSingletonAllocator() {
 	suite.NoError(err)
 	suite.NotNil(sa)
 
+	suite.Equal(0, sa.GetNumWorkersAllocated())
+
 	// allocate once, time should be ignored
 	allocatedWorker, err := sa.Allocate(time.Hour)
 	suite.NoError(err)
 	suite.Equal(worker1, allocatedWorker)
+	suite.Equal(1, sa.GetNumWorkersAllocated())
 
 	// allocate again, release doesn't need to happen
 	allocatedWorker, err = sa.Allocate(time.Hour)
 	suite.NoError(err)
 	suite.Equal(worker1, allocatedWorker)
 
-	// release shouldn't do anything
+	// release only marks the worker as no longer allocated
 	suite.NotPanics(func() { sa.Release(worker1) })
+	suite.Equal(0, sa.GetNumWorkersAllocated())
 
 	suite.False(sa.Shareable())
 }
@@ -74,10 +91,238 @@ func (suite *AllocatorTestSuite) TestFixedPoolAllocator() {
 	thirdAllocatedWorker, err := fpa.Allocate(time.Hour)
 	suite.NoError(err)
 	suite.Equal(worker2, thirdAllocatedWorker)
+	suite.Equal(uint64(0), atomic.LoadUint64(&worker2.GetStatistics().Queued))
+
+	// a waiting caller gets the worker once released, which counts the wait
+	allocatedWorkerChan := make(chan *Worker)
+	go func() {
+		allocatedWorker, _ := fpa.Allocate(time.Second)
+		allocatedWorkerChan <- allocatedWorker
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	fpa.Release(worker2)
+	suite.Equal(worker2, <-allocatedWorkerChan)
+	suite.Equal(uint64(1), atomic.LoadUint64(&worker2.GetStatistics().Queued))
 
 	suite.True(fpa.Shareable())
 }
 
+func (suite *AllocatorTestSuite) TestElasticPoolAllocator() {
+	var numStops int32
+
+	epa, err := NewElasticPoolWorkerAllocator(suite.logger, &ElasticPoolConfiguration{
+		MinWorkers:  1,
+		MaxWorkers:  3,
+		IdleTimeout: 50 * time.Millisecond,
+	}, func(workerIndex int) (*Worker, error) {
+		return NewWorker(suite.logger, workerIndex, &stoppableRuntime{numStops: &numStops}), nil
+	})
+
+	suite.Require().NoError(err)
+	suite.True(epa.Shareable())
+
+	// the minimum are created up front
+	suite.Len(epa.GetWorkers(), 1)
+
+	// grow to the maximum as workers are allocated
+	var allocatedWorkers []*Worker
+	for workerIndex := 0; workerIndex < 3; workerIndex++ {
+		allocatedWorker, err := epa.Allocate(time.Second)
+		suite.Require().NoError(err)
+
+		allocatedWorkers = append(allocatedWorkers, allocatedWorker)
+	}
+
+	suite.Len(epa.GetWorkers(), 3)
+	suite.Equal(3, epa.GetNumWorkersAllocated())
+	suite.Equal(uint64(3), atomic.LoadUint64(&epa.GetStatistics().WorkersCreated))
+
+	// all allocated - should time out
+	failedAllocationWorker, err := epa.Allocate(50 * time.Millisecond)
+	suite.Equal(ErrAllocationTimeout, err)
+	suite.Nil(failedAllocationWorker)
+
+	// a waiting caller gets the worker once released
+	allocatedWorkerChan := make(chan *Worker)
+	go func() {
+		allocatedWorker, _ := epa.Allocate(time.Second)
+		allocatedWorkerChan <- allocatedWorker
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	epa.Release(allocatedWorkers[0])
+	suite.Equal(allocatedWorkers[0], <-allocatedWorkerChan)
+	suite.Equal(uint64(1), atomic.LoadUint64(&allocatedWorkers[0].GetStatistics().Queued))
+
+	// release all, and let them go idle. the pool shrinks back to the minimum
+	for _, allocatedWorker := range allocatedWorkers {
+		epa.Release(allocatedWorker)
+	}
+
+	suite.Equal(0, epa.GetNumWorkersAllocated())
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint64(&epa.GetStatistics().WorkersStopped) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	suite.Len(epa.GetWorkers(), 1)
+	suite.Equal(int32(2), atomic.LoadInt32(&numStops))
+	suite.Equal(uint64(2), atomic.LoadUint64(&epa.GetStatistics().WorkersStopped))
+
+	// the remaining worker is allocatable
+	allocatedWorker, err := epa.Allocate(time.Second)
+	suite.NoError(err)
+	suite.NotNil(allocatedWorker)
+}
+
+func (suite *AllocatorTestSuite) TestElasticPoolWorkerCreationFailure() {
+	epa, err := NewElasticPoolWorkerAllocator(suite.logger, &ElasticPoolConfiguration{
+		MinWorkers:  0,
+		MaxWorkers:  1,
+		IdleTimeout: time.Minute,
+	}, func(workerIndex int) (*Worker, error) {
+		return nil, errors.New("Failed to create runtime")
+	})
+
+	suite.Require().NoError(err)
+
+	_, err = epa.Allocate(time.Second)
+	suite.Error(err)
+
+	// the failed creation doesn't take up a slot in the pool
+	suite.Len(epa.GetWorkers(), 0)
+	suite.Equal(0, epa.GetNumWorkersAllocated())
+}
+
+func (suite *AllocatorTestSuite) TestElasticPoolWorkerCreationFailureWakesWaiter() {
+	var numCreations int32
+	creationChan := make(chan struct{})
+
+	epa, err := NewElasticPoolWorkerAllocator(suite.logger, &ElasticPoolConfiguration{
+		MinWorkers:  0,
+		MaxWorkers:  1,
+		IdleTimeout: time.Minute,
+	}, func(workerIndex int) (*Worker, error) {
+
+		// the first creation fails once released, the rest succeed
+		if atomic.AddInt32(&numCreations, 1) == 1 {
+			<-creationChan
+			return nil, errors.New("Failed to create runtime")
+		}
+
+		return NewWorker(suite.logger, workerIndex, &MockRuntime{}), nil
+	})
+
+	suite.Require().NoError(err)
+
+	firstErrChan := make(chan error, 1)
+	go func() {
+		_, err := epa.Allocate(time.Second)
+		firstErrChan <- err
+	}()
+
+	for atomic.LoadInt32(&numCreations) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the second caller waits, since the only slot is taken by the worker being created
+	secondErrChan := make(chan error, 1)
+	go func() {
+		_, err := epa.Allocate(time.Second)
+		secondErrChan <- err
+	}()
+
+	for suite.getNumWaiters(epa) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	close(creationChan)
+
+	// once the creation fails, the waiting caller creates the worker instead of timing out
+	suite.Error(<-firstErrChan)
+	suite.NoError(<-secondErrChan)
+	suite.Len(epa.GetWorkers(), 1)
+}
+
+func (suite *AllocatorTestSuite) TestElasticPoolStop() {
+	var numStops int32
+
+	epa, err := NewElasticPoolWorkerAllocator(suite.logger, &ElasticPoolConfiguration{
+		MinWorkers:  1,
+		MaxWorkers:  2,
+		IdleTimeout: time.Minute,
+	}, func(workerIndex int) (*Worker, error) {
+		return NewWorker(suite.logger, workerIndex, &stoppableRuntime{numStops: &numStops}), nil
+	})
+
+	suite.Require().NoError(err)
+
+	for workerIndex := 0; workerIndex < 2; workerIndex++ {
+		_, err := epa.Allocate(time.Second)
+		suite.Require().NoError(err)
+	}
+
+	// wait for a worker that will never be released
+	waiterErrChan := make(chan error, 1)
+	go func() {
+		_, err := epa.Allocate(time.Hour)
+		waiterErrChan <- err
+	}()
+
+	for suite.getNumWaiters(epa) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// all workers are stopped, allocated or not, and the waiting caller gives up
+	suite.NoError(epa.Stop())
+	suite.Equal(int32(2), atomic.LoadInt32(&numStops))
+	suite.Equal(ErrAllocatorStopped, <-waiterErrChan)
+	suite.Empty(epa.GetWorkers())
+
+	_, err = epa.Allocate(time.Second)
+	suite.Equal(ErrAllocatorStopped, err)
+
+	// stopping again does nothing
+	suite.NoError(epa.Stop())
+	suite.Equal(int32(2), atomic.LoadInt32(&numStops))
+}
+
+func (suite *AllocatorTestSuite) TestFixedPoolStop() {
+	var numStops int32
+
+	fpa, err := NewFixedPoolWorkerAllocator(suite.logger, []*Worker{
+		NewWorker(suite.logger, 0, &stoppableRuntime{numStops: &numStops}),
+		NewWorker(suite.logger, 1, &stoppableRuntime{numStops: &numStops}),
+	})
+
+	suite.Require().NoError(err)
+
+	suite.NoError(fpa.Stop())
+	suite.Equal(int32(2), atomic.LoadInt32(&numStops))
+}
+
+func (suite *AllocatorTestSuite) TestElasticPoolInvalidConfiguration() {
+	for _, configuration := range []*ElasticPoolConfiguration{
+		{MinWorkers: 0, MaxWorkers: 0, IdleTimeout: time.Second},
+		{MinWorkers: 2, MaxWorkers: 1, IdleTimeout: time.Second},
+		{MinWorkers: 0, MaxWorkers: 1, IdleTimeout: 0},
+	} {
+		_, err := NewElasticPoolWorkerAllocator(suite.logger, configuration, nil)
+		suite.Error(err)
+	}
+}
+
+func (suite *AllocatorTestSuite) getNumWaiters(workerAllocator WorkerAllocator) int {
+	elasticPoolAllocator := workerAllocator.(*elasticPool)
+
+	elasticPoolAllocator.lock.Lock()
+	defer elasticPoolAllocator.lock.Unlock()
+
+	return elasticPoolAllocator.numWaiters
+}
+
 func TestAllocatorTestSuite(t *testing.T) {
 	suite.Run(t, new(AllocatorTestSuite))
 }
@@ -34,6 +34,22 @@ func (waf *WorkerFactory) CreateFixedPoolWorkerAllocator(logger nuclio.Logger,
 	return workerAllocator, nil
 }
 
+func (waf *WorkerFactory) CreateElasticPoolWorkerAllocator(logger nuclio.Logger,
+	configuration *ElasticPoolConfiguration,
+	runtimeConfiguration *viper.Viper) (WorkerAllocator, error) {
+
+	// workers are created by the allocator as needed
+	workerAllocator, err := NewElasticPoolWorkerAllocator(logger, configuration, func(workerIndex int) (*Worker, error) {
+		return waf.createWorker(logger, workerIndex, runtimeConfiguration)
+	})
+
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create worker allocator")
+	}
+
+	return workerAllocator, nil
+}
+
 func (waf *WorkerFactory) CreateSingletonPoolWorkerAllocator(logger nuclio.Logger,
 	runtimeConfiguration *viper.Viper) (WorkerAllocator, error) {
 
@@ -0,0 +1,343 @@
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/nuclio-sdk"
+
+	"github.com/pkg/errors"
+)
+
+const (
+
+	// contending members get an equal share of the pool
+	AllocationPolicyFairShare = "fair_share"
+
+	// contending members get a share of the pool proportional to their weight
+	AllocationPolicyWeighted = "weighted"
+)
+
+//
+// Shared worker pool
+// A named pool of workers shared by several event sources, each allocating through its own member
+// allocator. When workers are available they're allocated to whoever asks. When they aren't, each worker
+// released goes to the waiting member with the fewest workers allocated relative to its share, so that
+// a busy event source can't starve the others
+//
+
+type WorkerPool struct {
+	Name             string
+	logger           nuclio.Logger
+	allocator        WorkerAllocator
+	allocationPolicy string
+
+	// the number of workers that may be allocated at once (the most the pool holds)
+	capacity int
+
+	// the fields below are accessed under this lock
+	lock                sync.Mutex
+	members             []*poolMember
+	numWorkersAllocated int
+}
+
+func NewWorkerPool(parentLogger nuclio.Logger,
+	name string,
+	allocator WorkerAllocator,
+	capacity int,
+	allocationPolicy string) (*WorkerPool, error) {
+
+	if !allocator.Shareable() {
+		return nil, errors.New("Worker pool requires a shareable worker allocator")
+	}
+
+	if capacity < 1 {
+		return nil, errors.New("Worker pool requires at least one worker")
+	}
+
+	switch allocationPolicy {
+	case AllocationPolicyFairShare, AllocationPolicyWeighted:
+	default:
+		return nil, errors.Errorf("Unknown allocation policy %s", allocationPolicy)
+	}
+
+	return &WorkerPool{
+		Name:             name,
+		logger:           parentLogger.GetChild(name).(nuclio.Logger),
+		allocator:        allocator,
+		capacity:         capacity,
+		allocationPolicy: allocationPolicy,
+	}, nil
+}
+
+// creates the allocator through which an event source allocates the pool's workers. the weight is ignored
+// unless the allocation policy is weighted
+func (wp *WorkerPool) NewMemberAllocator(memberID string, weight int) (WorkerAllocator, error) {
+	if weight < 1 {
+		return nil, errors.Errorf("Invalid weight %d for member %s of worker pool %s", weight, memberID, wp.Name)
+	}
+
+	if wp.allocationPolicy == AllocationPolicyFairShare {
+		weight = 1
+	}
+
+	newMember := poolMember{
+		pool:   wp,
+		id:     memberID,
+		weight: weight,
+	}
+
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+
+	wp.members = append(wp.members, &newMember)
+
+	wp.logger.DebugWith("Added member", "id", memberID, "weight", weight)
+
+	return &newMember, nil
+}
+
+// implemented by the allocators of pool members. the pool's workers are reported with the pool, since
+// they're shared by its members
+type PoolMemberAllocator interface {
+	WorkerAllocator
+
+	// get the pool whose workers the member allocates
+	GetWorkerPool() *WorkerPool
+}
+
+// returns the allocator holding the pool's workers, whose statistics cover all members
+func (wp *WorkerPool) GetAllocator() WorkerAllocator {
+	return wp.allocator
+}
+
+func (wp *WorkerPool) GetCapacity() int {
+	return wp.capacity
+}
+
+func (wp *WorkerPool) GetAllocationPolicy() string {
+	return wp.allocationPolicy
+}
+
+// stops the pool's workers. called once none of its members allocate workers
+func (wp *WorkerPool) Stop() error {
+	return wp.allocator.Stop()
+}
+
+// returns whether a worker may be allocated right away. called under lock
+func (wp *WorkerPool) canAllocate() bool {
+	if wp.numWorkersAllocated >= wp.capacity {
+		return false
+	}
+
+	// members waiting for a worker are served first
+	for _, otherMember := range wp.members {
+		if len(otherMember.waiters) != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hands out available workers to waiting members, the most deprived first. called under lock
+func (wp *WorkerPool) grantWaiters() {
+	for wp.numWorkersAllocated < wp.capacity {
+		var selectedMember *poolMember
+
+		for _, member := range wp.members {
+			if len(member.waiters) == 0 {
+				continue
+			}
+
+			// compare allocated / weight without dividing
+			if selectedMember == nil ||
+				member.numWorkersAllocated*selectedMember.weight < selectedMember.numWorkersAllocated*member.weight {
+				selectedMember = member
+			}
+		}
+
+		if selectedMember == nil {
+			return
+		}
+
+		grantChan := selectedMember.waiters[0]
+		selectedMember.waiters = selectedMember.waiters[1:]
+
+		wp.allocated(selectedMember)
+
+		// buffered, so this never blocks
+		grantChan <- struct{}{}
+	}
+}
+
+// called under lock
+func (wp *WorkerPool) allocated(member *poolMember) {
+	wp.numWorkersAllocated++
+	member.numWorkersAllocated++
+}
+
+// called under lock
+func (wp *WorkerPool) released(member *poolMember) {
+	wp.numWorkersAllocated--
+	member.numWorkersAllocated--
+}
+
+// an event source's view of a shared pool
+type poolMember struct {
+	pool       *WorkerPool
+	id         string
+	weight     int
+	statistics AllocatorStatistics
+
+	// accessed under the pool's lock
+	numWorkersAllocated int
+	workers             []*Worker
+
+	// each waiting caller is granted a worker through its channel, in order
+	waiters []chan struct{}
+}
+
+func (pm *poolMember) Allocate(timeout time.Duration) (*Worker, error) {
+	pm.pool.lock.Lock()
+
+	if pm.pool.canAllocate() {
+		pm.pool.allocated(pm)
+		pm.pool.lock.Unlock()
+
+		return pm.allocateGranted(timeout)
+	}
+
+	// wait for our turn
+	grantChan := make(chan struct{}, 1)
+	pm.waiters = append(pm.waiters, grantChan)
+	pm.pool.lock.Unlock()
+
+	startTime := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-grantChan:
+	case <-timer.C:
+		pm.pool.lock.Lock()
+
+		// we may have been granted a worker just as we timed out
+		select {
+		case <-grantChan:
+			pm.pool.lock.Unlock()
+		default:
+			pm.removeWaiter(grantChan)
+			pm.pool.lock.Unlock()
+
+			atomic.AddUint64(&pm.statistics.AllocationTimeouts, 1)
+			atomic.AddUint64(&pm.statistics.AllocationWaitDuration, uint64(time.Since(startTime)))
+
+			return nil, ErrAllocationTimeout
+		}
+	}
+
+	atomic.AddUint64(&pm.statistics.AllocationWaitDuration, uint64(time.Since(startTime)))
+
+	workerInstance, err := pm.allocateGranted(timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	workerInstance.countQueued()
+
+	return workerInstance, nil
+}
+
+func (pm *poolMember) Release(worker *Worker) {
+	pm.pool.allocator.Release(worker)
+
+	pm.pool.lock.Lock()
+	defer pm.pool.lock.Unlock()
+
+	pm.removeWorker(worker)
+	pm.pool.released(pm)
+	pm.pool.grantWaiters()
+}
+
+// true if the several go routines can share this allocator
+func (pm *poolMember) Shareable() bool {
+	return true
+}
+
+// returns the pool's workers currently allocated to this member
+func (pm *poolMember) GetWorkers() []*Worker {
+	pm.pool.lock.Lock()
+	defer pm.pool.lock.Unlock()
+
+	workers := make([]*Worker, len(pm.workers))
+	copy(workers, pm.workers)
+
+	return workers
+}
+
+// returns the number of the pool's workers allocated to this member
+func (pm *poolMember) GetNumWorkersAllocated() int {
+	pm.pool.lock.Lock()
+	defer pm.pool.lock.Unlock()
+
+	return pm.numWorkersAllocated
+}
+
+func (pm *poolMember) GetStatistics() *AllocatorStatistics {
+	return &pm.statistics
+}
+
+// the pool's workers are shared with other members, and are stopped with the pool
+func (pm *poolMember) Stop() error {
+	return nil
+}
+
+func (pm *poolMember) GetWorkerPool() *WorkerPool {
+	return pm.pool
+}
+
+// allocates from the underlying allocator once granted a share of the pool. since no more than its
+// capacity are ever granted, a worker is available (or can be created) right away
+func (pm *poolMember) allocateGranted(timeout time.Duration) (*Worker, error) {
+	workerInstance, err := pm.pool.allocator.Allocate(timeout)
+	if err != nil {
+
+		// give the grant to someone else
+		pm.pool.lock.Lock()
+		pm.pool.released(pm)
+		pm.pool.grantWaiters()
+		pm.pool.lock.Unlock()
+
+		return nil, err
+	}
+
+	pm.pool.lock.Lock()
+	pm.workers = append(pm.workers, workerInstance)
+	pm.pool.lock.Unlock()
+
+	atomic.AddUint64(&pm.statistics.Allocations, 1)
+
+	return workerInstance, nil
+}
+
+// called under lock
+func (pm *poolMember) removeWorker(worker *Worker) {
+	for workerIndex, workerInstance := range pm.workers {
+		if workerInstance == worker {
+			pm.workers = append(pm.workers[:workerIndex], pm.workers[workerIndex+1:]...)
+			return
+		}
+	}
+}
+
+// called under lock
+func (pm *poolMember) removeWaiter(grantChan chan struct{}) {
+	for waiterIndex, waiter := range pm.waiters {
+		if waiter == grantChan {
+			pm.waiters = append(pm.waiters[:waiterIndex], pm.waiters[waiterIndex+1:]...)
+			return
+		}
+	}
+}
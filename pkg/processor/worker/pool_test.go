@@ -0,0 +1,195 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nuclio/nuclio/pkg/zap"
+
+	"github.com/nuclio/nuclio-sdk"
+	"github.com/stretchr/testify/suite"
+)
+
+type WorkerPoolTestSuite struct {
+	suite.Suite
+	logger nuclio.Logger
+}
+
+func (suite *WorkerPoolTestSuite) SetupSuite() {
+	suite.logger, _ = nucliozap.NewNuclioZap("test", nucliozap.DebugLevel)
+}
+
+func (suite *WorkerPoolTestSuite) TestAllocateWhileAvailable() {
+	workerPool := suite.createWorkerPool(2, AllocationPolicyFairShare)
+
+	first := suite.createMember(workerPool, "first", 1)
+	second := suite.createMember(workerPool, "second", 1)
+
+	// a single member may use the entire pool while no one else needs it
+	firstWorker, err := first.Allocate(time.Second)
+	suite.Require().NoError(err)
+
+	secondWorker, err := first.Allocate(time.Second)
+	suite.Require().NoError(err)
+
+	suite.Equal(2, first.GetNumWorkersAllocated())
+
+	// members only report the workers allocated to them
+	suite.Equal([]*Worker{firstWorker, secondWorker}, first.GetWorkers())
+	suite.Empty(second.GetWorkers())
+	suite.Len(workerPool.GetAllocator().GetWorkers(), 2)
+
+	// the pool is exhausted
+	_, err = second.Allocate(20 * time.Millisecond)
+	suite.Equal(ErrAllocationTimeout, err)
+	suite.Equal(uint64(1), second.GetStatistics().AllocationTimeouts)
+
+	first.Release(firstWorker)
+	first.Release(secondWorker)
+
+	suite.Equal(0, first.GetNumWorkersAllocated())
+	suite.Empty(first.GetWorkers())
+
+	thirdWorker, err := second.Allocate(time.Second)
+	suite.NoError(err)
+	suite.Equal([]*Worker{thirdWorker}, second.GetWorkers())
+}
+
+func (suite *WorkerPoolTestSuite) TestFairShare() {
+	workerPool := suite.createWorkerPool(2, AllocationPolicyFairShare)
+
+	// the weight is ignored
+	busy := suite.createMember(workerPool, "busy", 10)
+	idle := suite.createMember(workerPool, "idle", 1)
+
+	busyWorkers := suite.allocate(busy, 2)
+
+	// the busy member asks for another worker before the idle one does
+	busyGrantedChan := suite.allocateAsync(busy)
+	time.Sleep(20 * time.Millisecond)
+
+	idleGrantedChan := suite.allocateAsync(idle)
+	time.Sleep(20 * time.Millisecond)
+
+	// the released worker goes to the member with fewer workers, even though it asked later
+	busy.Release(busyWorkers[0])
+	suite.waitGranted(idleGrantedChan)
+	suite.assertNotGranted(busyGrantedChan)
+
+	busy.Release(busyWorkers[1])
+	suite.waitGranted(busyGrantedChan)
+}
+
+func (suite *WorkerPoolTestSuite) TestWeighted() {
+	workerPool := suite.createWorkerPool(3, AllocationPolicyWeighted)
+
+	heavy := suite.createMember(workerPool, "heavy", 2)
+	light := suite.createMember(workerPool, "light", 1)
+
+	heavyWorkers := suite.allocate(heavy, 3)
+
+	lightGrantedChan := suite.allocateAsync(light)
+	time.Sleep(20 * time.Millisecond)
+
+	heavyGrantedChan := suite.allocateAsync(heavy)
+	time.Sleep(20 * time.Millisecond)
+
+	// heavy holds 2 of its weight of 2, light none of its weight of 1 - light is served
+	heavy.Release(heavyWorkers[0])
+	suite.waitGranted(lightGrantedChan)
+	suite.assertNotGranted(heavyGrantedChan)
+
+	// heavy holds 1 of 2, light 1 of 1 - heavy is served
+	heavy.Release(heavyWorkers[1])
+	suite.waitGranted(heavyGrantedChan)
+}
+
+func (suite *WorkerPoolTestSuite) TestInvalidConfiguration() {
+	singletonAllocator, err := NewSingletonWorkerAllocator(suite.logger, &Worker{})
+	suite.Require().NoError(err)
+
+	// a pool must be shareable
+	_, err = NewWorkerPool(suite.logger, "pool", singletonAllocator, 1, AllocationPolicyFairShare)
+	suite.Error(err)
+
+	fixedPoolAllocator, err := NewFixedPoolWorkerAllocator(suite.logger, []*Worker{{}})
+	suite.Require().NoError(err)
+
+	_, err = NewWorkerPool(suite.logger, "pool", fixedPoolAllocator, 1, "unfair")
+	suite.Error(err)
+
+	workerPool, err := NewWorkerPool(suite.logger, "pool", fixedPoolAllocator, 1, AllocationPolicyWeighted)
+	suite.Require().NoError(err)
+
+	_, err = workerPool.NewMemberAllocator("member", 0)
+	suite.Error(err)
+}
+
+func (suite *WorkerPoolTestSuite) createWorkerPool(numWorkers int, allocationPolicy string) *WorkerPool {
+	var workers []*Worker
+
+	for workerIndex := 0; workerIndex < numWorkers; workerIndex++ {
+		workers = append(workers, &Worker{index: workerIndex})
+	}
+
+	fixedPoolAllocator, err := NewFixedPoolWorkerAllocator(suite.logger, workers)
+	suite.Require().NoError(err)
+
+	workerPool, err := NewWorkerPool(suite.logger, "pool", fixedPoolAllocator, numWorkers, allocationPolicy)
+	suite.Require().NoError(err)
+
+	return workerPool
+}
+
+func (suite *WorkerPoolTestSuite) createMember(workerPool *WorkerPool, memberID string, weight int) WorkerAllocator {
+	member, err := workerPool.NewMemberAllocator(memberID, weight)
+	suite.Require().NoError(err)
+
+	return member
+}
+
+func (suite *WorkerPoolTestSuite) allocate(member WorkerAllocator, numWorkers int) []*Worker {
+	var workers []*Worker
+
+	for workerIndex := 0; workerIndex < numWorkers; workerIndex++ {
+		workerInstance, err := member.Allocate(time.Second)
+		suite.Require().NoError(err)
+
+		workers = append(workers, workerInstance)
+	}
+
+	return workers
+}
+
+// allocates in the background, returning a channel receiving the worker once allocated
+func (suite *WorkerPoolTestSuite) allocateAsync(member WorkerAllocator) chan *Worker {
+	grantedChan := make(chan *Worker, 1)
+
+	go func() {
+		workerInstance, _ := member.Allocate(time.Second)
+		grantedChan <- workerInstance
+	}()
+
+	return grantedChan
+}
+
+func (suite *WorkerPoolTestSuite) waitGranted(grantedChan chan *Worker) {
+	select {
+	case workerInstance := <-grantedChan:
+		suite.NotNil(workerInstance)
+	case <-time.After(500 * time.Millisecond):
+		suite.Fail("Worker not granted")
+	}
+}
+
+func (suite *WorkerPoolTestSuite) assertNotGranted(grantedChan chan *Worker) {
+	select {
+	case <-grantedChan:
+		suite.Fail("Worker granted unexpectedly")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestWorkerPoolTestSuite(t *testing.T) {
+	suite.Run(t, new(WorkerPoolTestSuite))
+}
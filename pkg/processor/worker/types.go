@@ -4,13 +4,42 @@ import (
 	"time"
 )
 
+// fields are updated atomically and must be read with atomic.LoadUint64
 type Statistics struct {
+
+	// number of calls to process events and number of events processed by them
 	Iterations uint64
 	Items      uint64
-	Succeeded  uint64
-	Failed     uint64
-	Retry      uint64
-	Duration   uint64
-	Queued     uint64
-	StartTime  time.Time
+
+	// number of events processed successfully / unsuccessfully, and of events processed again since an
+	// earlier attempt failed
+	Succeeded uint64
+	Failed    uint64
+	Retry     uint64
+
+	// number of failed events whose deadline expired
+	TimedOut uint64
+
+	// total time spent processing events, in nanoseconds
+	Duration uint64
+
+	// number of allocations of the worker that waited for a worker to become available
+	Queued uint64
+
+	StartTime time.Time
+}
+
+// fields are updated atomically and must be read with atomic.LoadUint64
+type AllocatorStatistics struct {
+
+	// number of successful allocations, and of allocations that timed out waiting for a worker
+	Allocations        uint64
+	AllocationTimeouts uint64
+
+	// total time spent waiting for a worker to become available, in nanoseconds
+	AllocationWaitDuration uint64
+
+	// number of workers created and stopped by allocators whose pool changes size
+	WorkersCreated uint64
+	WorkersStopped uint64
 }
@@ -1,15 +1,25 @@
 package worker
 
 import (
+	"context"
+	"sync/atomic"
+	"time"
+
 	"github.com/nuclio/nuclio-sdk"
 	"github.com/nuclio/nuclio/pkg/processor/runtime"
+
+	"github.com/pkg/errors"
 )
 
+// returned by ProcessEvent when the event's deadline expired before it was processed
+var ErrEventTimeout = errors.New("Timed out processing event")
+
 type Worker struct {
-	logger  nuclio.Logger
-	context nuclio.Context
-	index   int
-	runtime runtime.Runtime
+	logger     nuclio.Logger
+	context    nuclio.Context
+	index      int
+	runtime    runtime.Runtime
+	statistics Statistics
 }
 
 func NewWorker(parentLogger nuclio.Logger,
@@ -23,18 +33,69 @@ func NewWorker(parentLogger nuclio.Logger,
 		context: nuclio.Context{
 			Logger: parentLogger.GetChild("event").(nuclio.Logger),
 		},
+		statistics: Statistics{
+			StartTime: time.Now(),
+		},
 	}
 
 	// return an instance of the default worker
 	return &newWorker
 }
 
-// called by event sources
-func (w *Worker) ProcessEvent(evt nuclio.Event) (interface{}, error) {
+// called by event sources. the event is abandoned once the context is done, in which case the error is
+// ErrEventTimeout if its deadline expired
+func (w *Worker) ProcessEvent(ctx context.Context, evt nuclio.Event) (interface{}, error) {
 	evt.SetID(nuclio.NewID())
 
+	startTime := time.Now()
+
 	// process the event at the runtime
-	response, err := w.runtime.ProcessEvent(evt)
+	response, err := w.runtime.ProcessEvent(ctx, evt)
+
+	// whatever the runtime failed with, the cause is the deadline
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		atomic.AddUint64(&w.statistics.TimedOut, 1)
+
+		err = ErrEventTimeout
+	}
+
+	// update statistics
+	atomic.AddUint64(&w.statistics.Duration, uint64(time.Since(startTime)))
+	atomic.AddUint64(&w.statistics.Iterations, 1)
+	atomic.AddUint64(&w.statistics.Items, 1)
+
+	if err == nil {
+		atomic.AddUint64(&w.statistics.Succeeded, 1)
+	} else {
+		atomic.AddUint64(&w.statistics.Failed, 1)
+	}
 
 	return response, err
 }
+
+// called by event sources before the worker processes events again, since an earlier attempt failed
+func (w *Worker) CountRetries(numEvents int) {
+	atomic.AddUint64(&w.statistics.Retry, uint64(numEvents))
+}
+
+// called by allocators when the worker was allocated after waiting for one to become available
+func (w *Worker) countQueued() {
+	atomic.AddUint64(&w.statistics.Queued, 1)
+}
+
+// releases the resources held by the worker's runtime, if any. the worker must not be used afterwards
+func (w *Worker) Stop() error {
+	if stopper, ok := w.runtime.(runtime.Stopper); ok {
+		return stopper.Stop()
+	}
+
+	return nil
+}
+
+func (w *Worker) GetIndex() int {
+	return w.index
+}
+
+func (w *Worker) GetStatistics() *Statistics {
+	return &w.statistics
+}
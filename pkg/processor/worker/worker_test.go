@@ -1,7 +1,11 @@
 package worker
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/nuclio/nuclio/pkg/zap"
 
@@ -14,8 +18,8 @@ type MockRuntime struct {
 	mock.Mock
 }
 
-func (mr *MockRuntime) ProcessEvent(event nuclio.Event) (interface{}, error) {
-	args := mr.Called(event)
+func (mr *MockRuntime) ProcessEvent(ctx context.Context, event nuclio.Event) (interface{}, error) {
+	args := mr.Called(ctx, event)
 	return args.Get(0), args.Error(1)
 }
 
@@ -34,10 +38,10 @@ func (suite *WorkerTestSuite) TestProcessEvent() {
 	event := &nuclio.AbstractEvent{}
 
 	// expect the mock process event to be called with the event
-	mockRuntime.On("ProcessEvent", event).Return(nil, nil).Once()
+	mockRuntime.On("ProcessEvent", context.Background(), event).Return(nil, nil).Once()
 
 	// process the event
-	worker.ProcessEvent(event)
+	worker.ProcessEvent(context.Background(), event)
 
 	// make sure all expectations are met
 	mockRuntime.AssertExpectations(suite.T())
@@ -46,6 +50,27 @@ func (suite *WorkerTestSuite) TestProcessEvent() {
 	suite.NotNil(event.GetID())
 }
 
+func (suite *WorkerTestSuite) TestProcessEventTimeout() {
+	mockRuntime := MockRuntime{}
+	worker := NewWorker(suite.logger, 100, &mockRuntime)
+	event := &nuclio.AbstractEvent{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	// the runtime fails once the deadline expires
+	mockRuntime.On("ProcessEvent", ctx, event).Return(nil, errors.New("Killed")).Run(func(args mock.Arguments) {
+		<-ctx.Done()
+	}).Once()
+
+	_, err := worker.ProcessEvent(ctx, event)
+	suite.Equal(ErrEventTimeout, err)
+	suite.Equal(uint64(1), atomic.LoadUint64(&worker.GetStatistics().TimedOut))
+	suite.Equal(uint64(1), atomic.LoadUint64(&worker.GetStatistics().Failed))
+
+	mockRuntime.AssertExpectations(suite.T())
+}
+
 // In order for 'go test' to run this suite, we need to create
 // a normal test function and pass our suite to suite.Run
 func TestWorkerTestSuite(t *testing.T) {
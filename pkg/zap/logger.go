@@ -1,12 +1,14 @@
 package nucliozap
 
 import (
+	"os"
 	"strings"
 	"time"
 
 	"github.com/mgutz/ansi"
 	"github.com/pavius/zap"
 	"github.com/pavius/zap/zapcore"
+	"github.com/pkg/errors"
 )
 
 type Level int8
@@ -32,43 +34,46 @@ type NuclioZap struct {
 }
 
 func NewNuclioZap(name string, level Level) (*NuclioZap, error) {
+	return NewNuclioZapTee(name, []OutputConfiguration{
+		{
+			Kind:      OutputKindStdout,
+			Level:     level,
+			Formatter: FormatterHumanReadable,
+			Colors:    true,
+		},
+	})
+}
+
+// creates a logger that writes each entry to all outputs whose level is enabled for it
+func NewNuclioZapTee(name string, outputConfigurations []OutputConfiguration) (*NuclioZap, error) {
 	newNuclioZap := &NuclioZap{}
 
-	encoderConfig := zapcore.EncoderConfig{
-		TimeKey:          "time",
-		LevelKey:         "level",
-		NameKey:          "name",
-		CallerKey:        "caller",
-		MessageKey:       "message",
-		StacktraceKey:    "stack",
-		LineEnding:       zapcore.DefaultLineEnding,
-		EncodeLevel:      newNuclioZap.encodeStdoutLevel,
-		EncodeTime:       newNuclioZap.encodeStdoutTime,
-		EncodeDuration:   zapcore.StringDurationEncoder,
-		EncodeCaller:     func(zapcore.EntryCaller, zapcore.PrimitiveArrayEncoder) {},
-		EncodeLoggerName: newNuclioZap.encodeLoggerName,
-	}
+	// initialize coloring by level
+	newNuclioZap.initializeColors()
 
-	// create a sane configuration
-	config := zap.Config{
-		Level:             zap.NewAtomicLevelAt(zapcore.Level(level)),
-		Development:       true,
-		Encoding:          "console",
-		EncoderConfig:     encoderConfig,
-		OutputPaths:       []string{"stdout"},
-		ErrorOutputPaths:  []string{"stdout"},
-		DisableStacktrace: true,
-	}
+	var cores []zapcore.Core
+
+	for _, outputConfiguration := range outputConfigurations {
+		writeSyncer, err := newWriteSyncer(name, &outputConfiguration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create %s output", outputConfiguration.Kind)
+		}
 
-	newZapLogger, err := config.Build()
-	if err != nil {
-		return nil, err
+		encoder, err := newNuclioZap.createEncoder(&outputConfiguration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to create %s output encoder", outputConfiguration.Kind)
+		}
+
+		cores = append(cores, zapcore.NewCore(encoder,
+			writeSyncer,
+			zap.NewAtomicLevelAt(zapcore.Level(outputConfiguration.Level))))
 	}
 
-	newNuclioZap.SugaredLogger = newZapLogger.Sugar().Named(name)
+	newZapLogger := zap.New(zapcore.NewTee(cores...),
+		zap.Development(),
+		zap.ErrorOutput(zapcore.Lock(os.Stdout)))
 
-	// initialize coloring by level
-	newNuclioZap.initializeColors()
+	newNuclioZap.SugaredLogger = newZapLogger.Sugar().Named(name)
 
 	return newNuclioZap, nil
 }
@@ -133,20 +138,70 @@ func (nz *NuclioZap) GetChild(name string) interface{} {
 	return &NuclioZap{SugaredLogger: nz.Named(name)}
 }
 
+func (nz *NuclioZap) createEncoder(outputConfiguration *OutputConfiguration) (zapcore.Encoder, error) {
+	switch outputConfiguration.Formatter {
+	case FormatterHumanReadable, "":
+		encoderConfig := zapcore.EncoderConfig{
+			TimeKey:          "time",
+			LevelKey:         "level",
+			NameKey:          "name",
+			CallerKey:        "caller",
+			MessageKey:       "message",
+			StacktraceKey:    "stack",
+			LineEnding:       zapcore.DefaultLineEnding,
+			EncodeLevel:      nz.encodeStdoutLevel,
+			EncodeTime:       nz.encodeStdoutTime,
+			EncodeDuration:   zapcore.StringDurationEncoder,
+			EncodeCaller:     func(zapcore.EntryCaller, zapcore.PrimitiveArrayEncoder) {},
+			EncodeLoggerName: nz.encodeLoggerName,
+		}
+
+		// colors are escape sequences - only terminals want them
+		if !outputConfiguration.Colors {
+			encoderConfig.EncodeLevel = nz.encodePlainLevel
+			encoderConfig.EncodeLoggerName = nz.encodePlainLoggerName
+		}
+
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+
+	case FormatterJSON:
+		return zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+			TimeKey:          "time",
+			LevelKey:         "level",
+			NameKey:          "name",
+			CallerKey:        "caller",
+			MessageKey:       "message",
+			StacktraceKey:    "stack",
+			LineEnding:       zapcore.DefaultLineEnding,
+			EncodeLevel:      zapcore.LowercaseLevelEncoder,
+			EncodeTime:       zapcore.ISO8601TimeEncoder,
+			EncodeDuration:   zapcore.StringDurationEncoder,
+			EncodeCaller:     func(zapcore.EntryCaller, zapcore.PrimitiveArrayEncoder) {},
+			EncodeLoggerName: zapcore.FullLoggerNameEncoder,
+		}), nil
+	}
+
+	return nil, errors.Errorf("Unknown formatter: %s", outputConfiguration.Formatter)
+}
+
 func (nz *NuclioZap) encodeLoggerName(loggerName string, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(nz.colorLoggerName(nz.padLoggerName(loggerName)))
+}
+
+func (nz *NuclioZap) encodePlainLoggerName(loggerName string, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(nz.padLoggerName(loggerName))
+}
+
+func (nz *NuclioZap) padLoggerName(loggerName string) string {
 	const maxLoggerNameLength = 25
 	actualLoggerNameLength := len(loggerName)
-	var encodedLoggerName string
 
+	// just truncate
 	if actualLoggerNameLength >= maxLoggerNameLength {
-		encodedLoggerName = loggerName[actualLoggerNameLength-maxLoggerNameLength:]
-
-	} else {
-		encodedLoggerName = strings.Repeat(" ", maxLoggerNameLength-actualLoggerNameLength) + loggerName
+		return loggerName[actualLoggerNameLength-maxLoggerNameLength:]
 	}
 
-	// just truncate
-	enc.AppendString(nz.colorLoggerName(encodedLoggerName))
+	return strings.Repeat(" ", maxLoggerNameLength-actualLoggerNameLength) + loggerName
 }
 
 func (nz *NuclioZap) encodeStdoutLevel(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
@@ -165,6 +220,22 @@ func (nz *NuclioZap) encodeStdoutLevel(level zapcore.Level, enc zapcore.Primitiv
 	enc.AppendString(nz.coloredLevelDebug)
 }
 
+func (nz *NuclioZap) encodePlainLevel(level zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch level {
+	case zapcore.InfoLevel:
+		enc.AppendString("(I)")
+		return
+	case zapcore.WarnLevel:
+		enc.AppendString("(W)")
+		return
+	case zapcore.ErrorLevel:
+		enc.AppendString("(E)")
+		return
+	}
+
+	enc.AppendString("(D)")
+}
+
 func (nz *NuclioZap) encodeStdoutTime(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 	enc.AppendString(t.Format("06.01.02 15:04:05.000"))
 }
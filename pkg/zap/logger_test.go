@@ -1,9 +1,15 @@
 package nucliozap
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/nuclio/nuclio-sdk"
+	"github.com/spf13/viper"
 )
 
 func TestSimpleLogging(t *testing.T) {
@@ -27,3 +33,73 @@ func TestSimpleLogging(t *testing.T) {
 	childLogger2.DebugWith("Foo", "a", 1)
 	childLogger2.DebugWith("Foo", "a", 1)
 }
+
+func TestTeeLogging(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "nucliozap-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(tempDir)
+
+	configuration := viper.New()
+	configuration.SetConfigType("yaml")
+
+	err = configuration.ReadConfig(bytes.NewBufferString(`
+outputs:
+- kind: "stdout"
+  colors: "off"
+  level: "debug"
+- kind: "rotated"
+  max-file-size-mb: 1
+  max-num-files: 2
+  formatter: "json"
+  level: "warning"
+  path: "` + tempDir + `"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseLogger, err := NewNuclioZapFromConfiguration("test", configuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	baseLogger.DebugWith("Should only go to stdout", "a", 1)
+	baseLogger.WarnWith("Should go to both", "b", 2)
+	baseLogger.Flush()
+
+	contents, err := ioutil.ReadFile(filepath.Join(tempDir, "test.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(contents), "Should only go to stdout") {
+		t.Error("Debug entry written to warning level output")
+	}
+
+	if !strings.Contains(string(contents), `"message":"Should go to both"`) {
+		t.Errorf("Warning entry not written as JSON to rotated output: %s", string(contents))
+	}
+}
+
+func TestInvalidOutputs(t *testing.T) {
+	for _, outputs := range []string{
+		`[{kind: "carrier-pigeon"}]`,
+		`[{kind: "stdout", level: "loud"}]`,
+		`[{kind: "stdout", formatter: "xml"}]`,
+		`[{kind: "rotated"}]`,
+	} {
+		configuration := viper.New()
+		configuration.SetConfigType("yaml")
+
+		if err := configuration.ReadConfig(bytes.NewBufferString("outputs: " + outputs)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := NewNuclioZapFromConfiguration("test", configuration); err == nil {
+			t.Errorf("Expected error for outputs %s", outputs)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package nucliozap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nuclio/nuclio/pkg/util/common"
+
+	"github.com/pavius/zap/zapcore"
+	"github.com/pkg/errors"
+	"github.com/spf13/cast"
+	"github.com/spf13/viper"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// where an output writes to
+const (
+	OutputKindStdout  = "stdout"
+	OutputKindStderr  = "stderr"
+	OutputKindFile    = "file"
+	OutputKindRotated = "rotated"
+)
+
+// how an output formats entries
+const (
+	FormatterHumanReadable = "human-readable"
+	FormatterJSON          = "json"
+)
+
+type OutputConfiguration struct {
+	Kind      string
+	Level     Level
+	Formatter string
+
+	// whether to color levels and logger names (human readable formatter only)
+	Colors bool
+
+	// file and rotated outputs write to this path. if it has no extension, it is treated as a directory
+	// and the logger writes to <path>/<logger name>.log
+	Path string
+
+	// rotated outputs roll the file once it reaches this size, keeping up to MaxNumFiles old files
+	MaxFileSizeMB int
+	MaxNumFiles   int
+}
+
+// creates a logger from a logger configuration section. for example:
+//
+//	outputs:
+//	- kind: "stdout"
+//	  colors: "off"
+//	  level: "debug"
+//	- kind: "rotated"
+//	  max-file-size-mb: 100
+//	  max-num-files: 5
+//	  formatter: "human-readable"
+//	  level: "warning"
+//	  path: "/var/log/nuclio"
+//
+// if the configuration is nil or declares no outputs, the logger writes everything to stdout
+func NewNuclioZapFromConfiguration(name string, configuration *viper.Viper) (*NuclioZap, error) {
+	if configuration == nil {
+		return NewNuclioZap(name, DebugLevel)
+	}
+
+	outputConfigurations, err := NewOutputConfigurations(configuration)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read logger outputs")
+	}
+
+	if len(outputConfigurations) == 0 {
+		return NewNuclioZap(name, DebugLevel)
+	}
+
+	return NewNuclioZapTee(name, outputConfigurations)
+}
+
+// reads the outputs declared in a logger configuration section
+func NewOutputConfigurations(configuration *viper.Viper) ([]OutputConfiguration, error) {
+	var outputConfigurations []OutputConfiguration
+
+	for outputIndex, output := range common.GetObjectSlice(configuration, "outputs") {
+		outputConfiguration, err := newOutputConfiguration(output)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to read output #%d", outputIndex)
+		}
+
+		outputConfigurations = append(outputConfigurations, *outputConfiguration)
+	}
+
+	return outputConfigurations, nil
+}
+
+// parses a level name, as written in configuration
+func ParseLevel(levelName string) (Level, error) {
+	switch strings.ToLower(levelName) {
+	case "debug", "":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+
+	return DebugLevel, fmt.Errorf("Unknown level: %s", levelName)
+}
+
+func newOutputConfiguration(output map[string]interface{}) (*OutputConfiguration, error) {
+	var err error
+
+	outputConfiguration := OutputConfiguration{
+		Kind:          cast.ToString(output["kind"]),
+		Formatter:     FormatterHumanReadable,
+		Path:          cast.ToString(output["path"]),
+		MaxFileSizeMB: 100,
+		MaxNumFiles:   5,
+	}
+
+	switch outputConfiguration.Kind {
+	case OutputKindStdout, OutputKindStderr:
+
+		// terminals are colored by default
+		outputConfiguration.Colors = true
+	case OutputKindFile, OutputKindRotated:
+		if outputConfiguration.Path == "" {
+			return nil, fmt.Errorf("Output of kind %s requires a path", outputConfiguration.Kind)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown output kind: %s", outputConfiguration.Kind)
+	}
+
+	outputConfiguration.Level, err = ParseLevel(cast.ToString(output["level"]))
+	if err != nil {
+		return nil, err
+	}
+
+	if formatter, found := output["formatter"]; found {
+		outputConfiguration.Formatter = cast.ToString(formatter)
+	}
+
+	if colors, found := output["colors"]; found {
+		outputConfiguration.Colors, err = parseSwitch(colors)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid value for colors")
+		}
+	}
+
+	if maxFileSizeMB, found := output["max-file-size-mb"]; found {
+		outputConfiguration.MaxFileSizeMB, err = cast.ToIntE(maxFileSizeMB)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid value for max-file-size-mb")
+		}
+	}
+
+	if maxNumFiles, found := output["max-num-files"]; found {
+		outputConfiguration.MaxNumFiles, err = cast.ToIntE(maxNumFiles)
+		if err != nil {
+			return nil, errors.Wrap(err, "Invalid value for max-num-files")
+		}
+	}
+
+	return &outputConfiguration, nil
+}
+
+// switches may be "on"/"off" as well as booleans
+func parseSwitch(value interface{}) (bool, error) {
+	switch strings.ToLower(cast.ToString(value)) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+
+	return cast.ToBoolE(value)
+}
+
+func newWriteSyncer(name string, outputConfiguration *OutputConfiguration) (zapcore.WriteSyncer, error) {
+	switch outputConfiguration.Kind {
+	case OutputKindStdout:
+		return zapcore.Lock(os.Stdout), nil
+
+	case OutputKindStderr:
+		return zapcore.Lock(os.Stderr), nil
+
+	case OutputKindFile:
+		path, err := getOutputFilePath(name, outputConfiguration.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to open %s", path)
+		}
+
+		return zapcore.Lock(file), nil
+
+	case OutputKindRotated:
+		path, err := getOutputFilePath(name, outputConfiguration.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return zapcore.AddSync(&lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    outputConfiguration.MaxFileSizeMB,
+			MaxBackups: outputConfiguration.MaxNumFiles,
+		}), nil
+	}
+
+	return nil, fmt.Errorf("Unknown output kind: %s", outputConfiguration.Kind)
+}
+
+func getOutputFilePath(name string, path string) (string, error) {
+
+	// a path without an extension is a directory
+	if filepath.Ext(path) == "" {
+		path = filepath.Join(path, name+".log")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", errors.Wrap(err, "Failed to create log directory")
+	}
+
+	return path, nil
+}